@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+// listFlag is a flag that may be repeated
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseBlock parses a decimal or hex block number, nil meaning latest
+func parseBlock(s string) (*big.Int, error) {
+	switch s {
+	case "", "latest":
+		return nil, nil
+	}
+	number, ok := new(big.Int).SetString(s, 0)
+	if !ok || number.Sign() < 0 {
+		return nil, usagef("invalid block number %q", s)
+	}
+	return number, nil
+}
+
+// resolve parses an address or resolves a name. Only malformed input is a
+// usage error, failures to resolve a name keep their cause for the exit code.
+func (e *env) resolve(ctx context.Context, input string) (common.Address, error) {
+	input = strings.TrimSpace(input)
+	switch {
+	case input == "":
+		return common.Address{}, usagef("missing address")
+	case common.IsHexAddress(input):
+		return common.HexToAddress(input), nil
+	case !strings.Contains(input, "."):
+		return common.Address{}, usagef("invalid address: %q", input)
+	}
+	if _, err := pyweb3.NormalizeName(input); err != nil {
+		return common.Address{}, usagef("%v", err)
+	}
+	address, err := e.client.ResolveAddress(ctx, input)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %w", input, err)
+	}
+	return address, nil
+}
+
+// loadABI reads a contract ABI from a JSON file, either the bare ABI array
+// or a compiler artifact with an "abi" field
+func loadABI(path string) (*abi.ABI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ABI: %w", err)
+	}
+	var artifact struct {
+		ABI json.RawMessage `json:"abi"`
+	}
+	if json.Unmarshal(data, &artifact) == nil && len(artifact.ABI) > 0 {
+		data = artifact.ABI
+	}
+	contractAbi, err := abi.JSON(strings.NewReader(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI %s: %w", path, err)
+	}
+	return &contractAbi, nil
+}
+
+// loadAccount unlocks a keystore file with the password of --password-file
+// or $WEB3RPC_PASSWORD. The caller locks it when done.
+func loadAccount(path, passwordFile string) (*pyweb3.KeystoreAccount, error) {
+	if path == "" {
+		return nil, usagef("missing --keystore")
+	}
+	account, err := pyweb3.LoadKeystore(path)
+	if err != nil {
+		return nil, err
+	}
+	password := os.Getenv("WEB3RPC_PASSWORD")
+	if passwordFile != "" {
+		secret, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(string(secret), "\r\n")
+	}
+	if err := account.Unlock(password, 0); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// packArgs converts command line arguments to the inputs of a method
+func packArgs(method abi.Method, args []string) ([]byte, error) {
+	if len(args) != len(method.Inputs) {
+		return nil, usagef("%s takes %d arguments, got %d", method.Sig, len(method.Inputs), len(args))
+	}
+	values := make([]interface{}, len(args))
+	for i, input := range method.Inputs {
+		value, err := parseArg(input.Type, args[i])
+		if err != nil {
+			return nil, usagef("argument %d of %s: %v", i+1, method.Sig, err)
+		}
+		values[i] = value
+	}
+	data, err := method.Inputs.Pack(values...)
+	if err != nil {
+		return nil, err
+	}
+	return append(method.ID, data...), nil
+}
+
+// parseArg converts a string to the Go value the ABI encoder expects for
+// typ. Arrays and tuples are given as JSON.
+func parseArg(typ abi.Type, s string) (interface{}, error) {
+	switch typ.T {
+	case abi.AddressTy:
+		if !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid address %q", s)
+		}
+		return common.HexToAddress(s), nil
+	case abi.BoolTy:
+		return strconv.ParseBool(s)
+	case abi.StringTy:
+		return s, nil
+	case abi.IntTy, abi.UintTy:
+		number, ok := new(big.Int).SetString(s, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid number %q", s)
+		}
+		return convertInt(typ, number)
+	case abi.BytesTy:
+		return hexutil.Decode(s)
+	case abi.FixedBytesTy:
+		b, err := hexutil.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != typ.Size {
+			return nil, fmt.Errorf("expected %d bytes, got %d", typ.Size, len(b))
+		}
+		array := reflect.New(typ.GetType()).Elem()
+		reflect.Copy(array, reflect.ValueOf(b))
+		return array.Interface(), nil
+	case abi.SliceTy, abi.ArrayTy:
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(s), &items); err != nil {
+			return nil, fmt.Errorf("expected a JSON array: %v", err)
+		}
+		if typ.T == abi.ArrayTy && len(items) != typ.Size {
+			return nil, fmt.Errorf("expected %d items, got %d", typ.Size, len(items))
+		}
+		out := reflect.New(typ.GetType()).Elem()
+		if typ.T == abi.SliceTy {
+			out = reflect.MakeSlice(typ.GetType(), len(items), len(items))
+		}
+		for i, item := range items {
+			var text string
+			if json.Unmarshal(item, &text) != nil {
+				text = string(item)
+			}
+			value, err := parseArg(*typ.Elem, text)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %v", i, err)
+			}
+			out.Index(i).Set(reflect.ValueOf(value))
+		}
+		return out.Interface(), nil
+	}
+	return nil, fmt.Errorf("unsupported argument type %s", typ)
+}
+
+// convertInt returns number as the Go type the encoder uses for typ, which is
+// a sized integer up to 64 bits and a *big.Int above
+func convertInt(typ abi.Type, number *big.Int) (interface{}, error) {
+	goType := typ.GetType()
+	if goType == reflect.TypeOf(&big.Int{}) {
+		return number, nil
+	}
+	value := reflect.New(goType).Elem()
+	if typ.T == abi.UintTy {
+		if number.Sign() < 0 || !number.IsUint64() || value.OverflowUint(number.Uint64()) {
+			return nil, fmt.Errorf("%s out of range for %s", number, typ)
+		}
+		value.SetUint(number.Uint64())
+	} else {
+		if !number.IsInt64() || value.OverflowInt(number.Int64()) {
+			return nil, fmt.Errorf("%s out of range for %s", number, typ)
+		}
+		value.SetInt(number.Int64())
+	}
+	return value.Interface(), nil
+}
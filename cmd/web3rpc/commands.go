@@ -0,0 +1,752 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+// newFlags creates the flag set of a command, whose errors are reported by run
+func newFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+func parseFlags(flags *flag.FlagSet, args []string, positional int) error {
+	if err := flags.Parse(args); err != nil {
+		return usagef("%v", err)
+	}
+	if flags.NArg() > positional {
+		return usagef("unexpected argument %q", flags.Arg(positional))
+	}
+	return nil
+}
+
+func parseBlockCmd(args []string) (action, error) {
+	flags := newFlags("block")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return nil, err
+	}
+	number, err := parseBlock(flags.Arg(0))
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runBlock(ctx, e, number)
+	}, nil
+}
+
+func runBlock(ctx context.Context, e *env, number *big.Int) (*result, error) {
+	block, err := e.client.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block: %w", err)
+	}
+	rec := newRecord(
+		"number", block.NumberU64(),
+		"hash", block.Hash(),
+		"parent", block.ParentHash(),
+		"time", time.Unix(int64(block.Time()), 0).UTC().Format(time.RFC3339),
+		"miner", block.Coinbase(),
+		"gas_used", block.GasUsed(),
+		"gas_limit", block.GasLimit(),
+		"transactions", len(block.Transactions()),
+	)
+	if baseFee := block.BaseFee(); baseFee != nil {
+		rec.add("base_fee", baseFee)
+	}
+	return rec, nil
+}
+
+func parseBalance(args []string) (action, error) {
+	flags := newFlags("balance")
+	blockFlag := flags.String("block", "latest", "block number")
+	tokenFlag := flags.String("token", "", "ERC-20 token, the native currency if empty")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return nil, err
+	}
+	if flags.Arg(0) == "" {
+		return nil, usagef("missing address")
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return nil, err
+	}
+	if block != nil && *tokenFlag != "" {
+		return nil, usagef("--block is not supported with --token")
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runBalance(ctx, e, flags.Arg(0), *tokenFlag, block)
+	}, nil
+}
+
+func runBalance(ctx context.Context, e *env, account, tokenInput string, block *big.Int) (*result, error) {
+	address, err := e.resolve(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	if tokenInput == "" {
+		balance, err := e.client.BalanceAt(ctx, address, block)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get balance: %w", err)
+		}
+		return newRecord(
+			"address", address,
+			"balance", pyweb3.NewAmount(balance, e.chain.Currency.Decimals),
+			"base_units", balance,
+			"symbol", e.chain.Currency.Symbol,
+		), nil
+	}
+
+	tokenAddress, err := e.resolve(ctx, tokenInput)
+	if err != nil {
+		return nil, err
+	}
+	token := pyweb3.NewERC20(e.client, tokenAddress)
+	balance, err := token.BalanceOf(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token balance: %w", err)
+	}
+	amount, err := token.Amount(ctx, balance)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := token.Symbol(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newRecord(
+		"address", address,
+		"token", tokenAddress,
+		"balance", amount,
+		"base_units", balance,
+		"symbol", symbol,
+	), nil
+}
+
+func parseNonce(args []string) (action, error) {
+	flags := newFlags("nonce")
+	pending := flags.Bool("pending", false, "count pending transactions")
+	blockFlag := flags.String("block", "latest", "block number")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return nil, err
+	}
+	if flags.Arg(0) == "" {
+		return nil, usagef("missing address")
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runNonce(ctx, e, flags.Arg(0), *pending, block)
+	}, nil
+}
+
+func runNonce(ctx context.Context, e *env, account string, pending bool, block *big.Int) (*result, error) {
+	address, err := e.resolve(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce uint64
+	if pending {
+		nonce, err = e.client.PendingNonceAt(ctx, address)
+	} else {
+		nonce, err = e.client.NonceAt(ctx, address, block)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nonce: %w", err)
+	}
+	return newRecord("address", address, "nonce", nonce), nil
+}
+
+func parseCall(args []string) (action, error) {
+	flags := newFlags("call")
+	toFlag := flags.String("to", "", "contract to call")
+	fromFlag := flags.String("from", "", "sender of the call")
+	abiFlag := flags.String("abi", "", "ABI or compiler artifact JSON file")
+	methodFlag := flags.String("method", "", "method to call, with --abi")
+	dataFlag := flags.String("data", "", "raw calldata, without --abi")
+	blockFlag := flags.String("block", "latest", "block number")
+	if err := flags.Parse(args); err != nil {
+		return nil, usagef("%v", err)
+	}
+	if *toFlag == "" {
+		return nil, usagef("missing --to")
+	}
+	block, err := parseBlock(*blockFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	if *abiFlag == "" {
+		if *dataFlag == "" || flags.NArg() > 0 {
+			return nil, usagef("give either --abi with --method and its arguments, or --data")
+		}
+		data, err := hexutil.Decode(*dataFlag)
+		if err != nil {
+			return nil, usagef("invalid --data: %v", err)
+		}
+		return func(ctx context.Context, e *env) (*result, error) {
+			out, err := e.call(ctx, *toFlag, *fromFlag, data, block)
+			if err != nil {
+				return nil, fmt.Errorf("call failed: %w", err)
+			}
+			return newRecord("result", hexutil.Bytes(out)), nil
+		}, nil
+	}
+
+	contractAbi, err := loadABI(*abiFlag)
+	if err != nil {
+		return nil, err
+	}
+	method, ok := contractAbi.Methods[*methodFlag]
+	if !ok {
+		return nil, usagef("no method %q in %s", *methodFlag, *abiFlag)
+	}
+	data, err := packArgs(method, flags.Args())
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		out, err := e.call(ctx, *toFlag, *fromFlag, data, block)
+		if err != nil {
+			return nil, fmt.Errorf("call to %s failed: %w", method.Sig, err)
+		}
+		values, err := method.Outputs.Unpack(out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s result: %w", method.Sig, err)
+		}
+
+		rec := newRecord()
+		for i, value := range values {
+			name := method.Outputs[i].Name
+			if name == "" {
+				name = fmt.Sprint(i)
+			}
+			rec.add(name, value)
+		}
+		return rec, nil
+	}, nil
+}
+
+// call resolves the contract and the optional sender, then calls it
+func (e *env) call(ctx context.Context, toInput, fromInput string, data []byte, block *big.Int) ([]byte, error) {
+	to, err := e.resolve(ctx, toInput)
+	if err != nil {
+		return nil, err
+	}
+	msg := ethereum.CallMsg{To: &to, Data: data}
+	if fromInput != "" {
+		if msg.From, err = e.resolve(ctx, fromInput); err != nil {
+			return nil, err
+		}
+	}
+	return e.client.CallContract(ctx, msg, block)
+}
+
+func parseSend(args []string) (action, error) {
+	flags := newFlags("send")
+	toFlag := flags.String("to", "", "recipient")
+	valueFlag := flags.String("value", "", "amount in the native currency, such as 0.1")
+	keystoreFlag := flags.String("keystore", os.Getenv("WEB3RPC_KEYSTORE"), "keystore file of the sender ($WEB3RPC_KEYSTORE)")
+	passwordFlag := flags.String("password-file", "", "file holding the keystore password")
+	wait := flags.Int("wait", -1, "wait for N confirmations, 0 for inclusion")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return nil, err
+	}
+	switch {
+	case *toFlag == "":
+		return nil, usagef("missing --to")
+	case *valueFlag == "":
+		return nil, usagef("missing --value")
+	case *keystoreFlag == "":
+		return nil, usagef("missing --keystore")
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runSend(ctx, e, *toFlag, *valueFlag, *keystoreFlag, *passwordFlag, *wait)
+	}, nil
+}
+
+func runSend(ctx context.Context, e *env, toInput, value, keystore, passwordFile string, wait int) (*result, error) {
+	to, err := e.resolve(ctx, toInput)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := pyweb3.ParseAmount(value, e.chain.Currency.Decimals)
+	if err != nil {
+		return nil, usagef("invalid --value: %v", err)
+	}
+	account, err := loadAccount(keystore, passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	defer account.Lock()
+	from := account.Address()
+
+	tx, err := e.client.SendTransaction(ctx, from, to, amount.BaseUnits())
+	if err != nil {
+		return nil, fmt.Errorf("failed to build transaction: %w", err)
+	}
+	signed, err := account.SignTx(ctx, tx, new(big.Int).SetUint64(e.chain.ChainID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign transaction: %w", err)
+	}
+	if err := e.client.SendRawTransaction(ctx, signed); err != nil {
+		return nil, fmt.Errorf("failed to send transaction: %w", err)
+	}
+
+	rec := newRecord(
+		"hash", signed.Hash(),
+		"from", from,
+		"to", to,
+		"value", amount,
+		"nonce", signed.Nonce(),
+	)
+	if wait < 0 {
+		return rec, nil
+	}
+	receipt, err := e.waitReceipt(ctx, signed.Hash(), wait)
+	if err != nil {
+		return rec, err
+	}
+	rec.add("status", receiptStatus(receipt)).add("block", receipt.BlockNumber)
+	return rec, receiptError(receipt)
+}
+
+func parseReceipt(args []string) (action, error) {
+	flags := newFlags("receipt")
+	wait := flags.Int("wait", -1, "wait for N confirmations, 0 for inclusion")
+	if err := parseFlags(flags, args, 1); err != nil {
+		return nil, err
+	}
+	raw, err := hexutil.Decode(flags.Arg(0))
+	if err != nil || len(raw) != common.HashLength {
+		return nil, usagef("invalid transaction hash %q", flags.Arg(0))
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runReceipt(ctx, e, common.BytesToHash(raw), *wait)
+	}, nil
+}
+
+func runReceipt(ctx context.Context, e *env, hash common.Hash, wait int) (*result, error) {
+	var (
+		receipt *types.Receipt
+		err     error
+	)
+	if wait < 0 {
+		receipt, err = e.client.TransactionReceipt(ctx, hash)
+		if err != nil {
+			err = fmt.Errorf("failed to get receipt of %s: %w", hash.Hex(), err)
+		}
+	} else {
+		receipt, err = e.waitReceipt(ctx, hash, wait)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec := newRecord(
+		"hash", hash,
+		"status", receiptStatus(receipt),
+		"block", receipt.BlockNumber,
+		"block_hash", receipt.BlockHash,
+		"gas_used", receipt.GasUsed,
+		"effective_gas_price", receipt.EffectiveGasPrice,
+		"logs", len(receipt.Logs),
+	)
+	if receipt.ContractAddress != (common.Address{}) {
+		rec.add("contract", receipt.ContractAddress)
+	}
+	return rec, receiptError(receipt)
+}
+
+// waitReceipt waits for a transaction to be mined, then for confirmations
+// more blocks, within the time left to the command
+func (e *env) waitReceipt(ctx context.Context, hash common.Hash, confirmations int) (*types.Receipt, error) {
+	if confirmations == 0 {
+		return e.client.WaitForTransaction(ctx, hash)
+	}
+	timeout := time.Minute
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	return pyweb3.NewTransactionWatcher(e.client, timeout, uint64(confirmations)).WaitForConfirmations(ctx, hash)
+}
+
+func receiptStatus(receipt *types.Receipt) string {
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		return "success"
+	}
+	return "failed"
+}
+
+// receiptError reports a mined transaction that failed
+func receiptError(receipt *types.Receipt) error {
+	if receipt.Status == types.ReceiptStatusSuccessful {
+		return nil
+	}
+	return fmt.Errorf("transaction %s failed: execution reverted", receipt.TxHash.Hex())
+}
+
+func parseLogs(args []string) (action, error) {
+	flags := newFlags("logs")
+	var addressFlags, topicFlags listFlag
+	flags.Var(&addressFlags, "address", "emitting contract, may be repeated")
+	flags.Var(&topicFlags, "topic", "comma separated topics of the next position, * for any, may be repeated")
+	abiFlag := flags.String("abi", "", "ABI or compiler artifact JSON file to decode the events")
+	eventFlag := flags.String("event", "", "only this event of the ABI")
+	fromFlag := flags.String("from", "latest", "first block")
+	toFlag := flags.String("to", "latest", "last block")
+	chunk := flags.Uint64("chunk", pyweb3.DefaultLogChunk, "blocks per eth_getLogs request, split further when the node refuses")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return nil, err
+	}
+
+	var (
+		query   ethereum.FilterQuery
+		decoder eventDecoder
+		err     error
+	)
+	if *abiFlag != "" {
+		if decoder.abi, err = loadABI(*abiFlag); err != nil {
+			return nil, err
+		}
+	}
+	if *eventFlag != "" {
+		if decoder.abi == nil {
+			return nil, usagef("--event needs --abi")
+		}
+		event, ok := decoder.abi.Events[*eventFlag]
+		if !ok {
+			return nil, usagef("no event %q in %s", *eventFlag, *abiFlag)
+		}
+		query.Topics = append(query.Topics, []common.Hash{event.ID})
+	}
+	for _, position := range topicFlags {
+		var topics []common.Hash
+		for _, topic := range strings.Split(position, ",") {
+			if topic = strings.TrimSpace(topic); topic == "*" || topic == "" {
+				topics = nil
+				break
+			}
+			raw, err := hexutil.Decode(topic)
+			if err != nil || len(raw) > common.HashLength {
+				return nil, usagef("invalid topic %q", topic)
+			}
+			topics = append(topics, common.BytesToHash(raw))
+		}
+		query.Topics = append(query.Topics, topics)
+	}
+	for _, block := range []string{*fromFlag, *toFlag} {
+		if _, err := blockOrHead(block, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(ctx context.Context, e *env) (*result, error) {
+		for _, input := range addressFlags {
+			address, err := e.resolve(ctx, input)
+			if err != nil {
+				return nil, err
+			}
+			query.Addresses = append(query.Addresses, address)
+		}
+		return runLogs(ctx, e, query, decoder, *fromFlag, *toFlag, *chunk)
+	}, nil
+}
+
+func runLogs(ctx context.Context, e *env, query ethereum.FilterQuery, decoder eventDecoder, fromInput, toInput string, chunk uint64) (*result, error) {
+	head, err := e.client.BlockNumber(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get head: %w", err)
+	}
+	from, err := blockOrHead(fromInput, head)
+	if err != nil {
+		return nil, err
+	}
+	to, err := blockOrHead(toInput, head)
+	if err != nil {
+		return nil, err
+	}
+	if from > to {
+		return nil, usagef("--from %d is after --to %d", from, to)
+	}
+
+	logs, err := e.client.FilterLogsRange(ctx, query, from, to, chunk)
+	if err != nil {
+		return nil, err
+	}
+	table := newTable("block", "tx", "index", "address", "event", "fields")
+	for _, log := range logs {
+		event, fields, err := decoder.decode(log)
+		if err != nil {
+			return nil, err
+		}
+		table.addRow(log.BlockNumber, log.TxHash, log.Index, log.Address, event, fields)
+	}
+	return table, nil
+}
+
+// blockOrHead parses a block number, latest being head
+func blockOrHead(s string, head uint64) (uint64, error) {
+	number, err := parseBlock(s)
+	if err != nil {
+		return 0, err
+	}
+	if number == nil {
+		return head, nil
+	}
+	if !number.IsUint64() {
+		return 0, usagef("invalid block number %q", s)
+	}
+	return number.Uint64(), nil
+}
+
+// eventDecoder decodes logs with an optional ABI
+type eventDecoder struct {
+	abi *abi.ABI
+}
+
+// decode returns the event name and fields of a log. Logs the ABI does not
+// know are shown by their first topic, with the raw topics and data.
+func (d eventDecoder) decode(log types.Log) (string, map[string]interface{}, error) {
+	if len(log.Topics) == 0 {
+		return "", map[string]interface{}{"data": hexutil.Bytes(log.Data)}, nil
+	}
+	raw := map[string]interface{}{"topics": log.Topics[1:], "data": hexutil.Bytes(log.Data)}
+	if d.abi == nil {
+		return log.Topics[0].Hex(), raw, nil
+	}
+	event, err := d.abi.EventByID(log.Topics[0])
+	if err != nil {
+		return log.Topics[0].Hex(), raw, nil
+	}
+	decoded, err := pyweb3.DecodeEvents(d.abi, []types.Log{log})
+	if err != nil {
+		return "", nil, err
+	}
+	return event.Name, decoded[0], nil
+}
+
+func parseGas(args []string) (action, error) {
+	flags := newFlags("gas")
+	fromFlag := flags.String("from", "", "sender of the transaction to estimate")
+	toFlag := flags.String("to", "", "recipient of the transaction to estimate")
+	valueFlag := flags.String("value", "0", "amount in the native currency")
+	dataFlag := flags.String("data", "", "calldata of the transaction to estimate")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return nil, err
+	}
+	var data []byte
+	if *dataFlag != "" {
+		var err error
+		if data, err = hexutil.Decode(*dataFlag); err != nil {
+			return nil, usagef("invalid --data: %v", err)
+		}
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runGas(ctx, e, *fromFlag, *toFlag, *valueFlag, data)
+	}, nil
+}
+
+func runGas(ctx context.Context, e *env, fromInput, toInput, valueInput string, data []byte) (*result, error) {
+	estimator := pyweb3.NewGasEstimator(e.client, 0)
+	gasPrice, err := e.client.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
+	}
+	rec := newRecord("chain", e.chain.ChainID, "gas_price", gasPrice)
+	if e.chain.EIP1559 {
+		tipCap, feeCap, err := estimator.SuggestFees(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to suggest fees: %w", err)
+		}
+		rec.add("max_priority_fee", tipCap).add("max_fee", feeCap)
+	}
+	if toInput == "" {
+		return rec, nil
+	}
+
+	var from common.Address
+	if fromInput != "" {
+		if from, err = e.resolve(ctx, fromInput); err != nil {
+			return nil, err
+		}
+	}
+	to, err := e.resolve(ctx, toInput)
+	if err != nil {
+		return nil, err
+	}
+	value, err := pyweb3.ParseAmount(valueInput, e.chain.Currency.Decimals)
+	if err != nil {
+		return nil, usagef("invalid --value: %v", err)
+	}
+
+	var tx *types.Transaction
+	if e.chain.EIP1559 {
+		tx = types.NewTx(&types.DynamicFeeTx{ChainID: new(big.Int).SetUint64(e.chain.ChainID), To: &to, Value: value.BaseUnits(), Data: data})
+	} else {
+		tx = types.NewTx(&types.LegacyTx{To: &to, Value: value.BaseUnits(), Data: data})
+	}
+	fees, err := estimator.EstimateFees(ctx, from, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate fees: %w", err)
+	}
+	rec.add("gas_limit", fees.GasLimit).
+		add("execution_fee", fees.ExecutionFee).
+		add("l1_data_fee", fees.L1DataFee).
+		add("total", fees.Total).
+		add("total_"+strings.ToLower(e.chain.Currency.Symbol), pyweb3.NewAmount(fees.Total, e.chain.Currency.Decimals))
+	return rec, nil
+}
+
+func parseBatchTransfer(args []string) (action, error) {
+	flags := newFlags("batch-transfer")
+	csvFlag := flags.String("csv", "", "CSV file of to,amount[,token] rows, amounts in whole units")
+	keystoreFlag := flags.String("keystore", os.Getenv("WEB3RPC_KEYSTORE"), "keystore file of the sender ($WEB3RPC_KEYSTORE)")
+	passwordFlag := flags.String("password-file", "", "file holding the keystore password")
+	dryRun := flags.Bool("dry-run", false, "check the balances and print the cost without sending")
+	if err := parseFlags(flags, args, 0); err != nil {
+		return nil, err
+	}
+	switch {
+	case *csvFlag == "":
+		return nil, usagef("missing --csv")
+	case *keystoreFlag == "":
+		return nil, usagef("missing --keystore")
+	}
+	return func(ctx context.Context, e *env) (*result, error) {
+		return runBatchTransfer(ctx, e, *csvFlag, *keystoreFlag, *passwordFlag, *dryRun)
+	}, nil
+}
+
+func runBatchTransfer(ctx context.Context, e *env, csvFile, keystore, passwordFile string, dryRun bool) (*result, error) {
+	instructions, err := e.readTransfers(ctx, csvFile)
+	if err != nil {
+		return nil, err
+	}
+	account, err := loadAccount(keystore, passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	defer account.Lock()
+	from := account.Address()
+	bp := pyweb3.NewBatchProcessor(e.client, len(instructions), 1)
+
+	if dryRun {
+		_, report, err := bp.Preflight(ctx, from, instructions, pyweb3.PreflightConfig{Policy: pyweb3.PreflightReject})
+		if report == nil {
+			return nil, err
+		}
+		shortfalls := make([]string, len(report.Shortfalls))
+		for i, shortfall := range report.Shortfalls {
+			shortfalls[i] = shortfall.String()
+		}
+		return newRecord(
+			"from", from,
+			"transfers", len(instructions),
+			"max_fees", report.MaxFees,
+			"shortfalls", strings.Join(shortfalls, "; "),
+		), err
+	}
+
+	opts := pyweb3.NewTransactOpts(ctx, account, new(big.Int).SetUint64(e.chain.ChainID))
+	bp.SetPreflight(&pyweb3.PreflightConfig{Policy: pyweb3.PreflightReject})
+
+	table := newTable("to", "token", "amount", "tx", "nonce", "error")
+	var failed []error
+	for _, res := range bp.BatchTransferTokens(ctx, opts, instructions) {
+		in := res.Instruction
+		var token interface{}
+		if in.Standard != pyweb3.Native {
+			token = in.Token
+		}
+		if res.Error != nil {
+			table.addRow(in.To, token, in.Amount, nil, nil, res.Error)
+			failed = append(failed, res.Error)
+			continue
+		}
+		table.addRow(in.To, token, in.Amount, res.TxHash, res.Nonce, nil)
+	}
+	if len(failed) > 0 {
+		return table, fmt.Errorf("%d of %d transfers failed: %w", len(failed), len(instructions), failed[0])
+	}
+	return table, nil
+}
+
+// readTransfers parses a CSV of to,amount[,token] rows, with an optional
+// header. Amounts are in whole units of the native currency or the token.
+func (e *env) readTransfers(ctx context.Context, path string) ([]pyweb3.TransferInstruction, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, usagef("invalid CSV %s: %v", path, err)
+	}
+
+	tokens := make(map[common.Address]*pyweb3.ERC20)
+	var instructions []pyweb3.TransferInstruction
+	for i, row := range rows {
+		line := i + 1
+		if i == 0 && strings.EqualFold(strings.TrimSpace(row[0]), "to") {
+			continue
+		}
+		if len(row) < 2 || len(row) > 3 {
+			return nil, usagef("%s line %d: expected to,amount[,token]", path, line)
+		}
+		to, err := e.resolve(ctx, row[0])
+		if err != nil {
+			return nil, usagef("%s line %d: %v", path, line, err)
+		}
+		in := pyweb3.TransferInstruction{Standard: pyweb3.Native, To: to}
+
+		var amount pyweb3.Amount
+		value := strings.TrimSpace(row[1])
+		if len(row) == 3 && strings.TrimSpace(row[2]) != "" {
+			if in.Token, err = e.resolve(ctx, row[2]); err != nil {
+				return nil, usagef("%s line %d: %v", path, line, err)
+			}
+			in.Standard = pyweb3.ERC20Token
+			token, ok := tokens[in.Token]
+			if !ok {
+				token = pyweb3.NewERC20(e.client, in.Token)
+				tokens[in.Token] = token
+			}
+			if amount, err = token.ParseAmount(ctx, value); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+		} else if amount, err = pyweb3.ParseAmount(value, e.chain.Currency.Decimals); err != nil {
+			return nil, usagef("%s line %d: %v", path, line, err)
+		}
+		in.Amount = amount.BaseUnits()
+		instructions = append(instructions, in)
+	}
+	if len(instructions) == 0 {
+		return nil, usagef("%s has no transfers", path)
+	}
+	return instructions, nil
+}
@@ -0,0 +1,239 @@
+// Command web3rpc runs everyday JSON-RPC operations against an Ethereum node.
+//
+// Usage:
+//
+//	web3rpc [--rpc URL] [--output table|json] [--timeout 30s] <command> [flags] [args]
+//
+// The node URL and output format default to $WEB3RPC_RPC and $WEB3RPC_OUTPUT.
+// Keystore passwords are read from --password-file or $WEB3RPC_PASSWORD.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+// Exit codes, so that scripts can tell failures apart
+const (
+	exitOK = 0
+	// exitFailure is any failure without a more specific code
+	exitFailure = 1
+	// exitUsage is a bad command line
+	exitUsage = 2
+	// exitRPCError is a JSON-RPC error returned by the node
+	exitRPCError = 3
+	// exitReverted is a call or transaction reverted by the EVM
+	exitReverted = 4
+	// exitUnreachable is a node that cannot be reached or does not answer
+	exitUnreachable = 5
+	// exitNotFound is an unknown block, transaction or receipt
+	exitNotFound = 6
+	// exitTimeout is a transaction not confirmed in time
+	exitTimeout = 7
+	// exitInsufficientFunds is a sender that cannot pay for a transaction
+	exitInsufficientFunds = 8
+)
+
+// command is a subcommand of web3rpc. Its arguments are parsed before the
+// node is dialed, so that a bad command line fails without a connection.
+type command struct {
+	usage string
+	parse func(args []string) (action, error)
+}
+
+// action runs a parsed command against the node
+type action func(ctx context.Context, env *env) (*result, error)
+
+var commands = map[string]command{
+	"block":          {"block [number|latest]", parseBlockCmd},
+	"balance":        {"balance [--block N] [--token ADDRESS] <address>", parseBalance},
+	"nonce":          {"nonce [--pending] [--block N] <address>", parseNonce},
+	"call":           {"call --to ADDRESS (--abi FILE --method NAME | --data HEX) [--from ADDRESS] [--block N] [args...]", parseCall},
+	"send":           {"send --to ADDRESS --value AMOUNT --keystore FILE [--password-file FILE] [--wait N]", parseSend},
+	"receipt":        {"receipt [--wait N] <hash>", parseReceipt},
+	"logs":           {"logs [--address ADDRESS]... [--topic T1,T2]... [--abi FILE [--event NAME]] [--from N] [--to N] [--chunk N]", parseLogs},
+	"gas":            {"gas [--from ADDRESS --to ADDRESS [--value AMOUNT] [--data HEX]]", parseGas},
+	"batch-transfer": {"batch-transfer --csv FILE --keystore FILE [--password-file FILE] [--dry-run]", parseBatchTransfer},
+}
+
+// env is what the commands share
+type env struct {
+	client *pyweb3.Web3Client
+	chain  pyweb3.ChainProfile
+}
+
+// usageError is a bad command line
+type usageError struct {
+	message string
+}
+
+func (e usageError) Error() string {
+	return e.message
+}
+
+func usagef(format string, args ...interface{}) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes a command line and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("web3rpc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	rpcURL := flags.String("rpc", getenv("WEB3RPC_RPC", "http://localhost:8545"), "node URL ($WEB3RPC_RPC)")
+	output := flags.String("output", getenv("WEB3RPC_OUTPUT", "table"), "output format, table or json ($WEB3RPC_OUTPUT)")
+	timeout := flags.Duration("timeout", 30*time.Second, "time limit of the command, waits included")
+	flags.Usage = func() { printUsage(stderr, flags) }
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "web3rpc: unknown output format %q\n", *output)
+		return exitUsage
+	}
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "web3rpc: unknown command %q\n", name)
+		flags.Usage()
+		return exitUsage
+	}
+	act, err := cmd.parse(flags.Args()[1:])
+	if err != nil {
+		return commandFailed(stderr, name, cmd, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	client, err := pyweb3.NewWeb3Client(*rpcURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "web3rpc: %v\n", err)
+		return exitUnreachable
+	}
+	defer client.Close()
+	chain, err := client.Chain(ctx)
+	if err != nil {
+		fmt.Fprintf(stderr, "web3rpc: %v\n", err)
+		return exitCode(err)
+	}
+	if chain.ENSRegistry != (common.Address{}) {
+		client.SetNameResolver(pyweb3.NewENS(client, chain.ENSRegistry))
+	}
+
+	res, err := act(ctx, &env{client: client, chain: chain})
+	if res != nil {
+		if err := res.write(stdout, *output); err != nil {
+			fmt.Fprintf(stderr, "web3rpc: %v\n", err)
+			return exitFailure
+		}
+	}
+	if err != nil {
+		return commandFailed(stderr, name, cmd, err)
+	}
+	return exitOK
+}
+
+// commandFailed reports the error of a command and returns its exit code
+func commandFailed(stderr io.Writer, name string, cmd command, err error) int {
+	fmt.Fprintf(stderr, "web3rpc %s: %v\n", name, err)
+	if _, ok := err.(usageError); ok {
+		fmt.Fprintf(stderr, "usage: web3rpc %s\n", cmd.usage)
+	}
+	return exitCode(err)
+}
+
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: web3rpc [flags] <command> [command flags] [args]")
+	fmt.Fprintln(w, "\nflags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
+
+func getenv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// exitCode maps an error to the exit code of its kind. Typed errors are
+// checked first; the messages are only matched for errors the library
+// wraps as text.
+func exitCode(err error) int {
+	var (
+		rpcErr   rpc.Error
+		jsonErr  *pyweb3.RPCError
+		fundsErr *pyweb3.InsufficientFundsError
+	)
+	switch {
+	case errors.As(err, &usageError{}):
+		return exitUsage
+	case errors.As(err, &fundsErr):
+		return exitInsufficientFunds
+	case errors.Is(err, ethereum.NotFound):
+		return exitNotFound
+	case errors.As(err, &rpcErr):
+		return rpcExitCode(rpcErr.ErrorCode(), rpcErr.Error())
+	case errors.As(err, &jsonErr):
+		return rpcExitCode(jsonErr.Code, jsonErr.Message)
+	case pyweb3.ClassifyError(err, 0, nil) == pyweb3.ClassTransient:
+		return exitUnreachable
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.HasSuffix(message, "not found"):
+		return exitNotFound
+	case strings.Contains(message, "insufficient funds"):
+		return exitInsufficientFunds
+	case strings.Contains(message, "execution reverted"):
+		return exitReverted
+	case strings.Contains(message, "timeout waiting"), strings.Contains(message, "not mined"):
+		return exitTimeout
+	case strings.Contains(message, "connection refused"), strings.Contains(message, "no such host"):
+		return exitUnreachable
+	}
+	return exitFailure
+}
+
+// rpcExitCode maps a JSON-RPC error returned by the node. Nodes report
+// reverts with code 3, or with code -32000 and the revert in the message.
+func rpcExitCode(code int, message string) int {
+	message = strings.ToLower(message)
+	switch {
+	case code == 3, strings.Contains(message, "execution reverted"):
+		return exitReverted
+	case strings.Contains(message, "insufficient funds"):
+		return exitInsufficientFunds
+	}
+	return exitRPCError
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pyweb3 "web3-rpc-client/src"
+	"web3-rpc-client/src/rpctest"
+)
+
+const erc20ABI = `[
+	{"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"balance","type":"uint256"}]},
+	{"type":"event","name":"Transfer","anonymous":false,"inputs":[{"name":"from","type":"address","indexed":true},{"name":"to","type":"address","indexed":true},{"name":"value","type":"uint256","indexed":false}]}
+]`
+
+var (
+	holder    = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	recipient = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+)
+
+// startNode starts a mock node of an unregistered chain, so transactions are
+// legacy and names are not resolved
+func startNode(t *testing.T) *rpctest.MockNode {
+	node := rpctest.NewMockNode().Respond("eth_chainId", "0x7a69")
+	t.Cleanup(node.Close)
+	return node
+}
+
+func runCLI(node *rpctest.MockNode, args ...string) (string, string, int) {
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"--rpc", node.URL()}, args...), &stdout, &stderr)
+	return stdout.String(), stderr.String(), code
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// writeKeystore saves a new key encrypted with password and returns its file
+func writeKeystore(t *testing.T, password string) (string, common.Address) {
+	privateKey, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	key := &keystore.Key{
+		Id:         uuid.New(),
+		Address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+		PrivateKey: privateKey,
+	}
+	data, err := keystore.EncryptKey(key, password, keystore.LightScryptN, keystore.LightScryptP)
+	require.NoError(t, err)
+	return writeFile(t, "key.json", string(data)), key.Address
+}
+
+func blockJSON(t *testing.T, number int64) map[string]interface{} {
+	header := &types.Header{
+		Number:      big.NewInt(number),
+		ParentHash:  common.HexToHash("0x01"),
+		Coinbase:    holder,
+		UncleHash:   types.EmptyUncleHash,
+		TxHash:      types.EmptyTxsHash,
+		ReceiptHash: types.EmptyReceiptsHash,
+		Difficulty:  new(big.Int),
+		GasLimit:    30000000,
+		GasUsed:     21000,
+		Time:        1700000000,
+		BaseFee:     big.NewInt(7),
+	}
+	data, err := json.Marshal(header)
+	require.NoError(t, err)
+	var block map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &block))
+	block["transactions"] = []interface{}{}
+	block["uncles"] = []interface{}{}
+	return block
+}
+
+func receiptJSON(t *testing.T, hash common.Hash, status uint64) map[string]interface{} {
+	receipt := &types.Receipt{
+		Type:              types.LegacyTxType,
+		Status:            status,
+		CumulativeGasUsed: 21000,
+		Logs:              []*types.Log{},
+		TxHash:            hash,
+		GasUsed:           21000,
+		EffectiveGasPrice: big.NewInt(1e9),
+		BlockHash:         common.HexToHash("0x02"),
+		BlockNumber:       big.NewInt(12),
+	}
+	data, err := json.Marshal(receipt)
+	require.NoError(t, err)
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &out))
+	return out
+}
+
+func TestRun(t *testing.T) {
+	t.Run("usage errors", func(t *testing.T) {
+		node := startNode(t)
+		for _, args := range [][]string{
+			{},
+			{"frobnicate"},
+			{"--output", "yaml", "block"},
+			{"--bogus", "block"},
+			{"block", "not-a-number"},
+			{"balance"},
+			{"balance", "not-an-address"},
+			{"receipt", "0x1234"},
+			{"call", "--to", recipient.Hex()},
+		} {
+			_, stderr, code := runCLI(node, args...)
+			assert.Equal(t, exitUsage, code, "%v: %s", args, stderr)
+		}
+	})
+
+	t.Run("usage errors before dialing", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"block", "not-a-number"},
+			{"receipt", "0x1234"},
+			{"call", "--to", recipient.Hex()},
+			{"logs", "--event", "Transfer"},
+			{"batch-transfer", "--keystore", "key.json"},
+		} {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"--rpc", "http://127.0.0.1:1"}, args...), &stdout, &stderr)
+			assert.Equal(t, exitUsage, code, "%v: %s", args, stderr.String())
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		node := startNode(t).Respond("eth_getBlockByNumber", blockJSON(t, 16))
+		stdout, stderr, code := runCLI(node, "--output", "json", "block", "16")
+		require.Equal(t, exitOK, code, stderr)
+
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(stdout), &out))
+		assert.Equal(t, float64(16), out["number"])
+		assert.Equal(t, "2023-11-14T22:13:20Z", out["time"])
+		assert.Equal(t, "7", out["base_fee"])
+		assert.Equal(t, strings.ToLower(holder.Hex()), strings.ToLower(out["miner"].(string)))
+	})
+
+	t.Run("balance and nonce", func(t *testing.T) {
+		node := startNode(t).
+			Respond("eth_getBalance", "0x1bc16d674ec80000").
+			Handle("eth_getTransactionCount", func(params []json.RawMessage) (interface{}, error) {
+				if string(params[1]) == `"pending"` {
+					return "0x5", nil
+				}
+				return "0x4", nil
+			})
+
+		stdout, stderr, code := runCLI(node, "balance", holder.Hex())
+		require.Equal(t, exitOK, code, stderr)
+		assert.Regexp(t, `(?m)^balance\s+2$`, stdout)
+		assert.Regexp(t, `(?m)^base_units\s+2000000000000000000$`, stdout)
+
+		stdout, stderr, code = runCLI(node, "--output", "json", "nonce", "--pending", holder.Hex())
+		require.Equal(t, exitOK, code, stderr)
+		assert.Contains(t, stdout, `"nonce": 5`)
+	})
+
+	t.Run("call with abi", func(t *testing.T) {
+		abiFile := writeFile(t, "token.json", `{"contractName":"Token","abi":`+erc20ABI+`}`)
+		node := startNode(t).Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			var msg struct {
+				Input hexutil.Bytes `json:"input"`
+				Data  hexutil.Bytes `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(params[0], &msg))
+			data := msg.Input
+			if data == nil {
+				data = msg.Data
+			}
+			assert.Equal(t, crypto.Keccak256([]byte("balanceOf(address)"))[:4], []byte(data[:4]))
+			assert.Equal(t, common.LeftPadBytes(holder.Bytes(), 32), []byte(data[4:]))
+			return hexutil.Encode(common.LeftPadBytes(big.NewInt(42).Bytes(), 32)), nil
+		})
+
+		stdout, stderr, code := runCLI(node, "--output", "json", "call", "--to", recipient.Hex(), "--abi", abiFile, "--method", "balanceOf", holder.Hex())
+		require.Equal(t, exitOK, code, stderr)
+		assert.JSONEq(t, `{"balance": "42"}`, stdout)
+
+		_, stderr, code = runCLI(node, "call", "--to", recipient.Hex(), "--abi", abiFile, "--method", "balanceOf")
+		assert.Equal(t, exitUsage, code)
+		assert.Contains(t, stderr, "takes 1 arguments, got 0")
+	})
+
+	t.Run("exit codes", func(t *testing.T) {
+		node := startNode(t).
+			Fail("eth_call", 3, "execution reverted: paused").
+			Fail("eth_getBalance", -32005, "limit exceeded").
+			Respond("eth_getTransactionReceipt", nil)
+
+		_, stderr, code := runCLI(node, "call", "--to", recipient.Hex(), "--data", "0x12345678")
+		assert.Equal(t, exitReverted, code, stderr)
+		_, stderr, code = runCLI(node, "balance", holder.Hex())
+		assert.Equal(t, exitRPCError, code, stderr)
+		_, stderr, code = runCLI(node, "receipt", common.HexToHash("0x03").Hex())
+		assert.Equal(t, exitNotFound, code, stderr)
+
+		hash := common.HexToHash("0x04")
+		node.Respond("eth_getTransactionReceipt", receiptJSON(t, hash, types.ReceiptStatusFailed))
+		stdout, stderr, code := runCLI(node, "receipt", hash.Hex())
+		assert.Equal(t, exitReverted, code, stderr)
+		assert.Regexp(t, `(?m)^status\s+failed$`, stdout)
+
+		var stdoutBuf, stderrBuf bytes.Buffer
+		code = run([]string{"--rpc", "http://127.0.0.1:1", "block"}, &stdoutBuf, &stderrBuf)
+		assert.Equal(t, exitUnreachable, code, stderrBuf.String())
+	})
+
+	t.Run("name resolution errors", func(t *testing.T) {
+		node := rpctest.NewMockNode().
+			Respond("eth_chainId", "0x1").
+			Fail("eth_call", -32000, "header not found")
+		t.Cleanup(node.Close)
+		_, stderr, code := runCLI(node, "balance", "vitalik.eth")
+		assert.Equal(t, exitRPCError, code, stderr)
+
+		_, stderr, code = runCLI(node, "balance", "not a name.eth")
+		assert.Equal(t, exitUsage, code, stderr)
+	})
+
+	t.Run("logs", func(t *testing.T) {
+		abiFile := writeFile(t, "token.json", erc20ABI)
+		transfer := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+		node := startNode(t).
+			Respond("eth_blockNumber", "0x64").
+			Handle("eth_getLogs", func(params []json.RawMessage) (interface{}, error) {
+				var query struct {
+					FromBlock hexutil.Uint64 `json:"fromBlock"`
+					ToBlock   hexutil.Uint64 `json:"toBlock"`
+				}
+				require.NoError(t, json.Unmarshal(params[0], &query))
+				if query.ToBlock-query.FromBlock >= 50 {
+					return nil, &rpctest.Error{Code: -32005, Message: "query returned more than 10000 results"}
+				}
+				if query.FromBlock > 90 || query.ToBlock < 90 {
+					return []interface{}{}, nil
+				}
+				return []*types.Log{{
+					Address:     recipient,
+					Topics:      []common.Hash{transfer, common.BytesToHash(holder.Bytes()), common.BytesToHash(recipient.Bytes())},
+					Data:        common.LeftPadBytes(big.NewInt(7).Bytes(), 32),
+					BlockNumber: 90,
+					TxHash:      common.HexToHash("0x05"),
+					BlockHash:   common.HexToHash("0x06"),
+					Index:       1,
+				}}, nil
+			})
+
+		stdout, stderr, code := runCLI(node, "--output", "json", "logs", "--abi", abiFile, "--event", "Transfer", "--from", "0", "--chunk", "100")
+		require.Equal(t, exitOK, code, stderr)
+
+		var out []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(stdout), &out))
+		require.Len(t, out, 1)
+		assert.Equal(t, float64(90), out[0]["block"])
+		assert.Equal(t, "Transfer", out[0]["event"])
+		fields := out[0]["fields"].(map[string]interface{})
+		assert.Equal(t, "7", fields["value"])
+		assert.Greater(t, node.Calls("eth_getLogs"), 2)
+	})
+
+	t.Run("logs without topics", func(t *testing.T) {
+		node := startNode(t).
+			Respond("eth_blockNumber", "0x64").
+			Respond("eth_getLogs", []*types.Log{{
+				Address:     recipient,
+				Topics:      []common.Hash{},
+				Data:        []byte{0x2a},
+				BlockNumber: 90,
+				TxHash:      common.HexToHash("0x05"),
+				BlockHash:   common.HexToHash("0x06"),
+			}})
+
+		stdout, stderr, code := runCLI(node, "--output", "json", "logs", "--address", recipient.Hex(), "--from", "0")
+		require.Equal(t, exitOK, code, stderr)
+
+		var out []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(stdout), &out))
+		require.Len(t, out, 1)
+		assert.Equal(t, "0x2a", out[0]["fields"].(map[string]interface{})["data"])
+	})
+
+	t.Run("send", func(t *testing.T) {
+		keyFile, sender := writeKeystore(t, "secret")
+		passwordFile := writeFile(t, "password", "secret\n")
+		var sent *types.Transaction
+		node := startNode(t).
+			Respond("eth_getTransactionCount", "0x3").
+			Respond("eth_estimateGas", "0x5208").
+			Respond("eth_gasPrice", "0x3b9aca00").
+			Handle("eth_sendRawTransaction", func(params []json.RawMessage) (interface{}, error) {
+				var raw hexutil.Bytes
+				require.NoError(t, json.Unmarshal(params[0], &raw))
+				sent = new(types.Transaction)
+				require.NoError(t, sent.UnmarshalBinary(raw))
+				return sent.Hash(), nil
+			}).
+			Handle("eth_getTransactionReceipt", func(params []json.RawMessage) (interface{}, error) {
+				return receiptJSON(t, sent.Hash(), types.ReceiptStatusSuccessful), nil
+			})
+
+		stdout, stderr, code := runCLI(node, "--output", "json", "send", "--to", recipient.Hex(), "--value", "0.5", "--keystore", keyFile, "--password-file", passwordFile, "--wait", "0")
+		require.Equal(t, exitOK, code, stderr)
+		require.NotNil(t, sent)
+
+		signer := types.LatestSignerForChainID(big.NewInt(31337))
+		from, err := types.Sender(signer, sent)
+		require.NoError(t, err)
+		assert.Equal(t, sender, from)
+		assert.Equal(t, uint64(3), sent.Nonce())
+		assert.Equal(t, "500000000000000000", sent.Value().String())
+
+		var out map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(stdout), &out))
+		assert.Equal(t, sent.Hash().Hex(), out["hash"])
+		assert.Equal(t, "success", out["status"])
+
+		_, stderr, code = runCLI(node, "send", "--to", recipient.Hex(), "--value", "0.5", "--keystore", keyFile, "--password-file", writeFile(t, "wrong", "wrong"))
+		assert.Equal(t, exitFailure, code)
+		assert.Contains(t, stderr, "failed to decrypt keystore")
+	})
+
+	t.Run("batch transfer dry run", func(t *testing.T) {
+		keyFile, _ := writeKeystore(t, "secret")
+		t.Setenv("WEB3RPC_PASSWORD", "secret")
+		csvFile := writeFile(t, "payouts.csv", "to,amount\n"+recipient.Hex()+",1\n"+holder.Hex()+",2.5\n")
+		node := startNode(t).
+			Respond("eth_getBalance", "0xde0b6b3a7640000").
+			Respond("eth_getTransactionCount", "0x0").
+			Respond("eth_estimateGas", "0x5208").
+			Respond("eth_gasPrice", "0x3b9aca00").
+			Respond("eth_getBlockByNumber", blockJSON(t, 16))
+
+		stdout, stderr, code := runCLI(node, "batch-transfer", "--csv", csvFile, "--keystore", keyFile, "--dry-run")
+		assert.Equal(t, exitInsufficientFunds, code, stderr)
+		assert.Regexp(t, `(?m)^transfers\s+2$`, stdout)
+		assert.Contains(t, stdout, "shortfalls")
+		assert.Zero(t, node.Calls("eth_sendRawTransaction"))
+
+		_, stderr, code = runCLI(node, "batch-transfer", "--csv", writeFile(t, "bad.csv", recipient.Hex()+",lots\n"), "--keystore", keyFile, "--dry-run")
+		assert.Equal(t, exitUsage, code, stderr)
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	reverted := fmt.Errorf("call failed: %w", &pyweb3.RPCError{Code: 3, Message: "paused"})
+	assert.Equal(t, exitReverted, exitCode(reverted))
+
+	rpcErr := fmt.Errorf("failed to get nonce: %w", &pyweb3.RPCError{Code: -32000, Message: "header not found"})
+	assert.Equal(t, exitRPCError, exitCode(rpcErr))
+
+	funds := fmt.Errorf("batch: %w", &pyweb3.InsufficientFundsError{Report: &pyweb3.PreflightReport{}})
+	assert.Equal(t, exitInsufficientFunds, exitCode(funds))
+
+	assert.Equal(t, exitNotFound, exitCode(fmt.Errorf("lookup: %w", ethereum.NotFound)))
+	assert.Equal(t, exitTimeout, exitCode(errors.New("timeout waiting for confirmations")))
+	assert.Equal(t, exitFailure, exitCode(errors.New("failed to read ABI")))
+}
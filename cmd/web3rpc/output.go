@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"text/tabwriter"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// result is what a command prints: a single record of named fields, or rows
+// under columns. Values keep their type so JSON output is not all strings.
+type result struct {
+	columns []string
+	rows    [][]interface{}
+	single  bool
+}
+
+// newRecord creates a single record from name, value pairs
+func newRecord(pairs ...interface{}) *result {
+	r := &result{single: true, rows: [][]interface{}{{}}}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		r.add(pairs[i].(string), pairs[i+1])
+	}
+	return r
+}
+
+// newTable creates an empty table
+func newTable(columns ...string) *result {
+	return &result{columns: columns}
+}
+
+// add appends a field to a record
+func (r *result) add(name string, value interface{}) *result {
+	r.columns = append(r.columns, name)
+	r.rows[0] = append(r.rows[0], value)
+	return r
+}
+
+// addRow appends a row to a table, one value per column
+func (r *result) addRow(values ...interface{}) {
+	r.rows = append(r.rows, values)
+}
+
+func (r *result) write(w io.Writer, format string) error {
+	if format == "json" {
+		return r.writeJSON(w)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	if r.single {
+		for i, name := range r.columns {
+			fmt.Fprintf(tw, "%s\t%s\n", name, formatValue(r.rows[0][i]))
+		}
+		return tw.Flush()
+	}
+	for i, name := range r.columns {
+		if i > 0 {
+			fmt.Fprint(tw, "\t")
+		}
+		fmt.Fprint(tw, name)
+	}
+	fmt.Fprintln(tw)
+	for _, row := range r.rows {
+		for i, value := range row {
+			if i > 0 {
+				fmt.Fprint(tw, "\t")
+			}
+			fmt.Fprint(tw, formatValue(value))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+func (r *result) writeJSON(w io.Writer) error {
+	objects := make([]map[string]interface{}, len(r.rows))
+	for i, row := range r.rows {
+		objects[i] = make(map[string]interface{}, len(row))
+		for j, value := range row {
+			objects[i][r.columns[j]] = jsonValue(value)
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if r.single {
+		return encoder.Encode(objects[0])
+	}
+	return encoder.Encode(objects)
+}
+
+// jsonValue turns byte arrays and slices into hex, the way nodes encode them
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return hexutil.Bytes(v)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			out[key] = jsonValue(item)
+		}
+		return out
+	case fmt.Stringer, error:
+		return fmt.Sprint(v)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return hexutil.Bytes(b)
+	}
+	return value
+}
+
+// formatValue prints a value in a table cell
+func formatValue(value interface{}) string {
+	switch v := jsonValue(value).(type) {
+	case nil:
+		return ""
+	case map[string]interface{}:
+		out, _ := json.Marshal(v)
+		return string(out)
+	default:
+		return fmt.Sprint(v)
+	}
+}
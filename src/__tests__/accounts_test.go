@@ -0,0 +1,181 @@
+package pyweb3
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeystore(t *testing.T, dir string, lockTimeout time.Duration) *Keystore {
+	ks, err := NewKeystore(KeystoreConfig{
+		Dir:         dir,
+		ScryptN:     keystore.LightScryptN,
+		ScryptP:     keystore.LightScryptP,
+		LockTimeout: lockTimeout,
+	})
+	require.NoError(t, err)
+	return ks
+}
+
+// assertSigns checks that signer produces transactions and messages
+// recovering to its address
+func assertSigns(t *testing.T, signer Signer) {
+	ctx := context.Background()
+	chainID := big.NewInt(5)
+	tx := types.NewTransaction(0, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	signed, err := signer.SignTx(ctx, tx, chainID)
+	require.NoError(t, err)
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	require.NoError(t, err)
+	assert.Equal(t, signer.Address(), sender)
+
+	signature, err := signer.SignMessage(ctx, []byte("hello"))
+	require.NoError(t, err)
+	require.Len(t, signature, 65)
+	assert.Contains(t, []byte{27, 28}, signature[64])
+	signature[64] -= 27
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte("hello")), signature)
+	require.NoError(t, err)
+	assert.Equal(t, signer.Address(), crypto.PubkeyToAddress(*pub))
+}
+
+func TestKeySigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	signer := NewKeySigner(key)
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), signer.Address())
+	assertSigns(t, signer)
+
+	signer.Zero()
+	assert.Zero(t, key.D.Sign())
+	_, err = signer.SignMessage(context.Background(), []byte("hello"))
+	assert.ErrorIs(t, err, ErrAccountLocked)
+}
+
+func TestNewTransactOpts(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := NewKeySigner(key)
+	opts := NewTransactOpts(context.Background(), signer, big.NewInt(5))
+	assert.Equal(t, signer.Address(), opts.From)
+
+	tx := types.NewTransaction(0, common.HexToAddress("0x01"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	signed, err := opts.Signer(signer.Address(), tx)
+	require.NoError(t, err)
+	assert.Equal(t, big.NewInt(5), signed.ChainId())
+
+	_, err = opts.Signer(common.HexToAddress("0x02"), tx)
+	assert.Error(t, err)
+}
+
+func TestKeystore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	ks := newTestKeystore(t, dir, 0)
+
+	account, err := ks.NewAccount("secret")
+	require.NoError(t, err)
+	assert.False(t, account.Unlocked())
+	info, err := os.Stat(account.Path())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	t.Run("locked until unlocked", func(t *testing.T) {
+		_, err := account.SignMessage(context.Background(), []byte("hello"))
+		assert.ErrorIs(t, err, ErrAccountLocked)
+
+		assert.ErrorContains(t, account.Unlock("wrong", 0), "failed to decrypt keystore")
+		require.NoError(t, account.Unlock("secret", 0))
+		assertSigns(t, account)
+
+		account.Lock()
+		assert.False(t, account.Unlocked())
+	})
+
+	t.Run("reloaded from the directory", func(t *testing.T) {
+		// Leftovers of an interrupted save and unrelated files are skipped
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a key"), 0o600))
+		reopened := newTestKeystore(t, dir, 0)
+		assert.Equal(t, []common.Address{account.Address()}, reopened.Accounts())
+		unlocked, err := reopened.Unlock(account.Address(), "secret")
+		require.NoError(t, err)
+		assert.True(t, unlocked.Unlocked())
+		reopened.LockAll()
+		assert.False(t, unlocked.Unlocked())
+
+		_, err = reopened.Account(common.HexToAddress("0x01"))
+		assert.Error(t, err)
+	})
+
+	t.Run("import key", func(t *testing.T) {
+		key, _ := crypto.GenerateKey()
+		imported, err := ks.ImportKey(key, "other")
+		require.NoError(t, err)
+		assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), imported.Address())
+		assert.NotZero(t, key.D.Sign(), "the caller's key is left alone")
+
+		_, err = ks.ImportKey(key, "other")
+		assert.ErrorContains(t, err, "already in keystore")
+		assert.Len(t, ks.Accounts(), 2)
+	})
+
+	t.Run("import mnemonic", func(t *testing.T) {
+		imported, err := ks.ImportMnemonic(hardhatMnemonic, "", AccountPath(1), "secret")
+		require.NoError(t, err)
+		assert.Equal(t, common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8"), imported.Address())
+
+		_, err = ks.ImportMnemonic("not a mnemonic", "", AccountPath(0), "secret")
+		assert.ErrorContains(t, err, "invalid mnemonic")
+	})
+}
+
+func TestKeystoreAccount_LockTimeout(t *testing.T) {
+	ks := newTestKeystore(t, t.TempDir(), 50*time.Millisecond)
+	created, err := ks.NewAccount("secret")
+	require.NoError(t, err)
+
+	account, err := ks.Unlock(created.Address(), "secret")
+	require.NoError(t, err)
+	assert.True(t, account.Unlocked())
+	assert.Eventually(t, func() bool { return !account.Unlocked() }, time.Second, 10*time.Millisecond)
+
+	_, err = account.SignTx(context.Background(), types.NewTransaction(0, common.Address{}, nil, 21000, nil, nil), big.NewInt(1))
+	assert.True(t, errors.Is(err, ErrAccountLocked))
+
+	// Unlocking again without a timeout cancels the pending one
+	require.NoError(t, account.Unlock("secret", 30*time.Millisecond))
+	require.NoError(t, account.Unlock("secret", 0))
+	time.Sleep(80 * time.Millisecond)
+	assert.True(t, account.Unlocked())
+	account.Lock()
+}
+
+func TestLoadKeystore(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{Address: crypto.PubkeyToAddress(key.PublicKey), PrivateKey: key}, "pw", keystore.LightScryptN, keystore.LightScryptP)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "key.json")
+	require.NoError(t, os.WriteFile(path, keyJSON, 0o600))
+
+	account, err := LoadKeystore(path)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), account.Address())
+	require.NoError(t, account.Unlock("pw", 0))
+	assertSigns(t, account)
+	account.Lock()
+
+	v1 := filepath.Join(t.TempDir(), "v1.json")
+	require.NoError(t, os.WriteFile(v1, []byte(`{"address":"0000000000000000000000000000000000000001","version":1}`), 0o600))
+	_, err = LoadKeystore(v1)
+	assert.ErrorContains(t, err, "unsupported keystore version")
+}
@@ -0,0 +1,59 @@
+package pyweb3
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		decimals uint8
+		expected string
+		wantErr  bool
+	}{
+		{"1", 18, "1000000000000000000", false},
+		{"1.5", 6, "1500000", false},
+		{"0.000001", 6, "1", false},
+		{".25", 2, "25", false},
+		{"12.", 2, "1200", false},
+		{"-3.1", 1, "-31", false},
+		{"0.1234567", 6, "", true},
+		{"1e18", 18, "", true},
+		{"", 18, "", true},
+		{"1.2.3", 18, "", true},
+		{"0.1", 18, "100000000000000000", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			amount, err := ParseAmount(tt.input, tt.decimals)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, amount.BaseUnits().String())
+		})
+	}
+}
+
+func TestAmount_String(t *testing.T) {
+	assert.Equal(t, "1.5", NewAmount(big.NewInt(1500000), 6).String())
+	assert.Equal(t, "0.000001", NewAmount(big.NewInt(1), 6).String())
+	assert.Equal(t, "42", NewAmount(big.NewInt(42), 0).String())
+	assert.Equal(t, "-0.5", NewAmount(big.NewInt(-50), 2).String())
+	assert.Equal(t, "100", NewAmount(big.NewInt(10000), 2).String())
+	assert.Equal(t, "0", Amount{}.String())
+
+	// Round trip without float error
+	amount := MustParseAmount("123456789.123456789123456789", 18)
+	assert.Equal(t, "123456789.123456789123456789", amount.String())
+}
+
+func TestAmount_Cmp(t *testing.T) {
+	assert.Equal(t, -1, MustParseAmount("0.1", 18).Cmp(MustParseAmount("0.2", 18)))
+	assert.Equal(t, 0, MustParseAmount("1", 6).Cmp(NewAmount(big.NewInt(1000000), 6)))
+}
@@ -0,0 +1,252 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// txNode emulates a node accepting raw transactions, rejecting the ones to rejectTo
+type txNode struct {
+	mutex    sync.Mutex
+	nonce    uint64
+	rejectTo *common.Address
+	sent     []*types.Transaction
+}
+
+func newTxNode(t *testing.T, nonce uint64) (*txNode, *Web3Client) {
+	node := &txNode{nonce: nonce}
+	mock := startMockNode(t).
+		Respond("eth_chainId", "0x1").
+		Handle("eth_getTransactionCount", func([]json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			return hexutil.Uint64(node.nonce), nil
+		}).
+		Handle("eth_sendRawTransaction", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			var raw hexutil.Bytes
+			json.Unmarshal(params[0], &raw)
+			tx := new(types.Transaction)
+			tx.UnmarshalBinary(raw)
+			if node.rejectTo != nil && *tx.To() == *node.rejectTo {
+				return nil, &rpctest.Error{Code: -32000, Message: "insufficient funds for gas * price + value"}
+			}
+			node.sent = append(node.sent, tx)
+			return tx.Hash(), nil
+		})
+
+	client, err := NewWeb3Client(mock.URL())
+	assert.NoError(t, err)
+	return node, client
+}
+
+func newTestTransactor(t *testing.T) *bind.TransactOpts {
+	key, _ := crypto.GenerateKey()
+	opts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1))
+	assert.NoError(t, err)
+	opts.GasLimit = 100000
+	opts.GasPrice = big.NewInt(1e9)
+	return opts
+}
+
+func TestBatchTransferTokens(t *testing.T) {
+	node, client := newTxNode(t, 7)
+	bp := NewBatchProcessor(client, 10, 2)
+	opts := newTestTransactor(t)
+
+	token := common.HexToAddress("0xaaaa")
+	nft := common.HexToAddress("0xbbbb")
+	multi := common.HexToAddress("0xcccc")
+	alice := common.HexToAddress("0x01")
+
+	instructions := []TransferInstruction{
+		{Standard: Native, To: alice, Amount: big.NewInt(1e18), IdempotencyKey: "a"},
+		{Standard: ERC20Token, Token: token, To: alice, Amount: big.NewInt(500), IdempotencyKey: "b"},
+		// Second payout to the same recipient, kept apart from the first one
+		{Standard: ERC20Token, Token: token, To: alice, Amount: big.NewInt(700), IdempotencyKey: "c"},
+		{Standard: ERC721Token, Token: nft, To: alice, TokenID: big.NewInt(42)},
+		{Standard: ERC1155Token, Token: multi, To: alice, TokenID: big.NewInt(3), Amount: big.NewInt(10)},
+		{Standard: ERC20Token, Token: token, To: alice, Amount: big.NewInt(500), IdempotencyKey: "b"},
+	}
+
+	results := bp.BatchTransferTokens(context.Background(), opts, instructions)
+	assert.Len(t, results, len(instructions))
+	for i, result := range results[:5] {
+		assert.NoError(t, result.Error)
+		assert.Equal(t, instructions[i], result.Instruction)
+		assert.Equal(t, uint64(7+i), result.Nonce)
+		assert.Equal(t, node.sent[i].Hash(), result.TxHash)
+	}
+	assert.True(t, results[5].Duplicate)
+	assert.Equal(t, results[1].TxHash, results[5].TxHash)
+	assert.Len(t, node.sent, 5)
+
+	assert.Equal(t, big.NewInt(1e18), node.sent[0].Value())
+	args, _ := transferABI.Methods["transfer"].Inputs.Unpack(node.sent[2].Data()[4:])
+	assert.Equal(t, big.NewInt(700), args[1])
+	args, _ = transferABI.Methods["safeTransferFrom"].Inputs.Unpack(node.sent[3].Data()[4:])
+	assert.Equal(t, []interface{}{opts.From, alice, big.NewInt(42)}, args)
+	args, _ = transferABI.Methods["safeTransferFrom0"].Inputs.Unpack(node.sent[4].Data()[4:])
+	assert.Equal(t, big.NewInt(10), args[3])
+
+	t.Run("idempotency keys remembered across batches", func(t *testing.T) {
+		results := bp.BatchTransferTokens(context.Background(), opts, instructions[:1])
+		assert.True(t, results[0].Duplicate)
+		assert.Len(t, node.sent, 5)
+	})
+}
+
+func TestBatchTransferTokens_StopsOnFailure(t *testing.T) {
+	node, client := newTxNode(t, 0)
+	bad := common.HexToAddress("0xdead")
+	node.rejectTo = &bad
+	bp := NewBatchProcessor(client, 10, 2)
+
+	results := bp.BatchTransferTokens(context.Background(), newTestTransactor(t), []TransferInstruction{
+		{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(1)},
+		{Standard: Native, To: bad, Amount: big.NewInt(1)},
+		{Standard: Native, To: common.HexToAddress("0x02"), Amount: big.NewInt(1)},
+	})
+
+	assert.NoError(t, results[0].Error)
+	assert.Error(t, results[1].Error)
+	assert.Error(t, results[2].Error)
+	assert.Contains(t, results[2].Error.Error(), "earlier transfer failed")
+	assert.Len(t, node.sent, 1)
+}
+
+func TestBatchTransferTokens_KeyReservation(t *testing.T) {
+	node, client := newTxNode(t, 0)
+	bp := NewBatchProcessor(client, 10, 2)
+	opts := newTestTransactor(t)
+	ctx := context.Background()
+
+	payout := []TransferInstruction{{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(1), IdempotencyKey: "payout"}}
+	batches := make([][]TransferResult, 8)
+	var wg sync.WaitGroup
+	for i := range batches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			batches[i] = bp.BatchTransferTokens(ctx, opts, payout)
+		}(i)
+	}
+	wg.Wait()
+	sent := 0
+	for _, results := range batches {
+		if results[0].Error == nil && !results[0].Duplicate {
+			sent++
+		}
+	}
+	assert.Equal(t, 1, sent)
+	assert.Len(t, node.sent, 1)
+
+	t.Run("released when not sent", func(t *testing.T) {
+		bad := common.HexToAddress("0xdead")
+		retry := []TransferInstruction{{Standard: Native, To: bad, Amount: big.NewInt(1), IdempotencyKey: "retry"}}
+
+		node.rejectTo = &bad
+		results := bp.BatchTransferTokens(ctx, opts, retry)
+		assert.Error(t, results[0].Error)
+
+		engine := NewPolicyEngine(nil, PolicyConfig{Deny: []common.Address{bad}})
+		results = bp.BatchTransferTokens(ctx, engine.TransactOpts(opts), retry)
+		var violation *PolicyViolation
+		assert.ErrorAs(t, results[0].Error, &violation)
+
+		node.rejectTo = nil
+		results = bp.BatchTransferTokens(ctx, opts, retry)
+		assert.NoError(t, results[0].Error)
+		assert.False(t, results[0].Duplicate)
+		assert.Len(t, node.sent, 2)
+	})
+}
+
+func TestDisperseTransfer(t *testing.T) {
+	node, client := newTxNode(t, 0)
+	bp := NewBatchProcessor(client, 10, 2)
+	disperse := common.HexToAddress("0xd15")
+	opts := newTestTransactor(t)
+
+	instructions := []TransferInstruction{
+		{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(100)},
+		{Standard: Native, To: common.HexToAddress("0x02"), Amount: big.NewInt(200)},
+	}
+	results := bp.DisperseTransfer(context.Background(), opts, disperse, instructions)
+	assert.NoError(t, results[0].Error)
+	assert.Equal(t, results[0].TxHash, results[1].TxHash)
+	assert.Len(t, node.sent, 1)
+	assert.Equal(t, disperse, *node.sent[0].To())
+	assert.Equal(t, big.NewInt(300), node.sent[0].Value())
+
+	t.Run("mixed assets", func(t *testing.T) {
+		mixed := append(instructions, TransferInstruction{Standard: ERC20Token, Token: common.HexToAddress("0xaaaa"), To: common.HexToAddress("0x03"), Amount: big.NewInt(1)})
+		results := bp.DisperseTransfer(context.Background(), opts, disperse, mixed)
+		for _, result := range results {
+			assert.Error(t, result.Error)
+		}
+	})
+
+	t.Run("duplicate keys paid once", func(t *testing.T) {
+		keyed := []TransferInstruction{
+			{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(100), IdempotencyKey: "x"},
+			{Standard: Native, To: common.HexToAddress("0x02"), Amount: big.NewInt(200), IdempotencyKey: "y"},
+			{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(100), IdempotencyKey: "x"},
+		}
+		results := bp.DisperseTransfer(context.Background(), opts, disperse, keyed)
+		assert.NoError(t, results[0].Error)
+		assert.True(t, results[2].Duplicate)
+		assert.Equal(t, results[0].TxHash, results[2].TxHash)
+		assert.Len(t, node.sent, 2)
+		assert.Equal(t, big.NewInt(300), node.sent[1].Value())
+		args, _ := disperseABI.Methods["disperseEther"].Inputs.Unpack(node.sent[1].Data()[4:])
+		assert.Len(t, args[0], 2)
+	})
+
+	t.Run("keys sent before paid once", func(t *testing.T) {
+		keyed := []TransferInstruction{
+			{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(100), IdempotencyKey: "x"},
+			{Standard: Native, To: common.HexToAddress("0x03"), Amount: big.NewInt(400), IdempotencyKey: "z"},
+		}
+		results := bp.DisperseTransfer(context.Background(), opts, disperse, keyed)
+		assert.True(t, results[0].Duplicate)
+		assert.Equal(t, node.sent[1].Hash(), results[0].TxHash)
+		assert.NoError(t, results[1].Error)
+		assert.Len(t, node.sent, 3)
+		assert.Equal(t, big.NewInt(400), node.sent[2].Value())
+	})
+
+	t.Run("policy violation", func(t *testing.T) {
+		denied := common.HexToAddress("0x04")
+		keyed := []TransferInstruction{
+			{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(100), IdempotencyKey: "x"},
+			{Standard: Native, To: denied, Amount: big.NewInt(500), IdempotencyKey: "w"},
+		}
+		engine := NewPolicyEngine(nil, PolicyConfig{Deny: []common.Address{denied}})
+		results := bp.DisperseTransfer(context.Background(), engine.TransactOpts(opts), disperse, keyed)
+		assert.True(t, results[0].Duplicate)
+		assert.NoError(t, results[0].Error)
+		var violation *PolicyViolation
+		assert.ErrorAs(t, results[1].Error, &violation)
+		assert.Len(t, node.sent, 3)
+
+		// The refused key was released
+		results = bp.DisperseTransfer(context.Background(), opts, disperse, keyed)
+		assert.NoError(t, results[1].Error)
+		assert.False(t, results[1].Duplicate)
+		assert.Len(t, node.sent, 4)
+	})
+}
@@ -0,0 +1,170 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachePolicy(t *testing.T) {
+	tests := []struct {
+		method string
+		params string
+		policy CachePolicy
+		block  uint64
+		tagged bool
+	}{
+		{"eth_chainId", `[]`, CachePermanent, 0, false},
+		{"eth_blockNumber", `[]`, CacheUntilNextBlock, 0, false},
+		{"eth_getBalance", `["0x01","latest"]`, CacheUntilNextBlock, 0, false},
+		{"eth_getBalance", `["0x01","pending"]`, CacheNever, 0, false},
+		{"eth_call", `[{"to":"0x01"},"0x10"]`, CachePermanent, 16, true},
+		{"eth_call", `[{"to":"0x01"},{"blockHash":"0xabc"}]`, CachePermanent, 0, false},
+		{"eth_getStorageAt", `["0x01","0x0","0x20"]`, CachePermanent, 32, true},
+		{"eth_getBlockByNumber", `["0x5",false]`, CachePermanent, 5, true},
+		{"eth_sendRawTransaction", `["0x00"]`, CacheNever, 0, false},
+		{"eth_getLogs", `[{}]`, CacheNever, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+tt.params, func(t *testing.T) {
+			policy, block, tagged := cachePolicy(&rpcMessage{Method: tt.method, Params: json.RawMessage(tt.params)})
+			assert.Equal(t, tt.policy, policy)
+			assert.Equal(t, tt.block, block)
+			assert.Equal(t, tt.tagged, tagged)
+		})
+	}
+}
+
+func TestCache_Permanent(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_chainId":            {reply(`"0x1"`)},
+		"eth_sendRawTransaction": {reply(`"0xhash"`)},
+	})
+	c := NewCache(CacheConfig{Transport: http.DefaultTransport})
+
+	for i := 0; i < 3; i++ {
+		resp, err := sendThrough(context.Background(), c, server.URL, `{"jsonrpc":"2.0","id":`+strconv.Itoa(i+1)+`,"method":"eth_chainId","params":[]}`)
+		assert.NoError(t, err)
+		body := readBody(t, resp)
+		assert.Contains(t, body, `"result":"0x1"`)
+		assert.Contains(t, body, `"id":`+strconv.Itoa(i+1))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_chainId"]))
+
+	for i := 0; i < 2; i++ {
+		_, err := sendThrough(context.Background(), c, server.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(counts["eth_sendRawTransaction"]))
+}
+
+func TestCache_Batch(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_chainId": {reply(`"0x1"`)},
+	})
+	c := NewCache(CacheConfig{})
+
+	_, err := sendThrough(context.Background(), c, server.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	assert.NoError(t, err)
+
+	// Fully cached batch, answered without reaching the node
+	resp, err := sendThrough(context.Background(), c, server.URL,
+		`[{"jsonrpc":"2.0","id":2,"method":"eth_chainId","params":[]},{"jsonrpc":"2.0","id":3,"method":"eth_chainId","params":[]}]`)
+	assert.NoError(t, err)
+	var replies []rpcMessage
+	assert.NoError(t, json.Unmarshal([]byte(readBody(t, resp)), &replies))
+	assert.Len(t, replies, 2)
+	assert.Equal(t, "3", string(replies[1].ID))
+	assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_chainId"]))
+}
+
+func TestCache_LatestExpiresOnNewBlock(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_getBalance":  {reply(`"0x1"`), reply(`"0x2"`)},
+		"eth_blockNumber": {reply(`"0x10"`), reply(`"0x11"`)},
+	})
+	c := NewCache(CacheConfig{LatestTTL: time.Minute})
+	balance := `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":["0x01","latest"]}`
+	blockNumber := `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+
+	sendThrough(context.Background(), c, server.URL, blockNumber)
+	sendThrough(context.Background(), c, server.URL, balance)
+	resp, _ := sendThrough(context.Background(), c, server.URL, balance)
+	assert.Contains(t, readBody(t, resp), `"0x1"`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_getBalance"]))
+
+	// A new head makes latest answers stale
+	c.SeenBlock(0x11, "0xnew")
+	resp, _ = sendThrough(context.Background(), c, server.URL, balance)
+	assert.Contains(t, readBody(t, resp), `"0x2"`)
+	assert.Equal(t, int32(2), atomic.LoadInt32(counts["eth_getBalance"]))
+}
+
+func TestCache_Reorg(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_getTransactionReceipt": {reply(`{"blockNumber":"0x10","status":"0x1"}`), reply(`{"blockNumber":"0x11","status":"0x1"}`)},
+		"eth_call":                  {reply(`"0xaa"`), reply(`"0xbb"`)},
+	})
+	c := NewCache(CacheConfig{})
+	receipt := `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["0xabc"]}`
+	call := `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x01"},"0x10"]}`
+
+	c.SeenBlock(0x10, "0xold")
+	sendThrough(context.Background(), c, server.URL, receipt)
+	sendThrough(context.Background(), c, server.URL, call)
+	sendThrough(context.Background(), c, server.URL, receipt)
+	sendThrough(context.Background(), c, server.URL, call)
+	assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_getTransactionReceipt"]))
+	assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_call"]))
+
+	// Block 0x10 replaced by another one
+	c.SeenBlock(0x10, "0xnew")
+	resp, _ := sendThrough(context.Background(), c, server.URL, receipt)
+	assert.Contains(t, readBody(t, resp), `"0x11"`)
+	resp, _ = sendThrough(context.Background(), c, server.URL, call)
+	assert.Contains(t, readBody(t, resp), `"0xbb"`)
+}
+
+func TestCache_PrunesOldBlocks(t *testing.T) {
+	server, _ := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_call": {reply(`"0xaa"`)},
+	})
+	c := NewCache(CacheConfig{Store: NewLRUStore(8)})
+
+	for block := 1; block <= 20; block++ {
+		c.SeenBlock(uint64(block), "0x"+strconv.Itoa(block))
+		sendThrough(context.Background(), c, server.URL,
+			`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x01"},"0x`+strconv.FormatInt(int64(block), 16)+`"]}`)
+	}
+	assert.Len(t, c.tagged, 20)
+
+	// Blocks 14 to 20 stay within 256 blocks of the head
+	c.SeenBlock(270, "0x270")
+	assert.Len(t, c.tagged, 7, "blocks below the reorg window are forgotten")
+	assert.Len(t, c.hashes, 8)
+}
+
+func TestLRUStore(t *testing.T) {
+	s := NewLRUStore(2)
+	s.Set("a", []byte("1"))
+	s.Set("b", []byte("2"))
+	s.Get("a")
+	s.Set("c", []byte("3"))
+
+	_, ok := s.Get("b")
+	assert.False(t, ok, "least recently used entry evicted")
+	value, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	assert.Equal(t, 2, s.Len())
+
+	s.Delete("a")
+	assert.Equal(t, 1, s.Len())
+}
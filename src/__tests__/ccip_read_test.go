@@ -0,0 +1,195 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+var offchainContract = common.HexToAddress("0xcc")
+
+// newOffchainNode emulates a token whose name is served by the gateways at urls.
+// The callback returns the gateway answer, or reverts again when loop is set.
+func newOffchainNode(t *testing.T, urls []string, loop bool) *Web3Client {
+	callback := offchainLookupABI.Methods["callback"].ID
+	lookupError := offchainLookupABI.Errors["OffchainLookup"]
+
+	node := startMockNode(t).Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+		var msg struct {
+			To    common.Address `json:"to"`
+			Input hexutil.Bytes  `json:"input"`
+		}
+		json.Unmarshal(params[0], &msg)
+		data := []byte(msg.Input)
+
+		lookup := func() *rpctest.Error {
+			args, _ := lookupError.Inputs.Pack(offchainContract, urls, data, [4]byte(callback), []byte("extra"))
+			return revert(append(lookupError.ID.Bytes()[:4], args...))
+		}
+		switch {
+		case string(data[:4]) == string(erc20ABI.Methods["name"].ID):
+			return nil, lookup()
+		case string(data[:4]) == string(callback):
+			if loop {
+				return nil, lookup()
+			}
+			args, _ := offchainLookupABI.Methods["callback"].Inputs.Unpack(data[4:])
+			assert.Equal(t, []byte("extra"), args[1])
+			return hexutil.Bytes(args[0].([]byte)), nil
+		}
+		return nil, revert(nil)
+	})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	return client
+}
+
+// newGateway answers every lookup with an ABI encoded string, counting the requests
+func newGateway(t *testing.T, status int, answer string, hits *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			var req map[string]string
+			json.Unmarshal(body, &req)
+			assert.Equal(t, strings.ToLower(offchainContract.Hex()), req["sender"])
+			assert.True(t, strings.HasPrefix(req["data"], "0x06fdde03"))
+		}
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		out, _ := erc20ABI.Methods["name"].Outputs.Pack(answer)
+		json.NewEncoder(w).Encode(map[string]string{"data": hexutil.Encode(out)})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCallContract_OffchainLookup(t *testing.T) {
+	var hits int32
+	gateway := newGateway(t, http.StatusOK, "Offchain Token", &hits)
+
+	t.Run("GET through the typed contract path", func(t *testing.T) {
+		client := newOffchainNode(t, []string{gateway.URL + "/{sender}/{data}.json"}, false)
+		name, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "Offchain Token", name)
+	})
+
+	t.Run("POST when the url has no data placeholder", func(t *testing.T) {
+		client := newOffchainNode(t, []string{gateway.URL + "/lookup"}, false)
+		name, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "Offchain Token", name)
+	})
+
+	t.Run("next gateway after a server error", func(t *testing.T) {
+		var failed int32
+		broken := newGateway(t, http.StatusBadGateway, "", &failed)
+		client := newOffchainNode(t, []string{broken.URL + "/{data}", gateway.URL + "/{data}"}, false)
+		name, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "Offchain Token", name)
+		assert.Equal(t, int32(1), failed)
+	})
+
+	t.Run("client error stops the lookup", func(t *testing.T) {
+		var rejected int32
+		rejecting := newGateway(t, http.StatusNotFound, "", &rejected)
+		before := atomic.LoadInt32(&hits)
+		client := newOffchainNode(t, []string{rejecting.URL + "/{data}", gateway.URL + "/{data}"}, false)
+		_, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, before, atomic.LoadInt32(&hits))
+	})
+
+	t.Run("host allowlist", func(t *testing.T) {
+		before := atomic.LoadInt32(&hits)
+		client := newOffchainNode(t, []string{gateway.URL + "/{data}"}, false)
+		client.SetCCIPRead(CCIPConfig{AllowedHosts: []string{"*.ens.domains"}})
+		_, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not allowed")
+		assert.Equal(t, before, atomic.LoadInt32(&hits))
+
+		client.SetCCIPRead(CCIPConfig{AllowedHosts: []string{"127.0.0.1"}})
+		_, err = NewERC20(client, offchainContract).Name(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("recursion limit", func(t *testing.T) {
+		before := atomic.LoadInt32(&hits)
+		client := newOffchainNode(t, []string{gateway.URL + "/{data}"}, true)
+		client.SetCCIPRead(CCIPConfig{MaxRedirects: 2})
+		_, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "too many offchain lookups")
+		assert.Equal(t, before+2, atomic.LoadInt32(&hits))
+	})
+
+	t.Run("redirects stay within the allowlist", func(t *testing.T) {
+		before := atomic.LoadInt32(&hits)
+		target := strings.Replace(gateway.URL, "127.0.0.1", "localhost", 1)
+		redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target+r.URL.Path, http.StatusFound)
+		}))
+		defer redirecting.Close()
+
+		client := newOffchainNode(t, []string{redirecting.URL + "/{data}"}, false)
+		client.SetCCIPRead(CCIPConfig{AllowedHosts: []string{"127.0.0.1"}})
+		_, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not allowed")
+		assert.Equal(t, before, atomic.LoadInt32(&hits))
+
+		client.SetCCIPRead(CCIPConfig{AllowedHosts: []string{"127.0.0.1", "localhost"}})
+		_, err = NewERC20(client, offchainContract).Name(context.Background())
+		assert.NoError(t, err)
+	})
+
+	t.Run("redirect limit", func(t *testing.T) {
+		var redirects int32
+		looping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&redirects, 1)
+			http.Redirect(w, r, r.URL.String(), http.StatusFound)
+		}))
+		defer looping.Close()
+
+		client := newOffchainNode(t, []string{looping.URL + "/{data}"}, false)
+		client.SetCCIPRead(CCIPConfig{MaxRedirects: 2})
+		_, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "redirected more than 2 times")
+		assert.Equal(t, int32(3), atomic.LoadInt32(&redirects))
+	})
+
+	t.Run("response size limit", func(t *testing.T) {
+		client := newOffchainNode(t, []string{gateway.URL + "/{data}"}, false)
+		client.SetCCIPRead(CCIPConfig{MaxResponseSize: 16})
+		_, err := NewERC20(client, offchainContract).Name(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "more than 16 bytes")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client := newOffchainNode(t, []string{gateway.URL + "/{data}"}, false)
+		client.SetCCIPRead(CCIPConfig{Disabled: true})
+		data, _ := erc20ABI.Pack("name")
+		_, err := client.CallContract(context.Background(), ethereum.CallMsg{To: &offchainContract, Data: data}, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,122 @@
+package pyweb3
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// newChainClient connects to a node of chainID with a 10 gwei base fee and a 1 gwei tip
+func newChainClient(t *testing.T, chainID uint64) *Web3Client {
+	node := startMockNode(t).
+		Respond("eth_chainId", hexutil.Uint64(chainID)).
+		Respond("eth_getTransactionCount", "0x3").
+		Respond("eth_estimateGas", "0x7a120").
+		Respond("eth_gasPrice", hexutil.Big(*big.NewInt(5e9))).
+		Respond("eth_maxPriorityFeePerGas", hexutil.Big(*big.NewInt(1e9))).
+		Respond("eth_getBlockByNumber", &types.Header{Number: big.NewInt(100), Difficulty: new(big.Int), BaseFee: big.NewInt(10e9)})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	return client
+}
+
+func TestLookupChain(t *testing.T) {
+	profile, ok := LookupChain(42161)
+	assert.True(t, ok)
+	assert.Equal(t, "Arbitrum One", profile.Name)
+	assert.True(t, profile.Quirks.NodeInterface)
+	assert.Equal(t, "https://arbiscan.io/tx/"+common.Hash{}.Hex(), profile.ExplorerTxURL(common.Hash{}))
+
+	profile, ok = LookupChain(999999)
+	assert.False(t, ok)
+	assert.False(t, profile.Known())
+	assert.False(t, profile.EIP1559)
+	assert.True(t, profile.Quirks.EstimateTransfers)
+
+	RegisterChain(ChainProfile{ChainID: 999999, Name: "Devnet", BlockTime: time.Second, FinalityDepth: 1, EIP1559: true})
+	profile, ok = LookupChain(999999)
+	assert.True(t, ok)
+	assert.Equal(t, "Devnet", profile.Name)
+}
+
+func TestWeb3Client_ChainDetectedOnConnect(t *testing.T) {
+	node := startMockNode(t).Respond("eth_chainId", "0x89")
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, node.Calls("eth_chainId"), "connecting detects the chain")
+
+	for i := 0; i < 2; i++ {
+		chain, err := client.Chain(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(137), chain.ChainID)
+	}
+	assert.Equal(t, 1, node.Calls("eth_chainId"))
+
+	t.Run("unreachable when connecting", func(t *testing.T) {
+		node := startMockNode(t).Respond("eth_chainId", "0x89").DropNext("eth_chainId", 1)
+		client, err := NewWeb3Client(node.URL())
+		assert.NoError(t, err)
+
+		chain, err := client.Chain(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(137), chain.ChainID)
+		assert.Equal(t, 2, node.Calls("eth_chainId"))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		unreachable, err := NewWeb3Client("http://127.0.0.1:1")
+		assert.NoError(t, err)
+		_, err = unreachable.Chain(ctx)
+		assert.ErrorContains(t, err, "failed to detect chain")
+	})
+}
+
+func TestWeb3Client_ChainAwareTransfers(t *testing.T) {
+	from, to := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	ctx := context.Background()
+
+	t.Run("Ethereum", func(t *testing.T) {
+		client := newChainClient(t, 1)
+		chain, err := client.Chain(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "Ethereum", chain.Name)
+
+		tx, err := client.SendTransaction(ctx, from, to, big.NewInt(1))
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(types.DynamicFeeTxType), tx.Type())
+		assert.Equal(t, uint64(21000), tx.Gas())
+		assert.Equal(t, big.NewInt(1e9), tx.GasTipCap())
+		assert.Equal(t, big.NewInt(21e9), tx.GasFeeCap())
+		assert.Equal(t, uint64(3), tx.Nonce())
+	})
+
+	t.Run("Arbitrum estimates transfers and pays no tip", func(t *testing.T) {
+		tx, err := newChainClient(t, 42161).SendTransaction(ctx, from, to, big.NewInt(1))
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(500000), tx.Gas())
+		assert.Equal(t, 0, tx.GasTipCap().Sign())
+		assert.Equal(t, big.NewInt(42161), tx.ChainId())
+	})
+
+	t.Run("Polygon enforces its minimum tip", func(t *testing.T) {
+		tip, _, err := NewGasEstimator(newChainClient(t, 137), 0).SuggestFees(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(30e9), tip)
+	})
+
+	t.Run("BNB Smart Chain uses legacy pricing", func(t *testing.T) {
+		tx, err := newChainClient(t, 56).SendTransaction(ctx, from, to, big.NewInt(1))
+		assert.NoError(t, err)
+		assert.Equal(t, uint8(types.LegacyTxType), tx.Type())
+		assert.Equal(t, big.NewInt(5e9), tx.GasPrice())
+	})
+}
@@ -0,0 +1,196 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// echoBatchServer answers each call with its params, batch replies in reverse order
+func echoBatchServer(t *testing.T, requests, calls *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		body, _ := io.ReadAll(r.Body)
+		msgs, batch, err := decodeRPCMessages(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(calls, int32(len(msgs)))
+
+		replies := make([]*rpcMessage, len(msgs))
+		for i, msg := range msgs {
+			result, _ := json.Marshal(string(msg.Params))
+			replies[len(msgs)-1-i] = &rpcMessage{Version: "2.0", ID: msg.ID, Result: result}
+		}
+		out, _ := encodeRPCMessages(replies, batch)
+		w.Write(out)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDispatcher_MicroBatching(t *testing.T) {
+	var requests, calls int32
+	server := echoBatchServer(t, &requests, &calls)
+	d := NewDispatcher(DispatcherConfig{MaxWait: 50 * time.Millisecond})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := sendThrough(context.Background(), d, server.URL,
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"eth_getBalance","params":["0x%02x","latest"]}`, 100+i, i))
+			assert.NoError(t, err)
+
+			var reply rpcMessage
+			assert.NoError(t, json.Unmarshal([]byte(readBody(t, resp)), &reply))
+			assert.Equal(t, fmt.Sprint(100+i), string(reply.ID))
+			assert.Contains(t, string(reply.Result), fmt.Sprintf("0x%02x", i))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(10), atomic.LoadInt32(&calls))
+}
+
+func TestDispatcher_Coalescing(t *testing.T) {
+	var requests, calls int32
+	server := echoBatchServer(t, &requests, &calls)
+	d := NewDispatcher(DispatcherConfig{MaxWait: 50 * time.Millisecond})
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sendThrough(context.Background(), d, server.URL,
+				`{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x01"},"latest"]}`)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestDispatcher_MaxBatchSize(t *testing.T) {
+	var requests, calls int32
+	server := echoBatchServer(t, &requests, &calls)
+	d := NewDispatcher(DispatcherConfig{MaxBatchSize: 2, MaxWait: time.Second})
+
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := sendThrough(context.Background(), d, server.URL,
+				fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_getCode","params":["0x%02x","latest"]}`, i))
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// Full batches leave without waiting for the window to close
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+}
+
+func TestDispatcher_PassThrough(t *testing.T) {
+	var requests, calls int32
+	server := echoBatchServer(t, &requests, &calls)
+	d := NewDispatcher(DispatcherConfig{})
+
+	for i := 0; i < 2; i++ {
+		_, err := sendThrough(context.Background(), d, server.URL,
+			`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestDispatcher_EndpointError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	d := NewDispatcher(DispatcherConfig{})
+
+	resp, err := sendThrough(context.Background(), d, server.URL,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+// hangingServer never answers until the request is cancelled, which it reports
+func hangingServer(t *testing.T) (*httptest.Server, chan struct{}) {
+	cancelled := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server notices a closed connection once the body is read
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+		cancelled <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return server, cancelled
+}
+
+func TestDispatcher_Timeout(t *testing.T) {
+	server, cancelled := hangingServer(t)
+	d := NewDispatcher(DispatcherConfig{Timeout: 50 * time.Millisecond})
+
+	_, err := sendThrough(context.Background(), d, server.URL,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the batch request was not cancelled")
+	}
+}
+
+func TestDispatcher_CallersGiveUp(t *testing.T) {
+	server, cancelled := hangingServer(t)
+	d := NewDispatcher(DispatcherConfig{MaxWait: 10 * time.Millisecond})
+	call := `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := sendThrough(ctx, d, server.URL, call)
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the batch request outlived its callers")
+	}
+
+	t.Run("later callers get a new batch", func(t *testing.T) {
+		var requests, calls int32
+		up := echoBatchServer(t, &requests, &calls)
+		_, err := sendThrough(context.Background(), d, up.URL, call)
+		assert.NoError(t, err)
+	})
+}
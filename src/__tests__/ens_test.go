@@ -0,0 +1,208 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+var (
+	testRegistry = common.HexToAddress("0xe25")
+	testResolver = common.HexToAddress("0xa1")
+	testWildcard = common.HexToAddress("0xa2")
+)
+
+// ensNode emulates the registry, a plain resolver for exact names and an
+// ENSIP-10 wildcard resolver answering through the gateway
+type ensNode struct {
+	resolvers map[common.Hash]common.Address
+	addrs     map[common.Hash]common.Address
+	names     map[common.Hash]string
+	texts     map[string]string
+	content   []byte
+	gateway   string
+}
+
+func revert(data []byte) *rpctest.Error {
+	return &rpctest.Error{Code: 3, Message: "execution reverted", Data: json.RawMessage(fmt.Sprintf("%q", hexutil.Encode(data)))}
+}
+
+func newENSClient(t *testing.T, node *ensNode) *Web3Client {
+	callback := crypto.Keccak256([]byte("resolveWithProof(bytes,bytes)"))[:4]
+
+	mock := startMockNode(t).Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+		var msg struct {
+			To    common.Address `json:"to"`
+			Input hexutil.Bytes  `json:"input"`
+		}
+		json.Unmarshal(params[0], &msg)
+		data := msg.Input
+		if msg.To == testWildcard && string(data[:4]) == string(callback) {
+			// The gateway answer is trusted as is, a real resolver checks its proof
+			args, _ := offchainLookupABI.Methods["callback"].Inputs.Unpack(data[4:])
+			out, _ := ensABI.Methods["resolve"].Outputs.Pack(args[0])
+			return hexutil.Bytes(out), nil
+		}
+
+		m, err := ensABI.MethodById(data[:4])
+		if err != nil {
+			m, err = erc721ABI.MethodById(data[:4])
+		}
+		if err != nil {
+			return nil, revert(nil)
+		}
+		args, _ := m.Inputs.Unpack(data[4:])
+
+		var out []byte
+		switch {
+		case m.Name == "resolver" && msg.To == testRegistry:
+			out, _ = m.Outputs.Pack(node.resolvers[args[0].([32]byte)])
+		case m.Name == "supportsInterface":
+			out, _ = m.Outputs.Pack(msg.To == testWildcard && args[0].([4]byte) == InterfaceIDExtendedResolver)
+		case m.Name == "resolve" && msg.To == testWildcard:
+			lookup, _ := offchainLookupABI.Errors["OffchainLookup"].Inputs.Pack(
+				testWildcard, []string{node.gateway + "/{sender}/{data}.json"}, []byte(data), [4]byte(callback), []byte{})
+			return nil, revert(append(offchainLookupABI.Errors["OffchainLookup"].ID.Bytes()[:4], lookup...))
+		case m.Name == "addr" && msg.To == testResolver:
+			out, _ = m.Outputs.Pack(node.addrs[args[0].([32]byte)])
+		case m.Name == "name" && msg.To == testResolver:
+			out, _ = m.Outputs.Pack(node.names[args[0].([32]byte)])
+		case m.Name == "text" && msg.To == testResolver:
+			out, _ = m.Outputs.Pack(node.texts[args[1].(string)])
+		case m.Name == "contenthash" && msg.To == testResolver:
+			out, _ = m.Outputs.Pack(node.content)
+		default:
+			return nil, revert(nil)
+		}
+		return hexutil.Bytes(out), nil
+	})
+
+	client, err := NewWeb3Client(mock.URL())
+	assert.NoError(t, err)
+	return client
+}
+
+func TestNormalizeName(t *testing.T) {
+	valid := map[string]string{
+		"Nick.ETH":          "nick.eth",
+		"__sub.vitalik.eth": "__sub.vitalik.eth",
+		"$100.eth":          "$100.eth",
+		"":                  "",
+	}
+	for input, expected := range valid {
+		normalized, err := NormalizeName(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, normalized)
+	}
+
+	for _, input := range []string{"ab--c.eth", "a_b.eth", "a..eth", "a b.eth", "a。b.eth", "́a.eth", "a!.eth", "💩.eth", "é.eth", "ｎick.eth"} {
+		_, err := NormalizeName(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestNameHash(t *testing.T) {
+	assert.Equal(t, common.Hash{}, NameHash(""))
+	assert.Equal(t, common.HexToHash("0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae"), NameHash("eth"))
+	assert.Equal(t, common.HexToHash("0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f"), NameHash("foo.eth"))
+
+	encoded, err := DNSEncode("foo.eth")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("\x03foo\x03eth\x00"), encoded)
+}
+
+func TestENS_Resolve(t *testing.T) {
+	alice := common.HexToAddress("0x0a11ce")
+	reverse := strings.ToLower(alice.Hex()[2:]) + ".addr.reverse"
+	node := &ensNode{
+		resolvers: map[common.Hash]common.Address{NameHash("alice.eth"): testResolver, NameHash(reverse): testResolver},
+		addrs:     map[common.Hash]common.Address{NameHash("alice.eth"): alice},
+		names:     map[common.Hash]string{NameHash(reverse): "alice.eth"},
+		texts:     map[string]string{"url": "https://alice.example"},
+		content:   common.FromHex("0xe3010170122029f2d17be6139079dc48696d1f582a8530eb9805b561eda517e22a892c7e3f1f"),
+	}
+	ens := NewENS(newENSClient(t, node), testRegistry)
+	ctx := context.Background()
+
+	address, err := ens.ResolveName(ctx, "Alice.eth")
+	assert.NoError(t, err)
+	assert.Equal(t, alice, address)
+
+	name, err := ens.LookupAddress(ctx, alice)
+	assert.NoError(t, err)
+	assert.Equal(t, "alice.eth", name)
+
+	url, err := ens.Text(ctx, "alice.eth", "url")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://alice.example", url)
+
+	content, err := ens.ContentHash(ctx, "alice.eth")
+	assert.NoError(t, err)
+	uri, err := ContentHashURI(content)
+	assert.NoError(t, err)
+	assert.Equal(t, "ipfs://bafybeibj6lixxzqtsb45ysdjnupvqkufgdvzqbnvmhw2kf7cfkesy7r7d4", uri)
+
+	_, err = ens.ResolveName(ctx, "bob.eth")
+	assert.True(t, errors.Is(err, ErrNoResolver))
+
+	t.Run("reverse record not resolving back", func(t *testing.T) {
+		node.addrs[NameHash("alice.eth")] = common.HexToAddress("0xb0b")
+		_, err := ens.LookupAddress(ctx, alice)
+		assert.Equal(t, ErrReverseMismatch, err)
+		node.addrs[NameHash("alice.eth")] = alice
+	})
+}
+
+func TestENS_WildcardCCIPRead(t *testing.T) {
+	sub := common.HexToAddress("0x5b")
+	var requested string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		out, _ := ensABI.Methods["addr"].Outputs.Pack(sub)
+		json.NewEncoder(w).Encode(map[string]string{"data": hexutil.Encode(out)})
+	}))
+	defer gateway.Close()
+
+	node := &ensNode{
+		resolvers: map[common.Hash]common.Address{NameHash("wild.eth"): testWildcard},
+		gateway:   gateway.URL,
+	}
+	client := newENSClient(t, node)
+	ens := NewENS(client, testRegistry)
+
+	address, err := ens.ResolveName(context.Background(), "anything.wild.eth")
+	assert.NoError(t, err)
+	assert.Equal(t, sub, address)
+	assert.True(t, strings.HasPrefix(requested, "/"+strings.ToLower(testWildcard.Hex())+"/0x9061b923"))
+
+	t.Run("address-taking APIs accept names once opted in", func(t *testing.T) {
+		_, err := client.ResolveAddress(context.Background(), "anything.wild.eth")
+		assert.Error(t, err)
+
+		client.SetNameResolver(ens)
+		address, err := client.ResolveAddress(context.Background(), "anything.wild.eth")
+		assert.NoError(t, err)
+		assert.Equal(t, sub, address)
+
+		transfers, err := NewBatchProcessor(client, 10, 2).ResolveTransfers(context.Background(), map[string]*big.Int{
+			"anything.wild.eth":                          big.NewInt(1),
+			"0x0000000000000000000000000000000000000001": big.NewInt(2),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, big.NewInt(1), transfers[sub])
+		assert.Equal(t, big.NewInt(2), transfers[common.HexToAddress("0x01")])
+	})
+}
@@ -0,0 +1,201 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// tokenNode emulates a node hosting an ERC-20 token answering calls by selector
+type tokenNode struct {
+	mutex     sync.Mutex
+	outputs   map[string][]byte
+	allowance *big.Int
+	sent      []*types.Transaction
+}
+
+func newTokenNode(t *testing.T) (*tokenNode, *Web3Client) {
+	node := &tokenNode{outputs: make(map[string][]byte), allowance: new(big.Int)}
+	mock := startMockNode(t).
+		Respond("eth_chainId", "0x1").
+		Handle("eth_getTransactionCount", func([]json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			return hexutil.Uint64(len(node.sent)), nil
+		}).
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			var msg struct {
+				Data  hexutil.Bytes `json:"data"`
+				Input hexutil.Bytes `json:"input"`
+			}
+			json.Unmarshal(params[0], &msg)
+			data := msg.Input
+			if len(data) == 0 {
+				data = msg.Data
+			}
+			m, err := erc20ABI.MethodById(data[:4])
+			if err != nil {
+				return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+			}
+			if m.Name == "allowance" {
+				out, _ := m.Outputs.Pack(node.allowance)
+				return hexutil.Bytes(out), nil
+			}
+			out, ok := node.outputs[m.Name]
+			if !ok {
+				return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+			}
+			return hexutil.Bytes(out), nil
+		}).
+		Handle("eth_sendRawTransaction", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			var raw hexutil.Bytes
+			json.Unmarshal(params[0], &raw)
+			tx := new(types.Transaction)
+			tx.UnmarshalBinary(raw)
+			node.sent = append(node.sent, tx)
+			return tx.Hash(), nil
+		})
+
+	client, err := NewWeb3Client(mock.URL())
+	assert.NoError(t, err)
+	return node, client
+}
+
+func (n *tokenNode) set(method string, values ...interface{}) {
+	out, _ := erc20ABI.Methods[method].Outputs.Pack(values...)
+	n.outputs[method] = out
+}
+
+func TestERC20_Reads(t *testing.T) {
+	node, client := newTokenNode(t)
+	node.set("name", "USD Coin")
+	node.set("decimals", uint8(6))
+	node.set("balanceOf", big.NewInt(2500000))
+	// MKR style bytes32 symbol
+	symbol := make([]byte, 32)
+	copy(symbol, "MKR")
+	node.outputs["symbol"] = symbol
+
+	token := NewERC20(client, common.HexToAddress("0x1000"))
+	ctx := context.Background()
+
+	name, err := token.Name(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "USD Coin", name)
+
+	sym, err := token.Symbol(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "MKR", sym)
+
+	decimals, err := token.Decimals(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(6), decimals)
+
+	balance, err := token.BalanceOf(ctx, common.HexToAddress("0x01"))
+	assert.NoError(t, err)
+	amount, err := token.Amount(ctx, balance)
+	assert.NoError(t, err)
+	assert.Equal(t, "2.5", amount.String())
+
+	parsed, err := token.ParseAmount(ctx, "0.75")
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(750000), parsed.BaseUnits())
+}
+
+func TestERC20_SafeApprove(t *testing.T) {
+	node, client := newTokenNode(t)
+	token := NewERC20(client, common.HexToAddress("0x1000"))
+	spender := common.HexToAddress("0x2000")
+
+	key, _ := crypto.GenerateKey()
+	opts, _ := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1))
+	opts.GasLimit = 60000
+	opts.GasPrice = big.NewInt(1e9)
+
+	t.Run("from zero", func(t *testing.T) {
+		txs, err := token.SafeApprove(context.Background(), opts, spender, big.NewInt(100))
+		assert.NoError(t, err)
+		assert.Len(t, txs, 1)
+	})
+
+	t.Run("reset first", func(t *testing.T) {
+		node.allowance = big.NewInt(100)
+		txs, err := token.SafeApprove(context.Background(), opts, spender, big.NewInt(200))
+		assert.NoError(t, err)
+		assert.Len(t, txs, 2)
+		assert.Equal(t, txs[0].Nonce()+1, txs[1].Nonce())
+
+		args, _ := erc20ABI.Methods["approve"].Inputs.Unpack(txs[0].Data()[4:])
+		assert.Equal(t, 0, args[1].(*big.Int).Sign())
+		args, _ = erc20ABI.Methods["approve"].Inputs.Unpack(txs[1].Data()[4:])
+		assert.Equal(t, big.NewInt(200), args[1])
+	})
+}
+
+func TestERC20_SignPermit(t *testing.T) {
+	node, client := newTokenNode(t)
+	node.set("name", "Permit Token")
+	node.set("nonces", big.NewInt(3))
+	tokenAddress := common.HexToAddress("0x1000")
+	token := NewERC20(client, tokenAddress)
+
+	key, _ := crypto.GenerateKey()
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+	spender := common.HexToAddress("0x2000")
+	value, deadline := big.NewInt(1000), big.NewInt(1700000000)
+
+	// EIP-712 digest computed by hand from the EIP-2612 definitions
+	uint256, _ := abi.NewType("uint256", "", nil)
+	bytes32, _ := abi.NewType("bytes32", "", nil)
+	address, _ := abi.NewType("address", "", nil)
+	domainArgs := abi.Arguments{{Type: bytes32}, {Type: bytes32}, {Type: bytes32}, {Type: uint256}, {Type: address}}
+	domain, _ := domainArgs.Pack(
+		crypto.Keccak256Hash([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)")),
+		crypto.Keccak256Hash([]byte("Permit Token")),
+		crypto.Keccak256Hash([]byte("1")),
+		big.NewInt(1),
+		tokenAddress,
+	)
+	domainSeparator := crypto.Keccak256(domain)
+	node.outputs["DOMAIN_SEPARATOR"] = domainSeparator
+
+	permit, err := token.SignPermit(context.Background(), key, spender, value, deadline, "")
+	assert.NoError(t, err)
+	assert.Equal(t, owner, permit.Owner)
+	assert.Equal(t, big.NewInt(3), permit.Nonce)
+
+	structArgs := abi.Arguments{{Type: bytes32}, {Type: address}, {Type: address}, {Type: uint256}, {Type: uint256}, {Type: uint256}}
+	structData, _ := structArgs.Pack(
+		crypto.Keccak256Hash([]byte("Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)")),
+		owner, spender, value, big.NewInt(3), deadline,
+	)
+	digest := crypto.Keccak256(append(append([]byte{0x19, 0x01}, domainSeparator...), crypto.Keccak256(structData)...))
+
+	sig := append(append(permit.R[:], permit.S[:]...), permit.V-27)
+	pub, err := crypto.SigToPub(digest, sig)
+	assert.NoError(t, err)
+	assert.Equal(t, owner, crypto.PubkeyToAddress(*pub))
+
+	t.Run("domain mismatch", func(t *testing.T) {
+		node.outputs["DOMAIN_SEPARATOR"], _ = hex.DecodeString("00" + hex.EncodeToString(domainSeparator[1:]))
+		_, err := token.SignPermit(context.Background(), key, spender, value, deadline, "")
+		assert.Error(t, err)
+	})
+}
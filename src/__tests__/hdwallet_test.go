@@ -0,0 +1,85 @@
+package pyweb3
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hardhatMnemonic is the well known mnemonic of the Hardhat and Anvil test accounts
+const hardhatMnemonic = "test test test test test test test test test test test junk"
+
+func TestHDWallet(t *testing.T) {
+	wallet, err := NewHDWallet(hardhatMnemonic, "")
+	require.NoError(t, err)
+
+	t.Run("bip44 accounts", func(t *testing.T) {
+		expected := []string{
+			"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266",
+			"0x70997970C51812dc3A010C7d01b50e0d17dc79C8",
+			"0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC",
+		}
+		for i, address := range expected {
+			signer, err := wallet.Account(uint32(i))
+			require.NoError(t, err)
+			assert.Equal(t, common.HexToAddress(address), signer.Address(), "account %d", i)
+			signer.Zero()
+		}
+		assert.Equal(t, "m/44'/60'/0'/0/2", AccountPath(2).String())
+		assert.Equal(t, "m/44'/60'/0'/0/0", accounts.DefaultBaseDerivationPath.String(), "the default path is not modified")
+	})
+
+	t.Run("private key", func(t *testing.T) {
+		path, err := accounts.ParseDerivationPath("m/44'/60'/0'/0/0")
+		require.NoError(t, err)
+		key, err := deriveKey(wallet.seed, path)
+		require.NoError(t, err)
+		assert.Equal(t, "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80", common.Bytes2Hex(crypto.FromECDSA(key)))
+	})
+
+	t.Run("passphrase changes the seed", func(t *testing.T) {
+		salted, err := NewHDWallet(hardhatMnemonic, "extra")
+		require.NoError(t, err)
+		signer, err := salted.Account(0)
+		require.NoError(t, err)
+		assert.NotEqual(t, common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), signer.Address())
+	})
+
+	t.Run("signs", func(t *testing.T) {
+		signer, err := wallet.Account(5)
+		require.NoError(t, err)
+		assertSigns(t, signer)
+	})
+
+	t.Run("zero", func(t *testing.T) {
+		seed := wallet.seed
+		wallet.Zero()
+		assert.Equal(t, make([]byte, len(seed)), seed)
+		_, err := wallet.Account(0)
+		assert.ErrorIs(t, err, ErrWalletZeroed)
+	})
+}
+
+func TestNewMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic(128)
+	require.NoError(t, err)
+	assert.Len(t, strings.Fields(mnemonic), 12)
+	_, err = NewHDWallet(mnemonic, "")
+	assert.NoError(t, err)
+
+	mnemonic, err = NewMnemonic(256)
+	require.NoError(t, err)
+	assert.Len(t, strings.Fields(mnemonic), 24)
+
+	_, err = NewMnemonic(100)
+	assert.Error(t, err)
+
+	// A word changed breaks the checksum
+	_, err = NewHDWallet(strings.Replace(hardhatMnemonic, "junk", "test", 1), "")
+	assert.ErrorContains(t, err, "invalid mnemonic")
+}
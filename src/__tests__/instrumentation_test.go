@@ -0,0 +1,209 @@
+package pyweb3
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordedRequest is a request seen by a recordingInstrumentation
+type recordedRequest struct {
+	info    RequestInfo
+	outcome *RequestOutcome
+}
+
+// recordingInstrumentation keeps everything it is told
+type recordingInstrumentation struct {
+	mutex       sync.Mutex
+	requests    []*recordedRequest
+	batches     map[string]int
+	connections map[string]int
+	subs        map[string]int
+	reconnects  map[string]int
+}
+
+func newRecordingInstrumentation() *recordingInstrumentation {
+	return &recordingInstrumentation{
+		batches:     make(map[string]int),
+		connections: make(map[string]int),
+		subs:        make(map[string]int),
+		reconnects:  make(map[string]int),
+	}
+}
+
+func (r *recordingInstrumentation) StartRequest(ctx context.Context, request RequestInfo) (context.Context, func(RequestOutcome)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	recorded := &recordedRequest{info: request}
+	r.requests = append(r.requests, recorded)
+	return ctx, func(outcome RequestOutcome) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		recorded.outcome = &outcome
+	}
+}
+
+func (r *recordingInstrumentation) BatchSize(ctx context.Context, operation string, size int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.batches[operation] += size
+}
+
+func (r *recordingInstrumentation) Connections(endpoint string, delta int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.connections[endpoint] += delta
+}
+
+func (r *recordingInstrumentation) Subscriptions(kind string, delta int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.subs[kind] += delta
+}
+
+func (r *recordingInstrumentation) subscribed(kind string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.subs[kind]
+}
+
+func (r *recordingInstrumentation) Reconnect(endpoint string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reconnects[endpoint]++
+}
+
+func (r *recordingInstrumentation) open(endpoint string) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.connections[endpoint]
+}
+
+func TestJSONRPCClient_Instrumentation(t *testing.T) {
+	ctx := context.Background()
+	node := startMockNode(t).
+		Respond("eth_blockNumber", "0x10").
+		Fail("eth_call", 3, "execution reverted")
+	rec := newRecordingInstrumentation()
+	client := NewJSONRPCClient(node.URL(), "", 0)
+	client.Instrumentation = rec
+	host := strings.TrimPrefix(node.URL(), "http://")
+
+	var head hexutil.Uint64
+	require.NoError(t, client.CallContext(ctx, &head, "eth_blockNumber"))
+	assert.Error(t, client.CallContext(ctx, nil, "eth_call"))
+	require.NoError(t, client.BatchCallContext(ctx, []rpc.BatchElem{
+		{Method: "eth_blockNumber", Result: &head},
+		{Method: "eth_call"},
+	}))
+
+	require.Len(t, rec.requests, 3)
+	assert.Equal(t, RequestInfo{Method: "eth_blockNumber", Endpoint: host, RequestID: "1", BatchSize: 1}, rec.requests[0].info)
+	require.NotNil(t, rec.requests[0].outcome)
+	assert.Empty(t, rec.requests[0].outcome.ErrorCodes())
+	assert.Positive(t, rec.requests[0].outcome.Latency)
+
+	assert.Equal(t, "eth_call", rec.requests[1].info.Method)
+	assert.Equal(t, []string{"3"}, rec.requests[1].outcome.ErrorCodes())
+
+	assert.Equal(t, RequestInfo{Method: "batch", Endpoint: host, BatchSize: 2}, rec.requests[2].info)
+	assert.Nil(t, rec.requests[2].outcome.Err)
+	assert.Equal(t, []string{"3"}, rec.requests[2].outcome.ErrorCodes())
+
+	unreachable := NewJSONRPCClient("http://127.0.0.1:1/v3/key", "", 0)
+	unreachable.Instrumentation = rec
+	assert.Error(t, unreachable.CallContext(ctx, &head, "eth_blockNumber"))
+	require.Len(t, rec.requests, 4)
+	assert.Equal(t, []string{"transport"}, rec.requests[3].outcome.ErrorCodes())
+	assert.NotContains(t, rec.requests[3].outcome.Err.Error(), "/v3/key")
+}
+
+func TestInstrumentation_Defaults(t *testing.T) {
+	assert.Equal(t, NopInstrumentation{}, instrumentationOr(nil))
+
+	rec, other := newRecordingInstrumentation(), newRecordingInstrumentation()
+	SetDefaultInstrumentation(MultiInstrumentation(rec, other))
+	t.Cleanup(func() { SetDefaultInstrumentation(nil) })
+
+	node := startMockNode(t).Respond("eth_blockNumber", "0x10")
+	var head hexutil.Uint64
+	require.NoError(t, NewJSONRPCClient(node.URL(), "", 0).CallContext(context.Background(), &head, "eth_blockNumber"))
+	assert.Len(t, rec.requests, 1)
+	assert.Len(t, other.requests, 1)
+	assert.NotNil(t, other.requests[0].outcome)
+
+	SetDefaultInstrumentation(nil)
+	assert.Equal(t, NopInstrumentation{}, instrumentationOr(nil))
+}
+
+func TestBatchProcessor_Instrumentation(t *testing.T) {
+	mockClient := new(MockWeb3Client)
+	bp := NewBatchProcessor(mockClient, 10, 2)
+	rec := newRecordingInstrumentation()
+	bp.SetInstrumentation(rec)
+
+	from := common.HexToAddress("0x1234")
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil)
+	mockClient.On("SendTransaction", from, common.HexToAddress("0x5678"), big.NewInt(1000)).Return(tx, nil)
+	mockClient.On("SendTransaction", from, common.HexToAddress("0x9abc"), big.NewInt(2000)).Return(tx, nil)
+	bp.BatchTransfer(context.Background(), from, map[common.Address]*big.Int{
+		common.HexToAddress("0x5678"): big.NewInt(1000),
+		common.HexToAddress("0x9abc"): big.NewInt(2000),
+	})
+	assert.Equal(t, map[string]int{"transfer": 2}, rec.batches)
+}
+
+func TestWebSocketClient_Instrumentation(t *testing.T) {
+	wsURL, tlsConfig := newGreetingNode(t, "established")
+	rec := newRecordingInstrumentation()
+	SetDefaultInstrumentation(rec)
+	t.Cleanup(func() { SetDefaultInstrumentation(nil) })
+
+	client, err := NewWebSocketClientWithTLS(wsURL, "test-agent", tlsConfig)
+	require.NoError(t, err)
+	endpoint := strings.TrimPrefix(wsURL, "wss://")
+	assert.Equal(t, 1, rec.open(endpoint))
+
+	require.NoError(t, client.Reconnect())
+	assert.Equal(t, 1, rec.reconnects[endpoint])
+	assert.Eventually(t, func() bool { return rec.open(endpoint) == 1 }, time.Second, 10*time.Millisecond)
+
+	client.Conn.Close()
+	assert.Eventually(t, func() bool { return rec.open(endpoint) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWeb3Client_SubscriptionInstrumentation(t *testing.T) {
+	node := startMockNode(t).
+		Respond("eth_chainId", "0x1").
+		Respond("eth_subscribe", "0x9cef478923ff08bf67fde6c64013158d").
+		Respond("eth_unsubscribe", true)
+	client, err := NewWeb3Client(node.WSURL())
+	require.NoError(t, err)
+	defer client.Close()
+	rec := newRecordingInstrumentation()
+	client.SetInstrumentation(rec)
+
+	ctx := context.Background()
+	first, err := client.SubscribeFilterLogs(ctx, ethereum.FilterQuery{}, make(chan types.Log))
+	require.NoError(t, err)
+	_, second, err := client.WatchEvents(ctx, common.HexToAddress("0x01"), common.HexToHash("0x02"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, rec.subscribed("logs"))
+
+	first.Unsubscribe()
+	first.Unsubscribe()
+	assert.Equal(t, 1, rec.subscribed("logs"))
+	second.Unsubscribe()
+	assert.Equal(t, 0, rec.subscribed("logs"))
+}
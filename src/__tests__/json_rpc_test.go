@@ -1,49 +1,43 @@
-package jsonrpc
+package pyweb3
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"net/http"
-	"net/http/httptest"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestJSONRPCRequest(t *testing.T) {
 	tests := []struct {
-		name           string
-		method         string
-		params         interface{}
-		expectedID     int64
-		expectedError  bool
-		expectedStatus int
+		name     string
+		method   string
+		params   interface{}
+		id       string
+		expected string
 	}{
 		{
-			name:           "valid request",
-			method:         "test_method",
-			params:         map[string]string{"key": "value"},
-			expectedID:     1,
-			expectedError:  false,
-			expectedStatus: http.StatusOK,
+			name:     "with params",
+			method:   "test_method",
+			params:   map[string]string{"key": "value"},
+			id:       "1",
+			expected: `{"jsonrpc":"2.0","method":"test_method","params":{"key":"value"},"id":"1"}`,
 		},
 		{
-			name:           "empty method",
-			method:         "",
-			params:         nil,
-			expectedID:     1,
-			expectedError:  true,
-			expectedStatus: http.StatusBadRequest,
+			name:     "without params",
+			method:   "eth_blockNumber",
+			params:   nil,
+			id:       "2",
+			expected: `{"jsonrpc":"2.0","method":"eth_blockNumber","params":null,"id":"2"}`,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req := NewRequest(tt.method, tt.params)
-			assert.Equal(t, "2.0", req.Version)
-			assert.Equal(t, tt.method, req.Method)
-			assert.Equal(t, tt.params, req.Params)
-			assert.NotZero(t, req.ID)
+			req, err := CreateJSONRPCRequest(tt.method, tt.params, tt.id)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.expected, req)
 		})
 	}
 }
@@ -51,87 +45,94 @@ func TestJSONRPCRequest(t *testing.T) {
 func TestJSONRPCResponse(t *testing.T) {
 	tests := []struct {
 		name     string
+		response string
+		id       string
 		result   interface{}
-		err      *Error
-		expected Response
+		err      string
 	}{
 		{
-			name:   "success response",
-			result: "test result",
-			err:    nil,
-			expected: Response{
-				Version: "2.0",
-				Result:  "test result",
-				Error:   nil,
-				ID:      1,
-			},
+			name:     "success response",
+			response: `{"jsonrpc":"2.0","id":"1","result":"test result"}`,
+			id:       "1",
+			result:   "test result",
+		},
+		{
+			name:     "error response",
+			response: `{"jsonrpc":"2.0","id":"1","error":{"code":-32600,"message":"Invalid Request"}}`,
+			err:      "JSON-RPC Error",
+		},
+		{
+			name:     "not JSON-RPC 2.0",
+			response: `{"jsonrpc":"1.0","id":"1","result":"test result"}`,
+			err:      "server is not JSONRPC 2.0",
 		},
 		{
-			name:   "error response",
-			result: nil,
-			err:    &Error{Code: -32600, Message: "Invalid Request"},
-			expected: Response{
-				Version: "2.0",
-				Result:  nil,
-				Error:   &Error{Code: -32600, Message: "Invalid Request"},
-				ID:      1,
-			},
+			name:     "missing result",
+			response: `{"jsonrpc":"2.0","id":"1"}`,
+			err:      "missing required fields",
+		},
+		{
+			name:     "not JSON",
+			response: `bad gateway`,
+			err:      "not JSON response",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resp := NewResponse(1, tt.result, tt.err)
-			assert.Equal(t, tt.expected.Version, resp.Version)
-			assert.Equal(t, tt.expected.Result, resp.Result)
-			assert.Equal(t, tt.expected.Error, resp.Error)
-			assert.Equal(t, tt.expected.ID, resp.ID)
+			id, result, err := jsonRPCUnpack([]byte(tt.response))
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.id, id)
+			assert.Equal(t, tt.result, result)
 		})
 	}
 }
 
-func TestJSONRPCHandler(t *testing.T) {
-	handler := func(params interface{}) (interface{}, *Error) {
-		return "success", nil
-	}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		HandleFunc(w, r, handler)
-	}))
-	defer server.Close()
+func TestJSONRPCClient_Calls(t *testing.T) {
+	node := startMockNode(t).
+		Respond("eth_blockNumber", "0x10").
+		Fail("eth_getBalance", -32602, "invalid argument").
+		Handle("test_echo", func(params []json.RawMessage) (interface{}, error) {
+			return params, nil
+		})
+	client := NewJSONRPCClient(node.URL(), DEFAULT_USER_AGENT, 0)
+	ctx := context.Background()
 
-	tests := []struct {
-		name           string
-		request        Request
-		expectedStatus int
-		expectedResult string
-	}{
-		{
-			name: "valid request",
-			request: Request{
-				Version: "2.0",
-				Method:  "test_method",
-				Params:  map[string]string{"key": "value"},
-				ID:      1,
-			},
-			expectedStatus: http.StatusOK,
-			expectedResult: "success",
-		},
-	}
+	t.Run("call", func(t *testing.T) {
+		var number string
+		assert.NoError(t, client.CallContext(ctx, &number, "eth_blockNumber"))
+		assert.Equal(t, "0x10", number)
+	})
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(tt.request)
-			assert.NoError(t, err)
+	t.Run("call error", func(t *testing.T) {
+		err := client.CallContext(ctx, nil, "eth_getBalance", "0x0", "latest")
+		var rpcErr *RPCError
+		if assert.ErrorAs(t, err, &rpcErr) {
+			assert.Equal(t, -32602, rpcErr.Code)
+		}
+	})
 
-			resp, err := http.Post(server.URL, "application/json", bytes.NewBuffer(reqBody))
-			assert.NoError(t, err)
-			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+	t.Run("batch", func(t *testing.T) {
+		var number string
+		var echo []string
+		batch := []rpc.BatchElem{
+			{Method: "eth_blockNumber", Result: &number},
+			{Method: "test_echo", Args: []interface{}{"a", "b"}, Result: &echo},
+			{Method: "eth_getBalance", Args: []interface{}{"0x0", "latest"}},
+		}
+		assert.NoError(t, client.BatchCallContext(ctx, batch))
+		assert.NoError(t, batch[0].Error)
+		assert.Equal(t, "0x10", number)
+		assert.NoError(t, batch[1].Error)
+		assert.Equal(t, []string{"a", "b"}, echo)
+		assert.Error(t, batch[2].Error)
+	})
 
-			var response Response
-			err = json.NewDecoder(resp.Body).Decode(&response)
-			assert.NoError(t, err)
-			assert.Equal(t, tt.expectedResult, response.Result)
-		})
-	}
+	t.Run("unknown method", func(t *testing.T) {
+		assert.Error(t, client.CallContext(ctx, nil, "eth_unknown"))
+	})
 }
@@ -0,0 +1,101 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// newRollupClient connects to a rollup node with a 0.1 gwei base fee whose
+// L1 fee oracle charges 5000 gwei and whose NodeInterface reports 80000 gas,
+// 30000 of it for L1
+func newRollupClient(t *testing.T, chainID uint64) *Web3Client {
+	node := startMockNode(t).
+		Respond("eth_chainId", hexutil.Uint64(chainID)).
+		Respond("eth_getTransactionCount", "0x0").
+		Respond("eth_estimateGas", "0xc350").
+		Respond("eth_maxPriorityFeePerGas", hexutil.Big(*big.NewInt(1e6))).
+		Respond("eth_getBlockByNumber", &types.Header{Number: big.NewInt(100), Difficulty: new(big.Int), BaseFee: big.NewInt(1e8)}).
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			var msg struct {
+				To    common.Address `json:"to"`
+				Input hexutil.Bytes  `json:"input"`
+			}
+			json.Unmarshal(params[0], &msg)
+			m, err := l2FeeABI.MethodById(msg.Input[:4])
+			if err != nil {
+				return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+			}
+			var out []byte
+			switch {
+			case m.Name == "getL1Fee" && msg.To == common.HexToAddress("0x420000000000000000000000000000000000000F"):
+				args, _ := m.Inputs.Unpack(msg.Input[4:])
+				tx := new(types.Transaction)
+				assert.NoError(t, tx.UnmarshalBinary(args[0].([]byte)))
+				out, _ = m.Outputs.Pack(big.NewInt(5000e9))
+			case m.Name == "gasEstimateComponents" && msg.To == ArbitrumNodeInterface:
+				out, _ = m.Outputs.Pack(uint64(80000), uint64(30000), big.NewInt(1e8), big.NewInt(20e9))
+			default:
+				return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+			}
+			return hexutil.Bytes(out), nil
+		})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	return client
+}
+
+func TestGasEstimator_EstimateFees(t *testing.T) {
+	ctx := context.Background()
+	from, to := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	transfer := types.NewTx(&types.DynamicFeeTx{To: &to, Value: big.NewInt(1), Gas: 21000})
+
+	t.Run("OP Stack adds the L1 data fee", func(t *testing.T) {
+		fees, err := NewGasEstimator(newRollupClient(t, 10), 0).EstimateFees(ctx, from, transfer)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(21000), fees.ExecutionGas)
+		// 0.1 gwei base fee and 0.001 gwei tip
+		assert.Equal(t, big.NewInt(101e6), fees.GasPrice)
+		assert.Equal(t, big.NewInt(21000*101e6), fees.ExecutionFee)
+		assert.Equal(t, big.NewInt(5000e9), fees.L1DataFee)
+		assert.Equal(t, new(big.Int).Add(fees.ExecutionFee, fees.L1DataFee), fees.Total)
+	})
+
+	t.Run("Arbitrum splits the gas estimate", func(t *testing.T) {
+		fees, err := NewGasEstimator(newRollupClient(t, 42161), 10).EstimateFees(ctx, from, transfer)
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(50000), fees.ExecutionGas)
+		assert.Equal(t, uint64(30000), fees.L1Gas)
+		assert.Equal(t, uint64(88000), fees.GasLimit)
+		assert.Equal(t, big.NewInt(30000*1e8), fees.L1DataFee)
+		assert.Equal(t, big.NewInt(80000*1e8), fees.Total)
+	})
+
+	t.Run("no L1 fee on L1", func(t *testing.T) {
+		fees, err := NewGasEstimator(newRollupClient(t, 1), 0).EstimateFees(ctx, from, types.NewTx(&types.DynamicFeeTx{To: &to}))
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(50000), fees.ExecutionGas)
+		assert.Equal(t, 0, fees.L1DataFee.Sign())
+		assert.Equal(t, fees.ExecutionFee, fees.Total)
+	})
+}
+
+func TestBatchProcessor_EstimateTransferFees(t *testing.T) {
+	bp := NewBatchProcessor(newRollupClient(t, 8453), 10, 2)
+	fees, total, err := bp.EstimateTransferFees(context.Background(), common.HexToAddress("0x01"), map[common.Address]*big.Int{
+		common.HexToAddress("0x02"): big.NewInt(1),
+		common.HexToAddress("0x03"): big.NewInt(2),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, fees, 2)
+	assert.Equal(t, new(big.Int).Mul(fees[common.HexToAddress("0x02")].Total, big.NewInt(2)), total)
+}
@@ -1,33 +1,26 @@
-package pyweb3_test
+package pyweb3
 
 import (
-	"errors"
-	"math/big"
 	"testing"
 
-	web3client "web3-rpc-client/src"
-
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestClientInitialization(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	mockClient := web3client.NewMockWeb3Client(ctrl)
+	node := startMockNode(t).Respond("eth_chainId", "0x1")
 
-	_, err := web3client.NewWeb3Client("https://...")
+	client, err := NewWeb3Client(node.URL())
 	assert.NoError(t, err, "Client should initialize without error")
+	defer client.Close()
+	assert.NotNil(t, client.Transport())
 }
 
 func TestBatchProcessorInitialization(t *testing.T) {
-	ctrl := gomock.NewController(t)
-	defer ctrl.Finish()
-
-	mockClient := web3client.NewMockWeb3Client(ctrl)
+	node := startMockNode(t).Respond("eth_chainId", "0x1")
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	defer client.Close()
 
-	batchProcessor := web3client.NewBatchProcessor(mockClient, 10, 5)
+	batchProcessor := NewBatchProcessor(client, 10, 5)
 	assert.NotNil(t, batchProcessor, "BatchProcessor should initialize correctly")
 }
@@ -0,0 +1,13 @@
+package pyweb3
+
+import (
+	"testing"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+func startMockNode(t *testing.T) *rpctest.MockNode {
+	node := rpctest.NewMockNode()
+	t.Cleanup(node.Close)
+	return node
+}
@@ -0,0 +1,146 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/stretchr/testify/assert"
+)
+
+const balanceOfABI = `[{"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+
+func TestMulticall_Split(t *testing.T) {
+	m := NewMulticall(nil, Multicall3Address).SetLimits(250000, DefaultMulticallCalldata)
+	calls := make([]Call3, 5)
+	chunks := m.split(calls)
+	assert.Len(t, chunks, 3)
+	assert.Len(t, chunks[0], 2)
+	assert.Len(t, chunks[2], 1)
+
+	m.SetLimits(DefaultMulticallGas, 400)
+	calls = []Call3{{CallData: make([]byte, 100)}, {CallData: make([]byte, 100)}, {CallData: make([]byte, 100)}}
+	assert.Len(t, m.split(calls), 3)
+}
+
+func TestMulticall_Aggregate3(t *testing.T) {
+	erc20, _ := abi.JSON(strings.NewReader(balanceOfABI))
+	token := common.HexToAddress("0x1000")
+	holders := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02")}
+
+	var aggregateCalls int32
+	node := startMockNode(t).
+		Respond("eth_getCode", "0x6080").
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			atomic.AddInt32(&aggregateCalls, 1)
+			var msg struct {
+				To   common.Address `json:"to"`
+				Data hexutil.Bytes  `json:"data"`
+			}
+			json.Unmarshal(params[0], &msg)
+			assert.Equal(t, Multicall3Address, msg.To)
+
+			first, _ := erc20.Methods["balanceOf"].Outputs.Pack(big.NewInt(42))
+			out, _ := multicallABI.Methods["aggregate3"].Outputs.Pack([]multicall3Result{
+				{Success: true, ReturnData: first},
+				{Success: false, ReturnData: nil},
+			})
+			return hexutil.Bytes(out), nil
+		})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+
+	calls := make([]Call3, len(holders))
+	for i, holder := range holders {
+		calls[i], err = NewCall3(token, &erc20, "balanceOf", true, holder)
+		assert.NoError(t, err)
+	}
+
+	results, err := NewMulticall(client, Multicall3Address).Aggregate(context.Background(), calls, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.True(t, results[0].Success)
+	assert.Equal(t, big.NewInt(42), results[0].Values[0])
+	assert.False(t, results[1].Success)
+	assert.Error(t, results[1].Error)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&aggregateCalls))
+}
+
+func TestMulticall_Fallback(t *testing.T) {
+	erc20, _ := abi.JSON(strings.NewReader(balanceOfABI))
+	token := common.HexToAddress("0x1000")
+
+	node := startMockNode(t).
+		Respond("eth_getCode", "0x").
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			var block string
+			json.Unmarshal(params[1], &block)
+			assert.Equal(t, "0x64", block)
+			out, _ := erc20.Methods["balanceOf"].Outputs.Pack(big.NewInt(7))
+			return hexutil.Bytes(out), nil
+		})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+
+	call, _ := NewCall3(token, &erc20, "balanceOf", false, common.HexToAddress("0x01"))
+	results, err := NewMulticall(client, Multicall3Address).Aggregate(context.Background(), []Call3{call, call}, big.NewInt(100))
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, big.NewInt(7), results[1].Values[0])
+}
+
+func TestMulticall_FallbackBatches(t *testing.T) {
+	erc20, _ := abi.JSON(strings.NewReader(balanceOfABI))
+	var batches int32
+	node := startMockNode(t).
+		Respond("eth_getCode", "0x").
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			out, _ := erc20.Methods["balanceOf"].Outputs.Pack(big.NewInt(7))
+			return hexutil.Bytes(out), nil
+		}).
+		Inspect(func(r *http.Request) {
+			atomic.AddInt32(&batches, 1)
+		})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	atomic.StoreInt32(&batches, 0)
+
+	call, _ := NewCall3(common.HexToAddress("0x1000"), &erc20, "balanceOf", false, common.HexToAddress("0x01"))
+	calls := []Call3{call, call, call, call, call}
+	results, err := NewMulticall(client, Multicall3Address).SetBatchLimit(2).Aggregate(context.Background(), calls, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 5)
+	assert.Equal(t, big.NewInt(7), results[4].Values[0])
+	assert.Equal(t, 5, node.Calls("eth_call"))
+	// one request checks the deployment, then three batches of at most two calls
+	assert.Equal(t, int32(4), atomic.LoadInt32(&batches))
+}
+
+func TestNewChainMulticall(t *testing.T) {
+	node := startMockNode(t).Respond("eth_chainId", "0x144")
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+
+	m, err := NewChainMulticall(context.Background(), client)
+	assert.NoError(t, err)
+	profile, _ := LookupChain(324)
+	assert.Equal(t, profile.Multicall3, m.address)
+	assert.NotEqual(t, Multicall3Address, m.address)
+
+	unknown := startMockNode(t).Respond("eth_chainId", "0x7a69")
+	client, err = NewWeb3Client(unknown.URL())
+	assert.NoError(t, err)
+	m, err = NewChainMulticall(context.Background(), client)
+	assert.NoError(t, err)
+	assert.Equal(t, Multicall3Address, m.address)
+}
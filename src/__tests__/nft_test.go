@@ -0,0 +1,188 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// newNFTNode answers calls by method name of the ERC-721 and ERC-1155 ABIs, and serves logs
+func newNFTNode(t *testing.T, outputs map[string][]interface{}, logs []types.Log) *Web3Client {
+	node := startMockNode(t).
+		Respond("eth_blockNumber", "0x10").
+		Respond("eth_getLogs", logs).
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			var msg struct {
+				Data  hexutil.Bytes `json:"data"`
+				Input hexutil.Bytes `json:"input"`
+			}
+			json.Unmarshal(params[0], &msg)
+			data := msg.Input
+			if len(data) == 0 {
+				data = msg.Data
+			}
+			m, err := erc1155ABI.MethodById(data[:4])
+			if err != nil {
+				if m, err = erc721ABI.MethodById(data[:4]); err != nil {
+					return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+				}
+			}
+			if m.Name == "supportsInterface" {
+				args, _ := m.Inputs.Unpack(data[4:])
+				id := args[0].([4]byte)
+				out, _ := m.Outputs.Pack(id == InterfaceIDERC165 || id == InterfaceIDERC1155)
+				return hexutil.Bytes(out), nil
+			}
+			values, ok := outputs[m.Name]
+			if !ok {
+				return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+			}
+			out, _ := m.Outputs.Pack(values...)
+			return hexutil.Bytes(out), nil
+		})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	return client
+}
+
+func TestERC721(t *testing.T) {
+	owner := common.HexToAddress("0x01")
+	client := newNFTNode(t, map[string][]interface{}{
+		"ownerOf":          {owner},
+		"tokenURI":         {"ipfs://collection/7"},
+		"isApprovedForAll": {true},
+	}, nil)
+	nft := NewERC721(client, common.HexToAddress("0xbbbb"))
+	ctx := context.Background()
+
+	got, err := nft.OwnerOf(ctx, big.NewInt(7))
+	assert.NoError(t, err)
+	assert.Equal(t, owner, got)
+
+	uri, err := nft.TokenURI(ctx, big.NewInt(7))
+	assert.NoError(t, err)
+	assert.Equal(t, "ipfs://collection/7", uri)
+
+	approved, err := nft.IsApprovedForAll(ctx, owner, common.HexToAddress("0x02"))
+	assert.NoError(t, err)
+	assert.True(t, approved)
+}
+
+func TestERC1155_URI(t *testing.T) {
+	client := newNFTNode(t, map[string][]interface{}{
+		"uri":       {"https://token-cdn-domain/{id}.json"},
+		"balanceOf": {big.NewInt(12)},
+	}, nil)
+	multi := NewERC1155(client, common.HexToAddress("0xcccc"))
+	ctx := context.Background()
+
+	uri, err := multi.URI(ctx, big.NewInt(314592))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://token-cdn-domain/000000000000000000000000000000000000000000000000000000000004cce0.json", uri)
+
+	balance, err := multi.BalanceOf(ctx, common.HexToAddress("0x01"), big.NewInt(1))
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewInt(12), balance)
+
+	_, err = multi.BalanceOfBatch(ctx, []common.Address{{}}, nil)
+	assert.Error(t, err)
+}
+
+func TestSupportsInterface(t *testing.T) {
+	client := newNFTNode(t, nil, nil)
+	ctx := context.Background()
+	address := common.HexToAddress("0xcccc")
+
+	supported, err := SupportsInterface(ctx, client, address, InterfaceIDERC1155)
+	assert.NoError(t, err)
+	assert.True(t, supported)
+
+	supported, err = SupportsInterface(ctx, client, address, InterfaceIDERC721)
+	assert.NoError(t, err)
+	assert.False(t, supported)
+}
+
+func TestEventFilter_Holdings(t *testing.T) {
+	nft := common.HexToAddress("0xbbbb")
+	multi := common.HexToAddress("0xcccc")
+	alice := common.HexToAddress("0x01")
+	bob := common.HexToAddress("0x02")
+	zero := common.Address{}
+	topic := func(a common.Address) common.Hash { return common.BytesToHash(a.Bytes()) }
+
+	single, _ := erc1155ABI.Events["TransferSingle"].Inputs.NonIndexed().Pack(big.NewInt(5), big.NewInt(10))
+	single6, _ := erc1155ABI.Events["TransferSingle"].Inputs.NonIndexed().Pack(big.NewInt(6), big.NewInt(1))
+	batch, _ := erc1155ABI.Events["TransferBatch"].Inputs.NonIndexed().Pack(
+		[]*big.Int{big.NewInt(5), big.NewInt(6)}, []*big.Int{big.NewInt(4), big.NewInt(1)})
+	transfer := erc721ABI.Events["Transfer"].ID
+
+	logs := []types.Log{
+		// Listed out of order on purpose
+		{Address: nft, BlockNumber: 2, Topics: []common.Hash{transfer, topic(alice), topic(bob), common.BigToHash(big.NewInt(1))}},
+		{Address: nft, BlockNumber: 1, Topics: []common.Hash{transfer, topic(zero), topic(alice), common.BigToHash(big.NewInt(1))}},
+		{Address: nft, BlockNumber: 1, Index: 1, Topics: []common.Hash{transfer, topic(zero), topic(alice), common.BigToHash(big.NewInt(2))}},
+		{Address: multi, BlockNumber: 3, Topics: []common.Hash{erc1155ABI.Events["TransferSingle"].ID, topic(alice), topic(zero), topic(alice)}, Data: single},
+		{Address: multi, BlockNumber: 3, Index: 1, Topics: []common.Hash{erc1155ABI.Events["TransferSingle"].ID, topic(alice), topic(zero), topic(alice)}, Data: single6},
+		{Address: multi, BlockNumber: 4, Topics: []common.Hash{erc1155ABI.Events["TransferBatch"].ID, topic(alice), topic(alice), topic(bob)}, Data: batch},
+		// An ERC-20 transfer carries the amount in data and is ignored
+		{Address: nft, BlockNumber: 5, Topics: []common.Hash{transfer, topic(bob), topic(alice)}, Data: common.BigToHash(big.NewInt(1)).Bytes()},
+	}
+	client := newNFTNode(t, nil, logs)
+
+	holdings, err := NewEventFilter(client).SetAddresses([]common.Address{nft, multi}).Holdings(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Holding{
+		{Token: nft, TokenID: big.NewInt(1), Owner: bob, Balance: big.NewInt(1)},
+		{Token: nft, TokenID: big.NewInt(2), Owner: alice, Balance: big.NewInt(1)},
+		{Token: multi, TokenID: big.NewInt(5), Owner: alice, Balance: big.NewInt(6)},
+		{Token: multi, TokenID: big.NewInt(5), Owner: bob, Balance: big.NewInt(4)},
+		{Token: multi, TokenID: big.NewInt(6), Owner: bob, Balance: big.NewInt(1)},
+	}, holdings)
+}
+
+func TestEventFilter_HoldingsRange(t *testing.T) {
+	nft := common.HexToAddress("0xbbbb")
+	alice := common.HexToAddress("0x01")
+	transfer := erc721ABI.Events["Transfer"].ID
+	mint := types.Log{
+		Address: nft, BlockNumber: 90,
+		Topics: []common.Hash{transfer, {}, common.BytesToHash(alice.Bytes()), common.BigToHash(big.NewInt(1))},
+	}
+	node := startMockNode(t).
+		Respond("eth_blockNumber", "0x64").
+		Handle("eth_getLogs", func(params []json.RawMessage) (interface{}, error) {
+			var query struct {
+				FromBlock hexutil.Uint64  `json:"fromBlock"`
+				ToBlock   hexutil.Uint64  `json:"toBlock"`
+				Topics    [][]common.Hash `json:"topics"`
+			}
+			json.Unmarshal(params[0], &query)
+			assert.Equal(t, transfer, query.Topics[0][0])
+			if query.ToBlock-query.FromBlock >= 50 {
+				return nil, &rpctest.Error{Code: -32005, Message: "query returned more than 10000 results"}
+			}
+			if query.FromBlock > 90 || query.ToBlock < 90 {
+				return []types.Log{}, nil
+			}
+			return []types.Log{mint}, nil
+		})
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+
+	topics := [][]common.Hash{{common.HexToHash("0x01")}}
+	filter := NewEventFilter(client).SetAddresses([]common.Address{nft}).SetTopics(topics).SetBlockRange(big.NewInt(10), nil)
+	holdings, err := filter.Holdings(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []Holding{{Token: nft, TokenID: big.NewInt(1), Owner: alice, Balance: big.NewInt(1)}}, holdings)
+	assert.Greater(t, node.Calls("eth_getLogs"), 2)
+	assert.Equal(t, topics, filter.query.Topics)
+}
@@ -0,0 +1,229 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// chainNode emulates a node with a mempool, mining everything on demand
+type chainNode struct {
+	mutex   sync.Mutex
+	mined   uint64
+	down    bool
+	refusal string
+	pool    map[common.Hash]*types.Transaction
+	blocks  map[common.Hash]*types.Transaction
+	sendLog []common.Hash
+}
+
+func newChainNode(t *testing.T) (*chainNode, *Web3Client) {
+	node := &chainNode{pool: make(map[common.Hash]*types.Transaction), blocks: make(map[common.Hash]*types.Transaction)}
+	mock := startMockNode(t).
+		Respond("eth_chainId", "0x1").
+		Handle("eth_getTransactionCount", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			var block string
+			json.Unmarshal(params[1], &block)
+			if block == "pending" {
+				return hexutil.Uint64(node.mined + uint64(len(node.pool))), nil
+			}
+			return hexutil.Uint64(node.mined), nil
+		}).
+		Handle("eth_sendRawTransaction", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			if node.down {
+				return nil, &rpctest.Error{Code: -32000, Message: "node unavailable"}
+			}
+			if node.refusal != "" {
+				return nil, &rpctest.Error{Code: -32000, Message: node.refusal}
+			}
+			var raw hexutil.Bytes
+			json.Unmarshal(params[0], &raw)
+			tx := new(types.Transaction)
+			tx.UnmarshalBinary(raw)
+			node.pool[tx.Hash()] = tx
+			node.sendLog = append(node.sendLog, tx.Hash())
+			return tx.Hash(), nil
+		}).
+		Handle("eth_getTransactionReceipt", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			var hash common.Hash
+			json.Unmarshal(params[0], &hash)
+			if _, ok := node.blocks[hash]; !ok {
+				return nil, nil
+			}
+			return &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: hash, Logs: []*types.Log{}, BlockNumber: big.NewInt(1)}, nil
+		}).
+		Handle("eth_getTransactionByHash", func(params []json.RawMessage) (interface{}, error) {
+			node.mutex.Lock()
+			defer node.mutex.Unlock()
+			var hash common.Hash
+			json.Unmarshal(params[0], &hash)
+			if tx, ok := node.pool[hash]; ok {
+				return tx, nil
+			}
+			return nil, nil
+		})
+
+	client, err := NewWeb3Client(mock.URL())
+	assert.NoError(t, err)
+	return node, client
+}
+
+func (n *chainNode) mine() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for hash, tx := range n.pool {
+		n.blocks[hash] = tx
+		n.mined++
+	}
+	n.pool = make(map[common.Hash]*types.Transaction)
+}
+
+func TestFileJobStore(t *testing.T) {
+	store, err := NewFileJobStore(t.TempDir())
+	assert.NoError(t, err)
+
+	job, err := NewPayoutJob("payroll-1", common.HexToAddress("0x01"), []TransferInstruction{
+		{Standard: ERC20Token, Token: common.HexToAddress("0xaaaa"), To: common.HexToAddress("0x02"), Amount: big.NewInt(500), IdempotencyKey: "a"},
+	})
+	assert.NoError(t, err)
+	job.Entries[0].RawTx = []byte{1, 2, 3}
+	assert.NoError(t, store.Save(job))
+
+	loaded, err := store.Load("payroll-1")
+	assert.NoError(t, err)
+	assert.Equal(t, job.Entries, loaded.Entries)
+	assert.Equal(t, job.From, loaded.From)
+
+	ids, err := store.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"payroll-1"}, ids)
+
+	assert.Error(t, store.Save(&PayoutJob{ID: "../escape"}))
+	_, err = store.Load("missing")
+	assert.Error(t, err)
+
+	_, err = NewPayoutJob("dup", common.Address{}, []TransferInstruction{{IdempotencyKey: "a"}, {IdempotencyKey: "a"}})
+	assert.Error(t, err)
+}
+
+func TestRunJob_ResumesWithoutResigning(t *testing.T) {
+	node, client := newChainNode(t)
+	bp := NewBatchProcessor(client, 10, 2)
+	opts := newTestTransactor(t)
+	store, _ := NewFileJobStore(t.TempDir())
+
+	job, _ := NewPayoutJob("job", opts.From, []TransferInstruction{
+		{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(1)},
+		{Standard: Native, To: common.HexToAddress("0x02"), Amount: big.NewInt(2)},
+	})
+	node.down = true
+	assert.Error(t, bp.RunJob(context.Background(), opts, store, job))
+
+	// The process restarts and reads the job back
+	job, err := store.Load("job")
+	assert.NoError(t, err)
+	assert.Equal(t, PayoutSigned, job.Entries[0].State)
+	assert.Equal(t, PayoutPending, job.Entries[1].State)
+	signed := job.Entries[0].TxHash
+
+	node.down = false
+	assert.NoError(t, bp.RunJob(context.Background(), opts, store, job))
+	assert.Equal(t, []common.Hash{signed, job.Entries[1].TxHash}, node.sendLog)
+	assert.Equal(t, uint64(0), job.Entries[0].Nonce)
+	assert.Equal(t, uint64(1), job.Entries[1].Nonce)
+	assert.Equal(t, PayoutBroadcast, job.Entries[1].State)
+	assert.False(t, job.Done())
+
+	node.mine()
+	assert.NoError(t, bp.ReconcileJob(context.Background(), store, job))
+	assert.True(t, job.Done())
+	assert.Equal(t, PayoutMined, job.Entries[0].State)
+
+	// Running a finished job again sends nothing
+	assert.NoError(t, bp.RunJob(context.Background(), opts, store, job))
+	assert.Len(t, node.sendLog, 2)
+}
+
+func TestReconcileJob_NonceConsumed(t *testing.T) {
+	node, client := newChainNode(t)
+	bp := NewBatchProcessor(client, 10, 2)
+	opts := newTestTransactor(t)
+	store, _ := NewFileJobStore(t.TempDir())
+
+	job, _ := NewPayoutJob("job", opts.From, []TransferInstruction{
+		{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(1)},
+	})
+	node.down = true
+	bp.RunJob(context.Background(), opts, store, job)
+
+	// Another transaction used the same nonce meanwhile
+	node.mined = 1
+	node.down = false
+	assert.NoError(t, bp.ReconcileJob(context.Background(), store, job))
+	assert.Equal(t, PayoutFailed, job.Entries[0].State)
+	assert.Empty(t, node.sendLog)
+}
+
+func TestReconcileJob_RebroadcastRefused(t *testing.T) {
+	tests := []struct {
+		refusal string
+		state   PayoutState
+	}{
+		{"nonce too low: next nonce 1, tx nonce 0", PayoutFailed},
+		{"replacement transaction underpriced", PayoutFailed},
+		{"already known", PayoutBroadcast},
+	}
+	for _, tt := range tests {
+		t.Run(tt.refusal, func(t *testing.T) {
+			node, client := newChainNode(t)
+			bp := NewBatchProcessor(client, 10, 2)
+			opts := newTestTransactor(t)
+			store, _ := NewFileJobStore(t.TempDir())
+
+			job, _ := NewPayoutJob("job", opts.From, []TransferInstruction{
+				{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(1)},
+			})
+			node.down = true
+			bp.RunJob(context.Background(), opts, store, job)
+
+			node.down = false
+			node.refusal = tt.refusal
+			assert.NoError(t, bp.ReconcileJob(context.Background(), store, job))
+			assert.Equal(t, tt.state, job.Entries[0].State)
+
+			loaded, err := store.Load("job")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.state, loaded.Entries[0].State)
+		})
+	}
+
+	t.Run("transient", func(t *testing.T) {
+		node, client := newChainNode(t)
+		bp := NewBatchProcessor(client, 10, 2)
+		opts := newTestTransactor(t)
+		store, _ := NewFileJobStore(t.TempDir())
+
+		job, _ := NewPayoutJob("job", opts.From, []TransferInstruction{
+			{Standard: Native, To: common.HexToAddress("0x01"), Amount: big.NewInt(1)},
+		})
+		node.down = true
+		bp.RunJob(context.Background(), opts, store, job)
+		assert.Error(t, bp.ReconcileJob(context.Background(), store, job))
+		assert.Equal(t, PayoutSigned, job.Entries[0].State)
+	})
+}
@@ -0,0 +1,233 @@
+package pyweb3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	policyFrom  = common.HexToAddress("0xf000")
+	policyAlice = common.HexToAddress("0xa11ce")
+	policyBob   = common.HexToAddress("0xb0b")
+	policyToken = common.HexToAddress("0x70c3")
+)
+
+func newPolicyTx(to common.Address, value int64, data []byte) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(2e10),
+		Gas:       60000,
+		To:        &to,
+		Value:     big.NewInt(value),
+		Data:      data,
+	})
+}
+
+func tokenTransferTx(to common.Address, amount int64) *types.Transaction {
+	data, _ := erc20ABI.Pack("transfer", to, big.NewInt(amount))
+	return newPolicyTx(policyToken, 0, data)
+}
+
+// assertViolation checks that err is a policy violation of rule
+func assertViolation(t *testing.T, err error, rule PolicyRule) {
+	t.Helper()
+	var violation *PolicyViolation
+	if assert.True(t, errors.As(err, &violation), "%v is not a policy violation", err) {
+		assert.Equal(t, rule, violation.Rule, violation.Reason)
+	}
+}
+
+func TestPolicyEngine_Rules(t *testing.T) {
+	ctx := context.Background()
+	var decisions []PolicyDecision
+	audit := AuditFunc(func(d PolicyDecision) { decisions = append(decisions, d) })
+
+	t.Run("recipients", func(t *testing.T) {
+		engine := NewPolicyEngine(nil, PolicyConfig{
+			Allow: []common.Address{policyAlice, policyBob},
+			Deny:  []common.Address{policyBob},
+			Audit: audit,
+		})
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 1, nil)))
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyBob, 1, nil)), RuleRecipientDenied)
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyFrom, 1, nil)), RuleRecipientNotAllowed)
+
+		// The beneficiary of a token transfer is checked, not the token
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, tokenTransferTx(policyAlice, 5)))
+		assertViolation(t, engine.Authorize(ctx, policyFrom, tokenTransferTx(policyBob, 5)), RuleRecipientDenied)
+
+		data, _ := disperseABI.Pack("disperseEther", []common.Address{policyAlice, policyFrom}, []*big.Int{big.NewInt(1), big.NewInt(1)})
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(common.HexToAddress("0xd15e"), 2, data)), RuleRecipientNotAllowed)
+	})
+
+	t.Run("selectors", func(t *testing.T) {
+		transfer := [4]byte{}
+		copy(transfer[:], erc20ABI.Methods["transfer"].ID)
+		engine := NewPolicyEngine(nil, PolicyConfig{
+			Selectors: map[common.Address][][4]byte{policyToken: {transfer}},
+			Audit:     audit,
+		})
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, tokenTransferTx(policyAlice, 5)))
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 1, nil)), "plain transfers are not method calls")
+
+		approve, _ := erc20ABI.Pack("approve", policyBob, big.NewInt(5))
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyToken, 0, approve)), RuleMethodNotAllowed)
+		data, _ := erc20ABI.Pack("transfer", policyAlice, big.NewInt(5))
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyBob, 0, data)), RuleMethodNotAllowed)
+		creation := types.NewTx(&types.LegacyTx{Gas: 100000, GasPrice: big.NewInt(1), Data: []byte{0x60, 0x80}})
+		assertViolation(t, engine.Authorize(ctx, policyFrom, creation), RuleMethodNotAllowed)
+	})
+
+	t.Run("fee caps", func(t *testing.T) {
+		engine := NewPolicyEngine(nil, PolicyConfig{MaxFeePerGas: big.NewInt(1e10), Audit: audit})
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 1, nil)), RuleFeeCap)
+
+		engine = NewPolicyEngine(nil, PolicyConfig{MaxFee: big.NewInt(1e15), Audit: audit})
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 1, nil)), RuleFeeCap)
+		engine = NewPolicyEngine(nil, PolicyConfig{MaxFee: big.NewInt(12e14), Audit: audit})
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 1, nil)))
+	})
+
+	t.Run("value limits", func(t *testing.T) {
+		now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+		engine := NewPolicyEngine(nil, PolicyConfig{
+			Limits: map[common.Address]Limit{
+				{}:         {PerTransaction: big.NewInt(100), PerDay: big.NewInt(250)},
+				policyFrom: {PerTransaction: big.NewInt(50)},
+			},
+			TokenLimits: map[common.Address]Limit{policyToken: {PerDay: big.NewInt(10)}},
+			Audit:       audit,
+			Now:         func() time.Time { return now },
+		})
+		other := common.HexToAddress("0x0123")
+
+		assertViolation(t, engine.Authorize(ctx, other, newPolicyTx(policyAlice, 101, nil)), RuleTransactionLimit)
+		assert.NoError(t, engine.Authorize(ctx, other, newPolicyTx(policyAlice, 100, nil)))
+		assert.NoError(t, engine.Authorize(ctx, other, newPolicyTx(policyAlice, 100, nil)))
+		assertViolation(t, engine.Authorize(ctx, other, newPolicyTx(policyAlice, 51, nil)), RuleDailyLimit)
+		assert.Equal(t, big.NewInt(200), engine.Spent(other, common.Address{}))
+
+		// An account with its own limit does not fall back to the default one
+		assertViolation(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 51, nil)), RuleTransactionLimit)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 50, nil)))
+		}
+
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, tokenTransferTx(policyAlice, 6)))
+		assertViolation(t, engine.Authorize(ctx, policyFrom, tokenTransferTx(policyAlice, 5)), RuleDailyLimit)
+		assert.Equal(t, big.NewInt(6), engine.Spent(policyFrom, policyToken))
+
+		// The day changes at midnight UTC
+		now = now.Add(2 * time.Hour)
+		assert.NoError(t, engine.Authorize(ctx, other, newPolicyTx(policyAlice, 100, nil)))
+		assert.Equal(t, big.NewInt(100), engine.Spent(other, common.Address{}))
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, tokenTransferTx(policyAlice, 10)))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		node := startMockNode(t).Respond("eth_chainId", "0x1").Respond("eth_call", "0x")
+		client, err := NewWeb3Client(node.URL())
+		require.NoError(t, err)
+		defer client.Close()
+		engine := NewPolicyEngine(client, PolicyConfig{
+			Limits: map[common.Address]Limit{{}: {PerDay: big.NewInt(100)}},
+			DryRun: true,
+			Audit:  audit,
+		})
+
+		assert.NoError(t, engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 10, nil)))
+		node.Fail("eth_call", 3, "execution reverted: paused")
+		err = engine.Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 10, nil))
+		assertViolation(t, err, RuleDryRun)
+		assert.ErrorContains(t, err, "paused")
+		assert.Equal(t, big.NewInt(10), engine.Spent(policyFrom, common.Address{}), "a refused transaction does not count")
+
+		assertViolation(t, NewPolicyEngine(nil, PolicyConfig{DryRun: true, Audit: audit}).Authorize(ctx, policyFrom, newPolicyTx(policyAlice, 1, nil)), RuleDryRun)
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		require.NotEmpty(t, decisions)
+		var allowed, refused int
+		for _, decision := range decisions {
+			if decision.Allowed {
+				allowed++
+				assert.Empty(t, decision.Rule)
+			} else {
+				refused++
+				assert.NotEmpty(t, decision.Rule)
+				assert.NotEmpty(t, decision.Reason)
+			}
+		}
+		assert.NotZero(t, allowed)
+		assert.NotZero(t, refused)
+
+		var buf bytes.Buffer
+		engine := NewPolicyEngine(nil, PolicyConfig{Deny: []common.Address{policyBob}, Audit: NewJSONAuditSink(&buf)})
+		engine.Authorize(ctx, policyFrom, tokenTransferTx(policyAlice, 5))
+		engine.Authorize(ctx, policyFrom, newPolicyTx(policyBob, 1, nil))
+
+		lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+		require.Len(t, lines, 2)
+		var first, second map[string]interface{}
+		require.NoError(t, json.Unmarshal(lines[0], &first))
+		require.NoError(t, json.Unmarshal(lines[1], &second))
+		assert.Equal(t, true, first["allowed"])
+		assert.Equal(t, "0xa9059cbb", first["selector"])
+		assert.Equal(t, []interface{}{"0x00000000000000000000000000000000000a11ce"}, first["recipients"])
+		assert.Equal(t, false, second["allowed"])
+		assert.Equal(t, "recipient denied", second["rule"])
+	})
+}
+
+func TestPolicyEngine_BatchTransfer(t *testing.T) {
+	node, client := newTxNode(t, 7)
+	bp := NewBatchProcessor(client, 10, 1)
+	engine := NewPolicyEngine(nil, PolicyConfig{
+		Deny:   []common.Address{policyBob},
+		Limits: map[common.Address]Limit{{}: {PerTransaction: big.NewInt(1e18)}},
+		Audit:  AuditFunc(func(PolicyDecision) {}),
+	})
+	opts := engine.TransactOpts(newTestTransactor(t))
+
+	instructions := []TransferInstruction{
+		{Standard: Native, To: policyAlice, Amount: big.NewInt(1e17)},
+		{Standard: Native, To: policyBob, Amount: big.NewInt(1e17)},
+		{Standard: Native, To: policyAlice, Amount: big.NewInt(2e18)},
+		{Standard: ERC20Token, Token: policyToken, To: policyAlice, Amount: big.NewInt(500)},
+	}
+	results := bp.BatchTransferTokens(context.Background(), opts, instructions)
+
+	assert.NoError(t, results[0].Error)
+	assertViolation(t, results[1].Error, RuleRecipientDenied)
+	assertViolation(t, results[2].Error, RuleTransactionLimit)
+	assert.NoError(t, results[3].Error, "refused transfers do not stop the batch")
+	assert.Equal(t, uint64(7), results[0].Nonce)
+	assert.Equal(t, uint64(8), results[3].Nonce, "refused transfers do not use a nonce")
+	assert.Len(t, node.sent, 2)
+}
+
+func TestPolicyEngine_Wrap(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	engine := NewPolicyEngine(nil, PolicyConfig{Allow: []common.Address{policyAlice}, Audit: AuditFunc(func(PolicyDecision) {})})
+	signer := engine.Wrap(NewKeySigner(key))
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), signer.Address())
+
+	_, err := signer.SignTx(context.Background(), newPolicyTx(policyAlice, 1, nil), big.NewInt(1))
+	assert.NoError(t, err)
+	_, err = signer.SignTx(context.Background(), newPolicyTx(policyBob, 1, nil), big.NewInt(1))
+	assertViolation(t, err, RuleRecipientNotAllowed)
+	_, err = signer.SignMessage(context.Background(), []byte("hello"))
+	assert.NoError(t, err, "messages are not transactions")
+}
@@ -0,0 +1,222 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+var (
+	preflightToken = common.HexToAddress("0xa0")
+	preflightNFT   = common.HexToAddress("0xb0")
+)
+
+// newPreflightClient connects to an Ethereum node where every transfer costs
+// 21000 gas at a 21 gwei fee cap, and the sender holds 1 ether, 150 tokens
+// with an allowance of 50 and the NFT #7
+func newPreflightClient(t *testing.T, sender common.Address) *Web3Client {
+	node := startMockNode(t).
+		Respond("eth_chainId", hexutil.Uint64(1)).
+		Handle("eth_getBalance", func(params []json.RawMessage) (interface{}, error) {
+			var block string
+			json.Unmarshal(params[1], &block)
+			assert.Equal(t, "pending", block)
+			return hexutil.Big(*big.NewInt(1e18)), nil
+		}).
+		Respond("eth_estimateGas", "0x5208").
+		Respond("eth_maxPriorityFeePerGas", hexutil.Big(*big.NewInt(1e9))).
+		Respond("eth_getBlockByNumber", &types.Header{Number: big.NewInt(100), Difficulty: new(big.Int), BaseFee: big.NewInt(10e9)}).
+		Handle("eth_call", func(params []json.RawMessage) (interface{}, error) {
+			var msg struct {
+				To    common.Address `json:"to"`
+				Input hexutil.Bytes  `json:"input"`
+			}
+			json.Unmarshal(params[0], &msg)
+			var out []byte
+			switch msg.To {
+			case preflightToken:
+				m, _ := erc20ABI.MethodById(msg.Input[:4])
+				switch m.Name {
+				case "balanceOf":
+					out, _ = m.Outputs.Pack(big.NewInt(150))
+				case "allowance":
+					out, _ = m.Outputs.Pack(big.NewInt(50))
+				}
+			case preflightNFT:
+				m, _ := erc721ABI.MethodById(msg.Input[:4])
+				args, _ := m.Inputs.Unpack(msg.Input[4:])
+				if m.Name != "ownerOf" || args[0].(*big.Int).Int64() != 7 {
+					return nil, &rpctest.Error{Code: 3, Message: "execution reverted"}
+				}
+				out, _ = m.Outputs.Pack(sender)
+			}
+			return hexutil.Bytes(out), nil
+		})
+
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	return client
+}
+
+func TestBatchProcessor_Preflight(t *testing.T) {
+	ctx := context.Background()
+	from, to := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	fee := big.NewInt(21e9 * 21000)
+	instructions := []TransferInstruction{
+		{Standard: Native, To: to, Amount: big.NewInt(5e17)},
+		{Standard: Native, To: to, Amount: big.NewInt(6e17)},
+		{Standard: ERC20Token, Token: preflightToken, To: to, Amount: big.NewInt(40)},
+		{Standard: ERC20Token, Token: preflightToken, To: to, Amount: big.NewInt(120)},
+		{Standard: ERC721Token, Token: preflightNFT, To: to, TokenID: big.NewInt(7)},
+		{Standard: ERC721Token, Token: preflightNFT, To: to, TokenID: big.NewInt(8)},
+	}
+	bp := NewBatchProcessor(newPreflightClient(t, from), 10, 2)
+
+	t.Run("fitting batch", func(t *testing.T) {
+		kept, report, err := bp.Preflight(ctx, from, instructions[:1], PreflightConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, instructions[:1], kept)
+		assert.Empty(t, report.Shortfalls)
+		assert.Equal(t, fee, report.MaxFees)
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		kept, report, err := bp.Preflight(ctx, from, instructions, PreflightConfig{})
+		var insufficient *InsufficientFundsError
+		assert.True(t, errors.As(err, &insufficient))
+		assert.Nil(t, kept)
+		assert.Equal(t, report, insufficient.Report)
+		assert.Len(t, report.Shortfalls, 3)
+
+		missing := make(map[TokenStandard]*big.Int)
+		for _, s := range report.Shortfalls {
+			missing[s.Standard] = s.Missing()
+		}
+		nativeRequired := new(big.Int).Add(big.NewInt(11e17), new(big.Int).Mul(fee, big.NewInt(6)))
+		assert.Equal(t, new(big.Int).Sub(nativeRequired, big.NewInt(1e18)), missing[Native])
+		assert.Equal(t, big.NewInt(10), missing[ERC20Token])
+		assert.Equal(t, big.NewInt(1), missing[ERC721Token])
+		assert.Contains(t, err.Error(), "#8")
+	})
+
+	t.Run("trim", func(t *testing.T) {
+		kept, report, err := bp.Preflight(ctx, from, instructions, PreflightConfig{Policy: PreflightTrim})
+		assert.NoError(t, err)
+		assert.Equal(t, []TransferInstruction{instructions[0], instructions[2], instructions[4]}, kept)
+		assert.Equal(t, []int{1, 3, 5}, report.Dropped)
+		assert.Equal(t, new(big.Int).Mul(fee, big.NewInt(3)), report.MaxFees)
+	})
+
+	t.Run("allowance", func(t *testing.T) {
+		spender := common.HexToAddress("0xd1")
+		kept, report, err := bp.Preflight(ctx, from, instructions[3:4], PreflightConfig{Spender: &spender})
+		assert.Error(t, err)
+		assert.Nil(t, kept)
+		assert.Len(t, report.Shortfalls, 1)
+		assert.True(t, report.Shortfalls[0].Allowance)
+		assert.Equal(t, big.NewInt(50), report.Shortfalls[0].Available)
+	})
+
+	t.Run("idempotency duplicates cost nothing", func(t *testing.T) {
+		repeated := []TransferInstruction{
+			{Standard: Native, To: to, Amount: big.NewInt(5e17), IdempotencyKey: "payout-1"},
+			{Standard: Native, To: to, Amount: big.NewInt(5e17), IdempotencyKey: "payout-1"},
+		}
+		kept, report, err := bp.Preflight(ctx, from, repeated, PreflightConfig{})
+		assert.NoError(t, err)
+		assert.Equal(t, repeated, kept)
+		assert.Equal(t, fee, report.MaxFees)
+	})
+
+	t.Run("direct transfers ignore the spender", func(t *testing.T) {
+		spender := common.HexToAddress("0xd1")
+		bp.SetPreflight(&PreflightConfig{Spender: &spender})
+		defer bp.SetPreflight(nil)
+
+		tokens := []TransferInstruction{{Standard: ERC20Token, Token: preflightToken, To: to, Amount: big.NewInt(60)}}
+		report, err := bp.directPreflight(ctx, from, tokens)
+		assert.NoError(t, err)
+		assert.Empty(t, report.Shortfalls)
+	})
+
+	t.Run("disperse", func(t *testing.T) {
+		disperse := common.HexToAddress("0xd15")
+		bp.SetPreflight(&PreflightConfig{})
+		defer bp.SetPreflight(nil)
+
+		// Four payments fit the balance with a single fee, not with four
+		amount := new(big.Int).Sub(big.NewInt(25e16), new(big.Int).Div(fee, big.NewInt(2)))
+		payments := make([]TransferInstruction, 4)
+		for i := range payments {
+			payments[i] = TransferInstruction{Standard: Native, To: to, Amount: amount}
+		}
+		report, err := bp.dispersePreflight(ctx, from, disperse, payments)
+		assert.NoError(t, err)
+		assert.Equal(t, fee, report.MaxFees)
+		_, _, err = bp.Preflight(ctx, from, payments, PreflightConfig{})
+		assert.Error(t, err)
+
+		bp.SetPreflight(&PreflightConfig{Policy: PreflightTrim})
+		tokens := []TransferInstruction{
+			{Standard: ERC20Token, Token: preflightToken, To: to, Amount: big.NewInt(30)},
+			{Standard: ERC20Token, Token: preflightToken, To: to, Amount: big.NewInt(30)},
+		}
+		report, err = bp.dispersePreflight(ctx, from, disperse, tokens)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1}, report.Dropped)
+		assert.Equal(t, fee, report.MaxFees)
+
+		bp.SetPreflight(&PreflightConfig{})
+		results := bp.DisperseTransfer(ctx, &bind.TransactOpts{From: from}, disperse, tokens)
+		for _, result := range results {
+			var insufficient *InsufficientFundsError
+			if assert.True(t, errors.As(result.Error, &insufficient)) {
+				assert.True(t, insufficient.Report.Shortfalls[0].Allowance)
+			}
+			assert.Equal(t, common.Hash{}, result.TxHash)
+		}
+	})
+
+	t.Run("plain batch transfers", func(t *testing.T) {
+		bp.SetPreflight(&PreflightConfig{})
+		defer bp.SetPreflight(nil)
+
+		results := bp.BatchTransfer(ctx, from, map[common.Address]*big.Int{to: big.NewInt(2e18)})
+		require.Len(t, results, 1)
+		var insufficient *InsufficientFundsError
+		assert.True(t, errors.As(results[0].Error, &insufficient))
+
+		bp.SetPreflight(&PreflightConfig{Policy: PreflightTrim})
+		results = bp.BatchTransfer(ctx, from, map[common.Address]*big.Int{
+			to:                          big.NewInt(5e17),
+			common.HexToAddress("0x03"): big.NewInt(6e17),
+		})
+		require.Len(t, results, 2)
+		assert.NotErrorIs(t, results[0].Error, ErrPreflightDropped)
+		assert.ErrorIs(t, results[1].Error, ErrPreflightDropped)
+	})
+
+	t.Run("before signing", func(t *testing.T) {
+		bp.SetPreflight(&PreflightConfig{})
+		defer bp.SetPreflight(nil)
+
+		results := bp.BatchTransferTokens(ctx, &bind.TransactOpts{From: from}, instructions)
+		assert.Len(t, results, len(instructions))
+		for _, result := range results {
+			var insufficient *InsufficientFundsError
+			assert.True(t, errors.As(result.Error, &insufficient))
+			assert.Equal(t, common.Hash{}, result.TxHash)
+		}
+	})
+}
@@ -0,0 +1,198 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRPCServer starts a test node answering every call with result, counting hits
+func newRPCServer(t *testing.T, status int, result string, hits *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID json.RawMessage `json:"id"`
+		}
+		json.Unmarshal(body, &req)
+
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":` + result + `}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postRPC(t *testing.T, p *Provider, method string) (string, error) {
+	req, _ := http.NewRequest(http.MethodPost, "http://provider",
+		strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"`+method+`","params":[]}`))
+	resp, err := p.RoundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), nil
+}
+
+func TestNewProvider(t *testing.T) {
+	_, err := NewProvider(nil, ProviderConfig{})
+	assert.Error(t, err)
+
+	_, err = NewProvider([]Endpoint{{URL: "wss://example.com"}}, ProviderConfig{})
+	assert.Error(t, err)
+
+	p, err := NewProvider([]Endpoint{{URL: "https://example.com"}}, ProviderConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.endpoints[0].Weight)
+}
+
+func TestProvider_Failover(t *testing.T) {
+	var downHits, upHits int32
+	down := newRPCServer(t, http.StatusBadGateway, "", &downHits)
+	up := newRPCServer(t, http.StatusOK, `"0x1"`, &upHits)
+
+	p, err := NewProvider([]Endpoint{
+		{URL: down.URL, Priority: 0},
+		{URL: up.URL, Priority: 1},
+	}, ProviderConfig{})
+	assert.NoError(t, err)
+
+	body, err := postRPC(t, p, "eth_chainId")
+	assert.NoError(t, err)
+	assert.Contains(t, body, `"result":"0x1"`)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&downHits))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&upHits))
+
+	status := p.Status()
+	assert.Equal(t, uint64(1), status[0].Failures)
+	assert.Error(t, status[0].LastError)
+}
+
+func TestProvider_AllEndpointsFail(t *testing.T) {
+	var hits int32
+	down := newRPCServer(t, http.StatusServiceUnavailable, "", &hits)
+
+	p, _ := NewProvider([]Endpoint{{URL: down.URL}}, ProviderConfig{})
+	_, err := postRPC(t, p, "eth_chainId")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "all endpoints failed")
+}
+
+func TestProvider_HealthCheck(t *testing.T) {
+	var hits int32
+	ahead := newRPCServer(t, http.StatusOK, `"0x64"`, &hits)
+	behind := newRPCServer(t, http.StatusOK, `"0x10"`, &hits)
+
+	p, _ := NewProvider([]Endpoint{
+		{URL: behind.URL, Priority: 0},
+		{URL: ahead.URL, Priority: 1},
+	}, ProviderConfig{MaxBlockLag: 5})
+
+	p.CheckHealth(context.Background())
+
+	status := p.Status()
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, uint64(0x10), status[0].Head)
+	assert.True(t, status[1].Healthy)
+	assert.Equal(t, uint64(0x64), status[1].Head)
+
+	// The lagging endpoint is only used as a last resort
+	candidates := p.candidates()
+	assert.Equal(t, ahead.URL, candidates[0].URL)
+}
+
+func TestProvider_Quorum(t *testing.T) {
+	var hits int32
+	a := newRPCServer(t, http.StatusOK, `"0xaa"`, &hits)
+	b := newRPCServer(t, http.StatusOK, `"0xaa"`, &hits)
+	c := newRPCServer(t, http.StatusOK, `"0xbb"`, &hits)
+
+	var reported []Disagreement
+	p, _ := NewProvider([]Endpoint{{URL: a.URL}, {URL: b.URL}, {URL: c.URL}}, ProviderConfig{
+		Quorum: 3,
+		OnDisagreement: func(d Disagreement) {
+			reported = append(reported, d)
+		},
+	})
+
+	t.Run("majority answer", func(t *testing.T) {
+		body, err := postRPC(t, p, "eth_getBalance")
+		assert.NoError(t, err)
+		assert.Contains(t, body, `"result":"0xaa"`)
+		assert.Len(t, reported, 1)
+		assert.Equal(t, "eth_getBalance", reported[0].Method)
+		assert.Equal(t, `"0xbb"`, reported[0].Results[c.URL])
+	})
+
+	t.Run("non quorum method", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		_, err := postRPC(t, p, "eth_sendRawTransaction")
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+}
+
+func TestProvider_NoQuorum(t *testing.T) {
+	var hits int32
+	a := newRPCServer(t, http.StatusOK, `"0x1"`, &hits)
+	b := newRPCServer(t, http.StatusOK, `"0x2"`, &hits)
+
+	p, _ := NewProvider([]Endpoint{{URL: a.URL}, {URL: b.URL}}, ProviderConfig{Quorum: 2})
+	_, err := postRPC(t, p, "eth_call")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no quorum")
+}
+
+func TestProvider_QuorumHealthyOnly(t *testing.T) {
+	var hits, staleHits int32
+	a := newRPCServer(t, http.StatusOK, `"0x64"`, &hits)
+	b := newRPCServer(t, http.StatusOK, `"0x64"`, &hits)
+	stale := newRPCServer(t, http.StatusOK, `"0x10"`, &staleHits)
+
+	var reported []Disagreement
+	p, _ := NewProvider([]Endpoint{{URL: a.URL}, {URL: b.URL}, {URL: stale.URL}}, ProviderConfig{
+		MaxBlockLag: 5,
+		Quorum:      3,
+		OnDisagreement: func(d Disagreement) {
+			reported = append(reported, d)
+		},
+	})
+	p.CheckHealth(context.Background())
+	atomic.StoreInt32(&staleHits, 0)
+
+	body, err := postRPC(t, p, "eth_getBalance")
+	assert.NoError(t, err)
+	assert.Contains(t, body, `"result":"0x64"`)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&staleHits), "unhealthy endpoints do not vote")
+	assert.Empty(t, reported)
+}
+
+func TestProvider_QuorumFailureIsNotDisagreement(t *testing.T) {
+	var hits int32
+	a := newRPCServer(t, http.StatusOK, `"0xaa"`, &hits)
+	b := newRPCServer(t, http.StatusOK, `"0xaa"`, &hits)
+	down := newRPCServer(t, http.StatusBadGateway, "", &hits)
+
+	var reported []Disagreement
+	p, _ := NewProvider([]Endpoint{{URL: a.URL}, {URL: b.URL}, {URL: down.URL}}, ProviderConfig{
+		Quorum: 3,
+		OnDisagreement: func(d Disagreement) {
+			reported = append(reported, d)
+		},
+	})
+
+	body, err := postRPC(t, p, "eth_call")
+	assert.NoError(t, err)
+	assert.Contains(t, body, `"result":"0xaa"`)
+	assert.Empty(t, reported)
+}
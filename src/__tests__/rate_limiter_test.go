@@ -0,0 +1,131 @@
+package pyweb3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sendThrough(ctx context.Context, rt http.RoundTripper, url, body string) (*http.Response, error) {
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	return rt.RoundTrip(req)
+}
+
+func TestRateLimiter_MethodCosts(t *testing.T) {
+	var hits int32
+	server := newRPCServer(t, http.StatusOK, `"0x1"`, &hits)
+
+	rl := NewRateLimiter(RateLimiterConfig{MethodCosts: map[string]uint64{"eth_getLogs": 100}})
+
+	_, err := sendThrough(context.Background(), rl, server.URL,
+		`[{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]},{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]}]`)
+	assert.NoError(t, err)
+	_, err = sendThrough(context.Background(), rl, server.URL,
+		`{"jsonrpc":"2.0","id":3,"method":"eth_blockNumber","params":[]}`)
+	assert.NoError(t, err)
+
+	stats := rl.Stats()
+	assert.Equal(t, MethodStats{Calls: 1, Units: 100}, stats["eth_getLogs"])
+	assert.Equal(t, MethodStats{Calls: 2, Units: 20}, stats["eth_blockNumber"])
+}
+
+func TestRateLimiter_TokenBucket(t *testing.T) {
+	var hits int32
+	server := newRPCServer(t, http.StatusOK, `"0x1"`, &hits)
+
+	rl := NewRateLimiter(RateLimiterConfig{Budget: Budget{UnitsPerSecond: 100, Burst: 100}})
+	call := `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]}`
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err := sendThrough(context.Background(), rl, server.URL, call)
+		assert.NoError(t, err)
+	}
+	// The second eth_getLogs needs 50 more units, refilled at 100 units per second
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	t.Run("cancelled while waiting", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := sendThrough(ctx, rl, server.URL, call)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestRateLimiter_RetryAfter(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer server.Close()
+
+	rl := NewRateLimiter(RateLimiterConfig{MaxRetries: 2})
+
+	start := time.Now()
+	resp, err := sendThrough(context.Background(), rl, server.URL,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, uint64(1), rl.Stats()["eth_chainId"].Throttled)
+}
+
+func TestRateLimiter_BelowRetrier(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer server.Close()
+
+	rl := NewRateLimiter(RateLimiterConfig{})
+	retries := RetryConfig{Default: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}}
+	rt := Chain(nil, RetryMiddleware(retries), func(next http.RoundTripper) http.RoundTripper {
+		rl.transport = next
+		return rl
+	})
+
+	start := time.Now()
+	resp, err := sendThrough(context.Background(), rt, server.URL,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits), "the retrier sends the 503 again")
+	assert.GreaterOrEqual(t, time.Since(start), time.Second, "after Retry-After")
+	assert.Equal(t, uint64(1), rl.Stats()["eth_chainId"].Throttled)
+
+	t.Run("longer than MaxDelay", func(t *testing.T) {
+		atomic.StoreInt32(&hits, 0)
+		retries.Default.MaxDelay = 500 * time.Millisecond
+		resp, err := sendThrough(context.Background(), Chain(nil, RetryMiddleware(retries), RateLimitMiddleware(RateLimiterConfig{})),
+			server.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Second, parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)))
+
+	delay := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, float64(time.Hour), float64(delay), float64(2*time.Second))
+}
@@ -0,0 +1,274 @@
+package pyweb3
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// standInArgs is what a stand-in signer reads of a signing request
+type standInArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Value                hexutil.Big     `json:"value"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Data                 hexutil.Bytes   `json:"data"`
+	ChainID              *hexutil.Big    `json:"chainId"`
+}
+
+// standInSigner signs like Clef would, with tamper changing the transaction
+// before it is signed
+type standInSigner struct {
+	key    *ecdsa.PrivateKey
+	tamper func(*types.DynamicFeeTx)
+}
+
+func (s *standInSigner) signTransaction(args standInArgs) (interface{}, error) {
+	var inner types.TxData
+	chainID := args.ChainID.ToInt()
+	if args.MaxFeePerGas != nil {
+		tx := &types.DynamicFeeTx{
+			ChainID:   args.ChainID.ToInt(),
+			Nonce:     uint64(args.Nonce),
+			GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+			GasFeeCap: args.MaxFeePerGas.ToInt(),
+			Gas:       uint64(args.Gas),
+			To:        args.To,
+			Value:     args.Value.ToInt(),
+			Data:      args.Data,
+		}
+		if s.tamper != nil {
+			s.tamper(tx)
+		}
+		chainID = tx.ChainID
+		inner = tx
+	} else {
+		inner = &types.LegacyTx{
+			Nonce:    uint64(args.Nonce),
+			GasPrice: args.GasPrice.ToInt(),
+			Gas:      uint64(args.Gas),
+			To:       args.To,
+			Value:    args.Value.ToInt(),
+			Data:     args.Data,
+		}
+	}
+	signed, err := types.SignNewTx(s.key, types.LatestSignerForChainID(chainID), inner)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"raw": hexutil.Bytes(raw), "tx": signed}, nil
+}
+
+func (s *standInSigner) signData(message hexutil.Bytes) (interface{}, error) {
+	signature, err := NewKeySigner(s.key).SignMessage(context.Background(), message)
+	return hexutil.Bytes(signature), err
+}
+
+// newStandInSigner serves the Clef and node signing APIs for a new key
+func newStandInSigner(t *testing.T) (*standInSigner, *rpctest.MockNode) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	stand := &standInSigner{key: key}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	signTransaction := func(params []json.RawMessage) (interface{}, error) {
+		var args standInArgs
+		if err := json.Unmarshal(params[0], &args); err != nil {
+			return nil, err
+		}
+		if args.From != address {
+			return nil, &rpctest.Error{Code: -32000, Message: "unknown account"}
+		}
+		return stand.signTransaction(args)
+	}
+	node := startMockNode(t).
+		Respond("account_list", []common.Address{address}).
+		Respond("eth_accounts", []common.Address{address}).
+		Handle("account_signTransaction", signTransaction).
+		Handle("eth_signTransaction", signTransaction).
+		Handle("account_signData", func(params []json.RawMessage) (interface{}, error) {
+			var contentType string
+			var message hexutil.Bytes
+			json.Unmarshal(params[0], &contentType)
+			json.Unmarshal(params[2], &message)
+			if contentType != "text/plain" {
+				return nil, &rpctest.Error{Code: -32000, Message: "unsupported content type"}
+			}
+			return stand.signData(message)
+		}).
+		Handle("eth_sign", func(params []json.RawMessage) (interface{}, error) {
+			var message hexutil.Bytes
+			json.Unmarshal(params[1], &message)
+			return stand.signData(message)
+		})
+	return stand, node
+}
+
+func newDynamicFeeTx() *types.Transaction {
+	to := common.HexToAddress("0x5678")
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     3,
+		GasTipCap: big.NewInt(1e9),
+		GasFeeCap: big.NewInt(3e10),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(1e18),
+	})
+}
+
+func TestRemoteSigner(t *testing.T) {
+	ctx := context.Background()
+	stand, node := newStandInSigner(t)
+	address := crypto.PubkeyToAddress(stand.key.PublicKey)
+
+	for _, api := range []SignerAPI{ClefAPI, NodeAPI} {
+		t.Run(api.String(), func(t *testing.T) {
+			signer, err := NewRemoteSigner(node.URL(), address, api)
+			require.NoError(t, err)
+			defer signer.Close()
+
+			accounts, err := signer.Accounts(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []common.Address{address}, accounts)
+
+			assertSigns(t, signer)
+			tx := newDynamicFeeTx()
+			signed, err := signer.SignTx(ctx, tx, big.NewInt(1))
+			require.NoError(t, err)
+			assert.Equal(t, types.LatestSignerForChainID(big.NewInt(1)).Hash(tx), types.LatestSignerForChainID(big.NewInt(1)).Hash(signed))
+		})
+	}
+	assert.Equal(t, 2, node.Calls("account_signTransaction"))
+	assert.Equal(t, 2, node.Calls("eth_signTransaction"))
+	assert.Equal(t, 1, node.Calls("account_signData"))
+	assert.Equal(t, 1, node.Calls("eth_sign"))
+
+	t.Run("tampered transaction", func(t *testing.T) {
+		signer := NewRemoteSignerFromTransport(NewJSONRPCClient(node.URL(), "", 0), address, ClefAPI)
+		stand.tamper = func(tx *types.DynamicFeeTx) { tx.To = &common.Address{0xee} }
+		defer func() { stand.tamper = nil }()
+		_, err := signer.SignTx(ctx, newDynamicFeeTx(), big.NewInt(1))
+		assert.ErrorIs(t, err, ErrSignatureMismatch)
+	})
+
+	t.Run("other chain", func(t *testing.T) {
+		signer := NewRemoteSignerFromTransport(NewJSONRPCClient(node.URL(), "", 0), address, ClefAPI)
+		stand.tamper = func(tx *types.DynamicFeeTx) { tx.ChainID = big.NewInt(5) }
+		defer func() { stand.tamper = nil }()
+		_, err := signer.SignTx(ctx, newDynamicFeeTx(), big.NewInt(1))
+		assert.ErrorIs(t, err, ErrSignatureMismatch)
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		signer := NewRemoteSignerFromTransport(NewJSONRPCClient(node.URL(), "", 0), address, ClefAPI)
+		key := stand.key
+		stand.key, _ = crypto.GenerateKey()
+		defer func() { stand.key = key }()
+		_, err := signer.SignTx(ctx, newDynamicFeeTx(), big.NewInt(1))
+		assert.ErrorIs(t, err, ErrSignatureMismatch)
+		_, err = signer.SignMessage(ctx, []byte("hello"))
+		assert.ErrorIs(t, err, ErrSignatureMismatch)
+	})
+
+	t.Run("refused", func(t *testing.T) {
+		refusing := startMockNode(t).Fail("account_signTransaction", -32000, "Request denied")
+		signer := NewRemoteSignerFromTransport(NewJSONRPCClient(refusing.URL(), "", 0), address, ClefAPI)
+		_, err := signer.SignTx(ctx, newDynamicFeeTx(), big.NewInt(1))
+		assert.ErrorContains(t, err, "Request denied")
+		assert.Equal(t, 1, refusing.Calls("account_signTransaction"), "signing requests are not retried")
+	})
+
+	t.Run("blob transactions", func(t *testing.T) {
+		signer := NewRemoteSignerFromTransport(NewJSONRPCClient(node.URL(), "", 0), address, ClefAPI)
+		_, err := signer.SignTx(ctx, types.NewTx(&types.BlobTx{}), big.NewInt(1))
+		assert.ErrorContains(t, err, "not supported")
+	})
+}
+
+// clefService answers account_ calls over IPC
+type clefService struct {
+	stand *standInSigner
+}
+
+func (s *clefService) SignTransaction(args standInArgs) (interface{}, error) {
+	return s.stand.signTransaction(args)
+}
+
+func TestRemoteSigner_IPC(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("account", &clefService{stand: &standInSigner{key: key}}))
+	defer server.Stop()
+
+	path := filepath.Join(t.TempDir(), "clef.ipc")
+	listener, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer listener.Close()
+	go server.ServeListener(listener)
+
+	signer, err := NewRemoteSigner(path, crypto.PubkeyToAddress(key.PublicKey), ClefAPI)
+	require.NoError(t, err)
+	defer signer.Close()
+	signed, err := signer.SignTx(context.Background(), newDynamicFeeTx(), big.NewInt(1))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), signed.Nonce())
+
+	_, err = NewRemoteSigner(filepath.Join(t.TempDir(), "missing.ipc"), common.Address{}, ClefAPI)
+	assert.Error(t, err)
+}
+
+func TestWeb3Client_SignAndSend(t *testing.T) {
+	ctx := context.Background()
+	stand, node := newStandInSigner(t)
+	var sent []*types.Transaction
+	node.Respond("eth_chainId", "0x1").
+		Handle("eth_sendRawTransaction", func(params []json.RawMessage) (interface{}, error) {
+			var raw hexutil.Bytes
+			json.Unmarshal(params[0], &raw)
+			tx := new(types.Transaction)
+			if err := tx.UnmarshalBinary(raw); err != nil {
+				return nil, err
+			}
+			sent = append(sent, tx)
+			return tx.Hash(), nil
+		})
+	client, err := NewWeb3Client(node.URL())
+	require.NoError(t, err)
+	defer client.Close()
+
+	signer, err := NewRemoteSigner(node.URL(), crypto.PubkeyToAddress(stand.key.PublicKey), ClefAPI)
+	require.NoError(t, err)
+	signed, err := client.SignAndSend(ctx, signer, newDynamicFeeTx())
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, signed.Hash(), sent[0].Hash())
+
+	// Nothing reaches the node when the signature is wrong
+	stand.tamper = func(tx *types.DynamicFeeTx) { tx.Value = big.NewInt(2e18) }
+	_, err = client.SignAndSend(ctx, signer, newDynamicFeeTx())
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+	assert.Len(t, sent, 1)
+}
@@ -0,0 +1,222 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+var fastRetries = RetryConfig{Default: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}}
+
+// scriptedServer answers each call with the next reply of the script for its method
+func scriptedServer(t *testing.T, script map[string][]func(w http.ResponseWriter, id json.RawMessage)) (*httptest.Server, map[string]*int32) {
+	counts := make(map[string]*int32)
+	for method := range script {
+		counts[method] = new(int32)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		json.Unmarshal(body, &req)
+
+		replies := script[req.Method]
+		n := int(atomic.AddInt32(counts[req.Method], 1))
+		if n > len(replies) {
+			n = len(replies)
+		}
+		replies[n-1](w, req.ID)
+	}))
+	t.Cleanup(server.Close)
+	return server, counts
+}
+
+func reply(result string) func(w http.ResponseWriter, id json.RawMessage) {
+	return func(w http.ResponseWriter, id json.RawMessage) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(id) + `,"result":` + result + `}`))
+	}
+}
+
+func replyError(message string) func(w http.ResponseWriter, id json.RawMessage) {
+	return func(w http.ResponseWriter, id json.RawMessage) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(id) + `,"error":{"code":-32000,"message":"` + message + `"}}`))
+	}
+}
+
+func replyStatus(status int) func(w http.ResponseWriter, id json.RawMessage) {
+	return func(w http.ResponseWriter, id json.RawMessage) {
+		w.WriteHeader(status)
+	}
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "base")
+		return newRPCResponse(req, nil), nil
+	})
+
+	req, _ := http.NewRequest(http.MethodPost, "http://node", nil)
+	_, err := Chain(base, tag("outer"), tag("inner")).RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "inner", "base"}, order)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, ClassOK, ClassifyError(nil, http.StatusOK, nil))
+	assert.Equal(t, ClassTransient, ClassifyError(syscall.ECONNRESET, 0, nil))
+	assert.Equal(t, ClassTransient, ClassifyError(context.DeadlineExceeded, 0, nil))
+	assert.Equal(t, ClassPermanent, ClassifyError(context.Canceled, 0, nil))
+	assert.Equal(t, ClassPermanent, ClassifyError(errors.New("boom"), 0, nil))
+	assert.Equal(t, ClassTransient, ClassifyError(nil, http.StatusTooManyRequests, nil))
+	assert.Equal(t, ClassTransient, ClassifyError(nil, http.StatusBadGateway, nil))
+	assert.Equal(t, ClassPermanent, ClassifyError(nil, http.StatusUnauthorized, nil))
+	assert.Equal(t, ClassTransient, ClassifyError(nil, http.StatusOK, &RPCError{Code: -32000, Message: "header not found"}))
+	assert.Equal(t, ClassPermanent, ClassifyError(nil, http.StatusOK, &RPCError{Code: 3, Message: "execution reverted"}))
+}
+
+func TestRetrier_Transient(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_getBalance": {replyStatus(http.StatusServiceUnavailable), replyError("header not found"), reply(`"0x10"`)},
+		"eth_call":       {replyError("execution reverted")},
+	})
+	rt := Chain(nil, RetryMiddleware(fastRetries))
+
+	t.Run("retried until success", func(t *testing.T) {
+		resp, err := sendThrough(context.Background(), rt, server.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[]}`)
+		assert.NoError(t, err)
+		assert.Contains(t, readBody(t, resp), `"0x10"`)
+		assert.Equal(t, int32(3), atomic.LoadInt32(counts["eth_getBalance"]))
+	})
+
+	t.Run("permanent error not retried", func(t *testing.T) {
+		resp, err := sendThrough(context.Background(), rt, server.URL, `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[]}`)
+		assert.NoError(t, err)
+		assert.Contains(t, readBody(t, resp), "execution reverted")
+		assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_call"]))
+	})
+}
+
+func TestRetrier_MethodPolicy(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_getLogs": {replyStatus(http.StatusBadGateway)},
+	})
+	config := fastRetries
+	config.Methods = map[string]RetryPolicy{"eth_getLogs": {MaxAttempts: 1}}
+
+	resp, err := sendThrough(context.Background(), NewRetrier(config, nil), server.URL,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_getLogs"]))
+}
+
+func TestRetrier_MethodPolicyMoreAttempts(t *testing.T) {
+	server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+		"eth_getLogs": {replyStatus(http.StatusBadGateway)},
+	})
+	config := fastRetries
+	config.Methods = map[string]RetryPolicy{"eth_getLogs": {MaxAttempts: 5, BaseDelay: time.Millisecond}}
+	retrier := NewRetrier(config, nil)
+
+	_, err := sendThrough(context.Background(), retrier, server.URL,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), atomic.LoadInt32(counts["eth_getLogs"]), "a single call uses its own policy")
+
+	var hits int32
+	down := newRPCServer(t, http.StatusBadGateway, "", &hits)
+	_, err = sendThrough(context.Background(), retrier, down.URL,
+		`[{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]},{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber","params":[]}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits), "a batch uses the most restrictive policy")
+}
+
+func TestSleepBackOff_NoMaxDelay(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond}
+	var slept time.Duration
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+		assert.NoError(t, sleepBackOff(context.Background(), policy, 3, 0))
+		slept += time.Since(start)
+	}
+	assert.Greater(t, slept, 5*time.Millisecond, "a zero MaxDelay does not disable the back off")
+}
+
+func TestRetrier_SendRawTransaction(t *testing.T) {
+	raw := hexutil.Bytes{0x02, 0xf8, 0x01, 0x02}
+	txHash := hexutil.Encode(crypto.Keccak256(raw))
+	request := `{"jsonrpc":"2.0","id":5,"method":"eth_sendRawTransaction","params":["` + raw.String() + `"]}`
+
+	t.Run("accepted despite failed answer", func(t *testing.T) {
+		server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+			"eth_sendRawTransaction":   {replyStatus(http.StatusBadGateway)},
+			"eth_getTransactionByHash": {reply(`{"hash":"` + txHash + `"}`)},
+		})
+
+		resp, err := sendThrough(context.Background(), NewRetrier(fastRetries, nil), server.URL, request)
+		assert.NoError(t, err)
+		body := readBody(t, resp)
+		assert.Contains(t, body, txHash)
+		assert.Contains(t, body, `"id":5`)
+		assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_sendRawTransaction"]))
+	})
+
+	t.Run("sent again when unknown", func(t *testing.T) {
+		server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+			"eth_sendRawTransaction":   {replyStatus(http.StatusBadGateway), reply(`"` + txHash + `"`)},
+			"eth_getTransactionByHash": {reply(`null`)},
+		})
+
+		resp, err := sendThrough(context.Background(), NewRetrier(fastRetries, nil), server.URL, request)
+		assert.NoError(t, err)
+		assert.Contains(t, readBody(t, resp), txHash)
+		assert.Equal(t, int32(2), atomic.LoadInt32(counts["eth_sendRawTransaction"]))
+	})
+
+	t.Run("rejected transaction not sent again", func(t *testing.T) {
+		server, counts := scriptedServer(t, map[string][]func(http.ResponseWriter, json.RawMessage){
+			"eth_sendRawTransaction":   {replyError("nonce too low")},
+			"eth_getTransactionByHash": {reply(`null`)},
+		})
+
+		resp, err := sendThrough(context.Background(), NewRetrier(fastRetries, nil), server.URL, request)
+		assert.NoError(t, err)
+		assert.Contains(t, readBody(t, resp), "nonce too low")
+		assert.Equal(t, int32(1), atomic.LoadInt32(counts["eth_sendRawTransaction"]))
+		assert.Equal(t, int32(0), atomic.LoadInt32(counts["eth_getTransactionByHash"]))
+	})
+}
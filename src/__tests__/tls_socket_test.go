@@ -2,80 +2,56 @@ package pyweb3
 
 import (
 	"crypto/tls"
-	"net"
+	"fmt"
+	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
-)
-
-func setupTestServer(t *testing.T) (string, int, func()) {
-	// Generate test certificate
-	cert, err := tls.LoadX509KeyPair("testdata/server.crt", "testdata/server.key")
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	config := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-	}
+	"github.com/stretchr/testify/require"
 
-	// Start test server
-	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	go func() {
-		conn, err := listener.Accept()
-		if err != nil {
-			return
-		}
-		defer conn.Close()
-
-		buffer := make([]byte, ReceivingBufferSize)
-		n, err := conn.Read(buffer)
-		if err != nil {
-			return
-		}
+	"web3-rpc-client/src/rpctest"
+)
 
-		// Echo back the received data
-		conn.Write(buffer[:n])
-	}()
+func setupTestServer(t *testing.T) (string, int, *tls.Config) {
+	node := rpctest.NewTLSMockNode().Respond("eth_blockNumber", "0x10")
+	t.Cleanup(node.Close)
 
-	addr := listener.Addr().(*net.TCPAddr)
+	nodeURL, err := url.Parse(node.URL())
+	require.NoError(t, err)
+	port, err := strconv.Atoi(nodeURL.Port())
+	require.NoError(t, err)
 
-	return "127.0.0.1", addr.Port, func() {
-		listener.Close()
-	}
+	return nodeURL.Hostname(), port, &tls.Config{ServerName: nodeURL.Hostname(), RootCAs: node.CertPool()}
 }
 
 func TestTLSSocket(t *testing.T) {
-	domain, port, cleanup := setupTestServer(t)
-	defer cleanup()
+	domain, port, conf := setupTestServer(t)
 
 	// Create new TLS socket
-	socket, err := NewTLSSocket(domain, port)
+	socket, err := NewTLSSocketWithConfig(domain, port, conf)
 	assert.NoError(t, err)
 	assert.NotNil(t, socket)
 	defer socket.Close()
 
 	// Test sending data
-	testData := []byte("Hello, World!")
-	err = socket.Send(testData)
+	body := `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`
+	request := fmt.Sprintf("POST / HTTP/1.1\r\nHost: %s\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", domain, len(body), body)
+	err = socket.Send([]byte(request))
 	assert.NoError(t, err)
 
 	// Test receiving data
 	received, err := socket.Receive()
 	assert.NoError(t, err)
-	assert.Equal(t, testData, received)
+	assert.Contains(t, string(received), "200 OK")
+	assert.Contains(t, string(received), `"result":"0x10"`)
 }
 
 func TestTLSSocketTimeout(t *testing.T) {
-	domain, port, cleanup := setupTestServer(t)
-	defer cleanup()
+	domain, port, conf := setupTestServer(t)
 
-	socket, err := NewTLSSocket(domain, port)
+	socket, err := NewTLSSocketWithConfig(domain, port, conf)
 	assert.NoError(t, err)
 	defer socket.Close()
 
@@ -2,26 +2,56 @@ package pyweb3
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"runtime"
+	"sync"
 	"testing"
-	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
-// MockWeb3Client is a mock implementation of Web3Client
+// MockWeb3Client is a mock implementation of Web3Client. The methods it does
+// not override panic through the nil BatchBackend.
 type MockWeb3Client struct {
 	mock.Mock
+	BatchBackend
+
+	sending  sync.Mutex
+	inflight int
+	peak     int
+	finished int
+	// how many sends had finished when each send started, in start order
+	started []int
 }
 
-func (m *MockWeb3Client) SendTransaction(from, to common.Address, amount *big.Int) (*types.Transaction, error) {
+// SendTransaction records how many sends are in flight
+func (m *MockWeb3Client) SendTransaction(ctx context.Context, from, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	m.sending.Lock()
+	m.inflight++
+	if m.inflight > m.peak {
+		m.peak = m.inflight
+	}
+	m.started = append(m.started, m.finished)
+	m.sending.Unlock()
+	defer func() {
+		m.sending.Lock()
+		m.inflight--
+		m.finished++
+		m.sending.Unlock()
+	}()
+
+	runtime.Gosched()
 	args := m.Called(from, to, amount)
-	return args.Get(0).(*types.Transaction), args.Error(1)
+	tx, _ := args.Get(0).(*types.Transaction)
+	return tx, args.Error(1)
 }
 
 func (m *MockWeb3Client) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
@@ -66,13 +96,65 @@ func TestBatchProcessor_BatchTransfer(t *testing.T) {
 	mockClient.On("SendTransaction", from, common.HexToAddress("0x9abc"), big.NewInt(2000)).Return(tx2, nil)
 
 	// Execute batch transfer
-	results := bp.BatchTransfer(from, transfers)
+	results := bp.BatchTransfer(context.Background(), from, transfers)
 
 	// Verify results
 	assert.Equal(t, 2, len(results))
 	mockClient.AssertExpectations(t)
 }
 
+func TestBatchProcessor_SignedBatchTransfer(t *testing.T) {
+	head, _ := json.Marshal(&types.Header{Number: big.NewInt(1), Difficulty: new(big.Int)})
+	var sent []*types.Transaction
+	node := startMockNode(t).
+		Respond("eth_chainId", "0x7a69").
+		Respond("eth_getTransactionCount", "0x4").
+		Respond("eth_getBlockByNumber", json.RawMessage(head)).
+		Respond("eth_gasPrice", "0x3b9aca00").
+		Respond("eth_estimateGas", "0x5208").
+		Handle("eth_sendRawTransaction", func(params []json.RawMessage) (interface{}, error) {
+			var raw hexutil.Bytes
+			json.Unmarshal(params[0], &raw)
+			tx := new(types.Transaction)
+			if err := tx.UnmarshalBinary(raw); err != nil {
+				return nil, err
+			}
+			sent = append(sent, tx)
+			return tx.Hash(), nil
+		})
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	wallet, err := NewHDWallet(hardhatMnemonic, "")
+	assert.NoError(t, err)
+	signer, err := wallet.Account(0)
+	assert.NoError(t, err)
+
+	transfers := map[common.Address]*big.Int{
+		common.HexToAddress("0x9abc"): big.NewInt(2000),
+		common.HexToAddress("0x5678"): big.NewInt(1000),
+	}
+	results := NewBatchProcessor(client, 10, 2).SignedBatchTransfer(context.Background(), signer, transfers)
+
+	assert.Len(t, results, 2)
+	assert.Len(t, sent, 2)
+	for i, result := range results {
+		assert.NoError(t, result.Error)
+		assert.Equal(t, sent[i].Hash(), result.TxHash)
+		assert.Equal(t, result.To, *sent[i].To())
+		assert.Equal(t, uint64(4+i), sent[i].Nonce())
+		from, err := types.Sender(types.LatestSignerForChainID(big.NewInt(31337)), sent[i])
+		assert.NoError(t, err)
+		assert.Equal(t, signer.Address(), from)
+	}
+	assert.Equal(t, common.HexToAddress("0x5678"), results[0].To)
+
+	signer.Zero()
+	results = NewBatchProcessor(client, 10, 2).SignedBatchTransfer(context.Background(), signer, transfers)
+	assert.ErrorIs(t, results[0].Error, ErrAccountLocked)
+}
+
 func TestEventFilter(t *testing.T) {
 	mockClient := new(MockWeb3Client)
 	ef := NewEventFilter(mockClient)
@@ -109,9 +191,9 @@ func TestEventFilter(t *testing.T) {
 	// Test SubscribeLogs
 	mockSub := new(MockSubscription)
 	errCh := make(chan error)
-	mockSub.On("Err").Return(errCh)
+	mockSub.On("Err").Return(errCh).Maybe()
 
-	mockClient.On("SubscribeFilterLogs", ctx, ef.query, mock.AnyChan()).Return(mockSub, nil)
+	mockClient.On("SubscribeFilterLogs", ctx, ef.query, mock.Anything).Return(mockSub, nil)
 	logCh, sub, err := ef.SubscribeLogs(ctx)
 	assert.NoError(t, err)
 	assert.NotNil(t, logCh)
@@ -137,14 +219,12 @@ func TestBatchProcessor_ConcurrencyLimit(t *testing.T) {
 		mockClient.On("SendTransaction", from, addr, transfers[addr]).Return(tx, nil)
 	}
 
-	// Add timing checks to verify concurrency
-	start := time.Now()
-	results := bp.BatchTransfer(from, transfers)
-	duration := time.Since(start)
+	results := bp.BatchTransfer(context.Background(), from, transfers)
 
 	// Verify results
 	assert.Equal(t, 5, len(results))
-	assert.True(t, duration >= time.Duration(5/concurrent)*100*time.Millisecond) // Assuming each transfer takes ~100ms
+	assert.GreaterOrEqual(t, mockClient.peak, 1)
+	assert.LessOrEqual(t, mockClient.peak, concurrent)
 
 	mockClient.AssertExpectations(t)
 }
@@ -167,7 +247,7 @@ func TestBatchProcessor_ErrorHandling(t *testing.T) {
 	mockClient.On("SendTransaction", from, common.HexToAddress("0xdef0"), big.NewInt(3000)).Return(tx1, nil)
 
 	// Execute batch transfer
-	results := bp.BatchTransfer(from, transfers)
+	results := bp.BatchTransfer(context.Background(), from, transfers)
 
 	// Verify results
 	assert.Equal(t, 3, len(results))
@@ -195,11 +275,16 @@ func TestBatchProcessor_BatchSizeLimit(t *testing.T) {
 	}
 
 	// Execute batch transfer
-	results := bp.BatchTransfer(from, transfers)
+	results := bp.BatchTransfer(context.Background(), from, transfers)
 
 	// Verify results
 	assert.Equal(t, 5, len(results))
-	assert.Equal(t, 2, len(mockClient.Calls)/3) // Should have processed in 2 batches
+	assert.LessOrEqual(t, mockClient.peak, 2)
+	// A send of the second batch starts only once the first batch is done
+	require.Len(t, mockClient.started, 5)
+	for k, finished := range mockClient.started {
+		assert.GreaterOrEqual(t, finished, k/batchSize*batchSize, "send %d", k)
+	}
 	mockClient.AssertExpectations(t)
 }
 
@@ -228,9 +313,9 @@ func TestEventFilter_ContextCancellation(t *testing.T) {
 
 	mockSub := new(MockSubscription)
 	errCh := make(chan error)
-	mockSub.On("Err").Return(errCh)
+	mockSub.On("Err").Return(errCh).Maybe()
 
-	mockClient.On("SubscribeFilterLogs", ctx, ef.query, mock.AnyChan()).Return(mockSub, context.Canceled)
+	mockClient.On("SubscribeFilterLogs", ctx, ef.query, mock.Anything).Return(mockSub, context.Canceled)
 
 	_, _, err := ef.SubscribeLogs(ctx)
 	assert.Error(t, err)
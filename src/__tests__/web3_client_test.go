@@ -0,0 +1,220 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+
+	"web3-rpc-client/src/rpctest"
+)
+
+// newAccountNode answers account and block queries of a devnet at block 0x10.
+// A transaction receipt is only found after receiptAfter lookups.
+func newAccountNode(t *testing.T, receiptAfter int32) *rpctest.MockNode {
+	var lookups int32
+	return startMockNode(t).
+		Respond("eth_chainId", hexutil.Uint64(31337)).
+		Respond("eth_blockNumber", "0x10").
+		Respond("eth_getBalance", hexutil.Big(*big.NewInt(1e18))).
+		Handle("eth_getTransactionCount", func(params []json.RawMessage) (interface{}, error) {
+			var block string
+			json.Unmarshal(params[1], &block)
+			if block == "pending" {
+				return "0x6", nil
+			}
+			return "0x5", nil
+		}).
+		Respond("eth_gasPrice", "0x3b9aca00").
+		Respond("eth_estimateGas", "0x5208").
+		Handle("eth_call", func([]json.RawMessage) (interface{}, error) {
+			return nil, revert(hexutil.MustDecode("0x08c379a0"))
+		}).
+		Respond("eth_getCode", "0x").
+		Respond("eth_newFilter", "0x1").
+		Respond("eth_getFilterLogs", []types.Log{}).
+		Respond("eth_getLogs", []types.Log{}).
+		Handle("eth_getTransactionReceipt", func([]json.RawMessage) (interface{}, error) {
+			if atomic.AddInt32(&lookups, 1) <= receiptAfter {
+				return nil, nil
+			}
+			return &types.Receipt{Status: 1, BlockNumber: big.NewInt(16), Logs: []*types.Log{}}, nil
+		})
+}
+
+func TestWeb3Client_Transports(t *testing.T) {
+	ctx := context.Background()
+	node := newAccountNode(t, 0)
+	address := common.HexToAddress("0x01")
+
+	viaEthclient, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	viaJSONRPC, err := NewWeb3ClientFromTransport(NewJSONRPCClient(node.URL(), DEFAULT_USER_AGENT, 0))
+	assert.NoError(t, err)
+
+	for name, client := range map[string]*Web3Client{"ethclient": viaEthclient, "JSONRPCClient": viaJSONRPC} {
+		t.Run(name, func(t *testing.T) {
+			defer client.Close()
+
+			chain, err := client.Chain(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(31337), chain.ChainID)
+
+			number, err := client.BlockNumber(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(16), number)
+
+			balance, err := client.BalanceAt(ctx, address, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, big.NewInt(1e18), balance)
+
+			nonce, err := client.NonceAt(ctx, address, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(5), nonce)
+			nonce, err = client.PendingNonceAt(ctx, address)
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(6), nonce)
+
+			gas, err := client.EstimateGas(ctx, ethereum.CallMsg{To: &address})
+			assert.NoError(t, err)
+			assert.Equal(t, uint64(21000), gas)
+
+			// revert data survives the transport
+			_, err = client.CallContract(ctx, ethereum.CallMsg{To: &address}, nil)
+			assert.Equal(t, hexutil.MustDecode("0x08c379a0"), revertData(err))
+
+			id, err := client.NewFilter(ctx, ethereum.FilterQuery{Addresses: []common.Address{address}})
+			assert.NoError(t, err)
+			logs, err := client.FilterLogsByID(ctx, id)
+			assert.NoError(t, err)
+			assert.Empty(t, logs)
+
+			// batches go through the transport too
+			call, err := NewCall3(address, &erc20ABI, "balanceOf", true, address)
+			assert.NoError(t, err)
+			results, err := NewMulticall(client, Multicall3Address).Aggregate(ctx, []Call3{call, call}, nil)
+			assert.NoError(t, err)
+			assert.Len(t, results, 2)
+			assert.Error(t, results[1].Error)
+		})
+	}
+}
+
+func TestWeb3Client_WaitForTransaction(t *testing.T) {
+	RegisterChain(ChainProfile{ChainID: 31337, Name: "Devnet", BlockTime: time.Millisecond, FinalityDepth: 1, EIP1559: true})
+	client, err := NewWeb3Client(newAccountNode(t, 2).URL())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	receipt, err := client.WaitForTransaction(ctx, common.HexToHash("0x123"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(1), receipt.Status)
+	}
+
+	client, err = NewWeb3Client(newAccountNode(t, 1000).URL())
+	assert.NoError(t, err)
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	receipt, err = client.WaitForTransaction(ctx, common.HexToHash("0x123"))
+	assert.Error(t, err)
+	assert.Nil(t, receipt)
+}
+
+func TestJSONRPCClient(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, DEFAULT_USER_AGENT, r.Header.Get("User-Agent"))
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var msgs []*rpcMessage
+		json.NewDecoder(r.Body).Decode(&msgs)
+		replies := make([]*rpcMessage, len(msgs))
+		for i, msg := range msgs {
+			replies[len(msgs)-1-i] = &rpcMessage{Version: "2.0", ID: msg.ID, Result: json.RawMessage(`"` + msg.Method + `"`)}
+		}
+		replies[0].Result, replies[0].Error = nil, &RPCError{Code: -32000, Message: "boom"}
+		json.NewEncoder(w).Encode(replies)
+	}))
+	defer server.Close()
+
+	client := NewJSONRPCClient(server.URL, DEFAULT_USER_AGENT, 1)
+	var first, second string
+	batch := []rpc.BatchElem{
+		{Method: "eth_first", Result: &first},
+		{Method: "eth_second", Result: &second},
+	}
+	assert.NoError(t, client.BatchCallContext(context.Background(), batch))
+	assert.Equal(t, int32(2), attempts)
+	assert.Equal(t, "eth_first", first)
+	assert.Equal(t, "boom", batch[1].Error.(*RPCError).Message)
+
+	client.Retries = 0
+	atomic.StoreInt32(&attempts, 0)
+	assert.Error(t, client.CallContext(context.Background(), &first, "eth_first"))
+}
+
+func TestDecodeEvents(t *testing.T) {
+	contractAbi, _ := abi.JSON(strings.NewReader(ERC20ABI))
+	from, to := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	data, _ := contractAbi.Events["Transfer"].Inputs.NonIndexed().Pack(big.NewInt(7))
+	logs := []types.Log{
+		{Topics: []common.Hash{contractAbi.Events["Transfer"].ID, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}, Data: data},
+		{Topics: []common.Hash{crypto.Keccak256Hash([]byte("Unknown()"))}},
+	}
+
+	events, err := DecodeEvents(&contractAbi, logs)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, from, events[0]["from"])
+	assert.Equal(t, to, events[0]["to"])
+	assert.Equal(t, big.NewInt(7), events[0]["value"])
+}
+
+func TestWeb3Client_FilterLogsRange(t *testing.T) {
+	var ranges []string
+	node := startMockNode(t).
+		Respond("eth_chainId", "0x1").
+		Handle("eth_getLogs", func(params []json.RawMessage) (interface{}, error) {
+			var arg struct{ FromBlock, ToBlock hexutil.Uint64 }
+			json.Unmarshal(params[0], &arg)
+			ranges = append(ranges, fmt.Sprintf("%d-%d", arg.FromBlock, arg.ToBlock))
+			if arg.ToBlock-arg.FromBlock >= 3 {
+				return nil, &rpctest.Error{Code: -32005, Message: "query returned more than 10000 results"}
+			}
+			return []types.Log{{Address: common.HexToAddress("0x1"), BlockNumber: uint64(arg.FromBlock), Topics: []common.Hash{}}}, nil
+		})
+	client, err := NewWeb3Client(node.URL())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	logs, err := client.FilterLogsRange(context.Background(), ethereum.FilterQuery{}, 10, 20, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10-15", "10-12", "13-15", "16-20", "16-18", "19-20"}, ranges)
+	blocks := make([]uint64, len(logs))
+	for i, log := range logs {
+		blocks[i] = log.BlockNumber
+	}
+	assert.Equal(t, []uint64{10, 13, 16, 19}, blocks)
+
+	node.Fail("eth_getLogs", -32000, "header not found")
+	_, err = client.FilterLogsRange(context.Background(), ethereum.FilterQuery{}, 10, 20, 6)
+	assert.ErrorContains(t, err, "blocks 10-15")
+}
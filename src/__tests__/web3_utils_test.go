@@ -1,4 +1,4 @@
-package main
+package pyweb3
 
 import (
 	"context"
@@ -13,23 +13,29 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
-// MockWeb3Client is a mock implementation of the Web3Client
-type MockWeb3Client struct {
+// MockWatcherBackend is a mock implementation of WatcherBackend
+type MockWatcherBackend struct {
 	mock.Mock
 }
 
-func (m *MockWeb3Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+// Chain fails, so that the watcher keeps its own confirmation count
+func (m *MockWatcherBackend) Chain(ctx context.Context) (ChainProfile, error) {
+	return ChainProfile{}, errors.New("no chain")
+}
+
+func (m *MockWatcherBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
 	args := m.Called(ctx, txHash)
-	return args.Get(0).(*types.Receipt), args.Error(1)
+	receipt, _ := args.Get(0).(*types.Receipt)
+	return receipt, args.Error(1)
 }
 
-func (m *MockWeb3Client) BlockNumber(ctx context.Context) (uint64, error) {
+func (m *MockWatcherBackend) BlockNumber(ctx context.Context) (uint64, error) {
 	args := m.Called(ctx)
 	return args.Get(0).(uint64), args.Error(1)
 }
 
 func TestNewTransactionWatcher(t *testing.T) {
-	client := &MockWeb3Client{}
+	client := &MockWatcherBackend{}
 	timeout := 10 * time.Second
 	blocks := uint64(6)
 
@@ -42,7 +48,7 @@ func TestNewTransactionWatcher(t *testing.T) {
 }
 
 func TestWaitForConfirmations_Success(t *testing.T) {
-	client := &MockWeb3Client{}
+	client := &MockWatcherBackend{}
 	txHash := common.HexToHash("0x12345")
 	receipt := &types.Receipt{
 		BlockNumber: big.NewInt(100),
@@ -61,8 +67,28 @@ func TestWaitForConfirmations_Success(t *testing.T) {
 	client.AssertExpectations(t)
 }
 
+func TestWaitForConfirmations_Inclusion(t *testing.T) {
+	client := &MockWatcherBackend{}
+	txHash := common.HexToHash("0x12345")
+	receipt := &types.Receipt{BlockNumber: big.NewInt(100)}
+
+	client.On("TransactionReceipt", mock.Anything, txHash).Return(receipt, nil).Times(1)
+	client.On("BlockNumber", mock.Anything).Return(uint64(100), nil).Times(1)
+
+	result, err := NewTransactionWatcher(client, 5*time.Second, 0).WaitForConfirmations(context.Background(), txHash)
+	assert.NoError(t, err)
+	assert.Equal(t, receipt, result)
+	client.AssertExpectations(t)
+}
+
+func TestWaitForConfirmations_UseFinality(t *testing.T) {
+	client := &MockWatcherBackend{}
+	_, err := NewTransactionWatcher(client, time.Second, UseFinality).WaitForConfirmations(context.Background(), common.HexToHash("0x12345"))
+	assert.ErrorContains(t, err, "no chain", "the finality depth needs the chain")
+}
+
 func TestWaitForConfirmations_Timeout(t *testing.T) {
-	client := &MockWeb3Client{}
+	client := &MockWatcherBackend{}
 	txHash := common.HexToHash("0x12345")
 
 	client.On("TransactionReceipt", mock.Anything, txHash).Return(nil, errors.New("not found")).Maybe()
@@ -80,13 +106,13 @@ func TestWaitForConfirmations_Timeout(t *testing.T) {
 }
 
 func TestWaitForConfirmations_ClientError(t *testing.T) {
-	client := &MockWeb3Client{}
+	client := &MockWatcherBackend{}
 	txHash := common.HexToHash("0x12345")
 
+	// polled every second, the receipt is never found so the block number is never read
 	client.On("TransactionReceipt", mock.Anything, txHash).Return(nil, errors.New("client error")).Times(3)
-	client.On("BlockNumber", mock.Anything).Return(uint64(0), errors.New("client error")).Times(3)
 
-	tw := NewTransactionWatcher(client, 5*time.Second, 6)
+	tw := NewTransactionWatcher(client, 3500*time.Millisecond, 6)
 	ctx := context.Background()
 
 	result, err := tw.WaitForConfirmations(ctx, txHash)
@@ -97,7 +123,7 @@ func TestWaitForConfirmations_ClientError(t *testing.T) {
 }
 
 func TestWaitForConfirmations_InsufficientConfirmations(t *testing.T) {
-	client := &MockWeb3Client{}
+	client := &MockWatcherBackend{}
 	txHash := common.HexToHash("0x12345")
 	receipt := &types.Receipt{
 		BlockNumber: big.NewInt(100),
@@ -1,27 +1,30 @@
-package main
+package pyweb3
 
 import (
-	"net/http/httptest"
+	"crypto/tls"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/websocket"
+
+	"web3-rpc-client/src/rpctest"
 )
 
-func TestNewWebSocketClient(t *testing.T) {
-	// Override timeout constants for faster tests
-	originalCyclesTimeout := cyclesTimeout
-	originalUnitWaitingTime := unitWaitingTime
-	defer func() {
-		cyclesTimeout = originalCyclesTimeout
-		unitWaitingTime = originalUnitWaitingTime
-	}()
-	cyclesTimeout = 2
-	unitWaitingTime = 100 * time.Millisecond
+// newGreetingNode starts a TLS mock node sending messages on each connection
+func newGreetingNode(t *testing.T, messages ...string) (string, *tls.Config) {
+	node := rpctest.NewTLSMockNode().Greet(messages...)
+	t.Cleanup(node.Close)
+	return "wss" + node.URL()[len("https"):], &tls.Config{RootCAs: node.CertPool()}
+}
 
+// newTestWebSocketClient connects with a short handshake timeout
+func newTestWebSocketClient(wsURL string, tlsConfig *tls.Config) (*WebSocketClient, error) {
+	return NewWebSocketClientWithConfig(wsURL, "test-agent", WebSocketConfig{TLS: tlsConfig, HandshakeTimeout: 200 * time.Millisecond})
+}
+
+func TestNewWebSocketClient(t *testing.T) {
 	t.Run("invalid URL", func(t *testing.T) {
-		_, err := NewWebSocketClient("invalid-url", "test-agent")
+		_, err := NewWebSocketClient("wss://[::1", "test-agent")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "Invalid URL")
 	})
@@ -33,19 +36,9 @@ func TestNewWebSocketClient(t *testing.T) {
 	})
 
 	t.Run("successful connection with handshake", func(t *testing.T) {
-		// Create test server
-		server := httptest.NewTLSServer(websocket.Handler(func(ws *websocket.Conn) {
-			// Send "established" message
-			websocket.Message.Send(ws, "established")
-			// Keep connection alive for test duration
-			select {}
-		}))
-		defer server.Close()
-
-		// Convert http URL to wss
-		wsURL := "wss" + server.URL[4:]
-
-		client, err := NewWebSocketClient(wsURL, "test-agent")
+		wsURL, tlsConfig := newGreetingNode(t, "established")
+
+		client, err := newTestWebSocketClient(wsURL, tlsConfig)
 		assert.NoError(t, err)
 		assert.NotNil(t, client)
 		assert.NotNil(t, client.Conn)
@@ -54,29 +47,18 @@ func TestNewWebSocketClient(t *testing.T) {
 	})
 
 	t.Run("handshake timeout", func(t *testing.T) {
-		server := httptest.NewTLSServer(websocket.Handler(func(ws *websocket.Conn) {
-			// Don't send any message, let it timeout
-			select {}
-		}))
-		defer server.Close()
-
-		wsURL := "wss" + server.URL[4:]
+		// Don't send any message, let it timeout
+		wsURL, tlsConfig := newGreetingNode(t)
 
-		_, err := NewWebSocketClient(wsURL, "test-agent")
+		_, err := newTestWebSocketClient(wsURL, tlsConfig)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "WebSocket handshake timeout")
 	})
 
 	t.Run("handshake rejected", func(t *testing.T) {
-		server := httptest.NewTLSServer(websocket.Handler(func(ws *websocket.Conn) {
-			websocket.Message.Send(ws, "rejected")
-			select {}
-		}))
-		defer server.Close()
-
-		wsURL := "wss" + server.URL[4:]
+		wsURL, tlsConfig := newGreetingNode(t, "rejected")
 
-		_, err := NewWebSocketClient(wsURL, "test-agent")
+		_, err := newTestWebSocketClient(wsURL, tlsConfig)
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "WebSocket handshake rejected")
 	})
@@ -132,6 +114,14 @@ func TestWaitForHandshake(t *testing.T) {
 		assert.Contains(t, err.Error(), "WebSocket handshake rejected")
 	})
 
+	t.Run("configured timeout", func(t *testing.T) {
+		client := &WebSocketClient{handshakeTimeout: 100 * time.Millisecond}
+		start := time.Now()
+		err := client.waitForHandshake()
+		assert.ErrorContains(t, err, "WebSocket handshake timeout")
+		assert.Less(t, time.Since(start), unitWaitingTime)
+	})
+
 	t.Run("multiple messages before established", func(t *testing.T) {
 		client := &WebSocketClient{
 			ReceivedMessages: []string{"msg1", "msg2", "established"},
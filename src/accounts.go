@@ -0,0 +1,429 @@
+package pyweb3
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slog"
+)
+
+// Signer signs transactions and messages for one account. Keys held in
+// memory, keystore files and HD wallet accounts all implement it.
+type Signer interface {
+	// Address is the account signed for
+	Address() common.Address
+	// SignTx signs a transaction for the chain
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// SignMessage signs an EIP-191 personal message, as personal_sign does
+	SignMessage(ctx context.Context, message []byte) ([]byte, error)
+}
+
+// ErrAccountLocked is returned when signing with a locked or wiped account
+var ErrAccountLocked = errors.New("account is locked")
+
+// NewTransactOpts returns transact options signing with signer, for contract
+// bindings and BatchTransferTokens
+func NewTransactOpts(ctx context.Context, signer Signer, chainID *big.Int) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From:    signer.Address(),
+		Context: ctx,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != signer.Address() {
+				return nil, bind.ErrNotAuthorized
+			}
+			return signer.SignTx(ctx, tx, chainID)
+		},
+	}
+}
+
+// signMessage signs the EIP-191 hash of message with a V of 27 or 28
+func signMessage(key *ecdsa.PrivateKey, message []byte) ([]byte, error) {
+	signature, err := crypto.Sign(accounts.TextHash(message), key)
+	if err != nil {
+		return nil, err
+	}
+	signature[crypto.RecoveryIDOffset] += 27
+	return signature, nil
+}
+
+// zeroKey overwrites the secret of a private key
+func zeroKey(key *ecdsa.PrivateKey) {
+	if key == nil || key.D == nil {
+		return
+	}
+	words := key.D.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	key.D.SetInt64(0)
+}
+
+// zeroBytes overwrites a buffer of key material
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// KeySigner signs with a private key held in memory until Zero is called
+type KeySigner struct {
+	address common.Address
+	key     *ecdsa.PrivateKey
+	mutex   sync.Mutex
+}
+
+// NewKeySigner creates a signer owning key, which Zero wipes
+func NewKeySigner(key *ecdsa.PrivateKey) *KeySigner {
+	return &KeySigner{address: crypto.PubkeyToAddress(key.PublicKey), key: key}
+}
+
+// Address returns the address of the key
+func (s *KeySigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx signs a transaction for the chain
+func (s *KeySigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return nil, ErrAccountLocked
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
+
+// SignMessage signs an EIP-191 personal message
+func (s *KeySigner) SignMessage(ctx context.Context, message []byte) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.key == nil {
+		return nil, ErrAccountLocked
+	}
+	return signMessage(s.key, message)
+}
+
+// Zero wipes the key, after which signing fails with ErrAccountLocked
+func (s *KeySigner) Zero() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	zeroKey(s.key)
+	s.key = nil
+}
+
+// KeystoreAccount is an account stored in a Web3 Secret Storage (v3) file.
+// Its key is only decrypted while the account is unlocked, and wiped when it
+// is locked again.
+type KeystoreAccount struct {
+	address common.Address
+	path    string
+	keyJSON []byte
+	key     *ecdsa.PrivateKey
+	timer   *time.Timer
+	mutex   sync.Mutex
+}
+
+// LoadKeystore reads a v3 keystore file. The account starts locked.
+func LoadKeystore(path string) (*KeystoreAccount, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore %s: %v", path, err)
+	}
+	var header struct {
+		Address string `json:"address"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal(keyJSON, &header); err != nil {
+		return nil, fmt.Errorf("invalid keystore %s: %v", path, err)
+	}
+	if header.Version != 3 {
+		return nil, fmt.Errorf("unsupported keystore version %d in %s", header.Version, path)
+	}
+	if !common.IsHexAddress(header.Address) {
+		return nil, fmt.Errorf("invalid address %q in keystore %s", header.Address, path)
+	}
+	return &KeystoreAccount{
+		address: common.HexToAddress(header.Address),
+		path:    path,
+		keyJSON: keyJSON,
+	}, nil
+}
+
+// Address returns the address of the account
+func (a *KeystoreAccount) Address() common.Address {
+	return a.address
+}
+
+// Path returns the keystore file of the account
+func (a *KeystoreAccount) Path() string {
+	return a.path
+}
+
+// Unlock decrypts the key with password. A positive timeout locks the
+// account again after that long, zero keeps it unlocked until Lock.
+func (a *KeystoreAccount) Unlock(password string, timeout time.Duration) error {
+	key, err := keystore.DecryptKey(a.keyJSON, password)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt keystore %s: %v", a.path, err)
+	}
+	if key.Address != a.address {
+		zeroKey(key.PrivateKey)
+		return fmt.Errorf("keystore %s holds the key of %s, not %s", a.path, key.Address.Hex(), a.address.Hex())
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.lock()
+	a.key = key.PrivateKey
+	if timeout > 0 {
+		var timer *time.Timer
+		timer = time.AfterFunc(timeout, func() {
+			a.mutex.Lock()
+			defer a.mutex.Unlock()
+			// A timer stopped too late must not lock a later unlock
+			if a.timer == timer {
+				a.lock()
+			}
+		})
+		a.timer = timer
+	}
+	return nil
+}
+
+// Lock wipes the decrypted key
+func (a *KeystoreAccount) Lock() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.lock()
+}
+
+func (a *KeystoreAccount) lock() {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	zeroKey(a.key)
+	a.key = nil
+}
+
+// Unlocked reports whether the account can sign
+func (a *KeystoreAccount) Unlocked() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.key != nil
+}
+
+// SignTx signs a transaction for the chain, if the account is unlocked
+func (a *KeystoreAccount) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.key == nil {
+		return nil, fmt.Errorf("%s: %w", a.address.Hex(), ErrAccountLocked)
+	}
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), a.key)
+}
+
+// SignMessage signs an EIP-191 personal message, if the account is unlocked
+func (a *KeystoreAccount) SignMessage(ctx context.Context, message []byte) ([]byte, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.key == nil {
+		return nil, fmt.Errorf("%s: %w", a.address.Hex(), ErrAccountLocked)
+	}
+	return signMessage(a.key, message)
+}
+
+// KeystoreConfig sets where and how a Keystore keeps its files
+type KeystoreConfig struct {
+	// Dir holds one v3 file per account
+	Dir string
+	// ScryptN and ScryptP are the key derivation costs of new files,
+	// keystore.StandardScryptN and StandardScryptP when zero
+	ScryptN int
+	ScryptP int
+	// LockTimeout locks accounts unlocked through the keystore after this long,
+	// zero meaning until Lock
+	LockTimeout time.Duration
+	// Logger receives the files skipped while loading, the package default if nil
+	Logger *slog.Logger
+}
+
+// Keystore manages the v3 keystore files of a directory
+type Keystore struct {
+	config   KeystoreConfig
+	accounts map[common.Address]*KeystoreAccount
+	mutex    sync.Mutex
+}
+
+// NewKeystore creates the directory if needed and loads the files already in it
+func NewKeystore(config KeystoreConfig) (*Keystore, error) {
+	if config.ScryptN == 0 {
+		config.ScryptN = keystore.StandardScryptN
+	}
+	if config.ScryptP == 0 {
+		config.ScryptP = keystore.StandardScryptP
+	}
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create keystore directory: %v", err)
+	}
+	entries, err := os.ReadDir(config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore directory: %v", err)
+	}
+
+	ks := &Keystore{config: config, accounts: make(map[common.Address]*KeystoreAccount)}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name[0] == '.' || filepath.Ext(name) == ".tmp" {
+			continue
+		}
+		account, err := LoadKeystore(filepath.Join(config.Dir, name))
+		if err != nil {
+			loggerOr(config.Logger).Warn("Skipping keystore file", "file", name, "error", err)
+			continue
+		}
+		if _, ok := ks.accounts[account.address]; ok {
+			return nil, fmt.Errorf("account %s is stored twice in %s", account.address.Hex(), config.Dir)
+		}
+		ks.accounts[account.address] = account
+	}
+	return ks, nil
+}
+
+// Accounts returns the addresses of the stored accounts, sorted
+func (ks *Keystore) Accounts() []common.Address {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	addresses := make([]common.Address, 0, len(ks.accounts))
+	for address := range ks.accounts {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Cmp(addresses[j]) < 0
+	})
+	return addresses
+}
+
+// Account returns a stored account
+func (ks *Keystore) Account(address common.Address) (*KeystoreAccount, error) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	account, ok := ks.accounts[address]
+	if !ok {
+		return nil, fmt.Errorf("no account %s in keystore", address.Hex())
+	}
+	return account, nil
+}
+
+// Unlock unlocks a stored account for the configured lock timeout
+func (ks *Keystore) Unlock(address common.Address, password string) (*KeystoreAccount, error) {
+	account, err := ks.Account(address)
+	if err != nil {
+		return nil, err
+	}
+	if err := account.Unlock(password, ks.config.LockTimeout); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// LockAll locks every stored account
+func (ks *Keystore) LockAll() {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	for _, account := range ks.accounts {
+		account.Lock()
+	}
+}
+
+// NewAccount generates a key and stores it encrypted with password
+func (ks *Keystore) NewAccount(password string) (*KeystoreAccount, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+	defer zeroKey(key)
+	return ks.store(key, password)
+}
+
+// ImportKey stores a copy of key encrypted with password. The caller still
+// owns key.
+func (ks *Keystore) ImportKey(key *ecdsa.PrivateKey, password string) (*KeystoreAccount, error) {
+	return ks.store(key, password)
+}
+
+// ImportMnemonic derives the key at path from a BIP-39 mnemonic and stores it
+// encrypted with password
+func (ks *Keystore) ImportMnemonic(mnemonic, passphrase string, path accounts.DerivationPath, password string) (*KeystoreAccount, error) {
+	wallet, err := NewHDWallet(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer wallet.Zero()
+	key, err := wallet.deriveKey(path)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+	return ks.store(key, password)
+}
+
+// store encrypts key into a new file named like geth names its own
+func (ks *Keystore) store(key *ecdsa.PrivateKey, password string) (*KeystoreAccount, error) {
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	keyJSON, err := keystore.EncryptKey(&keystore.Key{Id: id, Address: address, PrivateKey: key}, password, ks.config.ScryptN, ks.config.ScryptP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key: %v", err)
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	if _, ok := ks.accounts[address]; ok {
+		return nil, fmt.Errorf("account %s is already in keystore", address.Hex())
+	}
+
+	name := fmt.Sprintf("UTC--%s--%x", time.Now().UTC().Format("2006-01-02T15-04-05.000000000Z"), address)
+	path := filepath.Join(ks.config.Dir, name)
+	tmp, err := os.CreateTemp(ks.config.Dir, name+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to save keystore: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(keyJSON); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to save keystore: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to save keystore: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to save keystore: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to save keystore: %v", err)
+	}
+
+	account := &KeystoreAccount{address: address, path: path, keyJSON: keyJSON}
+	ks.accounts[address] = account
+	return account, nil
+}
@@ -0,0 +1,104 @@
+package pyweb3
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Amount is a token quantity kept in base units along with the token decimals,
+// so conversions to and from human strings never go through floats
+type Amount struct {
+	Value    *big.Int
+	Decimals uint8
+}
+
+// NewAmount wraps a quantity given in base units
+func NewAmount(value *big.Int, decimals uint8) Amount {
+	return Amount{Value: new(big.Int).Set(value), Decimals: decimals}
+}
+
+// ParseAmount converts a human string such as "12.5" into base units.
+// More fractional digits than decimals is an error rather than a silent rounding.
+func ParseAmount(s string, decimals uint8) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return Amount{}, fmt.Errorf("invalid amount: %q", s)
+	}
+	if len(frac) > int(decimals) {
+		return Amount{}, fmt.Errorf("amount %s has more than %d decimals", s, decimals)
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return Amount{}, fmt.Errorf("invalid amount: %q", s)
+			}
+		}
+	}
+
+	digits := whole + frac + strings.Repeat("0", int(decimals)-len(frac))
+	value, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Amount{}, fmt.Errorf("invalid amount: %q", s)
+	}
+	if negative {
+		value.Neg(value)
+	}
+	return Amount{Value: value, Decimals: decimals}, nil
+}
+
+// MustParseAmount is like ParseAmount but panics on error, for constants
+func MustParseAmount(s string, decimals uint8) Amount {
+	amount, err := ParseAmount(s, decimals)
+	if err != nil {
+		panic(err)
+	}
+	return amount
+}
+
+// String formats the amount as a human string without trailing zeros
+func (a Amount) String() string {
+	if a.Value == nil {
+		return "0"
+	}
+	digits := new(big.Int).Abs(a.Value).String()
+	sign := ""
+	if a.Value.Sign() < 0 {
+		sign = "-"
+	}
+	if a.Decimals == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= int(a.Decimals) {
+		digits = strings.Repeat("0", int(a.Decimals)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(a.Decimals)
+	whole, frac := digits[:point], strings.TrimRight(digits[point:], "0")
+	if frac == "" {
+		return sign + whole
+	}
+	return sign + whole + "." + frac
+}
+
+// BaseUnits returns a copy of the quantity in base units
+func (a Amount) BaseUnits() *big.Int {
+	if a.Value == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(a.Value)
+}
+
+// Cmp compares two amounts of the same token
+func (a Amount) Cmp(b Amount) int {
+	return a.BaseUnits().Cmp(b.BaseUnits())
+}
+
+// MarshalText encodes the amount as its human string
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
@@ -0,0 +1,101 @@
+package pyweb3
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// The interfaces below are what each helper needs from a node. *Web3Client
+// implements all of them, and tests can substitute their own.
+
+// ChainInfo reports the profile of the connected chain
+type ChainInfo interface {
+	Chain(ctx context.Context) (ChainProfile, error)
+}
+
+// WatcherBackend is what a TransactionWatcher needs
+type WatcherBackend interface {
+	ChainInfo
+	ethereum.BlockNumberReader
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// GasBackend is what a GasEstimator needs
+type GasBackend interface {
+	ChainInfo
+	ethereum.ContractCaller
+	ethereum.GasEstimator
+	ethereum.GasPricer
+	ethereum.GasPricer1559
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// NonceBackend is what signing needs to number transactions
+type NonceBackend interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+}
+
+// SendBackend is what building and sending transfers needs
+type SendBackend interface {
+	// SendTransaction builds an unsigned transfer priced for the chain
+	SendTransaction(ctx context.Context, from, to common.Address, amount *big.Int) (*types.Transaction, error)
+	SendRawTransaction(ctx context.Context, tx *types.Transaction) error
+	PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error)
+}
+
+// BalanceBackend is what a preflight needs to check funds
+type BalanceBackend interface {
+	ethereum.PendingContractCaller
+	PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error)
+}
+
+// BatchBackend is what a BatchProcessor needs to price, send and track
+// transfers
+type BatchBackend interface {
+	GasBackend
+	NonceBackend
+	SendBackend
+	BalanceBackend
+	ethereum.TransactionReader
+	ResolveAddress(ctx context.Context, input string) (common.Address, error)
+}
+
+// ContractReader is what contract bindings need to read contracts and their
+// events
+type ContractReader interface {
+	bind.ContractCaller
+	ethereum.LogFilterer
+}
+
+// contractTransactor adapts a BatchBackend to bind.ContractTransactor, whose
+// SendTransaction sends a signed transaction
+type contractTransactor struct {
+	BatchBackend
+}
+
+var _ bind.ContractTransactor = contractTransactor{}
+
+// SendTransaction sends a signed transaction
+func (b contractTransactor) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	return b.SendRawTransaction(ctx, tx)
+}
+
+// contractBackend joins a ContractReader and a contractTransactor into a
+// bind.ContractBackend
+type contractBackend struct {
+	ContractReader
+	contractTransactor
+}
+
+var _ bind.ContractBackend = contractBackend{}
+
+// ContractBackend returns the client as a bind.ContractBackend for contract bindings
+func (w *Web3Client) ContractBackend() bind.ContractBackend {
+	return contractBackend{w, contractTransactor{w}}
+}
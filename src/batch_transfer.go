@@ -0,0 +1,418 @@
+package pyweb3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TokenStandard is the kind of asset moved by a transfer instruction
+type TokenStandard int
+
+const (
+	// Native is the chain currency, such as ETH
+	Native TokenStandard = iota
+	// ERC20Token is a fungible token
+	ERC20Token
+	// ERC721Token is a non fungible token
+	ERC721Token
+	// ERC1155Token is a multi token
+	ERC1155Token
+)
+
+func (s TokenStandard) String() string {
+	switch s {
+	case Native:
+		return "native"
+	case ERC20Token:
+		return "ERC-20"
+	case ERC721Token:
+		return "ERC-721"
+	case ERC1155Token:
+		return "ERC-1155"
+	}
+	return fmt.Sprintf("TokenStandard(%d)", int(s))
+}
+
+// TransferInstruction is one payout of a batch.
+// Amount is in wei or token base units, TokenID is used by ERC-721 and ERC-1155.
+// A non-empty IdempotencyKey guarantees the payout is sent at most once.
+type TransferInstruction struct {
+	Standard       TokenStandard
+	Token          common.Address
+	To             common.Address
+	Amount         *big.Int
+	TokenID        *big.Int
+	IdempotencyKey string
+}
+
+// TransferResult is the outcome of a transfer instruction.
+// Duplicate is set when the idempotency key was already used.
+type TransferResult struct {
+	Instruction TransferInstruction
+	TxHash      common.Hash
+	Nonce       uint64
+	Duplicate   bool
+	Error       error
+}
+
+const transferABIs = `[
+{"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"name":"safeTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"}],"name":"safeTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+// DisperseABI is the interface of the Disperse contract (disperse.app)
+const DisperseABI = `[
+{"inputs":[{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"name":"disperseEther","outputs":[],"stateMutability":"payable","type":"function"},
+{"inputs":[{"name":"token","type":"address"},{"name":"recipients","type":"address[]"},{"name":"values","type":"uint256[]"}],"name":"disperseToken","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var (
+	transferABI, _ = abi.JSON(strings.NewReader(transferABIs))
+	disperseABI, _ = abi.JSON(strings.NewReader(DisperseABI))
+)
+
+// idempotencyLog remembers the transactions sent for each idempotency key,
+// and the keys of the transfers being signed and sent
+type idempotencyLog struct {
+	mutex    sync.Mutex
+	keys     map[string]TransferResult
+	reserved map[string]bool
+}
+
+func (l *idempotencyLog) lookup(key string) (TransferResult, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	result, ok := l.keys[key]
+	return result, ok
+}
+
+// reserve claims key before its transfer is signed, so that concurrent
+// batches cannot send it twice. It returns the result of the transfer
+// already sent for key, or an error while another batch holds it.
+func (l *idempotencyLog) reserve(key string) (TransferResult, bool, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if result, ok := l.keys[key]; ok {
+		return result, true, nil
+	}
+	if l.reserved[key] {
+		return TransferResult{}, false, fmt.Errorf("idempotency key %q is being sent by another batch", key)
+	}
+	if l.reserved == nil {
+		l.reserved = make(map[string]bool)
+	}
+	l.reserved[key] = true
+	return TransferResult{}, false, nil
+}
+
+// release gives up a reserved key whose transfer was not sent
+func (l *idempotencyLog) release(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.reserved, key)
+}
+
+func (l *idempotencyLog) record(result TransferResult) {
+	if result.Instruction.IdempotencyKey == "" || result.Error != nil {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.keys == nil {
+		l.keys = make(map[string]TransferResult)
+	}
+	l.keys[result.Instruction.IdempotencyKey] = result
+	delete(l.reserved, result.Instruction.IdempotencyKey)
+}
+
+// transferCall returns the destination, value and calldata of an instruction sent by from
+func transferCall(from common.Address, in TransferInstruction) (common.Address, *big.Int, []byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch in.Standard {
+	case Native:
+		return in.To, in.Amount, nil, nil
+	case ERC20Token:
+		data, err = transferABI.Pack("transfer", in.To, in.Amount)
+	case ERC721Token:
+		data, err = transferABI.Pack("safeTransferFrom", from, in.To, in.TokenID)
+	case ERC1155Token:
+		data, err = transferABI.Pack("safeTransferFrom0", from, in.To, in.TokenID, in.Amount, []byte{})
+	default:
+		return common.Address{}, nil, nil, fmt.Errorf("unsupported token standard %s", in.Standard)
+	}
+	if err != nil {
+		return common.Address{}, nil, nil, fmt.Errorf("failed to pack %s transfer: %v", in.Standard, err)
+	}
+	return in.Token, new(big.Int), data, nil
+}
+
+// BatchTransferTokens signs and broadcasts the instructions in order with
+// consecutive nonces of opts.From and returns the results in input order.
+// A broadcast failure stops the batch, as later nonces could never be mined,
+// while transfers refused by a PolicyEngine are skipped.
+// With a preflight set, the batch is checked against the balances of
+// opts.From before anything is signed.
+func (bp *BatchProcessor) BatchTransferTokens(ctx context.Context, opts *bind.TransactOpts, instructions []TransferInstruction) []TransferResult {
+	results := make([]TransferResult, len(instructions))
+	instrumentationOr(bp.instrumentation).BatchSize(ctx, "transfer_tokens", len(instructions))
+
+	dropped := make(map[int]bool)
+	if bp.preflight != nil {
+		report, err := bp.directPreflight(ctx, opts.From, instructions)
+		if err != nil {
+			for i, in := range instructions {
+				results[i] = TransferResult{Instruction: in, Error: err}
+			}
+			return results
+		}
+		for _, i := range report.Dropped {
+			dropped[i] = true
+		}
+	}
+
+	nonce, err := bp.client.PendingNonceAt(ctx, opts.From)
+	if err != nil {
+		for i, in := range instructions {
+			results[i] = TransferResult{Instruction: in, Error: fmt.Errorf("failed to get nonce: %v", err)}
+		}
+		return results
+	}
+
+	seen := make(map[string]int)
+	var failed error
+	for i, in := range instructions {
+		results[i].Instruction = in
+
+		if key := in.IdempotencyKey; key != "" {
+			if j, ok := seen[key]; ok {
+				results[i] = results[j]
+				results[i].Duplicate = true
+				continue
+			}
+			seen[key] = i
+			previous, sent, err := bp.sent.reserve(key)
+			if sent {
+				results[i] = previous
+				results[i].Duplicate = true
+				continue
+			}
+			if err != nil {
+				results[i].Error = err
+				continue
+			}
+		}
+		if dropped[i] {
+			bp.sent.release(in.IdempotencyKey)
+			results[i].Error = ErrPreflightDropped
+			continue
+		}
+		if failed != nil {
+			bp.sent.release(in.IdempotencyKey)
+			results[i].Error = fmt.Errorf("not sent, an earlier transfer failed: %v", failed)
+			continue
+		}
+
+		tx, err := bp.signTransfer(ctx, opts, nonce, in)
+		// A transfer refused by a policy never used its nonce, the next one takes it
+		var violation *PolicyViolation
+		if errors.As(err, &violation) {
+			bp.sent.release(in.IdempotencyKey)
+			results[i].Error = err
+			continue
+		}
+		if err == nil {
+			err = bp.client.SendRawTransaction(ctx, tx)
+		}
+		if err != nil {
+			bp.sent.release(in.IdempotencyKey)
+			results[i].Error = err
+			failed = err
+			continue
+		}
+
+		results[i].TxHash = tx.Hash()
+		results[i].Nonce = nonce
+		bp.sent.record(results[i])
+		nonce++
+	}
+	return results
+}
+
+// signTransfer builds and signs the transaction of an instruction without sending it
+func (bp *BatchProcessor) signTransfer(ctx context.Context, opts *bind.TransactOpts, nonce uint64, in TransferInstruction) (*types.Transaction, error) {
+	to, value, data, err := transferCall(opts.From, in)
+	if err != nil {
+		return nil, err
+	}
+
+	txOpts := *opts
+	txOpts.Context = ctx
+	txOpts.Nonce = new(big.Int).SetUint64(nonce)
+	txOpts.Value = value
+	txOpts.NoSend = true
+	// bind only estimates calls to contracts, so transfers to accounts are estimated here
+	if in.Standard == Native && txOpts.GasLimit == 0 {
+		gas, err := bp.client.EstimateGas(ctx, ethereum.CallMsg{From: opts.From, To: &to, Value: value})
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate gas: %v", err)
+		}
+		txOpts.GasLimit = gas
+	}
+
+	contract := bind.NewBoundContract(to, abi.ABI{}, nil, contractTransactor{bp.client}, nil)
+	return contract.RawTransact(&txOpts, data)
+}
+
+// DisperseTransfer pays every instruction in a single transaction through a
+// Disperse contract. All instructions must move the native currency or the
+// same ERC-20 token, which must already be approved for the contract.
+// Instructions repeating an idempotency key are paid once, and a transaction
+// refused by a PolicyEngine fails the instructions it would have paid.
+// With a preflight set, the batch is checked against the balances of
+// opts.From and its allowance for the contract, taking the fee once.
+func (bp *BatchProcessor) DisperseTransfer(ctx context.Context, opts *bind.TransactOpts, disperse common.Address, instructions []TransferInstruction) []TransferResult {
+	results := make([]TransferResult, len(instructions))
+	fail := func(err error) []TransferResult {
+		for i, in := range instructions {
+			results[i] = TransferResult{Instruction: in, Error: err}
+		}
+		return results
+	}
+	if len(instructions) == 0 {
+		return results
+	}
+	instrumentationOr(bp.instrumentation).BatchSize(ctx, "disperse", len(instructions))
+
+	first := instructions[0]
+	if first.Standard != Native && first.Standard != ERC20Token {
+		return fail(fmt.Errorf("disperse does not support %s", first.Standard))
+	}
+	for _, in := range instructions {
+		if in.Standard != first.Standard || in.Token != first.Token {
+			return fail(fmt.Errorf("disperse needs a single asset, got %s %s and %s %s",
+				first.Standard, first.Token.Hex(), in.Standard, in.Token.Hex()))
+		}
+	}
+
+	dropped := make(map[int]bool)
+	if bp.preflight != nil {
+		report, err := bp.dispersePreflight(ctx, opts.From, disperse, instructions)
+		if err != nil {
+			return fail(err)
+		}
+		for _, i := range report.Dropped {
+			dropped[i] = true
+		}
+	}
+
+	seen := make(map[string]int)
+	var (
+		paid    []TransferInstruction
+		indexes []int
+	)
+	for i, in := range instructions {
+		results[i].Instruction = in
+		if key := in.IdempotencyKey; key != "" {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = i
+			previous, sent, err := bp.sent.reserve(key)
+			if sent {
+				results[i] = previous
+				results[i].Duplicate = true
+				continue
+			}
+			if err != nil {
+				results[i].Error = err
+				continue
+			}
+		}
+		if dropped[i] {
+			bp.sent.release(in.IdempotencyKey)
+			results[i].Error = ErrPreflightDropped
+			continue
+		}
+		paid = append(paid, in)
+		indexes = append(indexes, i)
+	}
+
+	if len(paid) > 0 {
+		tx, err := bp.disperse(ctx, opts, disperse, paid)
+		for _, i := range indexes {
+			if err != nil {
+				bp.sent.release(instructions[i].IdempotencyKey)
+				results[i].Error = err
+				continue
+			}
+			results[i].TxHash, results[i].Nonce = tx.Hash(), tx.Nonce()
+			bp.sent.record(results[i])
+		}
+	}
+
+	for i, in := range instructions {
+		if j := seen[in.IdempotencyKey]; in.IdempotencyKey != "" && j != i {
+			results[i] = results[j]
+			results[i].Duplicate = true
+		}
+	}
+	return results
+}
+
+// disperse signs and sends the Disperse transaction paying the instructions
+func (bp *BatchProcessor) disperse(ctx context.Context, opts *bind.TransactOpts, disperse common.Address, instructions []TransferInstruction) (*types.Transaction, error) {
+	value, data, err := disperseCall(instructions)
+	if err != nil {
+		return nil, err
+	}
+	txOpts := *opts
+	txOpts.Context = ctx
+	txOpts.Value = value
+	contract := bind.NewBoundContract(disperse, disperseABI, nil, contractTransactor{bp.client}, nil)
+	return contract.RawTransact(&txOpts, data)
+}
+
+// disperseCall returns the value and calldata of the Disperse call paying
+// the instructions, which all move the asset of the first one
+func disperseCall(instructions []TransferInstruction) (*big.Int, []byte, error) {
+	recipients := make([]common.Address, len(instructions))
+	values := make([]*big.Int, len(instructions))
+	total := new(big.Int)
+	for i, in := range instructions {
+		recipients[i], values[i] = in.To, in.Amount
+		total.Add(total, in.Amount)
+	}
+
+	var (
+		value = new(big.Int)
+		data  []byte
+		err   error
+	)
+	switch first := instructions[0]; first.Standard {
+	case Native:
+		value = total
+		data, err = disperseABI.Pack("disperseEther", recipients, values)
+	case ERC20Token:
+		data, err = disperseABI.Pack("disperseToken", first.Token, recipients, values)
+	default:
+		return nil, nil, fmt.Errorf("disperse does not support %s", first.Standard)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to pack disperse call: %v", err)
+	}
+	return value, data, nil
+}
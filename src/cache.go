@@ -0,0 +1,519 @@
+package pyweb3
+
+import (
+	"bytes"
+	"container/list"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy tells how long the answer to a call stays valid
+type CachePolicy int
+
+const (
+	// CacheNever is used for calls whose answer may change at any time
+	CacheNever CachePolicy = iota
+	// CacheUntilNextBlock is used for calls on the latest state
+	CacheUntilNextBlock
+	// CachePermanent is used for calls on a fixed block or hash
+	CachePermanent
+)
+
+// CacheStore is the storage backend of a Cache.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Delete(key string)
+}
+
+// staticMethods never change for a given endpoint
+var staticMethods = map[string]bool{
+	"eth_chainId": true,
+	"net_version": true,
+}
+
+// headMethods follow the chain head
+var headMethods = map[string]bool{
+	"eth_blockNumber":          true,
+	"eth_gasPrice":             true,
+	"eth_maxPriorityFeePerGas": true,
+}
+
+// hashMethods are looked up by hash, their answer is final once mined
+var hashMethods = map[string]bool{
+	"eth_getBlockByHash":                 true,
+	"eth_getTransactionByHash":           true,
+	"eth_getTransactionReceipt":          true,
+	"eth_getBlockTransactionCountByHash": true,
+}
+
+// blockParamIndex gives the position of the block parameter of state methods
+var blockParamIndex = map[string]int{
+	"eth_getBlockByNumber":                 0,
+	"eth_getBlockTransactionCountByNumber": 0,
+	"eth_getBalance":                       1,
+	"eth_getCode":                          1,
+	"eth_getTransactionCount":              1,
+	"eth_call":                             1,
+	"eth_getStorageAt":                     2,
+	"eth_getProof":                         2,
+}
+
+// cacheEntry is what a Cache puts in its store
+type cacheEntry struct {
+	Result json.RawMessage `json:"result"`
+	Latest bool            `json:"latest,omitempty"`
+	Epoch  uint64          `json:"epoch,omitempty"`
+	Stored time.Time       `json:"stored"`
+}
+
+// CacheConfig holds the settings of a Cache
+type CacheConfig struct {
+	// Store keeps the entries, an LRU of DefaultCacheSize entries if nil
+	Store CacheStore
+	// LatestTTL bounds the life of entries on the latest state when no new head is seen
+	LatestTTL time.Duration
+	// Transport sends the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+// DefaultCacheSize is the number of entries of the default LRU store
+const DefaultCacheSize = 4096
+
+// reorgWindow is how many blocks below the head are followed for reorgs.
+// Entries of older blocks are final and left to the store to evict.
+const reorgWindow = 256
+
+// Cache is an http.RoundTripper answering repeated JSON-RPC calls from a store.
+// Entries tied to a block number are dropped when that block gets reorged out.
+type Cache struct {
+	store     CacheStore
+	latestTTL time.Duration
+	transport http.RoundTripper
+
+	mutex  sync.Mutex
+	head   uint64
+	epoch  uint64
+	hashes map[uint64]string
+	tagged map[uint64][]string
+}
+
+// NewCache creates a caching transport
+func NewCache(config CacheConfig) *Cache {
+	if config.Store == nil {
+		config.Store = NewLRUStore(DefaultCacheSize)
+	}
+	if config.LatestTTL <= 0 {
+		config.LatestTTL = 2 * time.Second
+	}
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+	return &Cache{
+		store:     config.Store,
+		latestTTL: config.LatestTTL,
+		transport: config.Transport,
+		hashes:    make(map[uint64]string),
+		tagged:    make(map[uint64][]string),
+	}
+}
+
+// CacheMiddleware returns a Middleware installing a Cache
+func CacheMiddleware(config CacheConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		config.Transport = next
+		return NewCache(config)
+	}
+}
+
+// RoundTrip answers the cached calls of a request and forwards the others
+func (c *Cache) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	msgs, batch, err := decodeRPCMessages(body)
+	if err != nil {
+		return c.transport.RoundTrip(req)
+	}
+
+	answers := make([]*rpcMessage, len(msgs))
+	var misses []*rpcMessage
+	for i, msg := range msgs {
+		if result, ok := c.lookup(msg); ok {
+			answers[i] = &rpcMessage{Version: "2.0", ID: msg.ID, Result: result}
+		} else {
+			misses = append(misses, msg)
+		}
+	}
+	if len(misses) == 0 {
+		out, err := encodeRPCMessages(answers, batch)
+		if err != nil {
+			return nil, err
+		}
+		return newRPCResponse(req, out), nil
+	}
+
+	forward := body
+	if len(misses) != len(msgs) {
+		if forward, err = encodeRPCMessages(misses, true); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := c.transport.RoundTrip(cloneRequest(req, forward))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := readResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	replies, _, err := decodeRPCMessages(respBody)
+	if err != nil {
+		return newRPCResponse(req, respBody), nil
+	}
+
+	byID := make(map[string]*rpcMessage, len(replies))
+	for _, r := range replies {
+		byID[string(r.ID)] = r
+	}
+	for i, msg := range msgs {
+		if answers[i] != nil {
+			continue
+		}
+		r, ok := byID[string(msg.ID)]
+		if !ok && len(replies) == 1 && len(misses) == 1 {
+			r = replies[0]
+		}
+		if r == nil {
+			// Let the caller deal with the incomplete batch as the node sent it
+			return newRPCResponse(req, respBody), nil
+		}
+		c.observe(msg, r)
+		c.save(msg, r)
+		answers[i] = r
+	}
+
+	out, err := encodeRPCMessages(answers, batch)
+	if err != nil {
+		return nil, err
+	}
+	return newRPCResponse(req, out), nil
+}
+
+// cachePolicy classifies a call and returns the block number it depends on, if any
+func cachePolicy(msg *rpcMessage) (CachePolicy, uint64, bool) {
+	switch {
+	case staticMethods[msg.Method]:
+		return CachePermanent, 0, false
+	case headMethods[msg.Method]:
+		return CacheUntilNextBlock, 0, false
+	case hashMethods[msg.Method]:
+		return CachePermanent, 0, false
+	}
+
+	index, ok := blockParamIndex[msg.Method]
+	if !ok {
+		return CacheNever, 0, false
+	}
+	var params []json.RawMessage
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return CacheNever, 0, false
+	}
+	if index >= len(params) {
+		return CacheUntilNextBlock, 0, false
+	}
+
+	var tag string
+	if err := json.Unmarshal(params[index], &tag); err != nil {
+		// EIP-1898 block object
+		var ref struct {
+			BlockHash   string `json:"blockHash"`
+			BlockNumber string `json:"blockNumber"`
+		}
+		if err := json.Unmarshal(params[index], &ref); err != nil {
+			return CacheNever, 0, false
+		}
+		if ref.BlockHash != "" {
+			return CachePermanent, 0, false
+		}
+		tag = ref.BlockNumber
+	}
+
+	switch tag {
+	case "latest", "safe", "finalized":
+		return CacheUntilNextBlock, 0, false
+	case "earliest":
+		return CachePermanent, 0, true
+	case "pending", "":
+		return CacheNever, 0, false
+	}
+	number, err := strconv.ParseUint(strings.TrimPrefix(tag, "0x"), 16, 64)
+	if err != nil {
+		return CacheNever, 0, false
+	}
+	return CachePermanent, number, true
+}
+
+func cacheKey(msg *rpcMessage) string {
+	var params bytes.Buffer
+	if err := json.Compact(&params, msg.Params); err != nil {
+		params.Write(msg.Params)
+	}
+	return msg.Method + ":" + params.String()
+}
+
+func (c *Cache) lookup(msg *rpcMessage) (json.RawMessage, bool) {
+	p, _, _ := cachePolicy(msg)
+	if p == CacheNever {
+		return nil, false
+	}
+
+	data, ok := c.store.Get(cacheKey(msg))
+	if !ok {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if entry.Latest {
+		c.mutex.Lock()
+		epoch := c.epoch
+		c.mutex.Unlock()
+		if entry.Epoch != epoch || time.Since(entry.Stored) > c.latestTTL {
+			return nil, false
+		}
+	}
+	return entry.Result, true
+}
+
+func (c *Cache) save(msg *rpcMessage, reply *rpcMessage) {
+	if reply.Error != nil || len(reply.Result) == 0 || string(reply.Result) == "null" {
+		return
+	}
+	p, number, tagged := cachePolicy(msg)
+	if p == CacheNever {
+		return
+	}
+	if hashMethods[msg.Method] {
+		// Only mined objects are final, tie them to their block for reorgs
+		n, ok := resultBlockNumber(reply.Result)
+		if !ok {
+			return
+		}
+		number, tagged = n, true
+	}
+
+	c.mutex.Lock()
+	entry := cacheEntry{Result: reply.Result, Latest: p == CacheUntilNextBlock, Epoch: c.epoch, Stored: time.Now()}
+	key := cacheKey(msg)
+	if tagged && number+reorgWindow >= c.head {
+		c.tagged[number] = append(c.tagged[number], key)
+	}
+	c.mutex.Unlock()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	c.store.Set(key, data)
+}
+
+// observe follows the chain head and block hashes seen in answers to detect reorgs
+func (c *Cache) observe(msg *rpcMessage, reply *rpcMessage) {
+	if reply.Error != nil {
+		return
+	}
+	switch msg.Method {
+	case "eth_blockNumber":
+		var head string
+		if json.Unmarshal(reply.Result, &head) == nil {
+			if number, err := strconv.ParseUint(strings.TrimPrefix(head, "0x"), 16, 64); err == nil {
+				c.setHead(number)
+			}
+		}
+	case "eth_getBlockByNumber", "eth_getBlockByHash":
+		var block struct {
+			Number string `json:"number"`
+			Hash   string `json:"hash"`
+		}
+		if json.Unmarshal(reply.Result, &block) != nil || block.Hash == "" {
+			return
+		}
+		number, err := strconv.ParseUint(strings.TrimPrefix(block.Number, "0x"), 16, 64)
+		if err != nil {
+			return
+		}
+		c.SeenBlock(number, block.Hash)
+	}
+}
+
+func (c *Cache) setHead(number uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if number > c.head {
+		c.head = number
+		c.epoch++
+		c.prune()
+	}
+}
+
+// prune forgets the blocks that fell out of the reorg window
+func (c *Cache) prune() {
+	for n := range c.hashes {
+		if n+reorgWindow < c.head {
+			delete(c.hashes, n)
+		}
+	}
+	for n := range c.tagged {
+		if n+reorgWindow < c.head {
+			delete(c.tagged, n)
+		}
+	}
+}
+
+// SeenBlock records the hash of a block. A different hash for a known
+// number means a reorg: entries for that block and above are dropped.
+func (c *Cache) SeenBlock(number uint64, hash string) {
+	c.mutex.Lock()
+	known, ok := c.hashes[number]
+	c.mutex.Unlock()
+
+	if ok && known != hash {
+		c.InvalidateFrom(number)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.hashes[number] = hash
+	if number > c.head {
+		c.head = number
+		c.epoch++
+	}
+	c.prune()
+}
+
+// InvalidateFrom drops the entries tied to blocks at or above number
+func (c *Cache) InvalidateFrom(number uint64) {
+	c.mutex.Lock()
+	var keys []string
+	for n, tagged := range c.tagged {
+		if n >= number {
+			keys = append(keys, tagged...)
+			delete(c.tagged, n)
+		}
+	}
+	for n := range c.hashes {
+		if n >= number {
+			delete(c.hashes, n)
+		}
+	}
+	// Entries on the latest state were computed on the old branch too
+	c.epoch++
+	c.mutex.Unlock()
+
+	for _, key := range keys {
+		c.store.Delete(key)
+	}
+}
+
+// resultBlockNumber reads the block number of a mined transaction, receipt or block
+func resultBlockNumber(result json.RawMessage) (uint64, bool) {
+	var obj struct {
+		BlockNumber *string `json:"blockNumber"`
+		Number      *string `json:"number"`
+	}
+	if err := json.Unmarshal(result, &obj); err != nil {
+		// Plain values such as transaction counts carry no block
+		return 0, false
+	}
+	value := obj.BlockNumber
+	if value == nil {
+		value = obj.Number
+	}
+	if value == nil {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(strings.TrimPrefix(*value, "0x"), 16, 64)
+	return number, err == nil
+}
+
+// LRUStore is an in-memory CacheStore evicting the least recently used entries
+type LRUStore struct {
+	size  int
+	mutex sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	value []byte
+}
+
+// NewLRUStore creates an LRU store holding up to size entries
+func NewLRUStore(size int) *LRUStore {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &LRUStore{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of key and marks it as recently used
+func (s *LRUStore) Get(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*lruItem).value, true
+}
+
+// Set stores value under key, evicting the oldest entry when full
+func (s *LRUStore) Set(key string, value []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		elem.Value.(*lruItem).value = value
+		s.order.MoveToFront(elem)
+		return
+	}
+	s.items[key] = s.order.PushFront(&lruItem{key: key, value: value})
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*lruItem).key)
+	}
+}
+
+// Delete removes key from the store
+func (s *LRUStore) Delete(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if elem, ok := s.items[key]; ok {
+		s.order.Remove(elem)
+		delete(s.items, key)
+	}
+}
+
+// Len returns the number of entries in the store
+func (s *LRUStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.order.Len()
+}
@@ -0,0 +1,252 @@
+package pyweb3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// DefaultCCIPRedirects is how many OffchainLookup reverts a single call may
+// follow, and how many HTTP redirects a gateway query may follow
+const DefaultCCIPRedirects = 4
+
+// DefaultCCIPResponseSize is the largest gateway answer read, in bytes
+const DefaultCCIPResponseSize = 1 << 20
+
+// CCIPConfig configures how contract calls follow EIP-3668 offchain lookups
+type CCIPConfig struct {
+	// Disabled returns OffchainLookup reverts as errors
+	Disabled bool
+	// MaxRedirects is how many lookups a call may chain, and how many HTTP
+	// redirects a gateway may answer with, DefaultCCIPRedirects when zero
+	MaxRedirects int
+	// AllowedHosts lists the gateway hosts that may be queried, any host when
+	// empty. Redirects must stay within them too. An entry such as
+	// "*.example.com" allows the subdomains of example.com.
+	AllowedHosts []string
+	// MaxResponseSize bounds the answer of a gateway, DefaultCCIPResponseSize when zero
+	MaxResponseSize int64
+	// HTTPClient queries the gateways, http.DefaultClient when nil. Its
+	// CheckRedirect is replaced to enforce AllowedHosts and MaxRedirects.
+	HTTPClient *http.Client
+}
+
+// maxRedirects returns MaxRedirects or its default
+func (c *CCIPConfig) maxRedirects() int {
+	if c.MaxRedirects == 0 {
+		return DefaultCCIPRedirects
+	}
+	return c.MaxRedirects
+}
+
+// client returns the HTTP client querying the gateways, which checks every
+// redirect against the allowed hosts and the redirect limit
+func (c *CCIPConfig) client() *http.Client {
+	client := http.Client{}
+	if c.HTTPClient != nil {
+		client = *c.HTTPClient
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > c.maxRedirects() {
+			return fmt.Errorf("gateway redirected more than %d times", c.maxRedirects())
+		}
+		if !c.allowed(req.URL.Hostname()) {
+			return fmt.Errorf("gateway redirected to host %s, which is not allowed", req.URL.Hostname())
+		}
+		return nil
+	}
+	return &client
+}
+
+// allowed tells whether a gateway host may be queried
+func (c *CCIPConfig) allowed(host string) bool {
+	if len(c.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, allowed := range c.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+const offchainLookupABIs = `[
+{"inputs":[{"name":"sender","type":"address"},{"name":"urls","type":"string[]"},{"name":"callData","type":"bytes"},{"name":"callbackFunction","type":"bytes4"},{"name":"extraData","type":"bytes"}],"name":"OffchainLookup","type":"error"},
+{"inputs":[{"name":"response","type":"bytes"},{"name":"extraData","type":"bytes"}],"name":"callback","outputs":[{"name":"","type":"bytes"}],"stateMutability":"view","type":"function"}
+]`
+
+var offchainLookupABI, _ = abi.JSON(strings.NewReader(offchainLookupABIs))
+
+// offchainLookup is the EIP-3668 revert asking the caller to query a gateway
+type offchainLookup struct {
+	Sender           common.Address
+	URLs             []string
+	CallData         []byte
+	CallbackFunction [4]byte
+	ExtraData        []byte
+}
+
+// revertData extracts the data of a reverted eth_call, nil if the error is not a revert
+func revertData(err error) []byte {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil
+	}
+	hex, ok := dataErr.ErrorData().(string)
+	if !ok {
+		return nil
+	}
+	data, err := hexutil.Decode(hex)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// decodeOffchainLookup decodes an OffchainLookup revert, returning false for other reverts
+func decodeOffchainLookup(data []byte) (*offchainLookup, bool) {
+	lookupErr := offchainLookupABI.Errors["OffchainLookup"]
+	if len(data) < 4 || !bytes.Equal(data[:4], lookupErr.ID[:4]) {
+		return nil, false
+	}
+	values, err := lookupErr.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, false
+	}
+	return &offchainLookup{
+		Sender:           values[0].(common.Address),
+		URLs:             values[1].([]string),
+		CallData:         values[2].([]byte),
+		CallbackFunction: values[3].([4]byte),
+		ExtraData:        values[4].([]byte),
+	}, true
+}
+
+// SetCCIPRead changes how CallContract follows offchain lookups
+func (w *Web3Client) SetCCIPRead(config CCIPConfig) *Web3Client {
+	w.ccip = config
+	return w
+}
+
+// CodeAt returns the code of a contract, so that Web3Client is a bind.ContractCaller
+func (w *Web3Client) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return w.client.CodeAt(ctx, contract, blockNumber)
+}
+
+// CallContract performs an eth_call. When the contract reverts with an EIP-3668
+// OffchainLookup, the gateways are queried and the callback is called with
+// their answer, up to the configured number of redirects.
+func (w *Web3Client) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	maxRedirects := w.ccip.maxRedirects()
+
+	for redirects := 0; ; redirects++ {
+		out, err := w.client.CallContract(ctx, msg, blockNumber)
+		if err == nil || w.ccip.Disabled {
+			return out, err
+		}
+		lookup, ok := decodeOffchainLookup(revertData(err))
+		if !ok {
+			return nil, err
+		}
+		if redirects == maxRedirects {
+			return nil, fmt.Errorf("too many offchain lookups from %s", lookup.Sender.Hex())
+		}
+		if msg.To == nil || lookup.Sender != *msg.To {
+			return nil, fmt.Errorf("offchain lookup sender %s does not match the called contract", lookup.Sender.Hex())
+		}
+
+		response, err := w.ccip.query(ctx, lookup)
+		if err != nil {
+			return nil, err
+		}
+		args, err := offchainLookupABI.Methods["callback"].Inputs.Pack(response, lookup.ExtraData)
+		if err != nil {
+			return nil, err
+		}
+		msg.Data = append(lookup.CallbackFunction[:], args...)
+	}
+}
+
+// query asks the gateways in order, moving to the next one on server errors only
+func (c *CCIPConfig) query(ctx context.Context, lookup *offchainLookup) ([]byte, error) {
+	client := c.client()
+	limit := c.MaxResponseSize
+	if limit <= 0 {
+		limit = DefaultCCIPResponseSize
+	}
+	sender := strings.ToLower(lookup.Sender.Hex())
+	data := hexutil.Encode(lookup.CallData)
+
+	var lastErr error
+	for _, url := range lookup.URLs {
+		var req *http.Request
+		var err error
+		url = strings.ReplaceAll(url, "{sender}", sender)
+		if strings.Contains(url, "{data}") {
+			req, err = http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(url, "{data}", data), nil)
+		} else {
+			body, _ := json.Marshal(map[string]string{"data": data, "sender": sender})
+			req, err = http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+			if req != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !c.allowed(req.URL.Hostname()) {
+			lastErr = fmt.Errorf("gateway host %s is not allowed", req.URL.Hostname())
+			continue
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if int64(len(body)) > limit {
+			return nil, fmt.Errorf("gateway %s answered more than %d bytes", req.URL.Host, limit)
+		}
+		if resp.StatusCode >= 500 {
+			lastErr = fmt.Errorf("gateway %s returned %s", req.URL.Host, resp.Status)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("gateway %s returned %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+		}
+
+		var answer struct {
+			Data hexutil.Bytes `json:"data"`
+		}
+		if err := json.Unmarshal(body, &answer); err != nil {
+			return nil, fmt.Errorf("invalid answer from gateway %s: %v", req.URL.Host, err)
+		}
+		return answer.Data, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no gateway url")
+	}
+	return nil, fmt.Errorf("offchain lookup failed: %v", lastErr)
+}
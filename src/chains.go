@@ -0,0 +1,202 @@
+package pyweb3
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NativeCurrency describes the currency paying for gas on a chain
+type NativeCurrency struct {
+	Name     string
+	Symbol   string
+	Decimals uint8
+}
+
+// GasQuirks lists where a chain departs from Ethereum gas accounting
+type GasQuirks struct {
+	// EstimateTransfers is set where a plain transfer may cost more than 21000 gas
+	EstimateTransfers bool
+	// MinPriorityFee is the lowest tip the chain accepts, if any
+	MinPriorityFee *big.Int
+	// IgnoresPriorityFee is set where the tip is never paid to anyone
+	IgnoresPriorityFee bool
+	// L1FeeOracle is the predeploy reporting the L1 data fee of OP Stack style rollups
+	L1FeeOracle common.Address
+	// NodeInterface is set on Arbitrum chains, which expose NodeInterface at 0xc8
+	NodeInterface bool
+}
+
+// ChainProfile holds the defaults of a chain
+type ChainProfile struct {
+	ChainID       uint64
+	Name          string
+	Currency      NativeCurrency
+	BlockTime     time.Duration
+	FinalityDepth uint64
+	EIP1559       bool
+	Multicall3    common.Address
+	ENSRegistry   common.Address
+	Explorers     []string
+	Quirks        GasQuirks
+}
+
+// Known reports whether the profile comes from the registry rather than defaults
+func (p ChainProfile) Known() bool {
+	return p.Name != ""
+}
+
+// ExplorerTxURL returns the explorer page of a transaction, empty without explorer
+func (p ChainProfile) ExplorerTxURL(hash common.Hash) string {
+	if len(p.Explorers) == 0 {
+		return ""
+	}
+	return p.Explorers[0] + "/tx/" + hash.Hex()
+}
+
+var (
+	ether = NativeCurrency{Name: "Ether", Symbol: "ETH", Decimals: 18}
+
+	opGasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+)
+
+var (
+	chainsMutex sync.RWMutex
+	chains      = map[uint64]ChainProfile{
+		1: {
+			ChainID: 1, Name: "Ethereum", Currency: ether, BlockTime: 12 * time.Second, FinalityDepth: 64, EIP1559: true,
+			Multicall3: Multicall3Address, ENSRegistry: ENSRegistryAddress,
+			Explorers: []string{"https://etherscan.io"},
+		},
+		11155111: {
+			ChainID: 11155111, Name: "Sepolia", Currency: NativeCurrency{Name: "Sepolia Ether", Symbol: "ETH", Decimals: 18},
+			BlockTime: 12 * time.Second, FinalityDepth: 64, EIP1559: true,
+			Multicall3: Multicall3Address, ENSRegistry: ENSRegistryAddress,
+			Explorers: []string{"https://sepolia.etherscan.io"},
+		},
+		17000: {
+			ChainID: 17000, Name: "Holesky", Currency: NativeCurrency{Name: "Holesky Ether", Symbol: "ETH", Decimals: 18},
+			BlockTime: 12 * time.Second, FinalityDepth: 64, EIP1559: true,
+			Multicall3: Multicall3Address, ENSRegistry: ENSRegistryAddress,
+			Explorers: []string{"https://holesky.etherscan.io"},
+		},
+		10: {
+			ChainID: 10, Name: "OP Mainnet", Currency: ether, BlockTime: 2 * time.Second, FinalityDepth: 10, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://optimistic.etherscan.io"},
+			Quirks:     GasQuirks{L1FeeOracle: opGasPriceOracle},
+		},
+		8453: {
+			ChainID: 8453, Name: "Base", Currency: ether, BlockTime: 2 * time.Second, FinalityDepth: 10, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://basescan.org"},
+			Quirks:     GasQuirks{L1FeeOracle: opGasPriceOracle},
+		},
+		42161: {
+			ChainID: 42161, Name: "Arbitrum One", Currency: ether, BlockTime: 250 * time.Millisecond, FinalityDepth: 20, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://arbiscan.io"},
+			Quirks:     GasQuirks{EstimateTransfers: true, IgnoresPriorityFee: true, NodeInterface: true},
+		},
+		42170: {
+			ChainID: 42170, Name: "Arbitrum Nova", Currency: ether, BlockTime: 250 * time.Millisecond, FinalityDepth: 20, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://nova.arbiscan.io"},
+			Quirks:     GasQuirks{EstimateTransfers: true, IgnoresPriorityFee: true, NodeInterface: true},
+		},
+		324: {
+			ChainID: 324, Name: "zkSync Era", Currency: ether, BlockTime: time.Second, FinalityDepth: 10, EIP1559: true,
+			Multicall3: common.HexToAddress("0xF9cda624FBC7e059355ce98a31693d299FACd963"),
+			Explorers:  []string{"https://explorer.zksync.io"},
+			Quirks:     GasQuirks{EstimateTransfers: true, IgnoresPriorityFee: true},
+		},
+		59144: {
+			ChainID: 59144, Name: "Linea", Currency: ether, BlockTime: 2 * time.Second, FinalityDepth: 10, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://lineascan.build"},
+			Quirks:     GasQuirks{EstimateTransfers: true},
+		},
+		534352: {
+			ChainID: 534352, Name: "Scroll", Currency: ether, BlockTime: 3 * time.Second, FinalityDepth: 10, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://scrollscan.com"},
+			Quirks:     GasQuirks{L1FeeOracle: common.HexToAddress("0x5300000000000000000000000000000000000002")},
+		},
+		137: {
+			ChainID: 137, Name: "Polygon", Currency: NativeCurrency{Name: "POL", Symbol: "POL", Decimals: 18},
+			BlockTime: 2 * time.Second, FinalityDepth: 128, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://polygonscan.com"},
+			Quirks:     GasQuirks{MinPriorityFee: big.NewInt(30e9)},
+		},
+		56: {
+			ChainID: 56, Name: "BNB Smart Chain", Currency: NativeCurrency{Name: "BNB", Symbol: "BNB", Decimals: 18},
+			BlockTime: 3 * time.Second, FinalityDepth: 15,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://bscscan.com"},
+		},
+		100: {
+			ChainID: 100, Name: "Gnosis", Currency: NativeCurrency{Name: "xDAI", Symbol: "XDAI", Decimals: 18},
+			BlockTime: 5 * time.Second, FinalityDepth: 20, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://gnosisscan.io"},
+		},
+		43114: {
+			ChainID: 43114, Name: "Avalanche C-Chain", Currency: NativeCurrency{Name: "Avalanche", Symbol: "AVAX", Decimals: 18},
+			BlockTime: 2 * time.Second, FinalityDepth: 1, EIP1559: true,
+			Multicall3: Multicall3Address,
+			Explorers:  []string{"https://snowtrace.io"},
+		},
+	}
+)
+
+// RegisterChain adds or replaces the profile of a chain
+func RegisterChain(profile ChainProfile) {
+	chainsMutex.Lock()
+	defer chainsMutex.Unlock()
+	chains[profile.ChainID] = profile
+}
+
+// LookupChain returns the profile of a chain. Unknown chains get conservative
+// defaults: legacy pricing, estimated transfers and mainnet finality.
+func LookupChain(chainID uint64) (ChainProfile, bool) {
+	chainsMutex.RLock()
+	defer chainsMutex.RUnlock()
+
+	if profile, ok := chains[chainID]; ok {
+		return profile, true
+	}
+	return ChainProfile{
+		ChainID:       chainID,
+		Currency:      ether,
+		BlockTime:     12 * time.Second,
+		FinalityDepth: 64,
+		Quirks:        GasQuirks{EstimateTransfers: true},
+	}, false
+}
+
+// detectChain reads eth_chainId and remembers the matching profile
+func (w *Web3Client) detectChain(ctx context.Context) (ChainProfile, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.chain == nil {
+		chainID, err := w.client.ChainID(ctx)
+		if err != nil {
+			return ChainProfile{}, fmt.Errorf("failed to detect chain: %v", err)
+		}
+		profile, _ := LookupChain(chainID.Uint64())
+		w.chain = &profile
+	}
+	return *w.chain, nil
+}
+
+// Chain returns the profile of the connected chain, detected when connecting
+// or on first use if the node was unreachable then
+func (w *Web3Client) Chain(ctx context.Context) (ChainProfile, error) {
+	return w.detectChain(ctx)
+}
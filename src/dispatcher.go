@@ -0,0 +1,285 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DispatcherConfig holds the batching settings of a Dispatcher
+type DispatcherConfig struct {
+	// MaxBatchSize flushes a batch as soon as it holds that many calls
+	MaxBatchSize int
+	// MaxWait is how long the first call of a batch waits for others to join
+	MaxWait time.Duration
+	// Timeout bounds the round trip of a batch, DefaultDispatchTimeout when zero
+	Timeout time.Duration
+	// Transport sends the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+// DefaultDispatchTimeout is the default deadline of a batch round trip
+const DefaultDispatchTimeout = 30 * time.Second
+
+// pendingCall is a call waiting for its answer, shared by identical callers
+type pendingCall struct {
+	key     string
+	msg     *rpcMessage
+	batch   *pendingBatch
+	waiters int
+	done    chan struct{}
+	reply   *rpcMessage
+	status  int
+	body    []byte
+	err     error
+}
+
+// pendingBatch gathers the calls sent to the same endpoint during MaxWait.
+// Its context is cancelled once every caller has given up.
+type pendingBatch struct {
+	endpoint string
+	template *http.Request
+	calls    []*pendingCall
+	timer    *time.Timer
+	ctx      context.Context
+	cancel   context.CancelFunc
+	// live counts the calls still awaited by a caller
+	live int
+}
+
+// Dispatcher is an http.RoundTripper merging identical in-flight calls and
+// gathering the distinct calls arriving within a short window into one
+// JSON-RPC batch, so concurrent callers share round trips
+type Dispatcher struct {
+	config    DispatcherConfig
+	transport http.RoundTripper
+
+	mutex    sync.Mutex
+	inflight map[string]*pendingCall
+	pending  map[string]*pendingBatch
+}
+
+// NewDispatcher creates a dispatcher
+func NewDispatcher(config DispatcherConfig) *Dispatcher {
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = 100
+	}
+	if config.MaxWait <= 0 {
+		config.MaxWait = 2 * time.Millisecond
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultDispatchTimeout
+	}
+	transport := config.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Dispatcher{
+		config:    config,
+		transport: transport,
+		inflight:  make(map[string]*pendingCall),
+		pending:   make(map[string]*pendingBatch),
+	}
+}
+
+// DispatcherMiddleware returns a Middleware installing a Dispatcher
+func DispatcherMiddleware(config DispatcherConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		config.Transport = next
+		return NewDispatcher(config)
+	}
+}
+
+// RoundTrip queues a single call into the current batch of its endpoint and
+// waits for its answer. Batches and transactions go through untouched.
+func (d *Dispatcher) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	msgs, batch, err := decodeRPCMessages(body)
+	if err != nil || batch || nonIdempotentMethods[msgs[0].Method] {
+		return d.transport.RoundTrip(req)
+	}
+	msg := msgs[0]
+
+	c := d.enqueue(req, msg)
+	select {
+	case <-req.Context().Done():
+		d.leave(c)
+		return nil, req.Context().Err()
+	case <-c.done:
+	}
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.reply == nil {
+		// The endpoint refused the whole batch, hand its answer to every caller
+		resp := newRPCResponse(req, c.body)
+		resp.StatusCode = c.status
+		resp.Status = fmt.Sprintf("%d %s", c.status, http.StatusText(c.status))
+		return resp, nil
+	}
+
+	reply := *c.reply
+	reply.ID = msg.ID
+	out, err := json.Marshal(&reply)
+	if err != nil {
+		return nil, err
+	}
+	return newRPCResponse(req, out), nil
+}
+
+// enqueue joins an identical in-flight call or adds a new one to the endpoint batch
+func (d *Dispatcher) enqueue(req *http.Request, msg *rpcMessage) *pendingCall {
+	endpoint := req.URL.String()
+	key := endpoint + "|" + cacheKey(msg)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if c, ok := d.inflight[key]; ok {
+		c.waiters++
+		return c
+	}
+
+	b, ok := d.pending[endpoint]
+	if !ok {
+		// The batch outlives its first caller, so it gets its own deadline
+		ctx, cancel := context.WithTimeout(context.Background(), d.config.Timeout)
+		b = &pendingBatch{endpoint: endpoint, template: req.Clone(ctx), ctx: ctx, cancel: cancel}
+		d.pending[endpoint] = b
+		b.timer = time.AfterFunc(d.config.MaxWait, func() {
+			d.flush(endpoint, b)
+		})
+	}
+	c := &pendingCall{key: key, msg: msg, batch: b, waiters: 1, done: make(chan struct{})}
+	d.inflight[key] = c
+	b.calls = append(b.calls, c)
+	b.live++
+	if len(b.calls) >= d.config.MaxBatchSize {
+		b.timer.Stop()
+		delete(d.pending, endpoint)
+		go d.send(b)
+	}
+	return c
+}
+
+// leave drops a caller that gave up. The batch is cancelled, and dropped if
+// not sent yet, once none of its calls is awaited anymore.
+func (d *Dispatcher) leave(c *pendingCall) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	if d.inflight[c.key] == c {
+		// Later identical calls must not join a call that may be cancelled
+		delete(d.inflight, c.key)
+	}
+	b := c.batch
+	b.live--
+	if b.live > 0 {
+		return
+	}
+	if d.pending[b.endpoint] == b {
+		b.timer.Stop()
+		delete(d.pending, b.endpoint)
+	}
+	b.cancel()
+}
+
+// flush sends the batch of an endpoint once its waiting window is over
+func (d *Dispatcher) flush(endpoint string, b *pendingBatch) {
+	d.mutex.Lock()
+	if d.pending[endpoint] != b {
+		// Already sent because it was full
+		d.mutex.Unlock()
+		return
+	}
+	delete(d.pending, endpoint)
+	d.mutex.Unlock()
+
+	d.send(b)
+}
+
+// send performs the round trip of a batch and wakes up its callers
+func (d *Dispatcher) send(b *pendingBatch) {
+	defer func() {
+		b.cancel()
+		d.mutex.Lock()
+		for _, c := range b.calls {
+			if d.inflight[c.key] == c {
+				delete(d.inflight, c.key)
+			}
+		}
+		d.mutex.Unlock()
+		for _, c := range b.calls {
+			close(c.done)
+		}
+	}()
+
+	msgs := make([]*rpcMessage, len(b.calls))
+	for i, c := range b.calls {
+		msgs[i] = &rpcMessage{
+			Version: "2.0",
+			ID:      json.RawMessage(strconv.Itoa(i + 1)),
+			Method:  c.msg.Method,
+			Params:  c.msg.Params,
+		}
+	}
+	body, err := encodeRPCMessages(msgs, len(msgs) > 1)
+	if err != nil {
+		d.fail(b, err)
+		return
+	}
+
+	resp, err := d.transport.RoundTrip(cloneRequest(b.template, body))
+	if err != nil {
+		d.fail(b, err)
+		return
+	}
+	respBody, err := readResponseBody(resp)
+	if err != nil {
+		d.fail(b, err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		for _, c := range b.calls {
+			c.status = resp.StatusCode
+			c.body = respBody
+		}
+		return
+	}
+
+	replies, _, err := decodeRPCMessages(respBody)
+	if err != nil {
+		d.fail(b, err)
+		return
+	}
+	byID := make(map[string]*rpcMessage, len(replies))
+	for _, r := range replies {
+		byID[string(r.ID)] = r
+	}
+	for i, c := range b.calls {
+		r, ok := byID[strconv.Itoa(i+1)]
+		if !ok {
+			c.err = fmt.Errorf("missing answer for %s in JSON-RPC batch", c.msg.Method)
+			continue
+		}
+		c.reply = r
+	}
+}
+
+func (d *Dispatcher) fail(b *pendingBatch, err error) {
+	for _, c := range b.calls {
+		c.err = err
+	}
+}
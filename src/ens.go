@@ -0,0 +1,328 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ENSRegistryAddress is the ENS registry on mainnet and its main testnets
+var ENSRegistryAddress = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+// InterfaceIDExtendedResolver is the ENSIP-10 resolve(bytes,bytes) interface
+var InterfaceIDExtendedResolver = [4]byte{0x90, 0x61, 0xb9, 0x23}
+
+const ensABIs = `[
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"resolver","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"addr","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"name","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"node","type":"bytes32"},{"name":"key","type":"string"}],"name":"text","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"node","type":"bytes32"}],"name":"contenthash","outputs":[{"name":"","type":"bytes"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"name","type":"bytes"},{"name":"data","type":"bytes"}],"name":"resolve","outputs":[{"name":"","type":"bytes"}],"stateMutability":"view","type":"function"}
+]`
+
+var ensABI, _ = abi.JSON(strings.NewReader(ensABIs))
+
+var (
+	// ErrNoResolver is returned for names without a resolver
+	ErrNoResolver = errors.New("no resolver for name")
+	// ErrNoReverseRecord is returned when an address has no primary name
+	ErrNoReverseRecord = errors.New("no reverse record")
+	// ErrReverseMismatch is returned when the primary name of an address does not resolve back to it
+	ErrReverseMismatch = errors.New("reverse record does not resolve to the address")
+)
+
+// NormalizeName normalizes an ENS name following ENSIP-15. Only ASCII
+// labels are supported, for which ENSIP-15 reduces to lowercasing and the
+// ASCII label rules. Other labels need the ENS Unicode data for mappings,
+// confusables and scripts, and normalized any other way could hash to the
+// node of a different name, so they are rejected.
+func NormalizeName(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		normalized, err := normalizeLabel(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid ENS name %q: %v", name, err)
+		}
+		labels[i] = normalized
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func normalizeLabel(label string) (string, error) {
+	if label == "" {
+		return "", errors.New("empty label")
+	}
+
+	normalized := make([]byte, 0, len(label))
+	for i, r := range label {
+		if r >= 0x80 {
+			return "", fmt.Errorf("non-ASCII label %q is not supported", label)
+		}
+		if r >= 'A' && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '$':
+		case r == '_':
+			if i > 0 && label[i-1] != '_' {
+				return "", errors.New("underscore allowed only at the start of a label")
+			}
+		default:
+			return "", fmt.Errorf("disallowed character %q", r)
+		}
+		normalized = append(normalized, byte(r))
+	}
+
+	if len(normalized) >= 4 && string(normalized[2:4]) == "--" {
+		return "", errors.New("hyphens at the third and fourth positions")
+	}
+	return string(normalized), nil
+}
+
+// NameHash computes the ENS node of a normalized name
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node[:], crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// DNSEncode encodes a normalized name in DNS wire format, as used by ENSIP-10
+func DNSEncode(name string) ([]byte, error) {
+	var out []byte
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) == 0 || len(label) > 255 {
+				return nil, fmt.Errorf("label %q cannot be DNS encoded", label)
+			}
+			out = append(out, byte(len(label)))
+			out = append(out, label...)
+		}
+	}
+	return append(out, 0), nil
+}
+
+// ENS resolves names through the ENS registry, including wildcard resolvers
+// answering with CCIP-Read offchain lookups
+type ENS struct {
+	client   *Web3Client
+	registry common.Address
+}
+
+// NewENS creates a resolver using the registry at address, usually ENSRegistryAddress
+func NewENS(client *Web3Client, registry common.Address) *ENS {
+	return &ENS{client: client, registry: registry}
+}
+
+// findResolver walks up from name to the first ancestor with a resolver.
+// exact tells whether the resolver was set on name itself.
+func (e *ENS) findResolver(ctx context.Context, name string) (common.Address, bool, error) {
+	for current := name; ; {
+		data, _ := ensABI.Pack("resolver", NameHash(current))
+		out, err := e.client.CallContract(ctx, ethereum.CallMsg{To: &e.registry, Data: data}, nil)
+		if err != nil {
+			return common.Address{}, false, fmt.Errorf("failed to get resolver of %s: %w", current, err)
+		}
+		if resolver := common.BytesToAddress(out); len(out) == 32 && resolver != (common.Address{}) {
+			return resolver, current == name, nil
+		}
+		if current == "" {
+			return common.Address{}, false, ErrNoResolver
+		}
+		_, parent, _ := strings.Cut(current, ".")
+		current = parent
+	}
+}
+
+// resolveRecord calls a resolver method for name, through resolve(bytes,bytes)
+// when the resolver supports ENSIP-10
+func (e *ENS) resolveRecord(ctx context.Context, name, method string, args ...interface{}) ([]interface{}, error) {
+	name, err := NormalizeName(name)
+	if err != nil {
+		return nil, err
+	}
+	resolver, exact, err := e.findResolver(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ensABI.Pack(method, append([]interface{}{NameHash(name)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	extended, err := SupportsInterface(ctx, e.client, resolver, InterfaceIDExtendedResolver)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	switch {
+	case extended:
+		encoded, err := DNSEncode(name)
+		if err != nil {
+			return nil, err
+		}
+		call, _ := ensABI.Pack("resolve", encoded, data)
+		out, err = e.client.CallContract(ctx, ethereum.CallMsg{To: &resolver, Data: call}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s of %s: %w", method, name, err)
+		}
+		values, err := ensABI.Unpack("resolve", out)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode resolve: %v", err)
+		}
+		out = values[0].([]byte)
+	case exact:
+		out, err = e.client.CallContract(ctx, ethereum.CallMsg{To: &resolver, Data: data}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s of %s: %w", method, name, err)
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNoResolver, name)
+	}
+
+	values, err := ensABI.Unpack(method, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", method, err)
+	}
+	return values, nil
+}
+
+// ResolveName returns the address of an ENS name
+func (e *ENS) ResolveName(ctx context.Context, name string) (common.Address, error) {
+	values, err := e.resolveRecord(ctx, name, "addr")
+	if err != nil {
+		return common.Address{}, err
+	}
+	return values[0].(common.Address), nil
+}
+
+// LookupAddress returns the primary name of address, checked to resolve back to it
+func (e *ENS) LookupAddress(ctx context.Context, address common.Address) (string, error) {
+	reverse := strings.ToLower(address.Hex()[2:]) + ".addr.reverse"
+	values, err := e.resolveRecord(ctx, reverse, "name")
+	if errors.Is(err, ErrNoResolver) {
+		return "", ErrNoReverseRecord
+	}
+	if err != nil {
+		return "", err
+	}
+	name := values[0].(string)
+	if name == "" {
+		return "", ErrNoReverseRecord
+	}
+
+	resolved, err := e.ResolveName(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify reverse record %s: %v", name, err)
+	}
+	if resolved != address {
+		return "", ErrReverseMismatch
+	}
+	return name, nil
+}
+
+// Text returns a text record of a name, such as "url" or "com.twitter"
+func (e *ENS) Text(ctx context.Context, name, key string) (string, error) {
+	values, err := e.resolveRecord(ctx, name, "text", key)
+	if err != nil {
+		return "", err
+	}
+	return values[0].(string), nil
+}
+
+// ContentHash returns the raw ENSIP-7 contenthash record of a name
+func (e *ENS) ContentHash(ctx context.Context, name string) ([]byte, error) {
+	values, err := e.resolveRecord(ctx, name, "contenthash")
+	if err != nil {
+		return nil, err
+	}
+	return values[0].([]byte), nil
+}
+
+// ContentHashURI converts a contenthash record into an ipfs://, ipns:// or bzz:// URI
+func ContentHashURI(contentHash []byte) (string, error) {
+	codec, n := binary.Uvarint(contentHash)
+	if n <= 0 {
+		return "", errors.New("invalid contenthash")
+	}
+	cid := contentHash[n:]
+	lowerBase32 := base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+	switch codec {
+	case 0xe3:
+		return "ipfs://b" + lowerBase32.EncodeToString(cid), nil
+	case 0xe5:
+		return "ipns://b" + lowerBase32.EncodeToString(cid), nil
+	case 0xe4:
+		if len(cid) < 32 {
+			return "", errors.New("invalid swarm contenthash")
+		}
+		return "bzz://" + common.Bytes2Hex(cid[len(cid)-32:]), nil
+	}
+	return "", fmt.Errorf("unsupported contenthash codec 0x%x", codec)
+}
+
+// NameResolver turns a name into an address
+type NameResolver interface {
+	ResolveName(ctx context.Context, name string) (common.Address, error)
+}
+
+// SetNameResolver lets the address-taking APIs accept names, such as an ENS
+func (w *Web3Client) SetNameResolver(resolver NameResolver) *Web3Client {
+	w.resolver = resolver
+	return w
+}
+
+// ResolveAddress parses a hex address, or resolves a name when a resolver is set
+func (w *Web3Client) ResolveAddress(ctx context.Context, input string) (common.Address, error) {
+	input = strings.TrimSpace(input)
+	if common.IsHexAddress(input) {
+		return common.HexToAddress(input), nil
+	}
+	if w.resolver == nil || !strings.Contains(input, ".") {
+		return common.Address{}, fmt.Errorf("invalid address: %q", input)
+	}
+	address, err := w.resolver.ResolveName(ctx, input)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, fmt.Errorf("%s has no address", input)
+	}
+	return address, nil
+}
+
+// ResolveTransfers turns recipients given as hex addresses or names into the
+// input of BatchTransfer. Two entries resolving to the same address are an error.
+func (bp *BatchProcessor) ResolveTransfers(ctx context.Context, transfers map[string]*big.Int) (map[common.Address]*big.Int, error) {
+	resolved := make(map[common.Address]*big.Int, len(transfers))
+	for recipient, amount := range transfers {
+		address, err := bp.client.ResolveAddress(ctx, recipient)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := resolved[address]; ok {
+			return nil, fmt.Errorf("%s resolves to an address already in the batch", recipient)
+		}
+		resolved[address] = amount
+	}
+	return resolved, nil
+}
@@ -0,0 +1,326 @@
+package pyweb3
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+// ERC20ABI is the ERC-20 interface along with the EIP-2612 permit extension
+const ERC20ABI = `[
+{"constant":true,"inputs":[],"name":"name","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[],"name":"symbol","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[],"name":"decimals","outputs":[{"name":"","type":"uint8"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"constant":false,"inputs":[{"name":"spender","type":"address"},{"name":"value","type":"uint256"}],"name":"approve","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"constant":false,"inputs":[{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"constant":false,"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"value","type":"uint256"}],"name":"transferFrom","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},
+{"constant":true,"inputs":[{"name":"owner","type":"address"}],"name":"nonces","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[],"name":"DOMAIN_SEPARATOR","outputs":[{"name":"","type":"bytes32"}],"stateMutability":"view","type":"function"},
+{"constant":true,"inputs":[],"name":"version","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"constant":false,"inputs":[{"name":"owner","type":"address"},{"name":"spender","type":"address"},{"name":"value","type":"uint256"},{"name":"deadline","type":"uint256"},{"name":"v","type":"uint8"},{"name":"r","type":"bytes32"},{"name":"s","type":"bytes32"}],"name":"permit","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"spender","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Approval","type":"event"}
+]`
+
+var erc20ABI, _ = abi.JSON(strings.NewReader(ERC20ABI))
+
+// ERC20 reads and writes an ERC-20 token contract
+type ERC20 struct {
+	client   *Web3Client
+	address  common.Address
+	contract *bind.BoundContract
+
+	mutex    sync.Mutex
+	decimals *uint8
+}
+
+// NewERC20 binds an ERC-20 token at address
+func NewERC20(client *Web3Client, address common.Address) *ERC20 {
+	return &ERC20{
+		client:   client,
+		address:  address,
+		contract: bind.NewBoundContract(address, erc20ABI, client, client.client, client.client),
+	}
+}
+
+// Address returns the token contract address
+func (t *ERC20) Address() common.Address {
+	return t.address
+}
+
+// call performs a read-only call and returns the raw answer
+func (t *ERC20) call(ctx context.Context, method string, args ...interface{}) ([]byte, error) {
+	data, err := erc20ABI.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %v", method, err)
+	}
+	out, err := t.client.CallContract(ctx, ethereum.CallMsg{To: &t.address, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s call failed: %v", method, err)
+	}
+	return out, nil
+}
+
+func (t *ERC20) callUint(ctx context.Context, method string, args ...interface{}) (*big.Int, error) {
+	out, err := t.call(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	values, err := erc20ABI.Unpack(method, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", method, err)
+	}
+	return values[0].(*big.Int), nil
+}
+
+// callString reads a string getter, also accepting tokens returning bytes32 such as MKR
+func (t *ERC20) callString(ctx context.Context, method string) (string, error) {
+	out, err := t.call(ctx, method)
+	if err != nil {
+		return "", err
+	}
+	if len(out) == 32 {
+		return string(bytes.TrimRight(out, "\x00")), nil
+	}
+	values, err := erc20ABI.Unpack(method, out)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %v", method, err)
+	}
+	return values[0].(string), nil
+}
+
+// Name returns the token name
+func (t *ERC20) Name(ctx context.Context) (string, error) {
+	return t.callString(ctx, "name")
+}
+
+// Symbol returns the token symbol
+func (t *ERC20) Symbol(ctx context.Context) (string, error) {
+	return t.callString(ctx, "symbol")
+}
+
+// Decimals returns the token decimals, read once and then cached
+func (t *ERC20) Decimals(ctx context.Context) (uint8, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.decimals == nil {
+		out, err := t.call(ctx, "decimals")
+		if err != nil {
+			return 0, err
+		}
+		// Some old tokens declare decimals as uint256
+		if len(out) != 32 {
+			return 0, fmt.Errorf("bad data when reading decimals")
+		}
+		value := new(big.Int).SetBytes(out)
+		if !value.IsUint64() || value.Uint64() > math.MaxUint8 {
+			return 0, fmt.Errorf("bad data when reading decimals")
+		}
+		decimals := uint8(value.Uint64())
+		t.decimals = &decimals
+	}
+	return *t.decimals, nil
+}
+
+// TotalSupply returns the total supply in base units
+func (t *ERC20) TotalSupply(ctx context.Context) (*big.Int, error) {
+	return t.callUint(ctx, "totalSupply")
+}
+
+// BalanceOf returns the balance of owner in base units
+func (t *ERC20) BalanceOf(ctx context.Context, owner common.Address) (*big.Int, error) {
+	return t.callUint(ctx, "balanceOf", owner)
+}
+
+// Allowance returns how much spender may still transfer from owner
+func (t *ERC20) Allowance(ctx context.Context, owner, spender common.Address) (*big.Int, error) {
+	return t.callUint(ctx, "allowance", owner, spender)
+}
+
+// ParseAmount converts a human string into an amount of this token
+func (t *ERC20) ParseAmount(ctx context.Context, s string) (Amount, error) {
+	decimals, err := t.Decimals(ctx)
+	if err != nil {
+		return Amount{}, err
+	}
+	return ParseAmount(s, decimals)
+}
+
+// Amount wraps a quantity in base units with the token decimals
+func (t *ERC20) Amount(ctx context.Context, value *big.Int) (Amount, error) {
+	decimals, err := t.Decimals(ctx)
+	if err != nil {
+		return Amount{}, err
+	}
+	return NewAmount(value, decimals), nil
+}
+
+// Transfer sends value base units to to
+func (t *ERC20) Transfer(opts *bind.TransactOpts, to common.Address, value *big.Int) (*types.Transaction, error) {
+	return t.contract.Transact(opts, "transfer", to, value)
+}
+
+// TransferFrom moves value base units from from to to using the allowance of the sender
+func (t *ERC20) TransferFrom(opts *bind.TransactOpts, from, to common.Address, value *big.Int) (*types.Transaction, error) {
+	return t.contract.Transact(opts, "transferFrom", from, to, value)
+}
+
+// Approve sets the allowance of spender
+func (t *ERC20) Approve(opts *bind.TransactOpts, spender common.Address, value *big.Int) (*types.Transaction, error) {
+	return t.contract.Transact(opts, "approve", spender, value)
+}
+
+// SafeApprove sets the allowance of spender, first resetting it to zero when
+// it is not already zero, as required by tokens such as USDT.
+// It returns every transaction sent, in order.
+func (t *ERC20) SafeApprove(ctx context.Context, opts *bind.TransactOpts, spender common.Address, value *big.Int) ([]*types.Transaction, error) {
+	current, err := t.Allowance(ctx, opts.From, spender)
+	if err != nil {
+		return nil, err
+	}
+	if current.Cmp(value) == 0 {
+		return nil, nil
+	}
+
+	var txs []*types.Transaction
+	if current.Sign() != 0 && value.Sign() != 0 {
+		reset, err := t.Approve(opts, spender, new(big.Int))
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset allowance: %v", err)
+		}
+		txs = append(txs, reset)
+
+		// Chain the second transaction on the nonce of the first one
+		next := *opts
+		next.Nonce = new(big.Int).SetUint64(reset.Nonce() + 1)
+		opts = &next
+	}
+
+	tx, err := t.Approve(opts, spender, value)
+	if err != nil {
+		return txs, err
+	}
+	return append(txs, tx), nil
+}
+
+// Permit is a signed EIP-2612 approval
+type Permit struct {
+	Owner    common.Address
+	Spender  common.Address
+	Value    *big.Int
+	Nonce    *big.Int
+	Deadline *big.Int
+	V        uint8
+	R        [32]byte
+	S        [32]byte
+}
+
+// SignPermit signs an EIP-2612 permit letting spender use value tokens of the
+// key owner until deadline. An empty version is read from the token, "1" if
+// it has no version getter. The domain is checked against DOMAIN_SEPARATOR.
+func (t *ERC20) SignPermit(ctx context.Context, key *ecdsa.PrivateKey, spender common.Address, value, deadline *big.Int, version string) (*Permit, error) {
+	owner := crypto.PubkeyToAddress(key.PublicKey)
+
+	name, err := t.Name(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version == "" {
+		if version, err = t.callString(ctx, "version"); err != nil || version == "" {
+			version = "1"
+		}
+	}
+	chainID, err := t.client.client.ChainID(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chain id: %v", err)
+	}
+	nonce, err := t.callUint(ctx, "nonces", owner)
+	if err != nil {
+		return nil, err
+	}
+
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"Permit": {
+				{Name: "owner", Type: "address"},
+				{Name: "spender", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "nonce", Type: "uint256"},
+				{Name: "deadline", Type: "uint256"},
+			},
+		},
+		PrimaryType: "Permit",
+		Domain: apitypes.TypedDataDomain{
+			Name:              name,
+			Version:           version,
+			ChainId:           (*math.HexOrDecimal256)(chainID),
+			VerifyingContract: t.address.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"owner":    owner.Hex(),
+			"spender":  spender.Hex(),
+			"value":    (*math.HexOrDecimal256)(value),
+			"nonce":    (*math.HexOrDecimal256)(nonce),
+			"deadline": (*math.HexOrDecimal256)(deadline),
+		},
+	}
+
+	domainSeparator, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash permit domain: %v", err)
+	}
+	if out, err := t.call(ctx, "DOMAIN_SEPARATOR"); err == nil && len(out) == 32 {
+		if !bytes.Equal(out, domainSeparator) {
+			return nil, fmt.Errorf("permit domain mismatch, token may use another version than %q", version)
+		}
+	}
+
+	digest, _, err := apitypes.TypedDataAndHash(typedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash permit: %v", err)
+	}
+	sig, err := crypto.Sign(digest, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign permit: %v", err)
+	}
+
+	permit := &Permit{
+		Owner:    owner,
+		Spender:  spender,
+		Value:    value,
+		Nonce:    nonce,
+		Deadline: deadline,
+		V:        sig[64] + 27,
+	}
+	copy(permit.R[:], sig[:32])
+	copy(permit.S[:], sig[32:64])
+	return permit, nil
+}
+
+// SubmitPermit sends a signed permit to the token, any account can relay it
+func (t *ERC20) SubmitPermit(opts *bind.TransactOpts, p *Permit) (*types.Transaction, error) {
+	return t.contract.Transact(opts, "permit", p.Owner, p.Spender, p.Value, p.Deadline, p.V, p.R, p.S)
+}
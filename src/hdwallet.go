@@ -0,0 +1,140 @@
+package pyweb3
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// ErrWalletZeroed is returned when deriving from a wiped wallet
+var ErrWalletZeroed = errors.New("wallet seed was wiped")
+
+// NewMnemonic generates a BIP-39 mnemonic of 12 words for 128 bits of
+// entropy, up to 24 words for 256 bits
+func NewMnemonic(bits int) (string, error) {
+	entropy, err := bip39.NewEntropy(bits)
+	if err != nil {
+		return "", err
+	}
+	defer zeroBytes(entropy)
+	return bip39.NewMnemonic(entropy)
+}
+
+// HDWallet derives keys from a BIP-39 seed along BIP-32 paths
+type HDWallet struct {
+	seed  []byte
+	mutex sync.Mutex
+}
+
+// NewHDWallet checks a mnemonic and keeps its seed, salted with the
+// optional passphrase, until Zero is called
+func NewHDWallet(mnemonic, passphrase string) (*HDWallet, error) {
+	seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mnemonic: %v", err)
+	}
+	return &HDWallet{seed: seed}, nil
+}
+
+// AccountPath returns the BIP-44 path of the account at index, m/44'/60'/0'/0/index
+func AccountPath(index uint32) accounts.DerivationPath {
+	path := make(accounts.DerivationPath, len(accounts.DefaultBaseDerivationPath))
+	copy(path, accounts.DefaultBaseDerivationPath)
+	path[len(path)-1] = index
+	return path
+}
+
+// Derive returns a signer for the key at path. Its key is independent of the
+// wallet and wiped by its own Zero.
+func (w *HDWallet) Derive(path accounts.DerivationPath) (*KeySigner, error) {
+	key, err := w.deriveKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySigner(key), nil
+}
+
+// Account returns a signer for the BIP-44 account at index
+func (w *HDWallet) Account(index uint32) (*KeySigner, error) {
+	return w.Derive(AccountPath(index))
+}
+
+// Zero wipes the seed, after which nothing can be derived
+func (w *HDWallet) Zero() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	zeroBytes(w.seed)
+	w.seed = nil
+}
+
+func (w *HDWallet) deriveKey(path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.seed == nil {
+		return nil, ErrWalletZeroed
+	}
+	return deriveKey(w.seed, path)
+}
+
+// deriveKey walks a BIP-32 path from the master key of seed, wiping the
+// intermediate keys and chain codes
+func deriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	curveOrder := crypto.S256().Params().N
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	defer zeroBytes(sum)
+	key, chainCode := make([]byte, 32), make([]byte, 32)
+	defer zeroBytes(key)
+	defer zeroBytes(chainCode)
+	copy(key, sum[:32])
+	copy(chainCode, sum[32:])
+
+	k := new(big.Int)
+	defer k.SetInt64(0)
+	data := make([]byte, 37)
+	defer zeroBytes(data)
+	for depth, index := range path {
+		// Hardened children hash the private key, others the public key
+		if index >= 0x80000000 {
+			data = append(append(data[:0], 0), key...)
+		} else {
+			private, err := crypto.ToECDSA(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key at depth %d of %s: %v", depth, path, err)
+			}
+			data = append(data[:0], crypto.CompressPubkey(&private.PublicKey)...)
+			zeroKey(private)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		child := mac.Sum(nil)
+		tweak := new(big.Int).SetBytes(child[:32])
+		k.SetBytes(key)
+		k.Add(k, tweak)
+		k.Mod(k, curveOrder)
+		// Invalid with a chance below 2^-127, the path must be changed
+		if tweak.Cmp(curveOrder) >= 0 || k.Sign() == 0 {
+			zeroBytes(child)
+			tweak.SetInt64(0)
+			return nil, fmt.Errorf("path %s derives an invalid key at depth %d", path, depth)
+		}
+		k.FillBytes(key)
+		copy(chainCode, child[32:])
+		zeroBytes(child)
+		tweak.SetInt64(0)
+	}
+	return crypto.ToECDSA(key)
+}
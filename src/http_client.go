@@ -1,11 +1,18 @@
 package pyweb3
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
 )
 
 // DefaultHTTPSPort is the default port for HTTPS connections
@@ -25,15 +32,26 @@ type HTTPClient struct {
 	conn             *tls.Conn
 	receivedMessages [][]byte
 	partialMessages  [][]byte
-	portNum         int
-	domain          string
-	endpoint        string
-	userAgent       string
+	portNum          int
+	domain           string
+	endpoint         string
+	userAgent        string
+	logger           *slog.Logger
+	instrumentation  Instrumentation
+	auth             AuthProvider
+	// pending ends the instrumentation of the request awaiting its response
+	pending func(RequestOutcome)
+	sentAt  time.Time
 }
 
-// NewHTTPClient creates a new HTTPS client for a given URL
+// NewHTTPClient creates a new HTTPS client for a given URL. Credentials in
+// the userinfo of the URL are sent as basic auth.
 func NewHTTPClient(httpURL string, ua string) (*HTTPClient, error) {
-	parsedURL, err := url.Parse(httpURL)
+	urlAuth, stripped, err := BasicAuthFromURL(httpURL)
+	if err != nil {
+		return nil, &HTTPClientException{message: "invalid URL"}
+	}
+	parsedURL, err := url.Parse(stripped)
 	if err != nil {
 		return nil, &HTTPClientException{message: "invalid URL"}
 	}
@@ -45,7 +63,9 @@ func NewHTTPClient(httpURL string, ua string) (*HTTPClient, error) {
 	port := parsedURL.Port()
 	portNum := DefaultHTTPSPort
 	if port != "" {
-		portNum = parseInt(port)
+		if portNum, err = strconv.Atoi(port); err != nil {
+			return nil, &HTTPClientException{message: "invalid port"}
+		}
 	}
 
 	endpoint := parsedURL.Path
@@ -53,39 +73,83 @@ func NewHTTPClient(httpURL string, ua string) (*HTTPClient, error) {
 		endpoint = "/"
 	}
 
+	var auth AuthProvider
+	if urlAuth != nil {
+		auth = urlAuth
+	}
+
 	return &HTTPClient{
 		conn:             nil,
 		receivedMessages: make([][]byte, 0),
 		partialMessages:  make([][]byte, 0),
-		portNum:         portNum,
-		domain:          parsedURL.Hostname(),
-		endpoint:        endpoint,
-		userAgent:       ua,
+		portNum:          portNum,
+		domain:           parsedURL.Hostname(),
+		endpoint:         endpoint,
+		userAgent:        ua,
+		auth:             auth,
 	}, nil
 }
 
+// SetLogger sets the logger of the client, nil meaning the package default
+func (c *HTTPClient) SetLogger(logger *slog.Logger) {
+	c.logger = logger
+}
+
+// SetInstrumentation sets the instrumentation of the client, nil meaning the
+// package default
+func (c *HTTPClient) SetInstrumentation(instrumentation Instrumentation) {
+	c.instrumentation = instrumentation
+}
+
+// SetAuth sets the credentials sent with each message, replacing those
+// taken from the userinfo of the URL
+func (c *HTTPClient) SetAuth(auth AuthProvider) {
+	c.auth = auth
+}
+
 // Close terminates the TLS connection
 func (c *HTTPClient) Close() {
 	if c.conn != nil {
-		log.Printf("Closing TLS")
+		loggerOr(c.logger).Debug("Closing TLS", "endpoint", c.address())
 		c.conn.Close()
 		c.conn = nil
 	}
 }
 
-func (c *HttpClient) SendMessage(message string) error {
+// address is the host:port the client connects to
+func (c *HTTPClient) address() string {
+	return fmt.Sprintf("%s:%d", c.domain, c.portNum)
+}
+
+// finish ends the instrumentation of the pending request
+func (c *HTTPClient) finish(outcome RequestOutcome) {
+	if c.pending != nil {
+		c.pending(outcome)
+		c.pending = nil
+	}
+}
+
+func (c *HTTPClient) SendMessage(message string) error {
+	logger := loggerOr(c.logger)
+	c.finish(RequestOutcome{Latency: time.Since(c.sentAt), Err: errors.New("response not read")})
+	info := RequestInfo{Method: "unknown", Endpoint: c.address()}
+	if msgs, _, err := decodeRPCMessages([]byte(message)); err == nil {
+		info = requestInfo(msgs, c.address())
+	}
+	_, c.pending = instrumentationOr(c.instrumentation).StartRequest(context.Background(), info)
+	c.sentAt = time.Now()
+
 	// Establish TLS connection
-	log.Printf("Connecting to HTTPS Host: %s Port: %d", c.domain, c.portNum)
-	
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", c.domain, c.portNum), &tls.Config{})
+	logger.Debug("Connecting to HTTPS host", "endpoint", c.address())
+
+	conn, err := tls.Dial("tcp", c.address(), &tls.Config{})
 	if err != nil {
-		log.Printf("Error during TLS connection: %v", err)
+		logger.Warn("TLS connection failed", "endpoint", c.address(), "error", err)
+		c.finish(RequestOutcome{Latency: time.Since(c.sentAt), Err: err})
 		return fmt.Errorf("tls connection error: %w", err)
 	}
-	c.tlsConn = conn
-	defer c.tlsConn.Close()
-
-	log.Printf("Connected to HTTPS Host=%s PathTarget=%s", c.domain, c.endpoint)
+	c.conn = conn
+	defer c.conn.Close()
 
 	// Construct HTTP POST request
 	headers := []string{
@@ -95,68 +159,98 @@ func (c *HttpClient) SendMessage(message string) error {
 		"Content-Type: application/json",
 		fmt.Sprintf("Content-Length: %d", len(message)),
 	}
+	credentials := make(http.Header)
+	if err := applyAuth(c.auth, credentials); err != nil {
+		c.finish(RequestOutcome{Latency: time.Since(c.sentAt), Err: err})
+		return err
+	}
+	authHeaders := make([]string, 0, len(credentials))
+	for name, values := range credentials {
+		for _, value := range values {
+			authHeaders = append(authHeaders, fmt.Sprintf("%s: %s", name, value))
+		}
+	}
 
 	request := fmt.Sprintf("POST %s HTTP/1.1\r\n%s\r\n\r\n%s",
 		c.endpoint,
-		strings.Join(headers, "\r\n"),
+		strings.Join(append(headers, authHeaders...), "\r\n"),
 		message,
 	)
 
-	log.Printf("Sending HTTP POST data: %s", request)
-	
+	// The path may hold an API key and the body a signed transaction.
+	// Credentials are logged by name only, whatever header carries them.
+	names := make([]string, 0, len(credentials))
+	for name := range credentials {
+		names = append(names, name)
+	}
+	logger.Debug("Sending HTTP POST", "endpoint", c.address(), "headers", headerLines(headers),
+		"auth_headers", names, "body", redactRPCBody([]byte(message)))
+
 	// Send the request
-	_, err = c.tlsConn.Write([]byte(request))
+	_, err = c.conn.Write([]byte(request))
 	if err != nil {
+		c.finish(RequestOutcome{Latency: time.Since(c.sentAt), Err: err})
 		return fmt.Errorf("failed to send request: %w", err)
 	}
 
 	return nil
 }
 
-func (c *HttpClient) GetMessages() ([]byte, error) {
-    if c.socket == nil {
-        c.Close()
-        log.Debug("Socket was closed by remote party")
-        return nil, nil
-    }
-
-    var partialMessages []byte
-    
-    for {
-        // Read from socket
-        buf := make([]byte, 4096) // Common buffer size
-        n, err := c.socket.Read(buf)
-        if err != nil {
-            if err == io.EOF {
-                c.Close()
-                return partialMessages, nil
-            }
-            return nil, fmt.Errorf("error reading from socket: %v", err)
-        }
-
-        // Process the response
-        if len(partialMessages) == 0 {
-            // Check response status code (first message)
-            response := string(buf[:n])
-            if !strings.Contains(response, "200 OK") {
-                return nil, fmt.Errorf("error in response code: %s", response)
-            }
-            
-            // Skip headers and get to body
-            if idx := strings.Index(response, "\r\n\r\n"); idx != -1 {
-                partialMessages = append(partialMessages, buf[idx+4:n]...)
-            }
-        } else {
-            partialMessages = append(partialMessages, buf[:n]...)
-        }
-
-        log.Debug("Data received from HTTP query:", string(buf[:n]))
-        
-        // Check if message is complete
-        if strings.HasSuffix(string(buf[:n]), "\r\n\r\n") {
-            break
-        }
-    }
-
-    return partialMessages, nil
+// GetMessages reads the response to the last message sent
+func (c *HTTPClient) GetMessages() ([]byte, error) {
+	body, err := c.getMessages()
+	if err != nil {
+		c.finish(RequestOutcome{Latency: time.Since(c.sentAt), Err: err})
+	} else {
+		c.finish(requestOutcome(c.sentAt, body))
+	}
+	return body, err
+}
+
+func (c *HTTPClient) getMessages() ([]byte, error) {
+	if c.conn == nil {
+		c.Close()
+		loggerOr(c.logger).Debug("Socket was closed by remote party", "endpoint", c.address())
+		return nil, nil
+	}
+
+	var partialMessages []byte
+
+	for {
+		// Read from socket
+		buf := make([]byte, 4096) // Common buffer size
+		n, err := c.conn.Read(buf)
+		if err != nil {
+			if err == io.EOF {
+				c.Close()
+				return partialMessages, nil
+			}
+			return nil, fmt.Errorf("error reading from socket: %v", err)
+		}
+
+		// Process the response
+		if len(partialMessages) == 0 {
+			// Check response status code (first message)
+			response := string(buf[:n])
+			if !strings.Contains(response, "200 OK") {
+				return nil, fmt.Errorf("error in response code: %s", response)
+			}
+
+			// Skip headers and get to body
+			if idx := strings.Index(response, "\r\n\r\n"); idx != -1 {
+				partialMessages = append(partialMessages, buf[idx+4:n]...)
+			}
+		} else {
+			partialMessages = append(partialMessages, buf[:n]...)
+		}
+
+		loggerOr(c.logger).Debug("Data received from HTTP query", "endpoint", c.address(), "bytes", n)
+
+		// Check if message is complete
+		if strings.HasSuffix(string(buf[:n]), "\r\n\r\n") {
+			break
+		}
+	}
+
+	return partialMessages, nil
 }
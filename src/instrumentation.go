@@ -0,0 +1,213 @@
+package pyweb3
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+)
+
+// Instrumentation observes the RPC path: JSONRPCClient, HTTPClient,
+// WebSocketClient, Web3Client and BatchProcessor report to it. The prommetrics and
+// oteltrace packages adapt it to Prometheus and OpenTelemetry. Embed
+// NopInstrumentation to implement only part of it.
+type Instrumentation interface {
+	// StartRequest is called as a JSON-RPC request is sent. It returns the
+	// context of the request, which may carry a span, and the function
+	// called once with the outcome.
+	StartRequest(ctx context.Context, request RequestInfo) (context.Context, func(RequestOutcome))
+	// BatchSize records the number of instructions of a batch operation
+	BatchSize(ctx context.Context, operation string, size int)
+	// Connections adds delta to the open WebSocket connections of an endpoint
+	Connections(endpoint string, delta int)
+	// Subscriptions adds delta to the in-flight eth_subscribe subscriptions
+	// of a kind, such as "logs"
+	Subscriptions(kind string, delta int)
+	// Reconnect records a reconnection to an endpoint
+	Reconnect(endpoint string)
+}
+
+// RequestInfo describes a JSON-RPC request. Batches have the method "batch"
+// and no request id.
+type RequestInfo struct {
+	Method    string
+	Endpoint  string
+	RequestID string
+	BatchSize int
+}
+
+// RequestOutcome is the outcome of a JSON-RPC request
+type RequestOutcome struct {
+	Latency time.Duration
+	// Err is the failure of the whole request, such as a transport error
+	// or a JSON-RPC error of a single call
+	Err error
+	// RPCErrors are the JSON-RPC errors of the calls of a batch
+	RPCErrors []*RPCError
+}
+
+// ErrorCodes returns a label per error of the outcome: the JSON-RPC error
+// code, or "transport" for failures without one
+func (r RequestOutcome) ErrorCodes() []string {
+	var codes []string
+	if r.Err != nil {
+		var rpcErr *RPCError
+		if errors.As(r.Err, &rpcErr) {
+			codes = append(codes, strconv.Itoa(rpcErr.Code))
+		} else {
+			codes = append(codes, "transport")
+		}
+	}
+	for _, rpcErr := range r.RPCErrors {
+		codes = append(codes, strconv.Itoa(rpcErr.Code))
+	}
+	return codes
+}
+
+// NopInstrumentation records nothing
+type NopInstrumentation struct{}
+
+// StartRequest returns ctx and a function doing nothing
+func (NopInstrumentation) StartRequest(ctx context.Context, request RequestInfo) (context.Context, func(RequestOutcome)) {
+	return ctx, func(RequestOutcome) {}
+}
+
+// BatchSize does nothing
+func (NopInstrumentation) BatchSize(ctx context.Context, operation string, size int) {}
+
+// Connections does nothing
+func (NopInstrumentation) Connections(endpoint string, delta int) {}
+
+// Subscriptions does nothing
+func (NopInstrumentation) Subscriptions(kind string, delta int) {}
+
+// Reconnect does nothing
+func (NopInstrumentation) Reconnect(endpoint string) {}
+
+// multiInstrumentation reports to several instrumentations in turn
+type multiInstrumentation []Instrumentation
+
+// MultiInstrumentation combines instrumentations, such as metrics and tracing
+func MultiInstrumentation(instruments ...Instrumentation) Instrumentation {
+	return multiInstrumentation(instruments)
+}
+
+func (m multiInstrumentation) StartRequest(ctx context.Context, request RequestInfo) (context.Context, func(RequestOutcome)) {
+	ends := make([]func(RequestOutcome), len(m))
+	for i, instrument := range m {
+		ctx, ends[i] = instrument.StartRequest(ctx, request)
+	}
+	return ctx, func(outcome RequestOutcome) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](outcome)
+		}
+	}
+}
+
+func (m multiInstrumentation) BatchSize(ctx context.Context, operation string, size int) {
+	for _, instrument := range m {
+		instrument.BatchSize(ctx, operation, size)
+	}
+}
+
+func (m multiInstrumentation) Connections(endpoint string, delta int) {
+	for _, instrument := range m {
+		instrument.Connections(endpoint, delta)
+	}
+}
+
+func (m multiInstrumentation) Subscriptions(kind string, delta int) {
+	for _, instrument := range m {
+		instrument.Subscriptions(kind, delta)
+	}
+}
+
+func (m multiInstrumentation) Reconnect(endpoint string) {
+	for _, instrument := range m {
+		instrument.Reconnect(endpoint)
+	}
+}
+
+// instrumentationHolder lets an interface be stored atomically
+type instrumentationHolder struct {
+	Instrumentation
+}
+
+var defaultInstrumentation atomic.Pointer[instrumentationHolder]
+
+// SetDefaultInstrumentation sets the instrumentation of the components not
+// given their own, nil turning it off again
+func SetDefaultInstrumentation(instrumentation Instrumentation) {
+	if instrumentation == nil {
+		defaultInstrumentation.Store(nil)
+		return
+	}
+	defaultInstrumentation.Store(&instrumentationHolder{instrumentation})
+}
+
+// instrumentationOr returns instrumentation, or the package default when nil
+func instrumentationOr(instrumentation Instrumentation) Instrumentation {
+	if instrumentation != nil {
+		return instrumentation
+	}
+	if holder := defaultInstrumentation.Load(); holder != nil {
+		return holder.Instrumentation
+	}
+	return NopInstrumentation{}
+}
+
+// countedSubscription counts as in flight until unsubscribed, which
+// go-ethereum asks of callers even after the subscription failed
+type countedSubscription struct {
+	ethereum.Subscription
+	instrumentation Instrumentation
+	kind            string
+	once            sync.Once
+}
+
+// countSubscription reports sub to instrumentation until it is unsubscribed
+func countSubscription(sub ethereum.Subscription, instrumentation Instrumentation, kind string) ethereum.Subscription {
+	instrumentation.Subscriptions(kind, 1)
+	return &countedSubscription{Subscription: sub, instrumentation: instrumentation, kind: kind}
+}
+
+// Unsubscribe ends the subscription and stops counting it
+func (s *countedSubscription) Unsubscribe() {
+	s.Subscription.Unsubscribe()
+	s.once.Do(func() {
+		s.instrumentation.Subscriptions(s.kind, -1)
+	})
+}
+
+// requestInfo describes the JSON-RPC messages of a request for instrumentation
+func requestInfo(msgs []*rpcMessage, endpoint string) RequestInfo {
+	if len(msgs) != 1 {
+		return RequestInfo{Method: "batch", Endpoint: endpoint, BatchSize: len(msgs)}
+	}
+	return RequestInfo{Method: msgs[0].Method, Endpoint: endpoint, RequestID: string(msgs[0].ID), BatchSize: 1}
+}
+
+// requestOutcome collects the JSON-RPC errors of a response body
+func requestOutcome(start time.Time, body []byte) RequestOutcome {
+	outcome := RequestOutcome{Latency: time.Since(start)}
+	replies, batch, err := decodeRPCMessages(body)
+	if err != nil {
+		outcome.Err = err
+		return outcome
+	}
+	for _, reply := range replies {
+		if reply.Error == nil {
+			continue
+		}
+		if batch {
+			outcome.RPCErrors = append(outcome.RPCErrors, reply.Error)
+		} else {
+			outcome.Err = reply.Error
+		}
+	}
+	return outcome
+}
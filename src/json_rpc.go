@@ -1,10 +1,17 @@
-package main
+package pyweb3
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"golang.org/x/exp/slog"
 )
 
 type JSONRPCException struct {
@@ -16,7 +23,8 @@ func (e JSONRPCException) Error() string {
 }
 
 const (
-	DEFAULT_USER_AGENT = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:96.0) Gecko/20100101 Firefox/96.0"
+	// DEFAULT_USER_AGENT names the client honestly, so that providers can tell it apart
+	DEFAULT_USER_AGENT = "web3-rpc-client"
 )
 
 // jsonEncode compacts JSON encoding.
@@ -73,29 +81,141 @@ func CreateJSONRPCRequest(method string, params interface{}, id string) (string,
 	return jsonEncode(request)
 }
 
-func main() {
-	// Example usage
-	log.Println("Starting JSON-RPC example...")
+// JSONRPCClient sends JSON-RPC requests to a node over HTTP, retrying
+// transient failures up to Retries times. It implements Transport.
+type JSONRPCClient struct {
+	NodeURL   string
+	UserAgent string
+	Retries   int
+	// Transport sends the HTTP requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// Logger receives the calls and retries, the package default if nil
+	Logger *slog.Logger
+	// Instrumentation observes the calls, the package default if nil
+	Instrumentation Instrumentation
+	// Auth adds credentials to every request
+	Auth AuthProvider
+
+	nextID uint64
+}
+
+// NewJSONRPCClient creates a JSON-RPC client for a node. Credentials in the
+// userinfo of the URL are moved to a BasicAuth.
+func NewJSONRPCClient(nodeURL, userAgent string, retries int) *JSONRPCClient {
+	client := &JSONRPCClient{NodeURL: nodeURL, UserAgent: userAgent, Retries: retries}
+	if auth, stripped, err := BasicAuthFromURL(nodeURL); err == nil && auth != nil {
+		client.NodeURL, client.Auth = stripped, auth
+	}
+	return client
+}
 
-	// Example of creating a request
-	params := map[string]interface{}{
-		"name":  "test",
-		"value": 123,
+// CallContext calls method with args and decodes the result into result
+func (c *JSONRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	batch := []rpc.BatchElem{{Method: method, Args: args, Result: result}}
+	if err := c.send(ctx, batch, false); err != nil {
+		return err
 	}
+	return batch[0].Error
+}
 
-	requestJSON, err := CreateJSONRPCRequest("test_method", params, "1")
+// BatchCallContext sends the calls as a single JSON-RPC batch. Errors of
+// individual calls are set on their element.
+func (c *JSONRPCClient) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if len(b) == 0 {
+		return nil
+	}
+	return c.send(ctx, b, true)
+}
+
+// Close is a no-op, HTTP connections are pooled by the transport
+func (c *JSONRPCClient) Close() {}
+
+// send posts the calls and fills in their results
+func (c *JSONRPCClient) send(ctx context.Context, calls []rpc.BatchElem, batch bool) error {
+	msgs := make([]*rpcMessage, len(calls))
+	index := make(map[string]int, len(calls))
+	for i, call := range calls {
+		args := call.Args
+		if args == nil {
+			args = []interface{}{}
+		}
+		params, err := json.Marshal(args)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s params: %v", call.Method, err)
+		}
+		id := json.RawMessage(fmt.Sprint(atomic.AddUint64(&c.nextID, 1)))
+		msgs[i] = &rpcMessage{Version: "2.0", ID: id, Method: call.Method, Params: params}
+		index[string(id)] = i
+	}
+	body, err := encodeRPCMessages(msgs, batch)
 	if err != nil {
-		log.Fatalf("Error creating JSON-RPC request: %v", err)
+		return err
 	}
-	log.Printf("Created request: %s", requestJSON)
 
-	// Original example code
-	exampleBuffer := []byte(`{"jsonrpc":"2.0","id":"1","result":"example result"}`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.NodeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if err := applyAuth(c.Auth, req.Header); err != nil {
+		return err
+	}
 
-	id, result, err := jsonRPCUnpack(exampleBuffer)
+	policy := DefaultRetryPolicy
+	policy.MaxAttempts = c.Retries + 1
+	httpClient := &http.Client{Transport: NewRetrier(RetryConfig{Default: policy, Logger: c.Logger}, c.Transport)}
+	logger := loggerOr(c.Logger)
+	attrs := append(requestAttrs(msgs), "endpoint", req.URL.Host)
+	ctx, end := instrumentationOr(c.Instrumentation).StartRequest(ctx, requestInfo(msgs, req.URL.Host))
+	start := time.Now()
+	resp, err := httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		logger.Warn("JSON-RPC request failed", append(attrs, "latency", time.Since(start), "error", errorOf(err))...)
+		end(RequestOutcome{Latency: time.Since(start), Err: errorOf(err)})
+		return err
+	}
+	respBody, err := readResponseBody(resp)
 	if err != nil {
-		log.Fatalf("Error unpacking JSON-RPC response: %v", err)
+		end(RequestOutcome{Latency: time.Since(start), Err: err})
+		return err
 	}
+	if resp.StatusCode != http.StatusOK {
+		logger.Warn("JSON-RPC request failed", append(attrs, "latency", time.Since(start), "status", resp.StatusCode)...)
+		err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(respBody))
+		end(RequestOutcome{Latency: time.Since(start), Err: err})
+		return err
+	}
+	logger.Debug("JSON-RPC request", append(attrs, "latency", time.Since(start), "response_bytes", len(respBody))...)
+	end(requestOutcome(start, respBody))
 
-	log.Printf("Response ID: %s, Result: %v", id, result)
+	replies, _, err := decodeRPCMessages(respBody)
+	if err != nil {
+		return err
+	}
+	answered := make([]bool, len(calls))
+	for _, reply := range replies {
+		i, ok := index[string(reply.ID)]
+		if !ok {
+			continue
+		}
+		answered[i] = true
+		switch {
+		case reply.Error != nil:
+			calls[i].Error = reply.Error
+		case calls[i].Result != nil && len(reply.Result) > 0:
+			if err := json.Unmarshal(reply.Result, calls[i].Result); err != nil {
+				calls[i].Error = fmt.Errorf("failed to decode %s result: %v", calls[i].Method, err)
+			}
+		}
+	}
+	for i := range calls {
+		if !answered[i] {
+			calls[i].Error = fmt.Errorf("no response to %s", calls[i].Method)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,164 @@
+package pyweb3
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ArbitrumNodeInterface is the virtual contract answering Arbitrum specific queries
+var ArbitrumNodeInterface = common.HexToAddress("0x00000000000000000000000000000000000000C8")
+
+const l2FeeABIs = `[
+{"inputs":[{"name":"_data","type":"bytes"}],"name":"getL1Fee","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"to","type":"address"},{"name":"contractCreation","type":"bool"},{"name":"data","type":"bytes"}],"name":"gasEstimateComponents","outputs":[{"name":"gasEstimate","type":"uint64"},{"name":"gasEstimateForL1","type":"uint64"},{"name":"baseFee","type":"uint256"},{"name":"l1BaseFeeEstimate","type":"uint256"}],"stateMutability":"payable","type":"function"}
+]`
+
+var l2FeeABI, _ = abi.JSON(strings.NewReader(l2FeeABIs))
+
+// FeeBreakdown is the expected cost of a transaction in wei.
+// L1DataFee is what rollups charge for posting the transaction to Ethereum.
+type FeeBreakdown struct {
+	// ExecutionGas is the gas used by the execution on the chain itself
+	ExecutionGas uint64
+	// L1Gas is the L1 cost expressed in L2 gas, only reported by Arbitrum
+	L1Gas uint64
+	// GasLimit is the gas limit to set on the transaction
+	GasLimit uint64
+	// GasPrice is the expected price paid per gas
+	GasPrice     *big.Int
+	ExecutionFee *big.Int
+	L1DataFee    *big.Int
+	Total        *big.Int
+}
+
+// EstimateFees returns the cost breakdown of an unsigned transaction sent by
+// from, adding the L1 data fee of OP Stack style rollups and the L1 component
+// of Arbitrum. The gas limit and prices of tx are used when set.
+func (ge *GasEstimator) EstimateFees(ctx context.Context, from common.Address, tx *types.Transaction) (*FeeBreakdown, error) {
+	chain, err := ge.client.Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if chain.Quirks.NodeInterface {
+		return ge.arbitrumFees(ctx, from, tx)
+	}
+
+	fees := &FeeBreakdown{ExecutionGas: tx.Gas(), L1DataFee: new(big.Int)}
+	if fees.ExecutionGas == 0 {
+		msg := ethereum.CallMsg{From: from, To: tx.To(), Value: tx.Value(), Data: tx.Data()}
+		if fees.ExecutionGas, err = ge.EstimateGasWithMargin(ctx, msg); err != nil {
+			return nil, err
+		}
+	}
+	fees.GasLimit = fees.ExecutionGas
+
+	if fees.GasPrice, err = ge.expectedGasPrice(ctx, chain, tx); err != nil {
+		return nil, err
+	}
+
+	if oracle := chain.Quirks.L1FeeOracle; oracle != (common.Address{}) {
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		values, err := callContract(ctx, ge.client, oracle, &l2FeeABI, "getL1Fee", raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get L1 data fee: %v", err)
+		}
+		fees.L1DataFee = values[0].(*big.Int)
+	}
+
+	fees.ExecutionFee = new(big.Int).Mul(fees.GasPrice, new(big.Int).SetUint64(fees.ExecutionGas))
+	fees.Total = new(big.Int).Add(fees.ExecutionFee, fees.L1DataFee)
+	return fees, nil
+}
+
+// expectedGasPrice is what a gas unit of tx should cost at the current base fee
+func (ge *GasEstimator) expectedGasPrice(ctx context.Context, chain ChainProfile, tx *types.Transaction) (*big.Int, error) {
+	if tx.Type() == types.LegacyTxType && tx.GasPrice().Sign() > 0 {
+		return tx.GasPrice(), nil
+	}
+	if !chain.EIP1559 {
+		return ge.client.SuggestGasPrice(ctx)
+	}
+
+	head, err := ge.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+	tipCap, feeCap := tx.GasTipCap(), tx.GasFeeCap()
+	if feeCap.Sign() == 0 {
+		if tipCap, feeCap, err = ge.SuggestFees(ctx); err != nil {
+			return nil, err
+		}
+	}
+	price := new(big.Int).Add(head.BaseFee, tipCap)
+	if price.Cmp(feeCap) > 0 {
+		price.Set(feeCap)
+	}
+	return price, nil
+}
+
+// arbitrumFees splits the gas estimate of Arbitrum into execution and L1 components
+func (ge *GasEstimator) arbitrumFees(ctx context.Context, from common.Address, tx *types.Transaction) (*FeeBreakdown, error) {
+	to := common.Address{}
+	if tx.To() != nil {
+		to = *tx.To()
+	}
+	data, err := l2FeeABI.Pack("gasEstimateComponents", to, tx.To() == nil, tx.Data())
+	if err != nil {
+		return nil, err
+	}
+	out, err := ge.client.CallContract(ctx, ethereum.CallMsg{From: from, To: &ArbitrumNodeInterface, Value: tx.Value(), Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("gasEstimateComponents call failed: %v", err)
+	}
+	values, err := l2FeeABI.Unpack("gasEstimateComponents", out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode gasEstimateComponents: %v", err)
+	}
+	total, l1Gas, baseFee := values[0].(uint64), values[1].(uint64), values[2].(*big.Int)
+	if l1Gas > total {
+		return nil, fmt.Errorf("gasEstimateComponents reported %d L1 gas out of %d", l1Gas, total)
+	}
+
+	// Arbitrum charges the base fee only, tips are not paid
+	fees := &FeeBreakdown{
+		ExecutionGas: total - l1Gas,
+		L1Gas:        l1Gas,
+		GasLimit:     total + total*ge.margin/100,
+		GasPrice:     baseFee,
+		ExecutionFee: new(big.Int).Mul(baseFee, new(big.Int).SetUint64(total-l1Gas)),
+		L1DataFee:    new(big.Int).Mul(baseFee, new(big.Int).SetUint64(l1Gas)),
+	}
+	fees.Total = new(big.Int).Add(fees.ExecutionFee, fees.L1DataFee)
+	return fees, nil
+}
+
+// EstimateTransferFees returns the cost of each transfer of a BatchTransfer
+// along with the total, so that it can be shown before sending
+func (bp *BatchProcessor) EstimateTransferFees(ctx context.Context, from common.Address, transfers map[common.Address]*big.Int) (map[common.Address]*FeeBreakdown, *big.Int, error) {
+	estimator := NewGasEstimator(bp.client, 0)
+	fees := make(map[common.Address]*FeeBreakdown, len(transfers))
+	total := new(big.Int)
+	for to, amount := range transfers {
+		tx, err := bp.client.SendTransaction(ctx, from, to, amount)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to build transfer to %s: %v", to.Hex(), err)
+		}
+		fee, err := estimator.EstimateFees(ctx, from, tx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to estimate transfer to %s: %v", to.Hex(), err)
+		}
+		fees[to] = fee
+		total.Add(total, fee.Total)
+	}
+	return fees, total, nil
+}
@@ -0,0 +1,148 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/exp/slog"
+)
+
+// Components log through a *slog.Logger given in their config or through
+// SetLogger, falling back to the package default. Nothing is logged unless
+// a logger is set. Events carry the fields method, endpoint, request_id,
+// latency and attempt where they apply. Endpoints are logged by host only,
+// since paths and userinfo often hold API keys.
+
+// discardHandler drops every record
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var (
+	silentLogger  = slog.New(discardHandler{})
+	defaultLogger atomic.Pointer[slog.Logger]
+)
+
+// SetDefaultLogger sets the logger of the components not given their own,
+// nil silencing them again
+func SetDefaultLogger(logger *slog.Logger) {
+	defaultLogger.Store(logger)
+}
+
+// loggerOr returns logger, or the package default when nil
+func loggerOr(logger *slog.Logger) *slog.Logger {
+	if logger != nil {
+		return logger
+	}
+	if logger = defaultLogger.Load(); logger != nil {
+		return logger
+	}
+	return silentLogger
+}
+
+// redacted replaces secrets in log records
+const redacted = "[REDACTED]"
+
+// sensitiveMethods carry signed transactions, keys, passwords or messages to
+// sign in their params
+var sensitiveMethods = map[string]bool{
+	"eth_sendRawTransaction":   true,
+	"eth_signTransaction":      true,
+	"eth_sign":                 true,
+	"eth_signTypedData_v4":     true,
+	"personal_sign":            true,
+	"personal_unlockAccount":   true,
+	"personal_importRawKey":    true,
+	"personal_sendTransaction": true,
+	"account_signTransaction":  true,
+	"account_signData":         true,
+	"account_signTypedData":    true,
+}
+
+// sensitiveHeaders hold credentials
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// redactRPCBody returns a JSON-RPC request body fit for logging, with the
+// params of sensitive methods replaced. Bodies that are not JSON-RPC are
+// replaced entirely.
+func redactRPCBody(body []byte) string {
+	msgs, batch, err := decodeRPCMessages(body)
+	if err != nil {
+		return redacted
+	}
+	for _, msg := range msgs {
+		if sensitiveMethods[msg.Method] {
+			msg.Params = json.RawMessage(`"` + redacted + `"`)
+		}
+	}
+	clean, err := encodeRPCMessages(msgs, batch)
+	if err != nil {
+		return redacted
+	}
+	return string(clean)
+}
+
+// redactHeader returns the value of a header fit for logging
+func redactHeader(name, value string) string {
+	if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return redacted
+	}
+	return value
+}
+
+// headerValue logs a header with its credentials redacted
+type headerValue http.Header
+
+// LogValue implements slog.LogValuer
+func (h headerValue) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for name, values := range h {
+		for _, value := range values {
+			attrs = append(attrs, slog.String(name, redactHeader(name, value)))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// headerLines parses raw "Name: value" header lines for logging
+func headerLines(lines []string) headerValue {
+	h := make(http.Header, len(lines))
+	for _, line := range lines {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			h.Add(name, strings.TrimSpace(value))
+		}
+	}
+	return headerValue(h)
+}
+
+// errorOf returns err fit for logging, without the URL an *url.Error
+// carries
+func errorOf(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// requestAttrs are the log fields identifying a JSON-RPC request
+func requestAttrs(msgs []*rpcMessage) []interface{} {
+	if len(msgs) != 1 {
+		return []interface{}{"method", "batch", "batch_size", len(msgs)}
+	}
+	return []interface{}{"method", msgs[0].Method, "request_id", string(msgs[0].ID)}
+}
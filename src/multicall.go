@@ -0,0 +1,299 @@
+package pyweb3
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Multicall3Address is where Multicall3 is deployed on most EVM chains, and
+// the address assumed for chains missing from the registry
+var Multicall3Address = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+const multicall3ABI = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
+
+var multicallABI, _ = abi.JSON(strings.NewReader(multicall3ABI))
+
+const (
+	// DefaultCallGas is the gas assumed for a call without a Gas hint
+	DefaultCallGas = 100000
+	// DefaultMulticallGas caps the summed gas hints of one aggregate3 call
+	DefaultMulticallGas = 25000000
+	// DefaultMulticallCalldata caps the summed calldata size of one aggregate3 call
+	DefaultMulticallCalldata = 100000
+	// DefaultFallbackBatch caps the calls of one eth_call batch, below the
+	// batch limits of common providers
+	DefaultFallbackBatch = 100
+)
+
+// Call3 is a read to aggregate. ABI and Method are optional and used to
+// decode the returned data into Values.
+type Call3 struct {
+	Target       common.Address
+	CallData     []byte
+	AllowFailure bool
+	Gas          uint64
+	ABI          *abi.ABI
+	Method       string
+}
+
+// NewCall3 packs a contract method call into a Call3 decoded with the same ABI
+func NewCall3(target common.Address, contractAbi *abi.ABI, method string, allowFailure bool, args ...interface{}) (Call3, error) {
+	data, err := contractAbi.Pack(method, args...)
+	if err != nil {
+		return Call3{}, fmt.Errorf("failed to pack %s: %v", method, err)
+	}
+	return Call3{Target: target, CallData: data, AllowFailure: allowFailure, ABI: contractAbi, Method: method}, nil
+}
+
+// CallResult is the outcome of one aggregated call
+type CallResult struct {
+	Success    bool
+	ReturnData []byte
+	Values     []interface{}
+	Error      error
+}
+
+type multicall3Call struct {
+	Target       common.Address
+	AllowFailure bool
+	CallData     []byte
+}
+
+type multicall3Result struct {
+	Success    bool
+	ReturnData []byte
+}
+
+// Multicall packs many contract reads into Multicall3 aggregate3 calls
+type Multicall struct {
+	client      *Web3Client
+	address     common.Address
+	maxGas      uint64
+	maxCalldata int
+	maxBatch    int
+
+	mutex    sync.Mutex
+	checked  bool
+	deployed bool
+}
+
+// NewMulticall creates a Multicall3 helper for the contract at address.
+// NewChainMulticall takes the address from the chain registry.
+func NewMulticall(client *Web3Client, address common.Address) *Multicall {
+	return &Multicall{
+		client:      client,
+		address:     address,
+		maxGas:      DefaultMulticallGas,
+		maxCalldata: DefaultMulticallCalldata,
+		maxBatch:    DefaultFallbackBatch,
+	}
+}
+
+// NewChainMulticall creates a Multicall3 helper for the Multicall3 of the
+// connected chain, as registered in its ChainProfile
+func NewChainMulticall(ctx context.Context, client *Web3Client) (*Multicall, error) {
+	chain, err := client.Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	address := chain.Multicall3
+	if address == (common.Address{}) {
+		address = Multicall3Address
+	}
+	return NewMulticall(client, address), nil
+}
+
+// SetLimits changes the gas and calldata size caps used to split calls
+func (m *Multicall) SetLimits(maxGas uint64, maxCalldata int) *Multicall {
+	m.maxGas = maxGas
+	m.maxCalldata = maxCalldata
+	return m
+}
+
+// SetBatchLimit changes the number of calls sent in one eth_call batch where
+// Multicall3 is missing
+func (m *Multicall) SetBatchLimit(maxBatch int) *Multicall {
+	m.maxBatch = maxBatch
+	return m
+}
+
+// Aggregate performs the calls at blockNumber (nil for latest) and returns
+// their results in the same order. A failing call not allowed to fail
+// makes the whole aggregation fail.
+func (m *Multicall) Aggregate(ctx context.Context, calls []Call3, blockNumber *big.Int) ([]CallResult, error) {
+	deployed, err := m.isDeployed(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !deployed {
+		return m.fallback(ctx, calls, blockNumber)
+	}
+
+	results := make([]CallResult, 0, len(calls))
+	for _, chunk := range m.split(calls) {
+		chunkResults, err := m.aggregate3(ctx, chunk, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, chunkResults...)
+	}
+	return results, nil
+}
+
+// isDeployed checks once whether the Multicall3 contract exists on the chain
+func (m *Multicall) isDeployed(ctx context.Context) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.checked {
+		code, err := m.client.client.CodeAt(ctx, m.address, nil)
+		if err != nil {
+			return false, fmt.Errorf("failed to check Multicall3 deployment: %v", err)
+		}
+		m.deployed = len(code) > 0
+		m.checked = true
+	}
+	return m.deployed, nil
+}
+
+// split cuts the calls into chunks fitting the gas and calldata caps
+func (m *Multicall) split(calls []Call3) [][]Call3 {
+	var (
+		chunks   [][]Call3
+		current  []Call3
+		gas      uint64
+		calldata int
+	)
+	for _, call := range calls {
+		callGas := call.Gas
+		if callGas == 0 {
+			callGas = DefaultCallGas
+		}
+		// Each entry adds the target, flag, offsets and padding to the data
+		callSize := len(call.CallData) + 5*32
+
+		if len(current) > 0 && (gas+callGas > m.maxGas || calldata+callSize > m.maxCalldata) {
+			chunks = append(chunks, current)
+			current, gas, calldata = nil, 0, 0
+		}
+		current = append(current, call)
+		gas += callGas
+		calldata += callSize
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+func (m *Multicall) aggregate3(ctx context.Context, calls []Call3, blockNumber *big.Int) ([]CallResult, error) {
+	packed := make([]multicall3Call, len(calls))
+	for i, call := range calls {
+		packed[i] = multicall3Call{Target: call.Target, AllowFailure: call.AllowFailure, CallData: call.CallData}
+	}
+	data, err := multicallABI.Pack("aggregate3", packed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack aggregate3: %v", err)
+	}
+
+	out, err := m.client.client.CallContract(ctx, ethereum.CallMsg{To: &m.address, Data: data}, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate3 call failed: %v", err)
+	}
+	unpacked, err := multicallABI.Unpack("aggregate3", out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unpack aggregate3: %v", err)
+	}
+	returned := *abi.ConvertType(unpacked[0], new([]multicall3Result)).(*[]multicall3Result)
+	if len(returned) != len(calls) {
+		return nil, fmt.Errorf("aggregate3 returned %d results for %d calls", len(returned), len(calls))
+	}
+
+	results := make([]CallResult, len(calls))
+	for i, r := range returned {
+		results[i] = decodeCallResult(calls[i], r.Success, r.ReturnData)
+	}
+	return results, nil
+}
+
+// fallback sends the calls as batches of plain eth_call where Multicall3 is
+// missing, at most maxBatch calls to a batch
+func (m *Multicall) fallback(ctx context.Context, calls []Call3, blockNumber *big.Int) ([]CallResult, error) {
+	block := "latest"
+	if blockNumber != nil {
+		block = hexutil.EncodeBig(blockNumber)
+	}
+	size := m.maxBatch
+	if size <= 0 {
+		size = len(calls)
+	}
+
+	results := make([]CallResult, len(calls))
+	for start := 0; start < len(calls); start += size {
+		end := start + size
+		if end > len(calls) {
+			end = len(calls)
+		}
+		if err := m.fallbackBatch(ctx, calls[start:end], block, results[start:end], start); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// fallbackBatch sends one eth_call batch and fills in its results. offset is
+// the index of the first call among all calls, for errors.
+func (m *Multicall) fallbackBatch(ctx context.Context, calls []Call3, block string, results []CallResult, offset int) error {
+	returned := make([]hexutil.Bytes, len(calls))
+	batch := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": call.Target, "data": hexutil.Bytes(call.CallData)},
+				block,
+			},
+			Result: &returned[i],
+		}
+	}
+	if err := m.client.transport.BatchCallContext(ctx, batch); err != nil {
+		return fmt.Errorf("eth_call batch failed: %v", err)
+	}
+
+	for i, elem := range batch {
+		if elem.Error != nil {
+			if !calls[i].AllowFailure {
+				return fmt.Errorf("call %d to %s failed: %v", offset+i, calls[i].Target.Hex(), elem.Error)
+			}
+			results[i] = CallResult{Error: elem.Error}
+			continue
+		}
+		results[i] = decodeCallResult(calls[i], true, returned[i])
+	}
+	return nil
+}
+
+func decodeCallResult(call Call3, success bool, data []byte) CallResult {
+	result := CallResult{Success: success, ReturnData: data}
+	if !success {
+		result.Error = fmt.Errorf("call to %s reverted", call.Target.Hex())
+		return result
+	}
+	if call.ABI != nil && call.Method != "" {
+		values, err := call.ABI.Unpack(call.Method, data)
+		if err != nil {
+			result.Error = fmt.Errorf("failed to decode %s: %v", call.Method, err)
+		}
+		result.Values = values
+	}
+	return result
+}
@@ -0,0 +1,376 @@
+package pyweb3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ERC-165 interface identifiers
+var (
+	InterfaceIDERC165             = [4]byte{0x01, 0xff, 0xc9, 0xa7}
+	InterfaceIDERC721             = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	InterfaceIDERC721Metadata     = [4]byte{0x5b, 0x5e, 0x13, 0x9f}
+	InterfaceIDERC1155            = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+	InterfaceIDERC1155MetadataURI = [4]byte{0x0e, 0x89, 0x34, 0x1c}
+)
+
+// ERC721ABI is the ERC-721 interface along with the metadata extension
+const ERC721ABI = `[
+{"inputs":[{"name":"interfaceId","type":"bytes4"}],"name":"supportsInterface","outputs":[{"name":"","type":"bool"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"tokenId","type":"uint256"}],"name":"ownerOf","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"tokenId","type":"uint256"}],"name":"tokenURI","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"owner","type":"address"},{"name":"operator","type":"address"}],"name":"isApprovedForAll","outputs":[{"name":"","type":"bool"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"operator","type":"address"},{"name":"approved","type":"bool"}],"name":"setApprovalForAll","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"}],"name":"safeTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"tokenId","type":"uint256"},{"name":"data","type":"bytes"}],"name":"safeTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":true,"name":"tokenId","type":"uint256"}],"name":"Transfer","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"owner","type":"address"},{"indexed":true,"name":"operator","type":"address"},{"indexed":false,"name":"approved","type":"bool"}],"name":"ApprovalForAll","type":"event"}
+]`
+
+// ERC1155ABI is the ERC-1155 interface along with the metadata URI extension
+const ERC1155ABI = `[
+{"inputs":[{"name":"interfaceId","type":"bytes4"}],"name":"supportsInterface","outputs":[{"name":"","type":"bool"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"accounts","type":"address[]"},{"name":"ids","type":"uint256[]"}],"name":"balanceOfBatch","outputs":[{"name":"","type":"uint256[]"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"id","type":"uint256"}],"name":"uri","outputs":[{"name":"","type":"string"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"account","type":"address"},{"name":"operator","type":"address"}],"name":"isApprovedForAll","outputs":[{"name":"","type":"bool"}],"stateMutability":"view","type":"function"},
+{"inputs":[{"name":"operator","type":"address"},{"name":"approved","type":"bool"}],"name":"setApprovalForAll","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"id","type":"uint256"},{"name":"value","type":"uint256"},{"name":"data","type":"bytes"}],"name":"safeTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"inputs":[{"name":"from","type":"address"},{"name":"to","type":"address"},{"name":"ids","type":"uint256[]"},{"name":"values","type":"uint256[]"},{"name":"data","type":"bytes"}],"name":"safeBatchTransferFrom","outputs":[],"stateMutability":"nonpayable","type":"function"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"operator","type":"address"},{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"id","type":"uint256"},{"indexed":false,"name":"value","type":"uint256"}],"name":"TransferSingle","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"operator","type":"address"},{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"ids","type":"uint256[]"},{"indexed":false,"name":"values","type":"uint256[]"}],"name":"TransferBatch","type":"event"},
+{"anonymous":false,"inputs":[{"indexed":true,"name":"account","type":"address"},{"indexed":true,"name":"operator","type":"address"},{"indexed":false,"name":"approved","type":"bool"}],"name":"ApprovalForAll","type":"event"}
+]`
+
+var (
+	erc721ABI, _  = abi.JSON(strings.NewReader(ERC721ABI))
+	erc1155ABI, _ = abi.JSON(strings.NewReader(ERC1155ABI))
+)
+
+// callContract performs a read-only call of a method of contractAbi and decodes the answer
+func callContract(ctx context.Context, client ethereum.ContractCaller, address common.Address, contractAbi *abi.ABI, method string, args ...interface{}) ([]interface{}, error) {
+	data, err := contractAbi.Pack(method, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pack %s: %v", method, err)
+	}
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s call failed: %v", method, err)
+	}
+	values, err := contractAbi.Unpack(method, out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", method, err)
+	}
+	return values, nil
+}
+
+// SupportsInterface asks a contract whether it implements an ERC-165 interface.
+// Contracts without ERC-165, which revert or answer garbage, do not support it.
+func SupportsInterface(ctx context.Context, client *Web3Client, address common.Address, id [4]byte) (bool, error) {
+	data, err := erc721ABI.Pack("supportsInterface", id)
+	if err != nil {
+		return false, err
+	}
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &address, Data: data}, nil)
+	if err != nil {
+		if isRevert(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("supportsInterface call failed: %v", err)
+	}
+	if len(out) != 32 {
+		return false, nil
+	}
+	return new(big.Int).SetBytes(out).Cmp(common.Big1) == 0, nil
+}
+
+// isRevert tells whether a call error comes from the contract rather than the node
+func isRevert(err error) bool {
+	if de, ok := err.(interface{ ErrorData() interface{} }); ok && de.ErrorData() != nil {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+// ERC721 reads and writes an ERC-721 collection
+type ERC721 struct {
+	client   *Web3Client
+	address  common.Address
+	contract *bind.BoundContract
+}
+
+// NewERC721 binds an ERC-721 collection at address
+func NewERC721(client *Web3Client, address common.Address) *ERC721 {
+	return &ERC721{
+		client:   client,
+		address:  address,
+		contract: bind.NewBoundContract(address, erc721ABI, client, client.client, client.client),
+	}
+}
+
+// Address returns the collection contract address
+func (n *ERC721) Address() common.Address {
+	return n.address
+}
+
+// SupportsInterface checks an ERC-165 interface, such as InterfaceIDERC721Metadata
+func (n *ERC721) SupportsInterface(ctx context.Context, id [4]byte) (bool, error) {
+	return SupportsInterface(ctx, n.client, n.address, id)
+}
+
+// OwnerOf returns the owner of a token
+func (n *ERC721) OwnerOf(ctx context.Context, tokenID *big.Int) (common.Address, error) {
+	values, err := callContract(ctx, n.client, n.address, &erc721ABI, "ownerOf", tokenID)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return values[0].(common.Address), nil
+}
+
+// BalanceOf returns how many tokens of the collection owner holds
+func (n *ERC721) BalanceOf(ctx context.Context, owner common.Address) (*big.Int, error) {
+	values, err := callContract(ctx, n.client, n.address, &erc721ABI, "balanceOf", owner)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].(*big.Int), nil
+}
+
+// TokenURI returns the metadata URI of a token
+func (n *ERC721) TokenURI(ctx context.Context, tokenID *big.Int) (string, error) {
+	values, err := callContract(ctx, n.client, n.address, &erc721ABI, "tokenURI", tokenID)
+	if err != nil {
+		return "", err
+	}
+	return values[0].(string), nil
+}
+
+// IsApprovedForAll tells whether operator may move every token of owner
+func (n *ERC721) IsApprovedForAll(ctx context.Context, owner, operator common.Address) (bool, error) {
+	values, err := callContract(ctx, n.client, n.address, &erc721ABI, "isApprovedForAll", owner, operator)
+	if err != nil {
+		return false, err
+	}
+	return values[0].(bool), nil
+}
+
+// SetApprovalForAll allows or forbids operator to move every token of the sender
+func (n *ERC721) SetApprovalForAll(opts *bind.TransactOpts, operator common.Address, approved bool) (*types.Transaction, error) {
+	return n.contract.Transact(opts, "setApprovalForAll", operator, approved)
+}
+
+// SafeTransferFrom moves a token, data is passed to a receiving contract when not nil
+func (n *ERC721) SafeTransferFrom(opts *bind.TransactOpts, from, to common.Address, tokenID *big.Int, data []byte) (*types.Transaction, error) {
+	if data == nil {
+		return n.contract.Transact(opts, "safeTransferFrom", from, to, tokenID)
+	}
+	return n.contract.Transact(opts, "safeTransferFrom0", from, to, tokenID, data)
+}
+
+// ERC1155 reads and writes an ERC-1155 multi token contract
+type ERC1155 struct {
+	client   *Web3Client
+	address  common.Address
+	contract *bind.BoundContract
+}
+
+// NewERC1155 binds an ERC-1155 contract at address
+func NewERC1155(client *Web3Client, address common.Address) *ERC1155 {
+	return &ERC1155{
+		client:   client,
+		address:  address,
+		contract: bind.NewBoundContract(address, erc1155ABI, client, client.client, client.client),
+	}
+}
+
+// Address returns the contract address
+func (m *ERC1155) Address() common.Address {
+	return m.address
+}
+
+// SupportsInterface checks an ERC-165 interface, such as InterfaceIDERC1155MetadataURI
+func (m *ERC1155) SupportsInterface(ctx context.Context, id [4]byte) (bool, error) {
+	return SupportsInterface(ctx, m.client, m.address, id)
+}
+
+// BalanceOf returns the balance of token id held by account
+func (m *ERC1155) BalanceOf(ctx context.Context, account common.Address, id *big.Int) (*big.Int, error) {
+	values, err := callContract(ctx, m.client, m.address, &erc1155ABI, "balanceOf", account, id)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].(*big.Int), nil
+}
+
+// BalanceOfBatch returns the balances of pairs of accounts and ids in one call
+func (m *ERC1155) BalanceOfBatch(ctx context.Context, accounts []common.Address, ids []*big.Int) ([]*big.Int, error) {
+	if len(accounts) != len(ids) {
+		return nil, fmt.Errorf("got %d accounts for %d ids", len(accounts), len(ids))
+	}
+	values, err := callContract(ctx, m.client, m.address, &erc1155ABI, "balanceOfBatch", accounts, ids)
+	if err != nil {
+		return nil, err
+	}
+	return values[0].([]*big.Int), nil
+}
+
+// URI returns the metadata URI of token id, with the {id} placeholder
+// replaced by the id in lowercase hex padded to 64 characters
+func (m *ERC1155) URI(ctx context.Context, id *big.Int) (string, error) {
+	values, err := callContract(ctx, m.client, m.address, &erc1155ABI, "uri", id)
+	if err != nil {
+		return "", err
+	}
+	return strings.ReplaceAll(values[0].(string), "{id}", fmt.Sprintf("%064x", id)), nil
+}
+
+// IsApprovedForAll tells whether operator may move every token of account
+func (m *ERC1155) IsApprovedForAll(ctx context.Context, account, operator common.Address) (bool, error) {
+	values, err := callContract(ctx, m.client, m.address, &erc1155ABI, "isApprovedForAll", account, operator)
+	if err != nil {
+		return false, err
+	}
+	return values[0].(bool), nil
+}
+
+// SetApprovalForAll allows or forbids operator to move every token of the sender
+func (m *ERC1155) SetApprovalForAll(opts *bind.TransactOpts, operator common.Address, approved bool) (*types.Transaction, error) {
+	return m.contract.Transact(opts, "setApprovalForAll", operator, approved)
+}
+
+// SafeTransferFrom moves value units of token id
+func (m *ERC1155) SafeTransferFrom(opts *bind.TransactOpts, from, to common.Address, id, value *big.Int, data []byte) (*types.Transaction, error) {
+	if data == nil {
+		data = []byte{}
+	}
+	return m.contract.Transact(opts, "safeTransferFrom", from, to, id, value, data)
+}
+
+// SafeBatchTransferFrom moves several token ids in one transaction
+func (m *ERC1155) SafeBatchTransferFrom(opts *bind.TransactOpts, from, to common.Address, ids, values []*big.Int, data []byte) (*types.Transaction, error) {
+	if len(ids) != len(values) {
+		return nil, fmt.Errorf("got %d values for %d ids", len(values), len(ids))
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return m.contract.Transact(opts, "safeBatchTransferFrom", from, to, ids, values, data)
+}
+
+// Holding is a balance of one NFT, always 1 for ERC-721
+type Holding struct {
+	Token   common.Address
+	TokenID *big.Int
+	Owner   common.Address
+	Balance *big.Int
+}
+
+type holdingKey struct {
+	token   common.Address
+	tokenID common.Hash
+	owner   common.Address
+}
+
+// Holdings rebuilds the current NFT balances from the Transfer, TransferSingle
+// and TransferBatch logs of the filter addresses. The topics of the filter
+// are not used. Its block range should cover the collections since
+// deployment, from genesis and up to the head when unset, and is fetched in
+// chunks the node accepts when the client supports it, as a Web3Client does.
+func (ef *EventFilter) Holdings(ctx context.Context) ([]Holding, error) {
+	query := ef.query
+	query.Topics = [][]common.Hash{{
+		erc721ABI.Events["Transfer"].ID,
+		erc1155ABI.Events["TransferSingle"].ID,
+		erc1155ABI.Events["TransferBatch"].ID,
+	}}
+	logs, err := ef.logsRange(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transfer logs: %v", err)
+	}
+	sort.SliceStable(logs, func(i, j int) bool {
+		if logs[i].BlockNumber != logs[j].BlockNumber {
+			return logs[i].BlockNumber < logs[j].BlockNumber
+		}
+		return logs[i].Index < logs[j].Index
+	})
+
+	balances := make(map[holdingKey]*big.Int)
+	balance := func(token, owner common.Address, id *big.Int) *big.Int {
+		key := holdingKey{token, common.BigToHash(id), owner}
+		if balances[key] == nil {
+			balances[key] = new(big.Int)
+		}
+		return balances[key]
+	}
+	// The zero address stands for mints and burns
+	move := func(token, from, to common.Address, id, value *big.Int) {
+		if from != (common.Address{}) {
+			b := balance(token, from, id)
+			b.Sub(b, value)
+		}
+		if to != (common.Address{}) {
+			b := balance(token, to, id)
+			b.Add(b, value)
+		}
+	}
+
+	for _, l := range logs {
+		if l.Removed || len(l.Topics) != 4 {
+			// ERC-20 Transfer logs share the signature but only have three topics
+			continue
+		}
+		switch l.Topics[0] {
+		case erc721ABI.Events["Transfer"].ID:
+			move(l.Address, common.BytesToAddress(l.Topics[1].Bytes()), common.BytesToAddress(l.Topics[2].Bytes()),
+				l.Topics[3].Big(), common.Big1)
+		case erc1155ABI.Events["TransferSingle"].ID:
+			values, err := erc1155ABI.Unpack("TransferSingle", l.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode TransferSingle in %s: %v", l.TxHash.Hex(), err)
+			}
+			move(l.Address, common.BytesToAddress(l.Topics[2].Bytes()), common.BytesToAddress(l.Topics[3].Bytes()),
+				values[0].(*big.Int), values[1].(*big.Int))
+		case erc1155ABI.Events["TransferBatch"].ID:
+			values, err := erc1155ABI.Unpack("TransferBatch", l.Data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode TransferBatch in %s: %v", l.TxHash.Hex(), err)
+			}
+			ids, amounts := values[0].([]*big.Int), values[1].([]*big.Int)
+			if len(ids) != len(amounts) {
+				return nil, fmt.Errorf("bad TransferBatch in %s: %d ids for %d values", l.TxHash.Hex(), len(ids), len(amounts))
+			}
+			for i := range ids {
+				move(l.Address, common.BytesToAddress(l.Topics[2].Bytes()), common.BytesToAddress(l.Topics[3].Bytes()), ids[i], amounts[i])
+			}
+		}
+	}
+
+	holdings := make([]Holding, 0, len(balances))
+	for key, amount := range balances {
+		if amount.Sign() > 0 {
+			holdings = append(holdings, Holding{Token: key.token, TokenID: key.tokenID.Big(), Owner: key.owner, Balance: amount})
+		}
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		a, b := holdings[i], holdings[j]
+		if c := bytes.Compare(a.Token[:], b.Token[:]); c != 0 {
+			return c < 0
+		}
+		if c := a.TokenID.Cmp(b.TokenID); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(a.Owner[:], b.Owner[:]) < 0
+	})
+	return holdings, nil
+}
@@ -0,0 +1,82 @@
+// Package oteltrace creates an OpenTelemetry span per JSON-RPC request of
+// the client. It lives apart from the client so that programs not using
+// OpenTelemetry do not link it.
+package oteltrace
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+// TracerName is the instrumentation scope of the spans
+const TracerName = "web3-rpc-client"
+
+// Span attributes, after the OpenTelemetry RPC and JSON-RPC conventions
+const (
+	AttrRPCSystem    = attribute.Key("rpc.system")
+	AttrRPCMethod    = attribute.Key("rpc.method")
+	AttrRequestID    = attribute.Key("rpc.jsonrpc.request_id")
+	AttrErrorCode    = attribute.Key("rpc.jsonrpc.error_code")
+	AttrErrorMessage = attribute.Key("rpc.jsonrpc.error_message")
+	AttrServer       = attribute.Key("server.address")
+	AttrBatchSize    = attribute.Key("rpc.jsonrpc.batch_size")
+)
+
+// Tracer is a pyweb3.Instrumentation starting a client span per request.
+// Batch sizes are added as events of the span of their context.
+type Tracer struct {
+	pyweb3.NopInstrumentation
+	tracer trace.Tracer
+}
+
+// New creates a tracer using provider, such as the global one from
+// otel.GetTracerProvider
+func New(provider trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: provider.Tracer(TracerName)}
+}
+
+// StartRequest starts a span named after the method, ended with the outcome
+func (t *Tracer) StartRequest(ctx context.Context, request pyweb3.RequestInfo) (context.Context, func(pyweb3.RequestOutcome)) {
+	attrs := []attribute.KeyValue{
+		AttrRPCSystem.String("jsonrpc"),
+		AttrRPCMethod.String(request.Method),
+		AttrServer.String(request.Endpoint),
+	}
+	if request.RequestID != "" {
+		attrs = append(attrs, AttrRequestID.String(request.RequestID))
+	}
+	if request.BatchSize > 1 {
+		attrs = append(attrs, AttrBatchSize.Int(request.BatchSize))
+	}
+	ctx, span := t.tracer.Start(ctx, request.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, func(outcome pyweb3.RequestOutcome) {
+		defer span.End()
+		var rpcErr *pyweb3.RPCError
+		switch {
+		case errors.As(outcome.Err, &rpcErr):
+			span.SetAttributes(AttrErrorCode.Int(rpcErr.Code), AttrErrorMessage.String(rpcErr.Message))
+			span.SetStatus(codes.Error, rpcErr.Message)
+		case outcome.Err != nil:
+			span.RecordError(outcome.Err)
+			span.SetStatus(codes.Error, outcome.Err.Error())
+		case len(outcome.RPCErrors) > 0:
+			for _, e := range outcome.RPCErrors {
+				span.AddEvent("rpc error", trace.WithAttributes(AttrErrorCode.Int(e.Code), AttrErrorMessage.String(e.Message)))
+			}
+			span.SetStatus(codes.Error, strconv.Itoa(len(outcome.RPCErrors))+" calls of the batch failed")
+		}
+	}
+}
+
+// BatchSize adds an event to the span of ctx, if any
+func (t *Tracer) BatchSize(ctx context.Context, operation string, size int) {
+	trace.SpanFromContext(ctx).AddEvent("batch", trace.WithAttributes(
+		attribute.String("operation", operation), attribute.Int("size", size)))
+}
@@ -0,0 +1,95 @@
+package oteltrace
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	pyweb3 "web3-rpc-client/src"
+	"web3-rpc-client/src/rpctest"
+)
+
+// attrs indexes the attributes of a span
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	index := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		index[kv.Key] = kv.Value
+	}
+	return index
+}
+
+func TestTracer(t *testing.T) {
+	ctx := context.Background()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(ctx)
+
+	node := rpctest.NewMockNode().
+		Respond("eth_blockNumber", "0x10").
+		Fail("eth_call", 3, "execution reverted")
+	defer node.Close()
+	host := strings.TrimPrefix(node.URL(), "http://")
+	client := pyweb3.NewJSONRPCClient(node.URL(), "", 0)
+	client.Instrumentation = New(provider)
+
+	parent, root := provider.Tracer("test").Start(ctx, "parent")
+	var head hexutil.Uint64
+	require.NoError(t, client.CallContext(parent, &head, "eth_blockNumber"))
+	root.End()
+	assert.Error(t, client.CallContext(ctx, nil, "eth_call"))
+	require.NoError(t, client.BatchCallContext(ctx, []rpc.BatchElem{
+		{Method: "eth_blockNumber", Result: &head},
+		{Method: "eth_call"},
+	}))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 4)
+
+	call := spans[0]
+	assert.Equal(t, "eth_blockNumber", call.Name())
+	assert.Equal(t, trace.SpanKindClient, call.SpanKind())
+	assert.Equal(t, root.SpanContext().SpanID(), call.Parent().SpanID(), "spans follow the context of the call")
+	assert.Equal(t, "1", attrs(call)[AttrRequestID].AsString())
+	assert.Equal(t, "jsonrpc", attrs(call)[AttrRPCSystem].AsString())
+	assert.Equal(t, host, attrs(call)[AttrServer].AsString())
+	assert.Equal(t, codes.Unset, call.Status().Code)
+
+	reverted := spans[2]
+	assert.Equal(t, "eth_call", reverted.Name())
+	assert.Equal(t, "2", attrs(reverted)[AttrRequestID].AsString())
+	assert.Equal(t, int64(3), attrs(reverted)[AttrErrorCode].AsInt64())
+	assert.Equal(t, codes.Error, reverted.Status().Code)
+
+	batch := spans[3]
+	assert.Equal(t, "batch", batch.Name())
+	assert.Equal(t, int64(2), attrs(batch)[AttrBatchSize].AsInt64())
+	assert.NotContains(t, attrs(batch), AttrRequestID)
+	assert.Equal(t, codes.Error, batch.Status().Code)
+	require.Len(t, batch.Events(), 1)
+	assert.Equal(t, "rpc error", batch.Events()[0].Name)
+}
+
+func TestTracer_TransportError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := pyweb3.NewJSONRPCClient("http://127.0.0.1:1/v3/secret-key", "", 0)
+	client.Instrumentation = New(provider)
+
+	var head hexutil.Uint64
+	assert.Error(t, client.CallContext(context.Background(), &head, "eth_blockNumber"))
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.NotContains(t, spans[0].Status().Description, "secret-key")
+	require.Len(t, spans[0].Events(), 1, "the error is recorded")
+}
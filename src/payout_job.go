@@ -0,0 +1,353 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PayoutState is the progress of one payout of a job
+type PayoutState string
+
+const (
+	// PayoutPending is not signed yet
+	PayoutPending PayoutState = "pending"
+	// PayoutSigned is signed and stored, but not known to be accepted by the node
+	PayoutSigned PayoutState = "signed"
+	// PayoutBroadcast is accepted by the node and waits to be mined
+	PayoutBroadcast PayoutState = "broadcast"
+	// PayoutMined is included in a block
+	PayoutMined PayoutState = "mined"
+	// PayoutFailed is reverted, replaced by another transaction or refused by the node for good
+	PayoutFailed PayoutState = "failed"
+)
+
+// PayoutEntry is a transfer instruction along with its signed transaction
+type PayoutEntry struct {
+	Instruction TransferInstruction `json:"instruction"`
+	State       PayoutState         `json:"state"`
+	Nonce       uint64              `json:"nonce,omitempty"`
+	TxHash      common.Hash         `json:"txHash,omitempty"`
+	RawTx       hexutil.Bytes       `json:"rawTx,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// PayoutJob is a batch of payouts from one account, persisted after every step
+type PayoutJob struct {
+	ID      string         `json:"id"`
+	From    common.Address `json:"from"`
+	Entries []PayoutEntry  `json:"entries"`
+	Created time.Time      `json:"created"`
+	Updated time.Time      `json:"updated"`
+}
+
+// NewPayoutJob creates a job with every instruction pending.
+// Idempotency keys must be unique within the job.
+func NewPayoutJob(id string, from common.Address, instructions []TransferInstruction) (*PayoutJob, error) {
+	keys := make(map[string]bool)
+	entries := make([]PayoutEntry, len(instructions))
+	for i, in := range instructions {
+		if in.IdempotencyKey != "" {
+			if keys[in.IdempotencyKey] {
+				return nil, fmt.Errorf("duplicate idempotency key %q", in.IdempotencyKey)
+			}
+			keys[in.IdempotencyKey] = true
+		}
+		entries[i] = PayoutEntry{Instruction: in, State: PayoutPending}
+	}
+	now := time.Now()
+	return &PayoutJob{ID: id, From: from, Entries: entries, Created: now, Updated: now}, nil
+}
+
+// Done tells whether every payout reached a final state
+func (j *PayoutJob) Done() bool {
+	for _, e := range j.Entries {
+		if e.State != PayoutMined && e.State != PayoutFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// Results converts the entries into transfer results, in input order
+func (j *PayoutJob) Results() []TransferResult {
+	results := make([]TransferResult, len(j.Entries))
+	for i, e := range j.Entries {
+		results[i] = TransferResult{Instruction: e.Instruction, TxHash: e.TxHash, Nonce: e.Nonce}
+		if e.Error != "" {
+			results[i].Error = errors.New(e.Error)
+		}
+	}
+	return results
+}
+
+// JobStore persists payout jobs
+type JobStore interface {
+	Save(job *PayoutJob) error
+	Load(id string) (*PayoutJob, error)
+	List() ([]string, error)
+}
+
+// FileJobStore keeps each job as a JSON file in a directory
+type FileJobStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewFileJobStore creates the directory if needed and returns a store using it
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create job directory: %v", err)
+	}
+	return &FileJobStore{dir: dir}, nil
+}
+
+func (s *FileJobStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid job id %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// Save writes the job atomically, so a crash never leaves a truncated file
+func (s *FileJobStore) Save(job *PayoutJob) error {
+	path, err := s.path(job.ID)
+	if err != nil {
+		return err
+	}
+	job.Updated = time.Now()
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, job.ID+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save job %s: %v", job.ID, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load reads a job back
+func (s *FileJobStore) Load(id string) (*PayoutJob, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job %s: %v", id, err)
+	}
+	job := new(PayoutJob)
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("failed to decode job %s: %v", id, err)
+	}
+	return job, nil
+}
+
+// List returns the ids of the stored jobs
+func (s *FileJobStore) List() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// RunJob moves a job forward and can be called again after a crash.
+// Payouts signed in a previous run are reconciled by hash and nonce and
+// broadcast again from the stored raw transaction, never signed twice.
+// Pending payouts are signed and saved before being broadcast.
+func (bp *BatchProcessor) RunJob(ctx context.Context, opts *bind.TransactOpts, store JobStore, job *PayoutJob) error {
+	if opts.From != job.From {
+		return fmt.Errorf("job %s pays from %s, not %s", job.ID, job.From.Hex(), opts.From.Hex())
+	}
+	instrumentationOr(bp.instrumentation).BatchSize(ctx, "payout_job", len(job.Entries))
+	if err := bp.ReconcileJob(ctx, store, job); err != nil {
+		return err
+	}
+
+	nonce, err := bp.client.PendingNonceAt(ctx, job.From)
+	if err != nil {
+		return fmt.Errorf("failed to get nonce: %v", err)
+	}
+	for _, e := range job.Entries {
+		if e.State != PayoutPending && e.State != PayoutFailed && e.Nonce >= nonce {
+			nonce = e.Nonce + 1
+		}
+	}
+
+	for i := range job.Entries {
+		e := &job.Entries[i]
+		if e.State != PayoutPending {
+			continue
+		}
+
+		tx, err := bp.signTransfer(ctx, opts, nonce, e.Instruction)
+		if err != nil {
+			e.State = PayoutFailed
+			e.Error = err.Error()
+			if err := store.Save(job); err != nil {
+				return err
+			}
+			continue
+		}
+		raw, err := tx.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.State, e.Nonce, e.TxHash, e.RawTx, e.Error = PayoutSigned, nonce, tx.Hash(), raw, ""
+		if err := store.Save(job); err != nil {
+			return err
+		}
+		nonce++
+
+		if err := bp.broadcast(ctx, store, job, e, tx); err != nil {
+			// Later nonces cannot be mined before this one, stop here
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcast sends a signed payout, leaving it signed when the node refuses it
+func (bp *BatchProcessor) broadcast(ctx context.Context, store JobStore, job *PayoutJob, e *PayoutEntry, tx *types.Transaction) error {
+	if err := bp.client.SendRawTransaction(ctx, tx); err != nil {
+		e.Error = err.Error()
+		if saveErr := store.Save(job); saveErr != nil {
+			return saveErr
+		}
+		return fmt.Errorf("failed to broadcast payout %s: %v", e.TxHash.Hex(), err)
+	}
+	bp.sent.record(TransferResult{Instruction: e.Instruction, TxHash: e.TxHash, Nonce: e.Nonce})
+	e.State, e.Error = PayoutBroadcast, ""
+	return store.Save(job)
+}
+
+// rebroadcastRefusal maps the node's answer to a rebroadcast that can never
+// succeed to the state of the payout: the node holding the transaction
+// already, its nonce taken by a replacement or its fee no longer accepted
+func rebroadcastRefusal(message string) (PayoutState, bool) {
+	message = strings.ToLower(message)
+	switch {
+	case strings.Contains(message, "already known"), strings.Contains(message, "known transaction"):
+		return PayoutBroadcast, true
+	case strings.Contains(message, "nonce too low"),
+		strings.Contains(message, "underpriced"),
+		strings.Contains(message, "fee too low"),
+		strings.Contains(message, "less than block base fee"):
+		return PayoutFailed, true
+	}
+	return "", false
+}
+
+// ReconcileJob checks the signed and broadcast payouts against the chain:
+// mined ones are marked so, lost ones are broadcast again and the ones
+// whose nonce was consumed by another transaction, or whose rebroadcast
+// the node refuses for good, are marked failed
+func (bp *BatchProcessor) ReconcileJob(ctx context.Context, store JobStore, job *PayoutJob) error {
+	var confirmed uint64
+	checkedNonce := false
+
+	for i := range job.Entries {
+		e := &job.Entries[i]
+		if e.State != PayoutSigned && e.State != PayoutBroadcast {
+			continue
+		}
+
+		receipt, err := bp.client.TransactionReceipt(ctx, e.TxHash)
+		if err == nil {
+			e.State = PayoutMined
+			if receipt.Status == types.ReceiptStatusFailed {
+				e.State, e.Error = PayoutFailed, "transaction reverted"
+			}
+			if err := store.Save(job); err != nil {
+				return err
+			}
+			continue
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return fmt.Errorf("failed to get receipt of %s: %v", e.TxHash.Hex(), err)
+		}
+
+		if _, _, err := bp.client.TransactionByHash(ctx, e.TxHash); err == nil {
+			if e.State != PayoutBroadcast {
+				e.State, e.Error = PayoutBroadcast, ""
+				if err := store.Save(job); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if !checkedNonce {
+			if confirmed, err = bp.client.NonceAt(ctx, job.From, nil); err != nil {
+				return fmt.Errorf("failed to get nonce: %v", err)
+			}
+			checkedNonce = true
+		}
+		if e.Nonce < confirmed {
+			e.State, e.Error = PayoutFailed, fmt.Sprintf("nonce %d used by another transaction", e.Nonce)
+			if err := store.Save(job); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(e.RawTx); err != nil {
+			return fmt.Errorf("corrupted raw transaction for %s: %v", e.TxHash.Hex(), err)
+		}
+		loggerOr(bp.logger).Info("Broadcasting payout again", "job", job.ID, "tx", e.TxHash.Hex(), "nonce", e.Nonce)
+		if err := bp.broadcast(ctx, store, job, e, tx); err != nil {
+			state, ok := rebroadcastRefusal(e.Error)
+			if !ok {
+				return err
+			}
+			// Trying again would be refused the same way, settle the payout
+			e.State = state
+			if state == PayoutBroadcast {
+				e.Error = ""
+			} else if state == PayoutFailed && strings.Contains(strings.ToLower(e.Error), "nonce too low") {
+				e.Error = fmt.Sprintf("nonce %d used by another transaction", e.Nonce)
+			}
+			if err := store.Save(job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,473 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/exp/slog"
+)
+
+// PolicyRule is a guardrail of the policy engine
+type PolicyRule int
+
+const (
+	// RuleRecipientDenied refuses recipients on the deny list
+	RuleRecipientDenied PolicyRule = iota
+	// RuleRecipientNotAllowed refuses recipients missing from the allow list
+	RuleRecipientNotAllowed
+	// RuleMethodNotAllowed refuses contract calls outside the selector allow list
+	RuleMethodNotAllowed
+	// RuleFeeCap refuses transactions paying more than the fee caps
+	RuleFeeCap
+	// RuleTransactionLimit refuses amounts above the per-transaction limit
+	RuleTransactionLimit
+	// RuleDailyLimit refuses amounts that would exceed the daily limit
+	RuleDailyLimit
+	// RuleDryRun refuses transactions whose dry-run fails
+	RuleDryRun
+)
+
+func (r PolicyRule) String() string {
+	switch r {
+	case RuleRecipientDenied:
+		return "recipient denied"
+	case RuleRecipientNotAllowed:
+		return "recipient not allowed"
+	case RuleMethodNotAllowed:
+		return "method not allowed"
+	case RuleFeeCap:
+		return "fee cap"
+	case RuleTransactionLimit:
+		return "transaction limit"
+	case RuleDailyLimit:
+		return "daily limit"
+	case RuleDryRun:
+		return "dry-run"
+	}
+	return fmt.Sprintf("PolicyRule(%d)", int(r))
+}
+
+// PolicyViolation is the error of a transaction refused by the policy engine
+type PolicyViolation struct {
+	Rule   PolicyRule
+	From   common.Address
+	Reason string
+}
+
+func (v *PolicyViolation) Error() string {
+	return fmt.Sprintf("policy violation (%s) by %s: %s", v.Rule, v.From.Hex(), v.Reason)
+}
+
+// Limit caps amounts in wei or token base units, nil fields meaning no cap
+type Limit struct {
+	PerTransaction *big.Int
+	PerDay         *big.Int
+}
+
+// PolicyConfig sets the guardrails checked before a transaction is signed.
+// Zero values disable a rule.
+type PolicyConfig struct {
+	// Limits caps the native value sent by each account. The entry of the
+	// zero address applies to accounts without one of their own.
+	Limits map[common.Address]Limit
+	// TokenLimits caps the ERC-20 amounts each account sends, per token
+	TokenLimits map[common.Address]Limit
+	// Allow, when not empty, lists the only recipients allowed
+	Allow []common.Address
+	// Deny lists recipients always refused
+	Deny []common.Address
+	// MaxFeePerGas caps the gas price or fee cap of a transaction
+	MaxFeePerGas *big.Int
+	// MaxFee caps the most a transaction can pay in fees, gas limit times fee cap
+	MaxFee *big.Int
+	// Selectors, when not empty, lists the 4-byte selectors callable on each
+	// contract. The entry of the zero address applies to every contract.
+	// Transfers without calldata are not method calls and always pass.
+	Selectors map[common.Address][][4]byte
+	// DryRun requires an eth_call of the transaction to succeed
+	DryRun bool
+	// Audit records every decision, logged through Logger when nil
+	Audit AuditSink
+	// Logger receives the decisions when Audit is nil, the package default if nil
+	Logger *slog.Logger
+	// Now is the clock of the daily limits, which reset at midnight UTC
+	Now func() time.Time
+}
+
+// PolicyDecision is the audit record of a transaction checked by the engine.
+// Recipients are the beneficiaries, decoded from token transfer calldata.
+type PolicyDecision struct {
+	Time       time.Time        `json:"time"`
+	From       common.Address   `json:"from"`
+	To         *common.Address  `json:"to"`
+	Nonce      uint64           `json:"nonce"`
+	Value      *big.Int         `json:"value"`
+	Selector   hexutil.Bytes    `json:"selector,omitempty"`
+	Recipients []common.Address `json:"recipients"`
+	Allowed    bool             `json:"allowed"`
+	Rule       string           `json:"rule,omitempty"`
+	Reason     string           `json:"reason,omitempty"`
+}
+
+// AuditSink records the decisions of a policy engine
+type AuditSink interface {
+	Record(decision PolicyDecision)
+}
+
+// AuditFunc adapts a function to an AuditSink
+type AuditFunc func(decision PolicyDecision)
+
+// Record calls f
+func (f AuditFunc) Record(decision PolicyDecision) {
+	f(decision)
+}
+
+// logAudit is the default sink, allowed transactions at info level and
+// refused ones as warnings
+func logAudit(logger *slog.Logger) AuditFunc {
+	return func(d PolicyDecision) {
+		attrs := []interface{}{"from", d.From.Hex(), "nonce", d.Nonce, "recipients", d.Recipients}
+		if d.Allowed {
+			loggerOr(logger).Info("Policy allowed transaction", attrs...)
+			return
+		}
+		loggerOr(logger).Warn("Policy refused transaction", append(attrs, "rule", d.Rule, "reason", d.Reason)...)
+	}
+}
+
+// JSONAuditSink writes each decision as a line of JSON
+type JSONAuditSink struct {
+	encoder *json.Encoder
+	mutex   sync.Mutex
+}
+
+// NewJSONAuditSink creates a sink writing to w, such as an append-only file
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	return &JSONAuditSink{encoder: json.NewEncoder(w)}
+}
+
+// Record writes the decision, failures going to the package default logger
+func (s *JSONAuditSink) Record(decision PolicyDecision) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.encoder.Encode(decision); err != nil {
+		loggerOr(nil).Error("Failed to write audit record", "error", err)
+	}
+}
+
+// spendKey identifies what an account spent of an asset on a day
+type spendKey struct {
+	from  common.Address
+	token common.Address
+	day   string
+}
+
+// PolicyEngine checks transactions against a PolicyConfig before they are
+// signed. Amounts count toward the daily limits once approved, whether or
+// not the transaction is eventually mined.
+type PolicyEngine struct {
+	caller ethereum.ContractCaller
+	config PolicyConfig
+	allow  map[common.Address]bool
+	deny   map[common.Address]bool
+	spent  map[spendKey]*big.Int
+	mutex  sync.Mutex
+}
+
+// NewPolicyEngine creates an engine. caller runs the dry-runs and may be nil
+// when they are not required.
+func NewPolicyEngine(caller ethereum.ContractCaller, config PolicyConfig) *PolicyEngine {
+	if config.Audit == nil {
+		config.Audit = logAudit(config.Logger)
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	p := &PolicyEngine{
+		caller: caller,
+		config: config,
+		allow:  make(map[common.Address]bool, len(config.Allow)),
+		deny:   make(map[common.Address]bool, len(config.Deny)),
+		spent:  make(map[spendKey]*big.Int),
+	}
+	for _, address := range config.Allow {
+		p.allow[address] = true
+	}
+	for _, address := range config.Deny {
+		p.deny[address] = true
+	}
+	return p
+}
+
+// Wrap returns a signer that only signs the transactions the policy allows
+func (p *PolicyEngine) Wrap(signer Signer) Signer {
+	return &policySigner{Signer: signer, policy: p}
+}
+
+// TransactOpts returns a copy of opts whose signer is guarded by the policy,
+// for transactors built from raw keys
+func (p *PolicyEngine) TransactOpts(opts *bind.TransactOpts) *bind.TransactOpts {
+	guarded := *opts
+	sign := opts.Signer
+	guarded.Signer = func(from common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		ctx := opts.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := p.Authorize(ctx, from, tx); err != nil {
+			return nil, err
+		}
+		return sign(from, tx)
+	}
+	return &guarded
+}
+
+// Authorize checks tx, sent by from, against the policy and records the
+// decision. An allowed transaction counts toward the daily limits.
+func (p *PolicyEngine) Authorize(ctx context.Context, from common.Address, tx *types.Transaction) error {
+	now := p.config.Now()
+	recipients, token, tokenAmount := transferEffects(tx)
+	decision := PolicyDecision{
+		Time:       now,
+		From:       from,
+		To:         tx.To(),
+		Nonce:      tx.Nonce(),
+		Value:      tx.Value(),
+		Recipients: recipients,
+	}
+	if len(tx.Data()) >= 4 {
+		decision.Selector = tx.Data()[:4]
+	}
+
+	err := p.check(ctx, from, tx, recipients, token, tokenAmount, now)
+	if err != nil {
+		decision.Rule = err.Rule.String()
+		decision.Reason = err.Reason
+	} else {
+		decision.Allowed = true
+	}
+	p.config.Audit.Record(decision)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (p *PolicyEngine) check(ctx context.Context, from common.Address, tx *types.Transaction, recipients []common.Address, token *common.Address, tokenAmount *big.Int, now time.Time) *PolicyViolation {
+	violation := func(rule PolicyRule, format string, args ...interface{}) *PolicyViolation {
+		return &PolicyViolation{Rule: rule, From: from, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if to := tx.To(); to != nil && p.deny[*to] {
+		return violation(RuleRecipientDenied, "%s is denied", to.Hex())
+	}
+	for _, recipient := range recipients {
+		if p.deny[recipient] {
+			return violation(RuleRecipientDenied, "%s is denied", recipient.Hex())
+		}
+		if len(p.allow) > 0 && !p.allow[recipient] {
+			return violation(RuleRecipientNotAllowed, "%s is not on the allow list", recipient.Hex())
+		}
+	}
+
+	if len(p.config.Selectors) > 0 && len(tx.Data()) > 0 {
+		if tx.To() == nil {
+			return violation(RuleMethodNotAllowed, "contract creation is not allowed")
+		}
+		if len(tx.Data()) < 4 {
+			return violation(RuleMethodNotAllowed, "calldata without a selector")
+		}
+		var selector [4]byte
+		copy(selector[:], tx.Data())
+		if !p.selectorAllowed(*tx.To(), selector) {
+			return violation(RuleMethodNotAllowed, "method %s of %s is not allowed", hexutil.Encode(selector[:]), tx.To().Hex())
+		}
+	}
+
+	if max := p.config.MaxFeePerGas; max != nil && tx.GasFeeCap().Cmp(max) > 0 {
+		return violation(RuleFeeCap, "fee of %s per gas is above %s", tx.GasFeeCap(), max)
+	}
+	if max := p.config.MaxFee; max != nil {
+		if fee := new(big.Int).Mul(tx.GasFeeCap(), new(big.Int).SetUint64(tx.Gas())); fee.Cmp(max) > 0 {
+			return violation(RuleFeeCap, "fee of up to %s is above %s", fee, max)
+		}
+	}
+
+	limit, ok := p.config.Limits[from]
+	if !ok {
+		limit = p.config.Limits[common.Address{}]
+	}
+	spends := map[common.Address]*big.Int{{}: tx.Value()}
+	limits := map[common.Address]Limit{{}: limit}
+	if token != nil {
+		if tokenLimit, ok := p.config.TokenLimits[*token]; ok {
+			spends[*token] = tokenAmount
+			limits[*token] = tokenLimit
+		}
+	}
+	day := now.UTC().Format("2006-01-02")
+	if v := p.reserve(from, day, spends, limits, violation); v != nil {
+		return v
+	}
+
+	if p.config.DryRun {
+		if v := p.dryRun(ctx, from, tx, violation); v != nil {
+			p.release(from, day, spends)
+			return v
+		}
+	}
+	return nil
+}
+
+func (p *PolicyEngine) selectorAllowed(contract common.Address, selector [4]byte) bool {
+	for _, key := range []common.Address{contract, {}} {
+		for _, allowed := range p.config.Selectors[key] {
+			if allowed == selector {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reserve checks the amounts against their limits and counts them as spent
+// on the day, all of them or none
+func (p *PolicyEngine) reserve(from common.Address, day string, spends map[common.Address]*big.Int, limits map[common.Address]Limit, violation func(PolicyRule, string, ...interface{}) *PolicyViolation) *PolicyViolation {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for key := range p.spent {
+		if key.day != day {
+			delete(p.spent, key)
+		}
+	}
+
+	for token, amount := range spends {
+		asset := "native value"
+		if token != (common.Address{}) {
+			asset = "amount of token " + token.Hex()
+		}
+		limit := limits[token]
+		if limit.PerTransaction != nil && amount.Cmp(limit.PerTransaction) > 0 {
+			return violation(RuleTransactionLimit, "%s %s is above %s", asset, amount, limit.PerTransaction)
+		}
+		if limit.PerDay != nil {
+			total := new(big.Int).Add(amount, p.spentOn(spendKey{from, token, day}))
+			if total.Cmp(limit.PerDay) > 0 {
+				return violation(RuleDailyLimit, "%s %s would bring the day to %s, above %s", asset, amount, total, limit.PerDay)
+			}
+		}
+	}
+	for token, amount := range spends {
+		key := spendKey{from, token, day}
+		p.spent[key] = new(big.Int).Add(p.spentOn(key), amount)
+	}
+	return nil
+}
+
+// release gives back amounts reserved for a transaction finally refused
+func (p *PolicyEngine) release(from common.Address, day string, spends map[common.Address]*big.Int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for token, amount := range spends {
+		key := spendKey{from, token, day}
+		if spent, ok := p.spent[key]; ok {
+			spent.Sub(spent, amount)
+		}
+	}
+}
+
+func (p *PolicyEngine) spentOn(key spendKey) *big.Int {
+	if spent, ok := p.spent[key]; ok {
+		return spent
+	}
+	return new(big.Int)
+}
+
+// Spent returns what from has spent today of a token, the zero address
+// being the native currency
+func (p *PolicyEngine) Spent(from, token common.Address) *big.Int {
+	day := p.config.Now().UTC().Format("2006-01-02")
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return new(big.Int).Set(p.spentOn(spendKey{from, token, day}))
+}
+
+// dryRun executes the transaction with eth_call at the latest block
+func (p *PolicyEngine) dryRun(ctx context.Context, from common.Address, tx *types.Transaction, violation func(PolicyRule, string, ...interface{}) *PolicyViolation) *PolicyViolation {
+	if p.caller == nil {
+		return violation(RuleDryRun, "no node to run the dry-run on")
+	}
+	msg := ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Value: tx.Value(), Data: tx.Data()}
+	if _, err := p.caller.CallContract(ctx, msg, nil); err != nil {
+		return violation(RuleDryRun, "%v", err)
+	}
+	return nil
+}
+
+// policySigner checks transactions before passing them to the wrapped signer
+type policySigner struct {
+	Signer
+	policy *PolicyEngine
+}
+
+// SignTx signs tx if the policy allows it
+func (s *policySigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if err := s.policy.Authorize(ctx, s.Address(), tx); err != nil {
+		return nil, err
+	}
+	return s.Signer.SignTx(ctx, tx, chainID)
+}
+
+// transferEffects returns who a transaction pays and how much of an ERC-20
+// token it moves, decoding token and Disperse calldata
+func transferEffects(tx *types.Transaction) ([]common.Address, *common.Address, *big.Int) {
+	if tx.To() == nil {
+		return nil, nil, nil
+	}
+	data := tx.Data()
+	if len(data) < 4 {
+		return []common.Address{*tx.To()}, nil, nil
+	}
+
+	// transferFrom of ERC-721 shares its selector, its token id only counts
+	// toward the limits of tokens configured as ERC-20
+	if method, err := erc20ABI.MethodById(data[:4]); err == nil {
+		if args, err := method.Inputs.Unpack(data[4:]); err == nil {
+			switch method.Name {
+			case "transfer":
+				return []common.Address{args[0].(common.Address)}, tx.To(), args[1].(*big.Int)
+			case "transferFrom":
+				return []common.Address{args[1].(common.Address)}, tx.To(), args[2].(*big.Int)
+			}
+		}
+	}
+	if method, err := transferABI.MethodById(data[:4]); err == nil && method.Name != "transfer" {
+		if args, err := method.Inputs.Unpack(data[4:]); err == nil {
+			return []common.Address{args[1].(common.Address)}, nil, nil
+		}
+	}
+	if method, err := disperseABI.MethodById(data[:4]); err == nil {
+		if args, err := method.Inputs.Unpack(data[4:]); err == nil {
+			if method.Name == "disperseEther" {
+				return args[0].([]common.Address), nil, nil
+			}
+			token := args[0].(common.Address)
+			total := new(big.Int)
+			for _, value := range args[2].([]*big.Int) {
+				total.Add(total, value)
+			}
+			return args[1].([]common.Address), &token, total
+		}
+	}
+	return []common.Address{*tx.To()}, nil, nil
+}
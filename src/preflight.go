@@ -0,0 +1,439 @@
+package pyweb3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PreflightPolicy decides what happens to a batch the sender cannot pay for
+type PreflightPolicy int
+
+const (
+	// PreflightReject refuses the whole batch
+	PreflightReject PreflightPolicy = iota
+	// PreflightTrim drops the instructions that do not fit, keeping the order of the others
+	PreflightTrim
+)
+
+// ErrPreflightDropped is the error of the transfers removed by PreflightTrim
+var ErrPreflightDropped = errors.New("dropped by preflight: insufficient funds")
+
+// fallbackGas is used when a transfer cannot be estimated, such as a token
+// transfer reverting for lack of balance
+var fallbackGas = map[TokenStandard]uint64{
+	Native:       21000,
+	ERC20Token:   65000,
+	ERC721Token:  120000,
+	ERC1155Token: 120000,
+}
+
+// PreflightConfig configures a balance preflight
+type PreflightConfig struct {
+	Policy PreflightPolicy
+	// Spender is checked for ERC-20 allowances when the tokens are moved by a
+	// contract. Direct transfers ignore it and DisperseTransfer checks its
+	// Disperse contract instead.
+	Spender *common.Address
+}
+
+// Shortfall is an asset the sender holds too little of.
+// Token is zero for the native currency, TokenID is set for NFTs.
+type Shortfall struct {
+	Standard  TokenStandard
+	Token     common.Address
+	TokenID   *big.Int
+	Allowance bool
+	Required  *big.Int
+	Available *big.Int
+}
+
+// Missing returns how much is lacking
+func (s Shortfall) Missing() *big.Int {
+	return new(big.Int).Sub(s.Required, s.Available)
+}
+
+func (s Shortfall) String() string {
+	asset := s.Standard.String()
+	if s.Standard != Native {
+		asset += " " + s.Token.Hex()
+	}
+	if s.TokenID != nil {
+		asset += fmt.Sprintf(" #%s", s.TokenID)
+	}
+	if s.Allowance {
+		asset += " allowance"
+	}
+	return fmt.Sprintf("%s: need %s, have %s", asset, s.Required, s.Available)
+}
+
+// PreflightReport describes what a batch costs and what the sender lacks.
+// MaxFees is the worst case fee of the kept instructions, Dropped lists the
+// indexes of the instructions removed by PreflightTrim.
+type PreflightReport struct {
+	MaxFees    *big.Int
+	Shortfalls []Shortfall
+	Dropped    []int
+}
+
+// InsufficientFundsError is returned when PreflightReject refuses a batch
+type InsufficientFundsError struct {
+	Report *PreflightReport
+}
+
+func (e *InsufficientFundsError) Error() string {
+	parts := make([]string, len(e.Report.Shortfalls))
+	for i, s := range e.Report.Shortfalls {
+		parts[i] = s.String()
+	}
+	return "insufficient funds for batch: " + strings.Join(parts, "; ")
+}
+
+// SetPreflight makes BatchTransfer, SignedBatchTransfer, BatchTransferTokens
+// and DisperseTransfer check the balances of the sender before signing, nil
+// disables the check
+func (bp *BatchProcessor) SetPreflight(config *PreflightConfig) {
+	bp.preflight = config
+}
+
+// assetKey identifies a balance: the native currency, a token or an NFT id
+type assetKey struct {
+	standard  TokenStandard
+	token     common.Address
+	tokenID   common.Hash
+	allowance bool
+}
+
+// instructionCost is what an instruction takes from each balance
+type instructionCost struct {
+	native *big.Int
+	fee    *big.Int
+	asset  *assetKey
+	amount *big.Int
+}
+
+// Preflight checks at the pending block that from can pay for the
+// instructions, transfer amounts and worst case fees included, before any
+// signing. Depending on the policy, a batch which does not fit is refused
+// with an *InsufficientFundsError or trimmed.
+func (bp *BatchProcessor) Preflight(ctx context.Context, from common.Address, instructions []TransferInstruction, config PreflightConfig) ([]TransferInstruction, *PreflightReport, error) {
+	quote, err := bp.quoteFees(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	costs, err := bp.instructionCosts(ctx, quote, from, instructions)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bp.settle(ctx, from, instructions, costs, new(big.Int), config)
+}
+
+// directPreflight runs the preflight of the processor for transfers sent
+// by from itself, which no spender allowance applies to
+func (bp *BatchProcessor) directPreflight(ctx context.Context, from common.Address, instructions []TransferInstruction) (*PreflightReport, error) {
+	config := *bp.preflight
+	config.Spender = nil
+	_, report, err := bp.Preflight(ctx, from, instructions, config)
+	return report, err
+}
+
+// dispersePreflight runs the preflight of the processor for instructions
+// paid by a single Disperse transaction: its fee is taken once, and the
+// tokens are checked against the allowance of the contract
+func (bp *BatchProcessor) dispersePreflight(ctx context.Context, from common.Address, disperse common.Address, instructions []TransferInstruction) (*PreflightReport, error) {
+	quote, err := bp.quoteFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := bp.duplicates(instructions)
+	paid := make([]TransferInstruction, 0, len(instructions))
+	costs := make([]instructionCost, len(instructions))
+	for i, in := range instructions {
+		costs[i] = instructionCost{native: new(big.Int), fee: new(big.Int)}
+		if duplicates[i] {
+			continue
+		}
+		paid = append(paid, in)
+		switch in.Standard {
+		case Native:
+			costs[i].native = in.Amount
+		case ERC20Token:
+			costs[i].asset = &assetKey{standard: ERC20Token, token: in.Token}
+			costs[i].amount = in.Amount
+		}
+	}
+
+	var overhead *big.Int
+	if len(paid) == 0 {
+		overhead = new(big.Int)
+	} else {
+		value, data, err := disperseCall(paid)
+		if err != nil {
+			return nil, err
+		}
+		fallback := fallbackGas[paid[0].Standard] * uint64(len(paid))
+		if overhead, err = quote.fee(ctx, from, disperse, value, data, fallback); err != nil {
+			return nil, err
+		}
+	}
+
+	config := *bp.preflight
+	config.Spender = &disperse
+	_, report, err := bp.settle(ctx, from, instructions, costs, overhead, config)
+	return report, err
+}
+
+// settle checks the costs of the instructions against the balances of from,
+// overhead being a native cost taken once before any instruction
+func (bp *BatchProcessor) settle(ctx context.Context, from common.Address, instructions []TransferInstruction, costs []instructionCost, overhead *big.Int, config PreflightConfig) ([]TransferInstruction, *PreflightReport, error) {
+	required := map[assetKey]*big.Int{{}: new(big.Int).Set(overhead)}
+	add := func(key assetKey, amount *big.Int) {
+		if required[key] == nil {
+			required[key] = new(big.Int)
+		}
+		required[key].Add(required[key], amount)
+	}
+	for i, cost := range costs {
+		add(assetKey{}, cost.native)
+		if cost.asset != nil {
+			add(*cost.asset, cost.amount)
+			if config.Spender != nil && instructions[i].Standard == ERC20Token {
+				allowance := *cost.asset
+				allowance.allowance = true
+				add(allowance, cost.amount)
+			}
+		}
+	}
+
+	var err error
+	available := make(map[assetKey]*big.Int, len(required))
+	for key := range required {
+		if available[key], err = bp.availableBalance(ctx, from, key, config.Spender); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	report := &PreflightReport{MaxFees: new(big.Int).Set(overhead)}
+	for _, cost := range costs {
+		report.MaxFees.Add(report.MaxFees, cost.fee)
+	}
+	for key, amount := range required {
+		if amount.Cmp(available[key]) > 0 {
+			shortfall := Shortfall{Standard: key.standard, Token: key.token, Allowance: key.allowance, Required: amount, Available: available[key]}
+			if key.standard == ERC721Token || key.standard == ERC1155Token {
+				shortfall.TokenID = key.tokenID.Big()
+			}
+			report.Shortfalls = append(report.Shortfalls, shortfall)
+		}
+	}
+	if len(report.Shortfalls) == 0 {
+		return instructions, report, nil
+	}
+	sort.Slice(report.Shortfalls, func(i, j int) bool {
+		return report.Shortfalls[i].String() < report.Shortfalls[j].String()
+	})
+	if config.Policy == PreflightReject {
+		return nil, report, &InsufficientFundsError{Report: report}
+	}
+
+	report.MaxFees = new(big.Int).Set(overhead)
+	available[assetKey{}].Sub(available[assetKey{}], overhead)
+
+	kept := make([]TransferInstruction, 0, len(instructions))
+	for i, cost := range costs {
+		fits := cost.native.Cmp(available[assetKey{}]) <= 0
+		var allowance assetKey
+		if cost.asset != nil {
+			fits = fits && cost.amount.Cmp(available[*cost.asset]) <= 0
+			allowance = *cost.asset
+			allowance.allowance = true
+			if budget, ok := available[allowance]; ok {
+				fits = fits && cost.amount.Cmp(budget) <= 0
+			}
+		}
+		if !fits {
+			report.Dropped = append(report.Dropped, i)
+			continue
+		}
+
+		available[assetKey{}].Sub(available[assetKey{}], cost.native)
+		if cost.asset != nil {
+			available[*cost.asset].Sub(available[*cost.asset], cost.amount)
+			if budget, ok := available[allowance]; ok {
+				budget.Sub(budget, cost.amount)
+			}
+		}
+		report.MaxFees.Add(report.MaxFees, cost.fee)
+		kept = append(kept, instructions[i])
+	}
+	return kept, report, nil
+}
+
+// feeQuote prices transactions at the worst case fees of the chain
+type feeQuote struct {
+	client    GasBackend
+	chain     ChainProfile
+	estimator *GasEstimator
+	tipCap    *big.Int
+	feeCap    *big.Int
+}
+
+// quoteFees reads the current fee caps of the chain
+func (bp *BatchProcessor) quoteFees(ctx context.Context) (*feeQuote, error) {
+	chain, err := bp.client.Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	quote := &feeQuote{client: bp.client, chain: chain, estimator: NewGasEstimator(bp.client, 0)}
+	if chain.EIP1559 {
+		quote.tipCap, quote.feeCap, err = quote.estimator.SuggestFees(ctx)
+	} else {
+		quote.feeCap, err = bp.client.SuggestGasPrice(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %v", err)
+	}
+	return quote, nil
+}
+
+// fee returns the worst case fee of a call from from: its gas limit at the
+// fee cap plus the L1 data fee. Calls which cannot be estimated, such as
+// token transfers reverting for lack of balance, take fallback gas.
+func (q *feeQuote) fee(ctx context.Context, from, to common.Address, value *big.Int, data []byte, fallback uint64) (*big.Int, error) {
+	gas, err := q.client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Value: value, Data: data})
+	if err != nil {
+		gas = fallback
+	}
+
+	var tx *types.Transaction
+	if q.chain.EIP1559 {
+		tx = types.NewTx(&types.DynamicFeeTx{ChainID: new(big.Int).SetUint64(q.chain.ChainID), To: &to, Value: value, Data: data, Gas: gas, GasTipCap: q.tipCap, GasFeeCap: q.feeCap})
+	} else {
+		tx = types.NewTx(&types.LegacyTx{To: &to, Value: value, Data: data, Gas: gas, GasPrice: q.feeCap})
+	}
+	fees, err := q.estimator.EstimateFees(ctx, from, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := gas
+	if fees.GasLimit > limit {
+		limit = fees.GasLimit
+	}
+	fee := new(big.Int).Mul(q.feeCap, new(big.Int).SetUint64(limit))
+	if !q.chain.Quirks.NodeInterface {
+		fee.Add(fee, fees.L1DataFee)
+	}
+	return fee, nil
+}
+
+// instructionCosts estimates the worst case native cost of each instruction
+// sent as its own transaction: its fee and the value it carries.
+// Idempotency duplicates are never sent and cost nothing.
+func (bp *BatchProcessor) instructionCosts(ctx context.Context, quote *feeQuote, from common.Address, instructions []TransferInstruction) ([]instructionCost, error) {
+	duplicates := bp.duplicates(instructions)
+	costs := make([]instructionCost, len(instructions))
+	for i, in := range instructions {
+		if duplicates[i] {
+			costs[i] = instructionCost{native: new(big.Int), fee: new(big.Int)}
+			continue
+		}
+		to, value, data, err := transferCall(from, in)
+		if err != nil {
+			return nil, err
+		}
+		fee, err := quote.fee(ctx, from, to, value, data, fallbackGas[in.Standard])
+		if err != nil {
+			return nil, err
+		}
+
+		costs[i] = instructionCost{native: new(big.Int).Add(fee, value), fee: fee, amount: in.Amount}
+		switch in.Standard {
+		case ERC20Token:
+			costs[i].asset = &assetKey{standard: ERC20Token, token: in.Token}
+		case ERC721Token:
+			costs[i].asset = &assetKey{standard: ERC721Token, token: in.Token, tokenID: common.BigToHash(in.TokenID)}
+			costs[i].amount = common.Big1
+		case ERC1155Token:
+			costs[i].asset = &assetKey{standard: ERC1155Token, token: in.Token, tokenID: common.BigToHash(in.TokenID)}
+		}
+	}
+	return costs, nil
+}
+
+// duplicates returns the indexes of the instructions BatchTransferTokens
+// skips, as their idempotency key was already sent or used earlier in the batch
+func (bp *BatchProcessor) duplicates(instructions []TransferInstruction) map[int]bool {
+	duplicates := make(map[int]bool)
+	seen := make(map[string]bool)
+	for i, in := range instructions {
+		key := in.IdempotencyKey
+		if key == "" {
+			continue
+		}
+		if _, ok := bp.sent.lookup(key); ok || seen[key] {
+			duplicates[i] = true
+		}
+		seen[key] = true
+	}
+	return duplicates
+}
+
+// availableBalance reads a balance of from at the pending block
+func (bp *BatchProcessor) availableBalance(ctx context.Context, from common.Address, key assetKey, spender *common.Address) (*big.Int, error) {
+	call := func(contractAbi *abi.ABI, method string, args ...interface{}) ([]interface{}, error) {
+		data, err := contractAbi.Pack(method, args...)
+		if err != nil {
+			return nil, err
+		}
+		out, err := bp.client.PendingCallContract(ctx, ethereum.CallMsg{To: &key.token, Data: data})
+		if err != nil {
+			return nil, fmt.Errorf("%s call to %s failed: %v", method, key.token.Hex(), err)
+		}
+		return contractAbi.Unpack(method, out)
+	}
+
+	var (
+		values []interface{}
+		err    error
+	)
+	switch {
+	case key.standard == Native:
+		balance, err := bp.client.PendingBalanceAt(ctx, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get balance: %v", err)
+		}
+		return balance, nil
+	case key.allowance:
+		values, err = call(&erc20ABI, "allowance", from, *spender)
+	case key.standard == ERC20Token:
+		values, err = call(&erc20ABI, "balanceOf", from)
+	case key.standard == ERC1155Token:
+		values, err = call(&erc1155ABI, "balanceOf", from, key.tokenID.Big())
+	case key.standard == ERC721Token:
+		if values, err = call(&erc721ABI, "ownerOf", key.tokenID.Big()); err != nil {
+			// ownerOf reverts for burnt or never minted tokens
+			if isRevert(err) {
+				return new(big.Int), nil
+			}
+			return nil, err
+		}
+		if values[0].(common.Address) == from {
+			return big.NewInt(1), nil
+		}
+		return new(big.Int), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return values[0].(*big.Int), nil
+}
@@ -0,0 +1,109 @@
+// Package prommetrics records the instrumentation of the client as
+// Prometheus metrics. It lives apart from the client so that programs not
+// using Prometheus do not link it.
+package prommetrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+// DefaultBuckets are the latency buckets in seconds, from a local node to a
+// slow hosted provider
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics is a pyweb3.Instrumentation updating Prometheus collectors
+type Metrics struct {
+	requests      *prometheus.CounterVec
+	errors        *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	batchSizes    *prometheus.HistogramVec
+	connections   *prometheus.GaugeVec
+	subscriptions *prometheus.GaugeVec
+	reconnects    *prometheus.CounterVec
+}
+
+// New creates the metrics, named <namespace>_rpc_requests_total and so on,
+// and registers them with registerer
+func New(registerer prometheus.Registerer, namespace string) (*Metrics, error) {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rpc_requests_total",
+			Help:      "JSON-RPC requests sent, by method and endpoint.",
+		}, []string{"method", "endpoint"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rpc_errors_total",
+			Help:      "JSON-RPC errors, by method, endpoint and error code or \"transport\".",
+		}, []string{"method", "endpoint", "code"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rpc_request_duration_seconds",
+			Help:      "Latency of JSON-RPC requests, by method and endpoint.",
+			Buckets:   DefaultBuckets,
+		}, []string{"method", "endpoint"}),
+		batchSizes: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "batch_size",
+			Help:      "Instructions per batch operation.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 7),
+		}, []string{"operation"}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connections_open",
+			Help:      "Open WebSocket connections, by endpoint.",
+		}, []string{"endpoint"}),
+		subscriptions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subscriptions_active",
+			Help:      "In-flight eth_subscribe subscriptions, by kind.",
+		}, []string{"kind"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnects_total",
+			Help:      "Reconnections, by endpoint.",
+		}, []string{"endpoint"}),
+	}
+	for _, collector := range []prometheus.Collector{m.requests, m.errors, m.latency, m.batchSizes, m.connections, m.subscriptions, m.reconnects} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// StartRequest counts the request and returns the function recording its
+// latency and errors
+func (m *Metrics) StartRequest(ctx context.Context, request pyweb3.RequestInfo) (context.Context, func(pyweb3.RequestOutcome)) {
+	m.requests.WithLabelValues(request.Method, request.Endpoint).Inc()
+	return ctx, func(outcome pyweb3.RequestOutcome) {
+		m.latency.WithLabelValues(request.Method, request.Endpoint).Observe(outcome.Latency.Seconds())
+		for _, code := range outcome.ErrorCodes() {
+			m.errors.WithLabelValues(request.Method, request.Endpoint, code).Inc()
+		}
+	}
+}
+
+// BatchSize observes the size of a batch
+func (m *Metrics) BatchSize(ctx context.Context, operation string, size int) {
+	m.batchSizes.WithLabelValues(operation).Observe(float64(size))
+}
+
+// Connections moves the open connections gauge of an endpoint
+func (m *Metrics) Connections(endpoint string, delta int) {
+	m.connections.WithLabelValues(endpoint).Add(float64(delta))
+}
+
+// Subscriptions moves the in-flight subscriptions gauge of a kind
+func (m *Metrics) Subscriptions(kind string, delta int) {
+	m.subscriptions.WithLabelValues(kind).Add(float64(delta))
+}
+
+// Reconnect counts a reconnection
+func (m *Metrics) Reconnect(endpoint string) {
+	m.reconnects.WithLabelValues(endpoint).Inc()
+}
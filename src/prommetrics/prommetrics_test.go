@@ -0,0 +1,94 @@
+package prommetrics
+
+import (
+	"context"
+	"crypto/tls"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pyweb3 "web3-rpc-client/src"
+	"web3-rpc-client/src/rpctest"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	registry := prometheus.NewRegistry()
+	metrics, err := New(registry, "web3")
+	require.NoError(t, err)
+	_, err = New(registry, "web3")
+	assert.Error(t, err, "metrics are registered once")
+
+	node := rpctest.NewMockNode().
+		Respond("eth_blockNumber", "0x10").
+		Fail("eth_call", 3, "execution reverted")
+	defer node.Close()
+	host := strings.TrimPrefix(node.URL(), "http://")
+	client := pyweb3.NewJSONRPCClient(node.URL(), "", 0)
+	client.Instrumentation = metrics
+
+	var head hexutil.Uint64
+	for i := 0; i < 2; i++ {
+		require.NoError(t, client.CallContext(ctx, &head, "eth_blockNumber"))
+	}
+	assert.Error(t, client.CallContext(ctx, nil, "eth_call"))
+	require.NoError(t, client.BatchCallContext(ctx, []rpc.BatchElem{
+		{Method: "eth_blockNumber", Result: &head},
+		{Method: "eth_call"},
+	}))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(metrics.requests.WithLabelValues("eth_blockNumber", host)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.requests.WithLabelValues("batch", host)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.errors.WithLabelValues("eth_call", host, "3")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.errors.WithLabelValues("batch", host, "3")))
+	assert.Equal(t, 3, testutil.CollectAndCount(metrics.latency), "one histogram per method and endpoint")
+
+	unreachable := pyweb3.NewJSONRPCClient("http://127.0.0.1:1", "", 0)
+	unreachable.Instrumentation = metrics
+	assert.Error(t, unreachable.CallContext(ctx, &head, "eth_blockNumber"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.errors.WithLabelValues("eth_blockNumber", "127.0.0.1:1", "transport")))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+	names := make([]string, len(families))
+	for i, family := range families {
+		names[i] = family.GetName()
+	}
+	assert.Contains(t, names, "web3_rpc_request_duration_seconds")
+}
+
+func TestMetrics_Connections(t *testing.T) {
+	metrics, err := New(prometheus.NewRegistry(), "web3")
+	require.NoError(t, err)
+	pyweb3.SetDefaultInstrumentation(metrics)
+	defer pyweb3.SetDefaultInstrumentation(nil)
+
+	node := rpctest.NewTLSMockNode().Greet("established")
+	defer node.Close()
+	wsURL := "wss" + strings.TrimPrefix(node.URL(), "https")
+	endpoint := strings.TrimPrefix(wsURL, "wss://")
+	client, err := pyweb3.NewWebSocketClientWithTLS(wsURL, "test-agent", &tls.Config{RootCAs: node.CertPool()})
+	require.NoError(t, err)
+
+	open := func() float64 { return testutil.ToFloat64(metrics.connections.WithLabelValues(endpoint)) }
+	assert.Equal(t, 1.0, open())
+	require.NoError(t, client.Reconnect())
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.reconnects.WithLabelValues(endpoint)))
+	client.Conn.Close()
+	assert.Eventually(t, func() bool { return open() == 0 }, time.Second, 10*time.Millisecond)
+
+	metrics.Subscriptions("logs", 1)
+	metrics.Subscriptions("logs", 1)
+	metrics.Subscriptions("logs", -1)
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.subscriptions.WithLabelValues("logs")))
+
+	metrics.BatchSize(context.Background(), "transfer", 12)
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.batchSizes))
+}
@@ -0,0 +1,464 @@
+package pyweb3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// DefaultQuorumMethods are the read methods answered by majority vote when quorum mode is on
+var DefaultQuorumMethods = []string{
+	"eth_call",
+	"eth_getBalance",
+	"eth_getTransactionReceipt",
+	"eth_getTransactionCount",
+	"eth_getCode",
+	"eth_getStorageAt",
+}
+
+// Endpoint describes an upstream RPC node served by a Provider.
+// Lower Priority values are preferred, Weight spreads the load between
+// endpoints sharing the same priority.
+type Endpoint struct {
+	URL      string
+	Weight   int
+	Priority int
+}
+
+// ProviderConfig holds the health and quorum settings of a Provider
+type ProviderConfig struct {
+	// HealthCheckInterval is the period of the background health checks
+	HealthCheckInterval time.Duration
+	// MaxBlockLag marks an endpoint unhealthy when its head is this many blocks behind the best one
+	MaxBlockLag uint64
+	// MaxLatency marks an endpoint unhealthy when a health check takes longer
+	MaxLatency time.Duration
+	// MaxErrorRate marks an endpoint unhealthy when its failure ratio since the last check exceeds it
+	MaxErrorRate float64
+	// Quorum is the number of healthy endpoints queried for quorum reads, 0 or 1 disables quorum mode
+	Quorum int
+	// QuorumMethods overrides DefaultQuorumMethods
+	QuorumMethods []string
+	// OnDisagreement is called whenever quorum endpoints return different
+	// answers. Endpoints that fail are left out and are not a disagreement.
+	OnDisagreement func(Disagreement)
+	// Transport sends the requests to the endpoints, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// Logger receives the failovers and health changes, the package default if nil
+	Logger *slog.Logger
+}
+
+// Disagreement reports diverging answers returned for a quorum read
+type Disagreement struct {
+	Method string
+	Params json.RawMessage
+	// Results are the answers by endpoint URL, of the endpoints that answered
+	Results map[string]string
+}
+
+// EndpointStatus is a snapshot of the health of an endpoint
+type EndpointStatus struct {
+	Endpoint
+	Healthy   bool
+	Head      uint64
+	Latency   time.Duration
+	Requests  uint64
+	Failures  uint64
+	LastError error
+}
+
+type endpointState struct {
+	Endpoint
+	url       *url.URL
+	healthy   bool
+	head      uint64
+	latency   time.Duration
+	requests  uint64
+	failures  uint64
+	lastError error
+}
+
+// Provider spreads JSON-RPC traffic over several endpoints.
+// It is an http.RoundTripper so it sits under both the go-ethereum rpc
+// client and the raw JSON-RPC client, failing over to the next endpoint on
+// transport errors and 5xx responses.
+type Provider struct {
+	config    ProviderConfig
+	transport http.RoundTripper
+	quorum    map[string]bool
+
+	mutex     sync.Mutex
+	endpoints []*endpointState
+	rnd       *rand.Rand
+}
+
+// NewProvider creates a provider over the given endpoints
+func NewProvider(endpoints []Endpoint, config ProviderConfig) (*Provider, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("provider needs at least one endpoint")
+	}
+
+	states := make([]*endpointState, 0, len(endpoints))
+	for _, ep := range endpoints {
+		parsedURL, err := url.Parse(ep.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+			return nil, fmt.Errorf("invalid endpoint URL: %s", ep.URL)
+		}
+		if ep.Weight <= 0 {
+			ep.Weight = 1
+		}
+		states = append(states, &endpointState{Endpoint: ep, url: parsedURL, healthy: true})
+	}
+
+	transport := config.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	methods := config.QuorumMethods
+	if methods == nil {
+		methods = DefaultQuorumMethods
+	}
+	quorum := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		quorum[method] = true
+	}
+
+	return &Provider{
+		config:    config,
+		transport: transport,
+		quorum:    quorum,
+		endpoints: states,
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// NewWeb3ClientWithProvider creates a Web3Client whose traffic goes through the provider
+func NewWeb3ClientWithProvider(p *Provider) (*Web3Client, error) {
+	return NewWeb3ClientWithTransport(p.endpoints[0].URL, p)
+}
+
+// RoundTrip sends a JSON-RPC HTTP request to the best available endpoint
+func (p *Provider) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.Quorum > 1 {
+		msgs, batch, err := decodeRPCMessages(body)
+		if err == nil && !batch && p.quorum[msgs[0].Method] {
+			return p.quorumRoundTrip(req, body, msgs[0])
+		}
+	}
+
+	var lastErr error
+	for _, ep := range p.candidates() {
+		resp, err := p.send(ep, req, body)
+		if err == nil {
+			return resp, nil
+		}
+		attrs := []interface{}{"endpoint", ep.url.Host, "error", errorOf(err)}
+		if msgs, _, err := decodeRPCMessages(body); err == nil {
+			attrs = append(requestAttrs(msgs), attrs...)
+		}
+		loggerOr(p.config.Logger).Warn("Endpoint failed, trying next one", attrs...)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("all endpoints failed, last error: %w", lastErr)
+}
+
+// send forwards the request to one endpoint, turning 5xx answers into errors
+func (p *Provider) send(ep *endpointState, req *http.Request, body []byte) (*http.Response, error) {
+	out := cloneRequest(req, body)
+	out.URL = ep.url
+	out.Host = ep.url.Host
+
+	start := time.Now()
+	resp, err := p.transport.RoundTrip(out)
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		resp.Body.Close()
+		err = fmt.Errorf("endpoint %s answered %s", ep.url.Host, resp.Status)
+	}
+	p.record(ep, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// quorumRoundTrip sends a read to several endpoints and answers with the majority result
+func (p *Provider) quorumRoundTrip(req *http.Request, body []byte, msg *rpcMessage) (*http.Response, error) {
+	candidates := p.voters()
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no quorum for %s: no healthy endpoint", msg.Method)
+	}
+
+	type answer struct {
+		endpoint string
+		host     string
+		body     []byte
+		key      string
+		err      error
+	}
+	answers := make([]answer, len(candidates))
+	wg := &sync.WaitGroup{}
+	for i, ep := range candidates {
+		wg.Add(1)
+		go func(i int, ep *endpointState) {
+			defer wg.Done()
+			answers[i].endpoint = ep.URL
+			answers[i].host = ep.url.Host
+			resp, err := p.send(ep, req, body)
+			if err != nil {
+				answers[i].err = err
+				return
+			}
+			respBody, err := readResponseBody(resp)
+			if err != nil {
+				answers[i].err = err
+				return
+			}
+			msgs, _, err := decodeRPCMessages(respBody)
+			if err != nil {
+				answers[i].err = err
+				return
+			}
+			answers[i].body = respBody
+			answers[i].key = msgs[0].resultKey()
+		}(i, ep)
+	}
+	wg.Wait()
+
+	votes := make(map[string]int)
+	results := make(map[string]string, len(answers))
+	for _, a := range answers {
+		if a.err != nil {
+			loggerOr(p.config.Logger).Warn("Quorum endpoint failed",
+				"method", msg.Method, "endpoint", a.host, "error", errorOf(a.err))
+			continue
+		}
+		votes[a.key]++
+		results[a.endpoint] = a.key
+	}
+
+	if len(votes) > 1 {
+		if p.config.OnDisagreement != nil {
+			p.config.OnDisagreement(Disagreement{Method: msg.Method, Params: msg.Params, Results: results})
+		}
+	}
+
+	needed := len(candidates)/2 + 1
+	for _, a := range answers {
+		if a.err == nil && votes[a.key] >= needed {
+			return newRPCResponse(req, a.body), nil
+		}
+	}
+	return nil, fmt.Errorf("no quorum for %s: %d endpoints needed to agree", msg.Method, needed)
+}
+
+// voters returns the healthy endpoints taking part in a quorum read, at most Quorum of them
+func (p *Provider) voters() []*endpointState {
+	ordered := p.candidates()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	voters := make([]*endpointState, 0, p.config.Quorum)
+	for _, ep := range ordered {
+		if ep.healthy && len(voters) < p.config.Quorum {
+			voters = append(voters, ep)
+		}
+	}
+	return voters
+}
+
+// candidates orders endpoints for a request: healthy ones first by priority,
+// weighted random order within a priority, unhealthy ones as a last resort
+func (p *Provider) candidates() []*endpointState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	keys := make(map[*endpointState]float64, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		// Weighted random sampling key, larger weights tend to come first
+		keys[ep] = -p.rnd.ExpFloat64() / float64(ep.Weight)
+	}
+
+	ordered := make([]*endpointState, len(p.endpoints))
+	copy(ordered, p.endpoints)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return keys[a] > keys[b]
+	})
+	return ordered
+}
+
+func (p *Provider) record(ep *endpointState, latency time.Duration, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ep.requests++
+	ep.latency = latency
+	if err != nil {
+		ep.failures++
+		ep.lastError = err
+	}
+}
+
+// StartHealthChecks runs the periodic health checks until the context is done
+func (p *Provider) StartHealthChecks(ctx context.Context) {
+	if p.config.HealthCheckInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.config.HealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.CheckHealth(ctx)
+			}
+		}
+	}()
+}
+
+// CheckHealth probes every endpoint with eth_blockNumber and updates its health
+// from block height lag, latency and the error rate since the previous check
+func (p *Provider) CheckHealth(ctx context.Context) {
+	type probe struct {
+		head    uint64
+		latency time.Duration
+		err     error
+	}
+	probes := make([]probe, len(p.endpoints))
+
+	wg := &sync.WaitGroup{}
+	for i, ep := range p.endpoints {
+		wg.Add(1)
+		go func(i int, ep *endpointState) {
+			defer wg.Done()
+			start := time.Now()
+			probes[i].head, probes[i].err = p.blockNumber(ctx, ep)
+			probes[i].latency = time.Since(start)
+		}(i, ep)
+	}
+	wg.Wait()
+
+	var best uint64
+	for _, pr := range probes {
+		if pr.err == nil && pr.head > best {
+			best = pr.head
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for i, ep := range p.endpoints {
+		pr := probes[i]
+		healthy := pr.err == nil
+		if pr.err != nil {
+			ep.lastError = pr.err
+		} else {
+			ep.head = pr.head
+			ep.latency = pr.latency
+		}
+		if p.config.MaxBlockLag > 0 && best-ep.head > p.config.MaxBlockLag {
+			healthy = false
+		}
+		if p.config.MaxLatency > 0 && pr.latency > p.config.MaxLatency {
+			healthy = false
+		}
+		if p.config.MaxErrorRate > 0 && ep.requests > 0 &&
+			float64(ep.failures)/float64(ep.requests) > p.config.MaxErrorRate {
+			healthy = false
+		}
+		if healthy != ep.healthy {
+			level := slog.LevelInfo
+			if !healthy {
+				level = slog.LevelWarn
+			}
+			loggerOr(p.config.Logger).Log(ctx, level, "Endpoint health changed",
+				"endpoint", ep.url.Host, "healthy", healthy, "head", ep.head, "latency", pr.latency, "error", errorOf(pr.err))
+		}
+		ep.healthy = healthy
+		ep.requests = 0
+		ep.failures = 0
+	}
+}
+
+func (p *Provider) blockNumber(ctx context.Context, ep *endpointState) (uint64, error) {
+	payload := []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return 0, err
+	}
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("health check answered %s", resp.Status)
+	}
+
+	msgs, _, err := decodeRPCMessages(body)
+	if err != nil {
+		return 0, err
+	}
+	if msgs[0].Error != nil {
+		return 0, msgs[0].Error
+	}
+	var head string
+	if err := json.Unmarshal(msgs[0].Result, &head); err != nil {
+		return 0, fmt.Errorf("bad data when reading blockNumber: %v", err)
+	}
+	return strconv.ParseUint(strings.TrimPrefix(head, "0x"), 16, 64)
+}
+
+// Status returns a snapshot of the endpoints health
+func (p *Provider) Status() []EndpointStatus {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	status := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		status = append(status, EndpointStatus{
+			Endpoint:  ep.Endpoint,
+			Healthy:   ep.healthy,
+			Head:      ep.head,
+			Latency:   ep.latency,
+			Requests:  ep.requests,
+			Failures:  ep.failures,
+			LastError: ep.lastError,
+		})
+	}
+	return status
+}
@@ -0,0 +1,321 @@
+package pyweb3
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// DefaultMethodCosts holds compute unit costs per method, modeled after
+// the pricing of the common hosted providers
+var DefaultMethodCosts = map[string]uint64{
+	"eth_chainId":               0,
+	"net_version":               0,
+	"eth_blockNumber":           10,
+	"eth_getTransactionReceipt": 15,
+	"eth_getBlockByNumber":      16,
+	"eth_getBlockByHash":        16,
+	"eth_getBalance":            19,
+	"eth_gasPrice":              19,
+	"eth_getTransactionByHash":  17,
+	"eth_getTransactionCount":   26,
+	"eth_getCode":               26,
+	"eth_call":                  26,
+	"eth_getLogs":               75,
+	"eth_estimateGas":           87,
+	"eth_sendRawTransaction":    250,
+}
+
+// DefaultMethodCost is the cost of a method missing from the cost table
+const DefaultMethodCost = 20
+
+// Budget is the token bucket setting of an endpoint, in compute units
+type Budget struct {
+	UnitsPerSecond float64
+	Burst          float64
+}
+
+// RateLimiterConfig holds the settings of a RateLimiter
+type RateLimiterConfig struct {
+	// Budget applies to every endpoint missing from EndpointBudgets
+	Budget Budget
+	// EndpointBudgets overrides the budget per endpoint host
+	EndpointBudgets map[string]Budget
+	// MethodCosts overrides DefaultMethodCosts
+	MethodCosts map[string]uint64
+	// MaxRetries is the number of times a throttled (429) request is sent again
+	MaxRetries int
+	// MaxRetryAfter caps the back off asked by a server
+	MaxRetryAfter time.Duration
+	// Transport sends the requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+	// Logger receives the throttled requests, the package default if nil
+	Logger *slog.Logger
+}
+
+// MethodStats counts the calls and compute units spent on a method
+type MethodStats struct {
+	Calls     uint64
+	Units     uint64
+	Throttled uint64
+}
+
+type tokenBucket struct {
+	budget       Budget
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// RateLimiter is an http.RoundTripper throttling JSON-RPC traffic with a
+// token bucket per endpoint, charging each call the cost of its method.
+// Only 429 answers are sent again. A 503 with Retry-After blocks the bucket
+// and is returned as is, so put the rate limiter below a Retrier in Chain:
+// the Retrier waits for Retry-After and its retries then wait for the bucket.
+type RateLimiter struct {
+	config    RateLimiterConfig
+	transport http.RoundTripper
+	costs     map[string]uint64
+
+	mutex   sync.Mutex
+	buckets map[string]*tokenBucket
+	stats   map[string]*MethodStats
+}
+
+// NewRateLimiter creates a rate limiter
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	transport := config.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if config.MaxRetryAfter <= 0 {
+		config.MaxRetryAfter = time.Minute
+	}
+
+	costs := make(map[string]uint64, len(DefaultMethodCosts)+len(config.MethodCosts))
+	for method, cost := range DefaultMethodCosts {
+		costs[method] = cost
+	}
+	for method, cost := range config.MethodCosts {
+		costs[method] = cost
+	}
+
+	return &RateLimiter{
+		config:    config,
+		transport: transport,
+		costs:     costs,
+		buckets:   make(map[string]*tokenBucket),
+		stats:     make(map[string]*MethodStats),
+	}
+}
+
+// RateLimitMiddleware returns a Middleware installing a RateLimiter
+func RateLimitMiddleware(config RateLimiterConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		config.Transport = next
+		return NewRateLimiter(config)
+	}
+}
+
+// RoundTrip waits for enough budget on the endpoint, then sends the request
+func (rl *RateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods []string
+	if msgs, _, err := decodeRPCMessages(body); err == nil {
+		for _, msg := range msgs {
+			methods = append(methods, msg.Method)
+		}
+	}
+	cost := rl.charge(methods)
+
+	for attempt := 0; ; attempt++ {
+		if err := rl.wait(req.Context(), req.URL.Host, cost); err != nil {
+			return nil, err
+		}
+
+		resp, err := rl.transport.RoundTrip(cloneRequest(req, body))
+		if err != nil {
+			return nil, err
+		}
+		throttled := resp.StatusCode == http.StatusTooManyRequests ||
+			resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != ""
+		if !throttled {
+			return resp, nil
+		}
+
+		delay := rl.backOff(req.URL.Host, resp.Header.Get("Retry-After"))
+		rl.countThrottled(methods)
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= rl.config.MaxRetries {
+			return resp, nil
+		}
+		resp.Body.Close()
+		loggerOr(rl.config.Logger).Warn("Endpoint throttled the request", "method", strings.Join(methods, ","),
+			"endpoint", req.URL.Host, "attempt", attempt+1, "backoff", delay)
+	}
+}
+
+// charge records the calls and returns the total cost of the methods
+func (rl *RateLimiter) charge(methods []string) float64 {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	var total uint64
+	for _, method := range methods {
+		cost, ok := rl.costs[method]
+		if !ok {
+			cost = DefaultMethodCost
+		}
+		stats := rl.methodStats(method)
+		stats.Calls++
+		stats.Units += cost
+		total += cost
+	}
+	return float64(total)
+}
+
+func (rl *RateLimiter) countThrottled(methods []string) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	for _, method := range methods {
+		rl.methodStats(method).Throttled++
+	}
+}
+
+func (rl *RateLimiter) methodStats(method string) *MethodStats {
+	stats, ok := rl.stats[method]
+	if !ok {
+		stats = &MethodStats{}
+		rl.stats[method] = stats
+	}
+	return stats
+}
+
+// bucket returns the token bucket of an endpoint, the caller holds the lock
+func (rl *RateLimiter) bucket(host string) *tokenBucket {
+	b, ok := rl.buckets[host]
+	if !ok {
+		budget, found := rl.config.EndpointBudgets[host]
+		if !found {
+			budget = rl.config.Budget
+		}
+		if budget.Burst < budget.UnitsPerSecond {
+			budget.Burst = budget.UnitsPerSecond
+		}
+		b = &tokenBucket{budget: budget, tokens: budget.Burst, last: time.Now()}
+		rl.buckets[host] = b
+	}
+	return b
+}
+
+// wait blocks until the endpoint bucket holds cost units and takes them
+func (rl *RateLimiter) wait(ctx context.Context, host string, cost float64) error {
+	for {
+		delay := rl.reserve(host, cost)
+		if delay <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes cost units from the bucket, or returns how long to wait before trying again
+func (rl *RateLimiter) reserve(host string, cost float64) time.Duration {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	b := rl.bucket(host)
+	now := time.Now()
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+	if b.budget.UnitsPerSecond <= 0 {
+		// No budget configured: unlimited
+		return 0
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * b.budget.UnitsPerSecond
+	if b.tokens > b.budget.Burst {
+		b.tokens = b.budget.Burst
+	}
+	b.last = now
+
+	// A call costing more than the burst goes through once the bucket is full
+	if cost > b.budget.Burst {
+		cost = b.budget.Burst
+	}
+	if b.tokens >= cost {
+		b.tokens -= cost
+		return 0
+	}
+	return time.Duration((cost - b.tokens) / b.budget.UnitsPerSecond * float64(time.Second))
+}
+
+// backOff blocks the endpoint bucket for the delay asked by the server
+func (rl *RateLimiter) backOff(host string, retryAfter string) time.Duration {
+	delay := parseRetryAfter(retryAfter)
+	if delay > rl.config.MaxRetryAfter {
+		delay = rl.config.MaxRetryAfter
+	}
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	b := rl.bucket(host)
+	until := time.Now().Add(delay)
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+		b.last = until
+	}
+	b.tokens = 0
+	return delay
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date,
+// falling back to one second when it is missing or malformed
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+	return time.Second
+}
+
+// Stats returns the counters of calls and units spent by method
+func (rl *RateLimiter) Stats() map[string]MethodStats {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	stats := make(map[string]MethodStats, len(rl.stats))
+	for method, s := range rl.stats {
+		stats[method] = *s
+	}
+	return stats
+}
+
+// String summarizes the units spent, handy in logs
+func (s MethodStats) String() string {
+	return fmt.Sprintf("calls=%d units=%d throttled=%d", s.Calls, s.Units, s.Throttled)
+}
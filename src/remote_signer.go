@@ -0,0 +1,221 @@
+package pyweb3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// SignerAPI is the JSON-RPC API spoken by a remote signer
+type SignerAPI int
+
+const (
+	// ClefAPI is the external API of Clef, account_signTransaction and account_signData
+	ClefAPI SignerAPI = iota
+	// NodeAPI is eth_signTransaction and eth_sign of a node holding the key
+	NodeAPI
+)
+
+func (a SignerAPI) String() string {
+	switch a {
+	case ClefAPI:
+		return "clef"
+	case NodeAPI:
+		return "node"
+	}
+	return fmt.Sprintf("SignerAPI(%d)", int(a))
+}
+
+// ErrSignatureMismatch is returned when a signer answers with a transaction
+// or signature other than the one requested
+var ErrSignatureMismatch = errors.New("signature does not match the request")
+
+// RemoteSigner is a Signer delegating to an external signer such as Clef,
+// so keys never enter the process. Every signature is checked against the
+// request before it is returned.
+type RemoteSigner struct {
+	transport Transport
+	address   common.Address
+	api       SignerAPI
+}
+
+// NewRemoteSigner connects to a signer at an http(s) URL, through a
+// JSONRPCClient, or at the path of an IPC socket
+func NewRemoteSigner(endpoint string, address common.Address, api SignerAPI) (*RemoteSigner, error) {
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		// Not retried, Clef would ask its operator to confirm again
+		return NewRemoteSignerFromTransport(NewJSONRPCClient(endpoint, "", 0), address, api), nil
+	}
+	client, err := rpc.DialIPC(context.Background(), endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to signer %s: %v", endpoint, err)
+	}
+	return NewRemoteSignerFromTransport(client, address, api), nil
+}
+
+// NewRemoteSignerFromTransport creates a remote signer over an existing transport
+func NewRemoteSignerFromTransport(transport Transport, address common.Address, api SignerAPI) *RemoteSigner {
+	return &RemoteSigner{transport: transport, address: address, api: api}
+}
+
+// Address returns the account signed for
+func (s *RemoteSigner) Address() common.Address {
+	return s.address
+}
+
+// Close closes the connection to the signer
+func (s *RemoteSigner) Close() {
+	s.transport.Close()
+}
+
+// Accounts lists the accounts the signer holds
+func (s *RemoteSigner) Accounts(ctx context.Context) ([]common.Address, error) {
+	method := "account_list"
+	if s.api == NodeAPI {
+		method = "eth_accounts"
+	}
+	var addresses []common.Address
+	if err := s.transport.CallContext(ctx, &addresses, method); err != nil {
+		return nil, fmt.Errorf("failed to list signer accounts: %v", err)
+	}
+	return addresses, nil
+}
+
+// signTxArgs are the transaction fields of account_signTransaction and eth_signTransaction
+type signTxArgs struct {
+	From                 common.Address    `json:"from"`
+	To                   *common.Address   `json:"to,omitempty"`
+	Gas                  hexutil.Uint64    `json:"gas"`
+	GasPrice             *hexutil.Big      `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big      `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big      `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big       `json:"value"`
+	Nonce                hexutil.Uint64    `json:"nonce"`
+	Data                 hexutil.Bytes     `json:"data"`
+	ChainID              *hexutil.Big      `json:"chainId"`
+	AccessList           *types.AccessList `json:"accessList,omitempty"`
+}
+
+// signTxResult is the answer of both APIs, the tx field is ignored
+type signTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+func newSignTxArgs(from common.Address, tx *types.Transaction, chainID *big.Int) (*signTxArgs, error) {
+	args := &signTxArgs{
+		From:    from,
+		To:      tx.To(),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    tx.Data(),
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	switch tx.Type() {
+	case types.LegacyTxType:
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	case types.AccessListTxType:
+		accessList := tx.AccessList()
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+		args.AccessList = &accessList
+	case types.DynamicFeeTxType:
+		accessList := tx.AccessList()
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+		args.AccessList = &accessList
+	default:
+		return nil, fmt.Errorf("remote signing of transaction type %d is not supported", tx.Type())
+	}
+	return args, nil
+}
+
+// SignTx asks the signer to sign tx and checks that the answer is tx, for
+// the chain, signed by the account
+func (s *RemoteSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args, err := newSignTxArgs(s.address, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	method := "account_signTransaction"
+	if s.api == NodeAPI {
+		method = "eth_signTransaction"
+	}
+	var result signTxResult
+	if err := s.transport.CallContext(ctx, &result, method, args); err != nil {
+		return nil, fmt.Errorf("remote signer refused transaction: %v", err)
+	}
+
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(result.Raw); err != nil {
+		return nil, fmt.Errorf("remote signer returned an invalid transaction: %v", err)
+	}
+	if err := verifySignedTx(tx, signed, chainID, s.address); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// verifySignedTx checks that signed carries the fields of tx, through the
+// hash its signature covers, and was signed by from for the chain
+func verifySignedTx(tx, signed *types.Transaction, chainID *big.Int, from common.Address) error {
+	if signed.Type() != tx.Type() {
+		return fmt.Errorf("%w: transaction type %d instead of %d", ErrSignatureMismatch, signed.Type(), tx.Type())
+	}
+	if !signed.Protected() {
+		return fmt.Errorf("%w: transaction is not replay protected", ErrSignatureMismatch)
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return fmt.Errorf("%w: transaction fields differ", ErrSignatureMismatch)
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureMismatch, err)
+	}
+	if sender != from {
+		return fmt.Errorf("%w: signed by %s instead of %s", ErrSignatureMismatch, sender.Hex(), from.Hex())
+	}
+	return nil
+}
+
+// SignMessage asks the signer for an EIP-191 personal signature of message
+// and checks that it recovers to the account
+func (s *RemoteSigner) SignMessage(ctx context.Context, message []byte) ([]byte, error) {
+	var (
+		signature hexutil.Bytes
+		err       error
+	)
+	if s.api == NodeAPI {
+		err = s.transport.CallContext(ctx, &signature, "eth_sign", s.address, hexutil.Bytes(message))
+	} else {
+		err = s.transport.CallContext(ctx, &signature, "account_signData", accounts.MimetypeTextPlain, s.address, hexutil.Bytes(message))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("remote signer refused message: %v", err)
+	}
+
+	if len(signature) != crypto.SignatureLength {
+		return nil, fmt.Errorf("%w: signature of %d bytes", ErrSignatureMismatch, len(signature))
+	}
+	recoverable := common.CopyBytes(signature)
+	if recoverable[crypto.RecoveryIDOffset] >= 27 {
+		recoverable[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash(message), recoverable)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignatureMismatch, err)
+	}
+	if signer := crypto.PubkeyToAddress(*pub); signer != s.address {
+		return nil, fmt.Errorf("%w: signed by %s instead of %s", ErrSignatureMismatch, signer.Hex(), s.address.Hex())
+	}
+	return signature, nil
+}
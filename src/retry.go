@@ -0,0 +1,379 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/exp/slog"
+)
+
+// Middleware wraps a transport to add behavior around the request path
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// Chain stacks middlewares on top of transport, the first one being the outermost
+func Chain(transport http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+// ErrorClass tells whether a failed request may be sent again
+type ErrorClass int
+
+const (
+	// ClassOK means the request succeeded
+	ClassOK ErrorClass = iota
+	// ClassTransient covers timeouts, connection resets, throttling and lagging nodes
+	ClassTransient
+	// ClassPermanent covers errors that would fail again, such as reverts or bad params
+	ClassPermanent
+)
+
+// transientMessages are JSON-RPC error messages worth retrying, often sent by
+// load balanced nodes not yet synced to the requested block
+var transientMessages = []string{
+	"header not found",
+	"unknown block",
+	"request timed out",
+	"too many requests",
+	"rate limit",
+}
+
+// ClassifyError classifies the outcome of a JSON-RPC HTTP exchange
+func ClassifyError(err error, statusCode int, rpcErr *RPCError) ErrorClass {
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, context.Canceled):
+			return ClassPermanent
+		case errors.As(err, &netErr) && netErr.Timeout(),
+			errors.Is(err, context.DeadlineExceeded),
+			errors.Is(err, syscall.ECONNRESET),
+			errors.Is(err, syscall.ECONNREFUSED),
+			errors.Is(err, io.ErrUnexpectedEOF),
+			errors.Is(err, io.EOF):
+			return ClassTransient
+		}
+		return ClassPermanent
+	}
+
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return ClassTransient
+	}
+	if statusCode >= http.StatusBadRequest {
+		return ClassPermanent
+	}
+
+	if rpcErr != nil {
+		message := strings.ToLower(rpcErr.Message)
+		for _, transient := range transientMessages {
+			if strings.Contains(message, transient) {
+				return ClassTransient
+			}
+		}
+		return ClassPermanent
+	}
+	return ClassOK
+}
+
+// RetryPolicy sets how a method is retried.
+// MaxAttempts counts the first try, so 1 disables retries. A zero MaxDelay
+// leaves the back off uncapped.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy is used for methods without a policy of their own
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// nonIdempotentMethods are never sent again blindly
+var nonIdempotentMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+	"eth_sendTransaction":    true,
+}
+
+// RetryConfig holds the retry policies of a Retrier
+type RetryConfig struct {
+	Default RetryPolicy
+	Methods map[string]RetryPolicy
+	// Logger receives the retries, the package default if nil
+	Logger *slog.Logger
+}
+
+// Retrier is an http.RoundTripper retrying transient failures with
+// jittered exponential back off. A Retry-After header on a 429 or 503 answer
+// is waited for, and ends the retries when it is longer than MaxDelay.
+// eth_sendRawTransaction is only sent again once a lookup by hash shows the
+// node did not already accept the transaction.
+type Retrier struct {
+	config    RetryConfig
+	transport http.RoundTripper
+}
+
+// NewRetrier creates a retrier sending its requests through transport
+func NewRetrier(config RetryConfig, transport http.RoundTripper) *Retrier {
+	if config.Default.MaxAttempts <= 0 {
+		config.Default = DefaultRetryPolicy
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &Retrier{config: config, transport: transport}
+}
+
+// RetryMiddleware returns a Middleware installing a Retrier
+func RetryMiddleware(config RetryConfig) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return NewRetrier(config, next)
+	}
+}
+
+// RoundTrip sends the request, retrying according to the policy of its method
+func (r *Retrier) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, batch, err := decodeRPCMessages(body)
+	if err != nil {
+		return r.transport.RoundTrip(req)
+	}
+
+	policy := r.policy(msgs)
+	for _, msg := range msgs {
+		if nonIdempotentMethods[msg.Method] {
+			if batch {
+				// No safe way to tell which part of a batch went through
+				return r.transport.RoundTrip(req)
+			}
+			return r.sendRawTransaction(req, body, msg, policy)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		resp, respBody, class, err := r.attempt(req, body)
+		if class != ClassTransient || attempt >= policy.MaxAttempts {
+			return finish(req, resp, respBody, err)
+		}
+		wait := retryAfter(resp)
+		if policy.MaxDelay > 0 && wait > policy.MaxDelay {
+			return finish(req, resp, respBody, err)
+		}
+		r.logger().Warn("Retrying after transient failure", append(requestAttrs(msgs),
+			"endpoint", req.URL.Host, "attempt", attempt, "max_attempts", policy.MaxAttempts,
+			"latency", time.Since(start), "error", failure(resp, err))...)
+		if err := sleepBackOff(req.Context(), policy, attempt, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// logger returns the logger of the retrier
+func (r *Retrier) logger() *slog.Logger {
+	return loggerOr(r.config.Logger)
+}
+
+// failure describes why an attempt failed, without the response body
+func failure(resp *http.Response, err error) string {
+	if err != nil {
+		return errorOf(err).Error()
+	}
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		return resp.Status
+	}
+	return "transient JSON-RPC error"
+}
+
+// policy returns the policy of the method of a single call, and the most
+// restrictive policy among the methods of a batch
+func (r *Retrier) policy(msgs []*rpcMessage) RetryPolicy {
+	if len(msgs) == 1 {
+		if p, ok := r.config.Methods[msgs[0].Method]; ok {
+			return p
+		}
+		return r.config.Default
+	}
+
+	policy := r.config.Default
+	for _, msg := range msgs {
+		if p, ok := r.config.Methods[msg.Method]; ok && p.MaxAttempts < policy.MaxAttempts {
+			policy = p
+		}
+	}
+	return policy
+}
+
+// attempt sends the request once and classifies the outcome.
+// The response body is read so JSON-RPC errors can be inspected.
+func (r *Retrier) attempt(req *http.Request, body []byte) (*http.Response, []byte, ErrorClass, error) {
+	resp, err := r.transport.RoundTrip(cloneRequest(req, body))
+	if err != nil {
+		return nil, nil, ClassifyError(err, 0, nil), err
+	}
+
+	respBody, err := readResponseBody(resp)
+	if err != nil {
+		return nil, nil, ClassifyError(err, 0, nil), err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, respBody, ClassifyError(nil, resp.StatusCode, nil), nil
+	}
+
+	msgs, _, err := decodeRPCMessages(respBody)
+	if err != nil {
+		return resp, respBody, ClassPermanent, nil
+	}
+	class := ClassOK
+	for _, msg := range msgs {
+		if c := ClassifyError(nil, resp.StatusCode, msg.Error); c > class {
+			class = c
+		}
+	}
+	return resp, respBody, class, nil
+}
+
+// sendRawTransaction retries a transaction broadcast, checking by hash
+// whether a previous attempt was accepted before sending it again
+func (r *Retrier) sendRawTransaction(req *http.Request, body []byte, msg *rpcMessage, policy RetryPolicy) (*http.Response, error) {
+	var params []hexutil.Bytes
+	if err := json.Unmarshal(msg.Params, &params); err != nil || len(params) != 1 {
+		return r.transport.RoundTrip(req)
+	}
+	txHash := common.BytesToHash(crypto.Keccak256(params[0]))
+
+	for attempt := 1; ; attempt++ {
+		resp, respBody, class, err := r.attempt(req, body)
+		if class == ClassOK {
+			return finish(req, resp, respBody, err)
+		}
+		if class == ClassPermanent && !isAlreadyKnown(respBody) {
+			return finish(req, resp, respBody, err)
+		}
+
+		known, lookupErr := r.transactionKnown(req, txHash)
+		if lookupErr == nil && known {
+			r.logger().Info("Transaction already accepted by the node", append(requestAttrs([]*rpcMessage{msg}),
+				"endpoint", req.URL.Host, "attempt", attempt, "tx", txHash.Hex())...)
+			result, _ := json.Marshal(&rpcMessage{Version: "2.0", ID: msg.ID, Result: json.RawMessage(`"` + txHash.Hex() + `"`)})
+			return newRPCResponse(req, result), nil
+		}
+		wait := retryAfter(resp)
+		if attempt >= policy.MaxAttempts || policy.MaxDelay > 0 && wait > policy.MaxDelay {
+			return finish(req, resp, respBody, err)
+		}
+		if err := sleepBackOff(req.Context(), policy, attempt, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// transactionKnown asks the node whether it knows a transaction hash
+func (r *Retrier) transactionKnown(req *http.Request, txHash common.Hash) (bool, error) {
+	lookup := []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["%s"]}`, txHash.Hex()))
+	resp, err := r.transport.RoundTrip(cloneRequest(req, lookup))
+	if err != nil {
+		return false, err
+	}
+	respBody, err := readResponseBody(resp)
+	if err != nil {
+		return false, err
+	}
+	msgs, _, err := decodeRPCMessages(respBody)
+	if err != nil {
+		return false, err
+	}
+	if msgs[0].Error != nil {
+		return false, msgs[0].Error
+	}
+	return len(msgs[0].Result) > 0 && string(msgs[0].Result) != "null", nil
+}
+
+// isAlreadyKnown tells whether a broadcast failed because the node already has the transaction
+func isAlreadyKnown(respBody []byte) bool {
+	msgs, _, err := decodeRPCMessages(respBody)
+	if err != nil || msgs[0].Error == nil {
+		return false
+	}
+	message := strings.ToLower(msgs[0].Error.Message)
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
+}
+
+// finish rebuilds the response of the last attempt
+func finish(req *http.Request, resp *http.Response, respBody []byte, err error) (*http.Response, error) {
+	if err != nil {
+		return nil, err
+	}
+	out := newRPCResponse(req, respBody)
+	out.Status = resp.Status
+	out.StatusCode = resp.StatusCode
+	out.Header = resp.Header
+	return out, nil
+}
+
+// retryAfter returns the delay asked by a throttled answer, zero if none
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil || resp.Header.Get("Retry-After") == "" {
+		return 0
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"))
+}
+
+// sleepBackOff waits a random delay up to the exponential back off of the
+// attempt, and at least minimum
+func sleepBackOff(ctx context.Context, policy RetryPolicy, attempt int, minimum time.Duration) error {
+	ceiling := policy.BaseDelay << uint(attempt-1)
+	if ceiling <= 0 && policy.BaseDelay > 0 {
+		// The shift overflowed
+		ceiling = time.Duration(1<<63 - 1)
+	}
+	if policy.MaxDelay > 0 && ceiling > policy.MaxDelay {
+		ceiling = policy.MaxDelay
+	}
+	var delay time.Duration
+	if ceiling > 0 {
+		delay = time.Duration(rand.Int63n(int64(ceiling)) + 1)
+	}
+	if delay < minimum {
+		delay = minimum
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,124 @@
+package pyweb3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// rpcMessage is a JSON-RPC 2.0 request or response as seen on the wire
+type rpcMessage struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is the error object of a JSON-RPC 2.0 response
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// decodeRPCMessages parses a single JSON-RPC message or a batch of them.
+// The boolean result reports whether the body was a batch.
+func decodeRPCMessages(body []byte) ([]*rpcMessage, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var msgs []*rpcMessage
+		if err := json.Unmarshal(body, &msgs); err != nil {
+			return nil, true, fmt.Errorf("invalid JSON-RPC batch: %v", err)
+		}
+		return msgs, true, nil
+	}
+
+	msg := new(rpcMessage)
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, false, fmt.Errorf("invalid JSON-RPC message: %v", err)
+	}
+	return []*rpcMessage{msg}, false, nil
+}
+
+// encodeRPCMessages is the reverse of decodeRPCMessages
+func encodeRPCMessages(msgs []*rpcMessage, batch bool) ([]byte, error) {
+	if batch {
+		return json.Marshal(msgs)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("expected a single JSON-RPC message, got %d", len(msgs))
+	}
+	return json.Marshal(msgs[0])
+}
+
+// resultKey returns a canonical form of a response used to compare answers
+// from different requests or endpoints, ignoring the message id
+func (m *rpcMessage) resultKey() string {
+	if m.Error != nil {
+		return fmt.Sprintf("error:%d:%s", m.Error.Code, m.Error.Message)
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, m.Result); err != nil {
+		return string(m.Result)
+	}
+	return buf.String()
+}
+
+// readRequestBody reads the request body and puts a fresh reader back in
+// place so the request can still be sent afterwards
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// readResponseBody reads and closes the response body
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	return body, nil
+}
+
+// cloneRequest returns a copy of req carrying the given body
+func cloneRequest(req *http.Request, body []byte) *http.Request {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	out.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return out
+}
+
+// newRPCResponse builds a successful HTTP response to req carrying body
+func newRPCResponse(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,131 @@
+package rpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Fixture is a recorded JSON-RPC call and its reply
+type Fixture struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *Error          `json:"error,omitempty"`
+}
+
+// key identifies the call of a fixture, ignoring the formatting of params
+func (f Fixture) key() string {
+	params := compactJSON(f.Params)
+	if params == "" {
+		params = "[]"
+	}
+	return f.Method + " " + params
+}
+
+// Recorder is an http.RoundTripper capturing the JSON-RPC traffic it
+// carries as fixtures, to be saved and replayed by a MockNode. Set it as
+// the transport of a client to record against a real node.
+type Recorder struct {
+	next     http.RoundTripper
+	mutex    sync.Mutex
+	fixtures []Fixture
+}
+
+// NewRecorder creates a recorder sending the requests through next,
+// http.DefaultTransport if nil
+func NewRecorder(next http.RoundTripper) *Recorder {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Recorder{next: next}
+}
+
+// RoundTrip sends the request and records the calls answered in the response
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+	}
+	forward := req.Clone(req.Context())
+	forward.Body = io.NopCloser(bytes.NewReader(body))
+	forward.ContentLength = int64(len(body))
+	resp, err := r.next.RoundTrip(forward)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	calls, _, err := decodeMessages(body)
+	if err != nil {
+		return resp, nil
+	}
+	replies, _, err := decodeMessages(respBody)
+	if err != nil {
+		return resp, nil
+	}
+	byID := make(map[string]*message, len(replies))
+	for _, reply := range replies {
+		byID[compactJSON(reply.ID)] = reply
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, call := range calls {
+		if reply, ok := byID[compactJSON(call.ID)]; ok {
+			r.fixtures = append(r.fixtures, Fixture{Method: call.Method, Params: call.Params, Result: reply.Result, Error: reply.Error})
+		}
+	}
+	return resp, nil
+}
+
+// Fixtures returns the calls recorded so far, in the order they were answered
+func (r *Recorder) Fixtures() []Fixture {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Fixture(nil), r.fixtures...)
+}
+
+// Save writes the recorded calls to a fixture file
+func (r *Recorder) Save(path string) error {
+	return SaveFixtures(path, r.Fixtures())
+}
+
+// SaveFixtures writes fixtures to a file as indented JSON
+func SaveFixtures(path string, fixtures []Fixture) error {
+	data, err := json.MarshalIndent(fixtures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fixtures: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixtures: %v", err)
+	}
+	return nil
+}
+
+// LoadFixtures reads a fixture file written by SaveFixtures
+func LoadFixtures(path string) ([]Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %v", err)
+	}
+	var fixtures []Fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("invalid fixture file %s: %v", path, err)
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,76 @@
+package rpctest
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+func TestRecorder_RecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	var blocks int32
+	live := startNode(t).
+		Handle("eth_blockNumber", func([]json.RawMessage) (interface{}, error) {
+			return atomic.AddInt32(&blocks, 1), nil
+		}).
+		Respond("eth_getBalance", "0x2a").
+		Fail("eth_gasPrice", -32005, "limit exceeded")
+
+	// record against the stand-in for a real node
+	recorder := NewRecorder(nil)
+	client := pyweb3.NewJSONRPCClient(live.URL(), "", 0)
+	client.Transport = recorder
+
+	var number int
+	var balance, price string
+	require.NoError(t, client.CallContext(ctx, &number, "eth_blockNumber"))
+	require.NoError(t, client.CallContext(ctx, &number, "eth_blockNumber"))
+	require.NoError(t, client.BatchCallContext(ctx, []rpc.BatchElem{
+		{Method: "eth_getBalance", Args: []interface{}{"0x0000000000000000000000000000000000000001", "latest"}, Result: &balance},
+		{Method: "eth_gasPrice", Result: &price},
+	}))
+	assert.Len(t, recorder.Fixtures(), 4)
+
+	path := filepath.Join(t.TempDir(), "node.json")
+	require.NoError(t, recorder.Save(path))
+	fixtures, err := LoadFixtures(path)
+	require.NoError(t, err)
+	want, _ := json.Marshal(recorder.Fixtures())
+	got, _ := json.Marshal(fixtures)
+	assert.JSONEq(t, string(want), string(got))
+
+	// replay without the live node, twice to check it is deterministic
+	for i := 0; i < 2; i++ {
+		replay := startNode(t).Replay(fixtures)
+		client := pyweb3.NewJSONRPCClient(replay.URL(), "", 0)
+
+		var first, second, third int
+		require.NoError(t, client.CallContext(ctx, &first, "eth_blockNumber"))
+		require.NoError(t, client.CallContext(ctx, &second, "eth_blockNumber"))
+		require.NoError(t, client.CallContext(ctx, &third, "eth_blockNumber"))
+		assert.Equal(t, []int{1, 2, 2}, []int{first, second, third})
+
+		balance = ""
+		require.NoError(t, client.CallContext(ctx, &balance, "eth_getBalance", "0x0000000000000000000000000000000000000001", "latest"))
+		assert.Equal(t, "0x2a", balance)
+		err := client.CallContext(ctx, &price, "eth_gasPrice")
+		assert.Equal(t, &pyweb3.RPCError{Code: -32005, Message: "limit exceeded"}, err)
+
+		// other params were never recorded
+		err = client.CallContext(ctx, &balance, "eth_getBalance", "0x0000000000000000000000000000000000000002", "latest")
+		assert.Equal(t, -32601, err.(*pyweb3.RPCError).Code)
+	}
+}
+
+func TestLoadFixtures_Invalid(t *testing.T) {
+	_, err := LoadFixtures(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package rpctest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// message is a JSON-RPC 2.0 request, response or notification
+type message struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error object of a JSON-RPC 2.0 response. Handlers return it
+// to send a given code and data.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("JSON-RPC error %d: %s", e.Code, e.Message)
+}
+
+// ErrorCode implements rpc.Error
+func (e *Error) ErrorCode() int {
+	return e.Code
+}
+
+// decodeMessages parses a single JSON-RPC message or a batch of them. The
+// boolean result reports whether the body was a batch.
+func decodeMessages(body []byte) ([]*message, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var msgs []*message
+		if err := json.Unmarshal(body, &msgs); err != nil {
+			return nil, true, fmt.Errorf("invalid JSON-RPC batch: %v", err)
+		}
+		return msgs, true, nil
+	}
+
+	msg := new(message)
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, false, fmt.Errorf("invalid JSON-RPC message: %v", err)
+	}
+	return []*message{msg}, false, nil
+}
+
+// encodeMessages is the reverse of decodeMessages
+func encodeMessages(msgs []*message, batch bool) ([]byte, error) {
+	if batch {
+		return json.Marshal(msgs)
+	}
+	if len(msgs) != 1 {
+		return nil, fmt.Errorf("expected a single JSON-RPC message, got %d", len(msgs))
+	}
+	return json.Marshal(msgs[0])
+}
+
+// compactJSON returns raw without insignificant spaces, as a map key
+func compactJSON(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
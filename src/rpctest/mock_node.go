@@ -0,0 +1,382 @@
+// Package rpctest serves scripted and recorded JSON-RPC nodes for tests. It
+// lives apart from the client so that programs do not link it.
+package rpctest
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// MockHandler answers a call to a MockNode. Returning an *Error sends that
+// error, any other error is sent with code -32000.
+type MockHandler func(params []json.RawMessage) (interface{}, error)
+
+// MockNode is an in-process JSON-RPC node for tests, served over HTTP and
+// WebSocket on the same address. Each method is scripted with a handler.
+type MockNode struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	handlers map[string]MockHandler
+	latency  map[string]time.Duration
+	drops    map[string]int
+	calls    map[string]int
+	replay   map[string][]Fixture
+	reverse  bool
+	greeting []string
+	inspect  func(*http.Request)
+	conns    map[*mockConn]struct{}
+}
+
+// mockConn is a WebSocket connection, whose writes come from both the
+// serving loop and Notify
+type mockConn struct {
+	ws    *websocket.Conn
+	mutex sync.Mutex
+}
+
+func (c *mockConn) send(msg []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return websocket.Message.Send(c.ws, string(msg))
+}
+
+// NewMockNode starts a mock node on a local plain HTTP address
+func NewMockNode() *MockNode {
+	n := newMockNode()
+	n.server = httptest.NewServer(n)
+	return n
+}
+
+// NewTLSMockNode starts a mock node on a local HTTPS address, whose
+// certificate is trusted by CertPool
+func NewTLSMockNode() *MockNode {
+	n := newMockNode()
+	n.server = httptest.NewTLSServer(n)
+	return n
+}
+
+func newMockNode() *MockNode {
+	return &MockNode{
+		handlers: make(map[string]MockHandler),
+		latency:  make(map[string]time.Duration),
+		drops:    make(map[string]int),
+		calls:    make(map[string]int),
+		replay:   make(map[string][]Fixture),
+		conns:    make(map[*mockConn]struct{}),
+	}
+}
+
+// URL returns the HTTP address of the node
+func (n *MockNode) URL() string {
+	return n.server.URL
+}
+
+// WSURL returns the WebSocket address of the node
+func (n *MockNode) WSURL() string {
+	return "ws" + strings.TrimPrefix(n.server.URL, "http")
+}
+
+// CertPool returns a pool trusting the certificate of a TLS node
+func (n *MockNode) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	if cert := n.server.Certificate(); cert != nil {
+		pool.AddCert(cert)
+	}
+	return pool
+}
+
+// Close shuts the node down and drops its connections
+func (n *MockNode) Close() {
+	n.mutex.Lock()
+	for conn := range n.conns {
+		conn.ws.Close()
+	}
+	n.mutex.Unlock()
+	n.server.Close()
+}
+
+// Handle scripts a method with a handler
+func (n *MockNode) Handle(method string, handler MockHandler) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.handlers[method] = handler
+	return n
+}
+
+// Respond scripts a method to always return result
+func (n *MockNode) Respond(method string, result interface{}) *MockNode {
+	return n.Handle(method, func([]json.RawMessage) (interface{}, error) {
+		return result, nil
+	})
+}
+
+// Fail scripts a method to always return a JSON-RPC error
+func (n *MockNode) Fail(method string, code int, message string) *MockNode {
+	return n.Handle(method, func([]json.RawMessage) (interface{}, error) {
+		return nil, &Error{Code: code, Message: message}
+	})
+}
+
+// SetLatency delays the replies to a method, or to every method if empty
+func (n *MockNode) SetLatency(method string, latency time.Duration) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.latency[method] = latency
+	return n
+}
+
+// DropNext closes the connection instead of answering the next count calls
+// to a method, or to any method if empty
+func (n *MockNode) DropNext(method string, count int) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.drops[method] = count
+	return n
+}
+
+// ReverseBatches answers batches with the replies in reverse order, which
+// clients must match by id
+func (n *MockNode) ReverseBatches(reverse bool) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.reverse = reverse
+	return n
+}
+
+// Greet sends messages to every WebSocket connection when it opens
+func (n *MockNode) Greet(messages ...string) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.greeting = messages
+	return n
+}
+
+// Inspect calls inspect with every HTTP request and WebSocket handshake
+// before answering it, such as to check the headers a client sends
+func (n *MockNode) Inspect(inspect func(r *http.Request)) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.inspect = inspect
+	return n
+}
+
+// Replay answers calls without a handler from recorded fixtures. Calls with
+// the same method and params get the recorded replies in order, the last
+// one repeating once they run out.
+func (n *MockNode) Replay(fixtures []Fixture) *MockNode {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	for _, fixture := range fixtures {
+		key := fixture.key()
+		n.replay[key] = append(n.replay[key], fixture)
+	}
+	return n
+}
+
+// Calls returns how many times a method was called, or all methods if empty
+func (n *MockNode) Calls(method string) int {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if method != "" {
+		return n.calls[method]
+	}
+	total := 0
+	for _, count := range n.calls {
+		total += count
+	}
+	return total
+}
+
+// Notify pushes a subscription notification to every WebSocket connection
+func (n *MockNode) Notify(subscription string, result interface{}) error {
+	params, err := json.Marshal(map[string]interface{}{"subscription": subscription, "result": result})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %v", err)
+	}
+	msg, _ := json.Marshal(&message{Version: "2.0", Method: "eth_subscription", Params: params})
+
+	n.mutex.Lock()
+	conns := make([]*mockConn, 0, len(n.conns))
+	for conn := range n.conns {
+		conns = append(conns, conn)
+	}
+	n.mutex.Unlock()
+
+	for _, conn := range conns {
+		if err := conn.send(msg); err != nil {
+			return fmt.Errorf("failed to notify: %v", err)
+		}
+	}
+	return nil
+}
+
+// ServeHTTP answers JSON-RPC over HTTP POST and upgrades WebSocket requests
+func (n *MockNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mutex.Lock()
+	inspect := n.inspect
+	n.mutex.Unlock()
+	if inspect != nil {
+		inspect(r)
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		// no Handshake, so that clients without an Origin are accepted
+		websocket.Server{Handler: n.serveWebSocket}.ServeHTTP(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	out, drop := n.answer(body)
+	if drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+func (n *MockNode) serveWebSocket(ws *websocket.Conn) {
+	conn := &mockConn{ws: ws}
+	n.mutex.Lock()
+	n.conns[conn] = struct{}{}
+	greeting := n.greeting
+	n.mutex.Unlock()
+
+	defer func() {
+		n.mutex.Lock()
+		delete(n.conns, conn)
+		n.mutex.Unlock()
+		ws.Close()
+	}()
+
+	for _, msg := range greeting {
+		if err := conn.send([]byte(msg)); err != nil {
+			return
+		}
+	}
+	for {
+		var body []byte
+		if err := websocket.Message.Receive(ws, &body); err != nil {
+			return
+		}
+		out, drop := n.answer(body)
+		if drop || conn.send(out) != nil {
+			return
+		}
+	}
+}
+
+// answer runs the handlers for a request body and encodes the replies. The
+// boolean result reports that the connection must be dropped instead.
+func (n *MockNode) answer(body []byte) ([]byte, bool) {
+	msgs, batch, err := decodeMessages(body)
+	if err != nil {
+		out, _ := json.Marshal(&message{Version: "2.0", ID: json.RawMessage("null"), Error: &Error{Code: -32700, Message: err.Error()}})
+		return out, false
+	}
+
+	replies := make([]*message, len(msgs))
+	drop := false
+	for i, msg := range msgs {
+		reply, dropped := n.call(msg)
+		replies[i] = reply
+		drop = drop || dropped
+	}
+	if drop {
+		return nil, true
+	}
+
+	n.mutex.Lock()
+	reverse := n.reverse
+	n.mutex.Unlock()
+	if batch && reverse {
+		for i, j := 0, len(replies)-1; i < j; i, j = i+1, j-1 {
+			replies[i], replies[j] = replies[j], replies[i]
+		}
+	}
+	out, _ := encodeMessages(replies, batch)
+	return out, false
+}
+
+// call answers a single message
+func (n *MockNode) call(msg *message) (*message, bool) {
+	n.mutex.Lock()
+	n.calls[msg.Method]++
+	drop := false
+	for _, method := range []string{msg.Method, ""} {
+		if n.drops[method] > 0 {
+			n.drops[method]--
+			drop = true
+			break
+		}
+	}
+	latency, ok := n.latency[msg.Method]
+	if !ok {
+		latency = n.latency[""]
+	}
+	handler := n.handlers[msg.Method]
+	fixture, replayed := n.nextFixture(msg)
+	n.mutex.Unlock()
+
+	time.Sleep(latency)
+	if drop {
+		return nil, true
+	}
+
+	reply := &message{Version: "2.0", ID: msg.ID}
+	switch {
+	case handler != nil:
+		var params []json.RawMessage
+		json.Unmarshal(msg.Params, &params)
+		result, err := handler(params)
+		if err != nil {
+			rpcErr, ok := err.(*Error)
+			if !ok {
+				rpcErr = &Error{Code: -32000, Message: err.Error()}
+			}
+			reply.Error = rpcErr
+			break
+		}
+		if reply.Result, err = json.Marshal(result); err != nil {
+			reply.Error = &Error{Code: -32603, Message: fmt.Sprintf("failed to encode result: %v", err)}
+		}
+	case replayed:
+		reply.Result, reply.Error = fixture.Result, fixture.Error
+	default:
+		reply.Error = &Error{Code: -32601, Message: fmt.Sprintf("the method %s does not exist/is not available", msg.Method)}
+	}
+	return reply, false
+}
+
+// nextFixture pops the recorded reply to a message, keeping the last one.
+// The caller holds the mutex.
+func (n *MockNode) nextFixture(msg *message) (Fixture, bool) {
+	key := Fixture{Method: msg.Method, Params: msg.Params}.key()
+	queue := n.replay[key]
+	if len(queue) == 0 {
+		return Fixture{}, false
+	}
+	if len(queue) > 1 {
+		n.replay[key] = queue[1:]
+	}
+	return queue[0], true
+}
@@ -0,0 +1,120 @@
+package rpctest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+func startNode(t *testing.T) *MockNode {
+	node := NewMockNode()
+	t.Cleanup(node.Close)
+	return node
+}
+
+func TestMockNode(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("http and websocket", func(t *testing.T) {
+		node := startNode(t).Respond("eth_chainId", "0x1").Respond("eth_blockNumber", "0x10")
+		for _, url := range []string{node.URL(), node.WSURL()} {
+			client, err := pyweb3.NewWeb3Client(url)
+			require.NoError(t, err)
+			number, err := client.BlockNumber(ctx)
+			client.Close()
+			require.NoError(t, err, url)
+			assert.Equal(t, uint64(16), number, url)
+		}
+		assert.Equal(t, 2, node.Calls("eth_blockNumber"))
+	})
+
+	t.Run("handlers and errors", func(t *testing.T) {
+		node := startNode(t).
+			Handle("eth_getBalance", func(params []json.RawMessage) (interface{}, error) {
+				var address common.Address
+				json.Unmarshal(params[0], &address)
+				if address == (common.Address{}) {
+					return nil, errors.New("zero address")
+				}
+				return "0x2a", nil
+			}).
+			Fail("eth_gasPrice", -32005, "limit exceeded")
+		client := pyweb3.NewJSONRPCClient(node.URL(), "", 0)
+
+		var balance string
+		require.NoError(t, client.CallContext(ctx, &balance, "eth_getBalance", common.HexToAddress("0x1"), "latest"))
+		assert.Equal(t, "0x2a", balance)
+
+		err := client.CallContext(ctx, &balance, "eth_getBalance", common.Address{}, "latest")
+		assert.Equal(t, &pyweb3.RPCError{Code: -32000, Message: "zero address"}, err)
+		err = client.CallContext(ctx, &balance, "eth_gasPrice")
+		assert.Equal(t, &pyweb3.RPCError{Code: -32005, Message: "limit exceeded"}, err)
+		err = client.CallContext(ctx, &balance, "eth_unknown")
+		assert.Equal(t, -32601, err.(*pyweb3.RPCError).Code)
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		node := startNode(t).Respond("eth_blockNumber", "0x1").SetLatency("eth_blockNumber", 300*time.Millisecond)
+		client := pyweb3.NewJSONRPCClient(node.URL(), "", 0)
+
+		ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		var number string
+		assert.ErrorIs(t, client.CallContext(ctx, &number, "eth_blockNumber"), context.DeadlineExceeded)
+	})
+
+	t.Run("dropped connection", func(t *testing.T) {
+		node := startNode(t).Respond("eth_blockNumber", "0x1").DropNext("eth_blockNumber", 1)
+		var number string
+		assert.Error(t, pyweb3.NewJSONRPCClient(node.URL(), "", 0).CallContext(ctx, &number, "eth_blockNumber"))
+
+		node.DropNext("", 1)
+		require.NoError(t, pyweb3.NewJSONRPCClient(node.URL(), "", 1).CallContext(ctx, &number, "eth_blockNumber"))
+		assert.Equal(t, "0x1", number)
+		assert.Equal(t, 3, node.Calls(""))
+	})
+
+	t.Run("out of order batch", func(t *testing.T) {
+		node := startNode(t).Respond("eth_blockNumber", "0x1").Respond("eth_gasPrice", "0x2").ReverseBatches(true)
+		var number, price string
+		batch := []rpc.BatchElem{
+			{Method: "eth_blockNumber", Result: &number},
+			{Method: "eth_gasPrice", Result: &price},
+		}
+		require.NoError(t, pyweb3.NewJSONRPCClient(node.URL(), "", 0).BatchCallContext(ctx, batch))
+		assert.Equal(t, "0x1", number)
+		assert.Equal(t, "0x2", price)
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		node := startNode(t).Respond("eth_chainId", "0x1").Respond("eth_subscribe", "0xabc")
+		client, err := pyweb3.NewWeb3Client(node.WSURL())
+		require.NoError(t, err)
+		defer client.Close()
+
+		logs := make(chan types.Log, 1)
+		sub, err := client.SubscribeFilterLogs(ctx, ethereum.FilterQuery{}, logs)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		sent := types.Log{Address: common.HexToAddress("0x1234"), Topics: []common.Hash{}, Data: []byte{}}
+		require.NoError(t, node.Notify("0xabc", sent))
+		select {
+		case got := <-logs:
+			assert.Equal(t, sent.Address, got.Address)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no notification")
+		}
+	})
+}
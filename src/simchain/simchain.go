@@ -0,0 +1,243 @@
+// Package simchain provides an in-memory chain for tests, built on
+// go-ethereum's simulated backend. It lives apart from the client so that
+// programs using the client do not link a whole node.
+package simchain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+// ChainID is the chain id of a Chain
+const ChainID = 1337
+
+// Account is a funded account of a Chain
+type Account struct {
+	Address common.Address
+	Key     *ecdsa.PrivateKey
+}
+
+// Config configures a Chain
+type Config struct {
+	// Number of funded accounts, 10 if zero
+	Accounts int
+	// Balance of every account, 1000 ether if nil
+	Balance *big.Int
+	// Extra genesis accounts, such as predeployed contracts
+	Alloc core.GenesisAlloc
+	// Mine a block after every transaction sent through the client,
+	// otherwise blocks are mined by calling Commit
+	Instant bool
+}
+
+// Chain is a simulated chain with funded accounts. The accounts derive
+// from fixed seeds, so addresses are the same on every run.
+type Chain struct {
+	backend  *simulated.Backend
+	client   *pyweb3.Web3Client
+	accounts []Account
+	ipcDir   string
+	mutex    sync.Mutex
+	instant  bool
+}
+
+// New creates a simulated chain with funded accounts
+func New(config Config) (*Chain, error) {
+	if config.Accounts == 0 {
+		config.Accounts = 10
+	}
+	if config.Balance == nil {
+		config.Balance = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))
+	}
+
+	alloc := core.GenesisAlloc{}
+	for address, account := range config.Alloc {
+		alloc[address] = account
+	}
+	accounts := make([]Account, config.Accounts)
+	for i := range accounts {
+		key, err := crypto.ToECDSA(crypto.Keccak256([]byte(fmt.Sprintf("simulated account %d", i))))
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive account %d: %v", i, err)
+		}
+		accounts[i] = Account{Address: crypto.PubkeyToAddress(key.PublicKey), Key: key}
+		alloc[accounts[i].Address] = core.GenesisAccount{Balance: config.Balance}
+	}
+
+	if _, known := pyweb3.LookupChain(ChainID); !known {
+		pyweb3.RegisterChain(pyweb3.ChainProfile{
+			ChainID: ChainID, Name: "Simulated", Currency: pyweb3.NativeCurrency{Name: "Ether", Symbol: "ETH", Decimals: 18},
+			BlockTime: time.Second, FinalityDepth: 1, EIP1559: true,
+		})
+	}
+
+	// the backend keeps its node to itself, so the client dials the node's
+	// ipc endpoint, which the options of the backend can place
+	dir, err := os.MkdirTemp("", "simchain")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ipc directory: %v", err)
+	}
+	endpoint := filepath.Join(dir, "node.ipc")
+	sc := &Chain{
+		backend: simulated.NewBackend(alloc, func(nodeConf *node.Config, _ *ethconfig.Config) {
+			nodeConf.IPCPath = endpoint
+		}),
+		accounts: accounts,
+		ipcDir:   dir,
+		instant:  config.Instant,
+	}
+	rpcClient, err := rpc.Dial(endpoint)
+	if err != nil {
+		sc.backend.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to dial simulated node: %v", err)
+	}
+	client, err := pyweb3.NewWeb3ClientFromTransport(&minerTransport{rpcClient: rpcClient, chain: sc})
+	if err != nil {
+		rpcClient.Close()
+		sc.backend.Close()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create simulated client: %v", err)
+	}
+	sc.client = client
+	return sc, nil
+}
+
+// Client returns a Web3Client connected to the chain
+func (sc *Chain) Client() *pyweb3.Web3Client {
+	return sc.client
+}
+
+// Accounts returns the funded accounts
+func (sc *Chain) Accounts() []Account {
+	return sc.accounts
+}
+
+// TransactOpts returns signing options for the i-th account
+func (sc *Chain) TransactOpts(i int) (*bind.TransactOpts, error) {
+	if i < 0 || i >= len(sc.accounts) {
+		return nil, fmt.Errorf("no simulated account %d", i)
+	}
+	return bind.NewKeyedTransactorWithChainID(sc.accounts[i].Key, big.NewInt(ChainID))
+}
+
+// SetInstant switches between instant and manual mining
+func (sc *Chain) SetInstant(instant bool) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.instant = instant
+}
+
+// Commit mines a block with the pending transactions and returns its hash
+func (sc *Chain) Commit() common.Hash {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return sc.backend.Commit()
+}
+
+// Rollback drops the pending transactions
+func (sc *Chain) Rollback() {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	sc.backend.Rollback()
+}
+
+// AdjustTime mines an empty block whose timestamp is moved forward
+func (sc *Chain) AdjustTime(adjustment time.Duration) error {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	return sc.backend.AdjustTime(adjustment)
+}
+
+// Reorg replaces the last depth blocks with a longer chain of empty blocks,
+// dropping the transactions they held. Pending transactions must be mined
+// or rolled back first.
+func (sc *Chain) Reorg(ctx context.Context, depth uint64) error {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+
+	head, err := sc.client.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get head: %v", err)
+	}
+	if depth == 0 || depth > head {
+		return fmt.Errorf("cannot reorg %d blocks at height %d", depth, head)
+	}
+	ancestor, err := sc.client.HeaderByNumber(ctx, new(big.Int).SetUint64(head-depth))
+	if err != nil {
+		return fmt.Errorf("failed to get block %d: %v", head-depth, err)
+	}
+	if err := sc.backend.Fork(ancestor.Hash()); err != nil {
+		return fmt.Errorf("failed to fork: %v", err)
+	}
+	for i := uint64(0); i <= depth; i++ {
+		sc.backend.Commit()
+	}
+	return nil
+}
+
+// Close stops the chain and its client
+func (sc *Chain) Close() error {
+	sc.client.Close()
+	err := sc.backend.Close()
+	os.RemoveAll(sc.ipcDir)
+	return err
+}
+
+// minerTransport mines a block after each sent transaction when the chain
+// mines instantly
+type minerTransport struct {
+	rpcClient *rpc.Client
+	chain     *Chain
+}
+
+func (t *minerTransport) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	err := t.rpcClient.CallContext(ctx, result, method, args...)
+	if err == nil && method == "eth_sendRawTransaction" {
+		t.mine()
+	}
+	return err
+}
+
+func (t *minerTransport) BatchCallContext(ctx context.Context, b []rpc.BatchElem) error {
+	if err := t.rpcClient.BatchCallContext(ctx, b); err != nil {
+		return err
+	}
+	for _, elem := range b {
+		if elem.Error == nil && elem.Method == "eth_sendRawTransaction" {
+			t.mine()
+			break
+		}
+	}
+	return nil
+}
+
+func (t *minerTransport) Close() {
+	t.rpcClient.Close()
+}
+
+func (t *minerTransport) mine() {
+	t.chain.mutex.Lock()
+	defer t.chain.mutex.Unlock()
+	if t.chain.instant {
+		t.chain.backend.Commit()
+	}
+}
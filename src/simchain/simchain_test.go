@@ -0,0 +1,111 @@
+package simchain
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pyweb3 "web3-rpc-client/src"
+)
+
+func newChain(t *testing.T, instant bool) *Chain {
+	sc, err := New(Config{Accounts: 2, Instant: instant})
+	require.NoError(t, err)
+	t.Cleanup(func() { sc.Close() })
+	return sc
+}
+
+// sendSigned builds a transfer between the two accounts and sends it signed
+func sendSigned(t *testing.T, sc *Chain, amount *big.Int) *types.Transaction {
+	ctx := context.Background()
+	from, to := sc.Accounts()[0], sc.Accounts()[1]
+
+	tx, err := sc.Client().SendTransaction(ctx, from.Address, to.Address, amount)
+	require.NoError(t, err)
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(big.NewInt(ChainID)), from.Key)
+	require.NoError(t, err)
+	require.NoError(t, sc.Client().SendRawTransaction(ctx, signed))
+	return signed
+}
+
+func TestChain(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("funded accounts", func(t *testing.T) {
+		sc := newChain(t, true)
+		again := newChain(t, true)
+		assert.Equal(t, sc.Accounts(), again.Accounts())
+
+		balance, err := sc.Client().BalanceAt(ctx, sc.Accounts()[0].Address, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "1000000000000000000000", balance.String())
+
+		chain, err := sc.Client().Chain(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, "Simulated", chain.Name)
+	})
+
+	t.Run("instant mining", func(t *testing.T) {
+		sc := newChain(t, true)
+		tx := sendSigned(t, sc, big.NewInt(1000))
+
+		receipt, err := sc.Client().TransactionReceipt(ctx, tx.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, types.ReceiptStatusSuccessful, receipt.Status)
+
+		balance, err := sc.Client().BalanceAt(ctx, sc.Accounts()[1].Address, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "1000000000000000001000", balance.String())
+	})
+
+	t.Run("manual mining", func(t *testing.T) {
+		sc := newChain(t, false)
+		tx := sendSigned(t, sc, big.NewInt(1000))
+
+		receipt, err := sc.Client().TransactionReceipt(ctx, tx.Hash())
+		assert.Error(t, err)
+		assert.Nil(t, receipt)
+
+		sc.Commit()
+		receipt, err = sc.Client().TransactionReceipt(ctx, tx.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), receipt.BlockNumber.Uint64())
+	})
+
+	t.Run("watcher", func(t *testing.T) {
+		sc := newChain(t, true)
+		tx := sendSigned(t, sc, big.NewInt(1000))
+		sc.Commit()
+
+		receipt, err := pyweb3.NewTransactionWatcher(sc.Client(), 5*time.Second, 1).WaitForConfirmations(ctx, tx.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, tx.Hash(), receipt.TxHash)
+	})
+
+	t.Run("reorg", func(t *testing.T) {
+		sc := newChain(t, true)
+		tx := sendSigned(t, sc, big.NewInt(1000))
+		mined, err := sc.Client().HeaderByNumber(ctx, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, sc.Reorg(ctx, 1))
+
+		head, err := sc.Client().HeaderByNumber(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), head.Number.Uint64())
+		replaced, err := sc.Client().HeaderByNumber(ctx, mined.Number)
+		require.NoError(t, err)
+		assert.NotEqual(t, mined.Hash(), replaced.Hash())
+
+		_, err = sc.Client().TransactionReceipt(ctx, tx.Hash())
+		assert.Equal(t, ethereum.NotFound, err)
+
+		assert.Error(t, sc.Reorg(ctx, 10))
+	})
+}
@@ -6,8 +6,9 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
-	"log"
 	"time"
+
+	"golang.org/x/exp/slog"
 )
 
 const (
@@ -19,22 +20,27 @@ const (
 
 // TLSSocket represents a TLS socket client with a host, push and read data
 type TLSSocket struct {
-	conn *tls.Conn
+	conn   *tls.Conn
+	logger *slog.Logger
 }
 
 // NewTLSSocket creates a new TLS connection with a host domain:port
 func NewTLSSocket(domain string, port int) (*TLSSocket, error) {
-	conf := &tls.Config{
+	return NewTLSSocketWithConfig(domain, port, &tls.Config{
 		ServerName: domain,
-	}
+	})
+}
 
+// NewTLSSocketWithConfig creates a new TLS connection with a host
+// domain:port using a custom TLS configuration
+func NewTLSSocketWithConfig(domain string, port int, conf *tls.Config) (*TLSSocket, error) {
 	addr := fmt.Sprintf("%s:%d", domain, port)
 	conn, err := tls.Dial("tcp", addr, conf)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	log.Printf("Socket connected to %s", addr)
+	loggerOr(nil).Debug("Socket connected", "endpoint", addr)
 
 	// Set timeout
 	err = conn.SetDeadline(time.Now().Add(DefaultTimeout))
@@ -48,10 +54,16 @@ func NewTLSSocket(domain string, port int) (*TLSSocket, error) {
 	}, nil
 }
 
+// SetLogger sets the logger of the socket, nil meaning the package default.
+// The connection itself is logged by the package default.
+func (t *TLSSocket) SetLogger(logger *slog.Logger) {
+	t.logger = logger
+}
+
 // Close closes the socket connection
 func (t *TLSSocket) Close() error {
 	if t.conn != nil {
-		log.Println("Closing socket")
+		loggerOr(t.logger).Debug("Closing socket")
 		err := t.conn.Close()
 		t.conn = nil
 		return err
@@ -84,7 +96,7 @@ func (t *TLSSocket) Receive() ([]byte, error) {
 	n, err := t.conn.Read(buffer)
 	if err != nil {
 		if err == io.EOF {
-			log.Println("Socket disconnected")
+			loggerOr(t.logger).Debug("Socket disconnected")
 			t.Close()
 			return nil, fmt.Errorf("connection closed by peer")
 		}
@@ -92,7 +104,7 @@ func (t *TLSSocket) Receive() ([]byte, error) {
 	}
 
 	if n == 0 {
-		log.Println("Socket disconnected")
+		loggerOr(t.logger).Debug("Socket disconnected")
 		t.Close()
 		return nil, fmt.Errorf("connection closed by peer")
 	}
@@ -0,0 +1,101 @@
+package pyweb3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Transport carries JSON-RPC calls to a node. It is implemented by
+// JSONRPCClient and by *rpc.Client, the client under ethclient.
+type Transport interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+	Close()
+}
+
+// transportBridge is an http.RoundTripper answering the requests of an
+// rpc.Client from a Transport, so that ethclient runs over any Transport
+type transportBridge struct {
+	transport Transport
+}
+
+// RoundTrip decodes the calls of the request and answers them through the transport
+func (b *transportBridge) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	msgs, batch, err := decodeRPCMessages(body)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([]rpc.BatchElem, len(msgs))
+	for i, msg := range msgs {
+		var params []json.RawMessage
+		if len(msg.Params) > 0 {
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				return nil, fmt.Errorf("invalid %s params: %v", msg.Method, err)
+			}
+		}
+		args := make([]interface{}, len(params))
+		for j := range params {
+			args[j] = params[j]
+		}
+		calls[i] = rpc.BatchElem{Method: msg.Method, Args: args, Result: new(json.RawMessage)}
+	}
+
+	if batch {
+		err = b.transport.BatchCallContext(req.Context(), calls)
+	} else {
+		err = b.transport.CallContext(req.Context(), calls[0].Result, calls[0].Method, calls[0].Args...)
+		if _, ok := err.(rpc.Error); ok || errors.As(err, new(*RPCError)) {
+			calls[0].Error, err = err, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([]*rpcMessage, len(msgs))
+	for i, call := range calls {
+		replies[i] = &rpcMessage{Version: "2.0", ID: msgs[i].ID}
+		if call.Error != nil {
+			replies[i].Error = toRPCError(call.Error)
+			continue
+		}
+		replies[i].Result = *call.Result.(*json.RawMessage)
+		if len(replies[i].Result) == 0 {
+			replies[i].Result = json.RawMessage("null")
+		}
+	}
+	out, err := encodeRPCMessages(replies, batch)
+	if err != nil {
+		return nil, err
+	}
+	return newRPCResponse(req, out), nil
+}
+
+// toRPCError converts the error of a call back to its JSON-RPC form
+func toRPCError(err error) *RPCError {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	rpcErr = &RPCError{Code: -32603, Message: err.Error()}
+	if coded, ok := err.(rpc.Error); ok {
+		rpcErr.Code = coded.ErrorCode()
+	}
+	if dataErr, ok := err.(rpc.DataError); ok {
+		if data, err := json.Marshal(dataErr.ErrorData()); err == nil {
+			rpcErr.Data = data
+		}
+	}
+	return rpcErr
+}
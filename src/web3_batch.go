@@ -1,26 +1,36 @@
 package pyweb3
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"golang.org/x/exp/slog"
 )
 
 // BatchProcessor handles concurrent blockchain operations
 type BatchProcessor struct {
-	client     *Web3Client
-	batchSize  int
-	concurrent int
+	client          BatchBackend
+	batchSize       int
+	concurrent      int
+	sent            idempotencyLog
+	preflight       *PreflightConfig
+	logger          *slog.Logger
+	instrumentation Instrumentation
 }
 
-// NewBatchProcessor creates a new batch processor instance
-func NewBatchProcessor(client *Web3Client, batchSize, concurrent int) *BatchProcessor {
+// NewBatchProcessor creates a new batch processor instance. BatchTransfer
+// builds batchSize transfers at a time, all at once if zero, with at most
+// concurrent of them in flight.
+func NewBatchProcessor(client BatchBackend, batchSize, concurrent int) *BatchProcessor {
 	return &BatchProcessor{
 		client:     client,
 		batchSize:  batchSize,
@@ -28,6 +38,17 @@ func NewBatchProcessor(client *Web3Client, batchSize, concurrent int) *BatchProc
 	}
 }
 
+// SetInstrumentation sets the instrumentation of the processor, nil meaning
+// the package default
+func (bp *BatchProcessor) SetInstrumentation(instrumentation Instrumentation) {
+	bp.instrumentation = instrumentation
+}
+
+// SetLogger sets the logger of the processor, nil meaning the package default
+func (bp *BatchProcessor) SetLogger(logger *slog.Logger) {
+	bp.logger = logger
+}
+
 // BatchTransferResult represents the result of a batch transfer
 type BatchTransferResult struct {
 	To     common.Address
@@ -36,71 +57,133 @@ type BatchTransferResult struct {
 	Error  error
 }
 
-// BatchTransfer performs multiple transfers concurrently
-func (bp *BatchProcessor) BatchTransfer(from common.Address, transfers map[common.Address]*big.Int) []BatchTransferResult {
-	var (
-		results = make([]BatchTransferResult, 0, len(transfers))
-		mutex   = &sync.Mutex{}
-		wg      = &sync.WaitGroup{}
-		sem     = make(chan struct{}, bp.concurrent)
-	)
+// BatchTransfer builds multiple transfers from an address and returns the
+// results sorted by recipient. Transfers are built in batches of the batch
+// size of the processor, each finished before the next starts, with at most
+// concurrent transfers of a batch in flight. The transactions are not
+// signed, SignedBatchTransfer signs and sends them. With a preflight set,
+// the transfers are checked against the balance of from before any is built.
+func (bp *BatchProcessor) BatchTransfer(ctx context.Context, from common.Address, transfers map[common.Address]*big.Int) []BatchTransferResult {
+	instructions := nativeInstructions(transfers)
+	results := make([]BatchTransferResult, len(instructions))
+	for i, in := range instructions {
+		results[i] = BatchTransferResult{To: in.To, Amount: in.Amount}
+	}
+	instrumentationOr(bp.instrumentation).BatchSize(ctx, "transfer", len(transfers))
 
-	for to, amount := range transfers {
-		wg.Add(1)
-		sem <- struct{}{} // Acquire semaphore
-
-		go func(to common.Address, amount *big.Int) {
-			defer func() {
-				<-sem // Release semaphore
-				wg.Done()
-			}()
-
-			result := BatchTransferResult{
-				To:     to,
-				Amount: amount,
+	if bp.preflight != nil {
+		report, err := bp.directPreflight(ctx, from, instructions)
+		if err != nil {
+			for i := range results {
+				results[i].Error = err
 			}
+			return results
+		}
+		for _, i := range report.Dropped {
+			results[i].Error = ErrPreflightDropped
+		}
+	}
 
-			tx, err := bp.client.SendTransaction(from, to, amount)
-			if err != nil {
-				result.Error = err
-			} else {
-				result.TxHash = tx.Hash()
-			}
+	pending := make([]int, 0, len(results))
+	for i := range results {
+		if results[i].Error == nil {
+			pending = append(pending, i)
+		}
+	}
+	size := bp.batchSize
+	if size <= 0 {
+		size = len(pending)
+	}
+	sem := make(chan struct{}, bp.concurrent)
+	for start := 0; start < len(pending); start += size {
+		end := start + size
+		if end > len(pending) {
+			end = len(pending)
+		}
+
+		wg := &sync.WaitGroup{}
+		for _, i := range pending[start:end] {
+			wg.Add(1)
+			sem <- struct{}{} // Acquire semaphore
+
+			go func(result *BatchTransferResult) {
+				defer func() {
+					<-sem // Release semaphore
+					wg.Done()
+				}()
+
+				tx, err := bp.client.SendTransaction(ctx, from, result.To, result.Amount)
+				if err != nil {
+					result.Error = err
+				} else {
+					result.TxHash = tx.Hash()
+				}
+			}(&results[i])
+		}
+		wg.Wait()
+	}
+	return results
+}
 
-			mutex.Lock()
-			results = append(results, result)
-			mutex.Unlock()
-		}(to, amount)
+// SignedBatchTransfer signs transfers with signer and sends them with
+// consecutive nonces, in recipient order, which is also the order of the
+// results. Unlike BatchTransfer, nothing is left for the caller to sign.
+func (bp *BatchProcessor) SignedBatchTransfer(ctx context.Context, signer Signer, transfers map[common.Address]*big.Int) []BatchTransferResult {
+	instructions := nativeInstructions(transfers)
+	results := make([]BatchTransferResult, len(instructions))
+	for i, in := range instructions {
+		results[i] = BatchTransferResult{To: in.To, Amount: in.Amount}
+	}
+	chain, err := bp.client.Chain(ctx)
+	if err != nil {
+		for i := range results {
+			results[i].Error = err
+		}
+		return results
 	}
 
-	wg.Wait()
+	opts := NewTransactOpts(ctx, signer, new(big.Int).SetUint64(chain.ChainID))
+	for i, res := range bp.BatchTransferTokens(ctx, opts, instructions) {
+		results[i].TxHash = res.TxHash
+		results[i].Error = res.Error
+	}
 	return results
 }
 
+// nativeInstructions turns transfers into native currency instructions, in recipient order
+func nativeInstructions(transfers map[common.Address]*big.Int) []TransferInstruction {
+	instructions := make([]TransferInstruction, 0, len(transfers))
+	for to, amount := range transfers {
+		instructions = append(instructions, TransferInstruction{Standard: Native, To: to, Amount: amount})
+	}
+	sort.Slice(instructions, func(i, j int) bool {
+		return bytes.Compare(instructions[i].To[:], instructions[j].To[:]) < 0
+	})
+	return instructions
+}
+
 // ContractDeployer handles contract deployment operations
 type ContractDeployer struct {
-	client  *Web3Client
 	auth    *bind.TransactOpts
 	backend bind.ContractBackend
 }
 
-// NewContractDeployer creates a new contract deployer instance
-func NewContractDeployer(client *Web3Client, auth *bind.TransactOpts) *ContractDeployer {
+// NewContractDeployer creates a new contract deployer instance. Pass
+// Web3Client.ContractBackend to deploy through a Web3Client.
+func NewContractDeployer(backend bind.ContractBackend, auth *bind.TransactOpts) *ContractDeployer {
 	return &ContractDeployer{
-		client:  client,
 		auth:    auth,
-		backend: client.client,
+		backend: backend,
 	}
 }
 
-// DeployContract deploys a contract with the given bytecode and constructor args
-func (cd *ContractDeployer) DeployContract(bytecode []byte, args ...interface{}) (common.Address, *types.Transaction, error) {
-	parsed, err := bind.ParseBytecode(bytecode, args...)
-	if err != nil {
-		return common.Address{}, nil, fmt.Errorf("failed to parse bytecode: %v", err)
-	}
+// DeployContract deploys a contract with the given bytecode, packing the
+// constructor args with the ABI of the contract
+func (cd *ContractDeployer) DeployContract(ctx context.Context, contractAbi abi.ABI, bytecode []byte, args ...interface{}) (common.Address, *types.Transaction, error) {
+	auth := *cd.auth
+	auth.Context = ctx
 
-	address, tx, _, err := bind.DeployContract(cd.auth, parsed, cd.backend)
+	address, tx, _, err := bind.DeployContract(&auth, contractAbi, bytecode, cd.backend, args...)
 	if err != nil {
 		return common.Address{}, nil, fmt.Errorf("failed to deploy contract: %v", err)
 	}
@@ -110,12 +193,12 @@ func (cd *ContractDeployer) DeployContract(bytecode []byte, args ...interface{})
 
 // EventFilter handles event filtering and subscription
 type EventFilter struct {
-	client *Web3Client
+	client ethereum.LogFilterer
 	query  ethereum.FilterQuery
 }
 
 // NewEventFilter creates a new event filter instance
-func NewEventFilter(client *Web3Client) *EventFilter {
+func NewEventFilter(client ethereum.LogFilterer) *EventFilter {
 	return &EventFilter{
 		client: client,
 		query:  ethereum.FilterQuery{},
@@ -143,15 +226,44 @@ func (ef *EventFilter) SetBlockRange(from, to *big.Int) *EventFilter {
 
 // GetLogs retrieves the filtered logs
 func (ef *EventFilter) GetLogs(ctx context.Context) ([]types.Log, error) {
-	return ef.client.client.FilterLogs(ctx, ef.query)
+	return ef.client.FilterLogs(ctx, ef.query)
+}
+
+// rangeFilterer gets logs over block ranges too large for one request
+type rangeFilterer interface {
+	ethereum.BlockNumberReader
+	FilterLogsRange(ctx context.Context, query ethereum.FilterQuery, from, to, chunk uint64) ([]types.Log, error)
+}
+
+// logsRange gets the logs of query, in chunks of DefaultLogChunk blocks when
+// the client supports it
+func (ef *EventFilter) logsRange(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	client, ok := ef.client.(rangeFilterer)
+	if !ok || query.BlockHash != nil {
+		return ef.client.FilterLogs(ctx, query)
+	}
+	var from, to uint64
+	if query.FromBlock != nil {
+		from = query.FromBlock.Uint64()
+	}
+	if query.ToBlock != nil {
+		to = query.ToBlock.Uint64()
+	} else {
+		head, err := client.BlockNumber(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get head: %v", err)
+		}
+		to = head
+	}
+	return client.FilterLogsRange(ctx, query, from, to, DefaultLogChunk)
 }
 
 // SubscribeLogs creates a subscription for the filtered logs
 func (ef *EventFilter) SubscribeLogs(ctx context.Context) (chan types.Log, ethereum.Subscription, error) {
 	logCh := make(chan types.Log)
-	sub, err := ef.client.client.SubscribeFilterLogs(ctx, ef.query, logCh)
+	sub, err := ef.client.SubscribeFilterLogs(ctx, ef.query, logCh)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to subscribe to logs: %v", err)
+		return nil, nil, err
 	}
 	return logCh, sub, nil
 }
@@ -2,16 +2,47 @@ package pyweb3
 
 import (
 	"context"
+	"fmt"
 	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 // Web3Client wraps ethclient.Client to provide Ethereum interaction capabilities
 type Web3Client struct {
-	client *ethclient.Client
+	client    *ethclient.Client
+	transport Transport
+	resolver  NameResolver
+	ccip      CCIPConfig
+	// instrumentation counts the subscriptions, the package default if nil
+	instrumentation Instrumentation
+
+	mutex sync.Mutex
+	chain *ChainProfile
+}
+
+// chainDetectTimeout bounds the eth_chainId call made when connecting
+const chainDetectTimeout = 5 * time.Second
+
+// newWeb3Client wraps an ethclient and detects the chain through eth_chainId.
+// An unreachable node is not an error here, detection is tried again on
+// first use.
+func newWeb3Client(client *ethclient.Client, transport Transport) *Web3Client {
+	w := &Web3Client{client: client, transport: transport}
+	ctx, cancel := context.WithTimeout(context.Background(), chainDetectTimeout)
+	defer cancel()
+	w.detectChain(ctx)
+	return w
 }
 
 // NewWeb3Client creates a new Web3Client instance
@@ -20,26 +51,413 @@ func NewWeb3Client(url string) (*Web3Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Web3Client{client: client}, nil
+	return NewWeb3ClientFromEthclient(client), nil
 }
 
-// SendTransaction sends an Ethereum transaction
-func (w *Web3Client) SendTransaction(from, to common.Address, amount *big.Int) (*types.Transaction, error) {
-	nonce, err := w.client.PendingNonceAt(context.Background(), from)
+// NewWeb3ClientWithTransport creates a Web3Client sending its HTTP requests
+// through transport, such as a Provider or a RateLimiter
+func NewWeb3ClientWithTransport(url string, transport http.RoundTripper) (*Web3Client, error) {
+	rpcClient, err := rpc.DialOptions(context.Background(), url, rpc.WithHTTPClient(&http.Client{Transport: transport}))
 	if err != nil {
 		return nil, err
 	}
+	return newWeb3Client(ethclient.NewClient(rpcClient), rpcClient), nil
+}
+
+// NewWeb3ClientFromEthclient creates a Web3Client over an existing ethclient
+func NewWeb3ClientFromEthclient(client *ethclient.Client) *Web3Client {
+	return newWeb3Client(client, client.Client())
+}
+
+// NewWeb3ClientFromTransport creates a Web3Client sending its calls through
+// transport, such as a JSONRPCClient or an *rpc.Client
+func NewWeb3ClientFromTransport(transport Transport) (*Web3Client, error) {
+	if rpcClient, ok := transport.(*rpc.Client); ok {
+		return newWeb3Client(ethclient.NewClient(rpcClient), rpcClient), nil
+	}
 
-	gasPrice, err := w.client.SuggestGasPrice(context.Background())
+	// the URL is never dialed, every request is answered by the bridge
+	bridge := &http.Client{Transport: &transportBridge{transport: transport}}
+	rpcClient, err := rpc.DialOptions(context.Background(), "http://transport", rpc.WithHTTPClient(bridge))
 	if err != nil {
 		return nil, err
 	}
+	return newWeb3Client(ethclient.NewClient(rpcClient), transport), nil
+}
+
+// Transport returns the transport carrying the calls of the client
+func (w *Web3Client) Transport() Transport {
+	return w.transport
+}
+
+// Close closes the client connection
+func (w *Web3Client) Close() {
+	w.client.Close()
+	if _, ok := w.transport.(*rpc.Client); !ok {
+		w.transport.Close()
+	}
+}
+
+// BlockNumber returns the number of the latest block
+func (w *Web3Client) BlockNumber(ctx context.Context) (uint64, error) {
+	return w.client.BlockNumber(ctx)
+}
 
-	tx := types.NewTransaction(nonce, to, amount, 21000, gasPrice, nil)
-	return tx, nil
+// BlockByNumber returns a block, the latest one if number is nil
+func (w *Web3Client) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return w.client.BlockByNumber(ctx, number)
+}
+
+// HeaderByNumber returns a block header, the latest one if number is nil
+func (w *Web3Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return w.client.HeaderByNumber(ctx, number)
+}
+
+// BalanceAt returns the balance of an address at a block, the latest one if block is nil
+func (w *Web3Client) BalanceAt(ctx context.Context, address common.Address, block *big.Int) (*big.Int, error) {
+	return w.client.BalanceAt(ctx, address, block)
+}
+
+// PendingBalanceAt returns the balance of an address at the pending block
+func (w *Web3Client) PendingBalanceAt(ctx context.Context, address common.Address) (*big.Int, error) {
+	return w.client.PendingBalanceAt(ctx, address)
+}
+
+// NonceAt returns the number of transactions sent by an address up to a block,
+// the latest one if block is nil
+func (w *Web3Client) NonceAt(ctx context.Context, address common.Address, block *big.Int) (uint64, error) {
+	return w.client.NonceAt(ctx, address, block)
+}
+
+// PendingNonceAt returns the next nonce of an address, pending transactions included
+func (w *Web3Client) PendingNonceAt(ctx context.Context, address common.Address) (uint64, error) {
+	return w.client.PendingNonceAt(ctx, address)
+}
+
+// SuggestGasPrice returns the legacy gas price suggested by the node
+func (w *Web3Client) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return w.client.SuggestGasPrice(ctx)
+}
+
+// SuggestGasTipCap returns the priority fee suggested by the node
+func (w *Web3Client) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return w.client.SuggestGasTipCap(ctx)
+}
+
+// PendingCodeAt returns the code of a contract at the pending block
+func (w *Web3Client) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return w.client.PendingCodeAt(ctx, account)
+}
+
+// PendingCallContract executes a call at the pending block, without
+// following offchain lookups
+func (w *Web3Client) PendingCallContract(ctx context.Context, msg ethereum.CallMsg) ([]byte, error) {
+	return w.client.PendingCallContract(ctx, msg)
+}
+
+// EstimateGas estimates the gas needed for a transaction
+func (w *Web3Client) EstimateGas(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	return w.client.EstimateGas(ctx, msg)
+}
+
+// SendTransaction builds a transfer priced for the connected chain: EIP-1559
+// fees where supported, and estimated gas where transfers cost more than 21000
+func (w *Web3Client) SendTransaction(ctx context.Context, from, to common.Address, amount *big.Int) (*types.Transaction, error) {
+	chain, err := w.Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := w.client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+
+	gas := uint64(21000)
+	if chain.Quirks.EstimateTransfers {
+		gas, err = w.client.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Value: amount})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !chain.EIP1559 {
+		gasPrice, err := w.client.SuggestGasPrice(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewTransaction(nonce, to, amount, gas, gasPrice, nil), nil
+	}
+
+	tipCap, feeCap, err := NewGasEstimator(w, 0).SuggestFees(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTx(&types.DynamicFeeTx{
+		ChainID:   new(big.Int).SetUint64(chain.ChainID),
+		Nonce:     nonce,
+		GasTipCap: tipCap,
+		GasFeeCap: feeCap,
+		Gas:       gas,
+		To:        &to,
+		Value:     amount,
+	}), nil
 }
 
 // SendRawTransaction sends a signed transaction
-func (w *Web3Client) SendRawTransaction(tx *types.Transaction) error {
-	return w.client.SendTransaction(context.Background(), tx)
+func (w *Web3Client) SendRawTransaction(ctx context.Context, tx *types.Transaction) error {
+	return w.client.SendTransaction(ctx, tx)
+}
+
+// SignAndSend signs tx with signer for the connected chain and sends it,
+// once the signed transaction is known to come from the signer's account
+func (w *Web3Client) SignAndSend(ctx context.Context, signer Signer, tx *types.Transaction) (*types.Transaction, error) {
+	chain, err := w.Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chainID := new(big.Int).SetUint64(chain.ChainID)
+	signed, err := signer.SignTx(ctx, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignedTx(tx, signed, chainID, signer.Address()); err != nil {
+		return nil, err
+	}
+	if err := w.SendRawTransaction(ctx, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// TransactionByHash retrieves a transaction by its hash, failing with
+// ethereum.NotFound for unknown transactions
+func (w *Web3Client) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	return w.client.TransactionByHash(ctx, txHash)
+}
+
+// TransactionReceipt returns the receipt of a mined transaction, failing with
+// ethereum.NotFound while it is not mined
+func (w *Web3Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return w.client.TransactionReceipt(ctx, txHash)
+}
+
+// WaitForTransaction polls until a transaction is mined and returns its
+// receipt. Use a context with a deadline to bound the wait.
+func (w *Web3Client) WaitForTransaction(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	chain, err := w.Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ticker := time.NewTicker(pollInterval(chain.BlockTime))
+	defer ticker.Stop()
+
+	for {
+		receipt, err := w.client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			return receipt, nil
+		}
+		if err != ethereum.NotFound {
+			return nil, fmt.Errorf("failed to get transaction receipt: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("transaction %s not mined: %v", txHash.Hex(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// FilterLogs retrieves the logs matching a query
+func (w *Web3Client) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	return w.client.FilterLogs(ctx, query)
+}
+
+// DefaultLogChunk is the number of blocks asked in one eth_getLogs request
+// when a range is fetched in chunks
+const DefaultLogChunk = 2000
+
+// rangeTooLargeMessages are the ways nodes refuse an eth_getLogs range
+var rangeTooLargeMessages = []string{
+	"query returned more than",
+	"block range",
+	"range is too large",
+	"range too large",
+	"response size exceeded",
+	"too many logs",
+	"limit exceeded",
+}
+
+// FilterLogsRange retrieves the logs matching a query from block from to
+// block to in chunks of at most chunk blocks. A chunk the node refuses as too
+// large is split in halves until it fits.
+func (w *Web3Client) FilterLogsRange(ctx context.Context, query ethereum.FilterQuery, from, to, chunk uint64) ([]types.Log, error) {
+	if chunk == 0 {
+		chunk = 1
+	}
+	var logs []types.Log
+	for start := from; start <= to; start += chunk {
+		end := start + chunk - 1
+		if end > to || end < start {
+			end = to
+		}
+		found, err := w.filterLogsSplit(ctx, query, start, end)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, found...)
+		if end == to {
+			break
+		}
+	}
+	return logs, nil
+}
+
+func (w *Web3Client) filterLogsSplit(ctx context.Context, query ethereum.FilterQuery, from, to uint64) ([]types.Log, error) {
+	query.BlockHash = nil
+	query.FromBlock = new(big.Int).SetUint64(from)
+	query.ToBlock = new(big.Int).SetUint64(to)
+	logs, err := w.client.FilterLogs(ctx, query)
+	if err == nil || from == to || !isRangeTooLarge(err) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to get logs of blocks %d-%d: %v", from, to, err)
+		}
+		return logs, nil
+	}
+
+	middle := from + (to-from)/2
+	first, err := w.filterLogsSplit(ctx, query, from, middle)
+	if err != nil {
+		return nil, err
+	}
+	second, err := w.filterLogsSplit(ctx, query, middle+1, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(first, second...), nil
+}
+
+func isRangeTooLarge(err error) bool {
+	message := strings.ToLower(err.Error())
+	for _, tooLarge := range rangeTooLargeMessages {
+		if strings.Contains(message, tooLarge) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetInstrumentation sets the instrumentation counting the subscriptions of
+// the client, nil meaning the package default
+func (w *Web3Client) SetInstrumentation(instrumentation Instrumentation) {
+	w.instrumentation = instrumentation
+}
+
+// SubscribeFilterLogs streams the new logs matching a query
+func (w *Web3Client) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	sub, err := w.client.SubscribeFilterLogs(ctx, query, ch)
+	if err != nil {
+		return nil, err
+	}
+	return countSubscription(sub, instrumentationOr(w.instrumentation), "logs"), nil
+}
+
+// WatchEvents listens for an event of a contract from a block on
+func (w *Web3Client) WatchEvents(ctx context.Context, contractAddress common.Address, eventID common.Hash, fromBlock *big.Int) (chan types.Log, ethereum.Subscription, error) {
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{contractAddress},
+		Topics:    [][]common.Hash{{eventID}},
+		FromBlock: fromBlock,
+	}
+
+	logs := make(chan types.Log)
+	sub, err := w.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to subscribe to event logs: %v", err)
+	}
+	return logs, sub, nil
+}
+
+// NewFilter installs a log filter on the node and returns its id
+func (w *Web3Client) NewFilter(ctx context.Context, query ethereum.FilterQuery) (string, error) {
+	var id string
+	if err := w.transport.CallContext(ctx, &id, "eth_newFilter", filterArg(query)); err != nil {
+		return "", fmt.Errorf("failed to install filter: %v", err)
+	}
+	return id, nil
+}
+
+// FilterLogsByID returns all the logs matching a filter installed with NewFilter
+func (w *Web3Client) FilterLogsByID(ctx context.Context, id string) ([]types.Log, error) {
+	var logs []types.Log
+	if err := w.transport.CallContext(ctx, &logs, "eth_getFilterLogs", id); err != nil {
+		return nil, fmt.Errorf("failed to get filter logs: %v", err)
+	}
+	return logs, nil
+}
+
+// UninstallFilter removes a filter installed with NewFilter
+func (w *Web3Client) UninstallFilter(ctx context.Context, id string) (bool, error) {
+	var removed bool
+	if err := w.transport.CallContext(ctx, &removed, "eth_uninstallFilter", id); err != nil {
+		return false, fmt.Errorf("failed to uninstall filter: %v", err)
+	}
+	return removed, nil
+}
+
+// filterArg encodes a query the way eth_newFilter expects it
+func filterArg(query ethereum.FilterQuery) map[string]interface{} {
+	arg := map[string]interface{}{
+		"address": query.Addresses,
+		"topics":  query.Topics,
+	}
+	if query.BlockHash != nil {
+		arg["blockHash"] = *query.BlockHash
+		return arg
+	}
+	arg["fromBlock"] = blockArg(query.FromBlock, "earliest")
+	arg["toBlock"] = blockArg(query.ToBlock, "latest")
+	return arg
+}
+
+// blockArg encodes a block number, using name when it is nil
+func blockArg(number *big.Int, name string) string {
+	if number == nil {
+		return name
+	}
+	if number.Sign() < 0 {
+		return rpc.BlockNumber(number.Int64()).String()
+	}
+	return hexutil.EncodeBig(number)
+}
+
+// DecodeEvents decodes the logs emitted by a contract into maps of event
+// arguments, indexed arguments included. Logs of unknown events are skipped.
+func DecodeEvents(contractAbi *abi.ABI, logs []types.Log) ([]map[string]interface{}, error) {
+	var events []map[string]interface{}
+	for _, log := range logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		event, err := contractAbi.EventByID(log.Topics[0])
+		if err != nil {
+			continue
+		}
+
+		decoded := make(map[string]interface{})
+		if err := contractAbi.UnpackIntoMap(decoded, event.Name, log.Data); err != nil {
+			return nil, fmt.Errorf("failed to decode %s event: %v", event.Name, err)
+		}
+		var indexed abi.Arguments
+		for _, arg := range event.Inputs {
+			if arg.Indexed {
+				indexed = append(indexed, arg)
+			}
+		}
+		if err := abi.ParseTopicsIntoMap(decoded, indexed, log.Topics[1:]); err != nil {
+			return nil, fmt.Errorf("failed to decode %s topics: %v", event.Name, err)
+		}
+		events = append(events, decoded)
+	}
+	return events, nil
 }
@@ -13,13 +13,18 @@ import (
 
 // TransactionWatcher handles transaction monitoring
 type TransactionWatcher struct {
-	client  *Web3Client
+	client  WatcherBackend
 	timeout time.Duration
 	blocks  uint64
 }
 
-// NewTransactionWatcher creates a new transaction watcher
-func NewTransactionWatcher(client *Web3Client, timeout time.Duration, blocks uint64) *TransactionWatcher {
+// UseFinality makes a TransactionWatcher wait for the finality depth of the chain
+const UseFinality = ^uint64(0)
+
+// NewTransactionWatcher creates a new transaction watcher. Zero blocks
+// returns as soon as the transaction is included, UseFinality waits for the
+// finality depth of the chain.
+func NewTransactionWatcher(client WatcherBackend, timeout time.Duration, blocks uint64) *TransactionWatcher {
 	return &TransactionWatcher{
 		client:  client,
 		timeout: timeout,
@@ -27,12 +32,25 @@ func NewTransactionWatcher(client *Web3Client, timeout time.Duration, blocks uin
 	}
 }
 
-// WaitForConfirmations waits for a specific number of block confirmations
+// WaitForConfirmations waits for a specific number of block confirmations.
+// The receipt is polled at a pace following the chain block time.
 func (tw *TransactionWatcher) WaitForConfirmations(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
 	ctx, cancel := context.WithTimeout(ctx, tw.timeout)
 	defer cancel()
 
-	ticker := time.NewTicker(time.Second)
+	blocks, interval := tw.blocks, time.Second
+	chain, err := tw.client.Chain(ctx)
+	if err == nil {
+		interval = pollInterval(chain.BlockTime)
+	}
+	if blocks == UseFinality {
+		if err != nil {
+			return nil, err
+		}
+		blocks = chain.FinalityDepth
+	}
+
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -40,32 +58,44 @@ func (tw *TransactionWatcher) WaitForConfirmations(ctx context.Context, txHash c
 		case <-ctx.Done():
 			return nil, fmt.Errorf("timeout waiting for confirmations")
 		case <-ticker.C:
-			receipt, err := tw.client.client.TransactionReceipt(ctx, txHash)
+			receipt, err := tw.client.TransactionReceipt(ctx, txHash)
 			if err != nil {
 				continue
 			}
 
-			currentBlock, err := tw.client.client.BlockNumber(ctx)
+			currentBlock, err := tw.client.BlockNumber(ctx)
 			if err != nil {
 				continue
 			}
 
 			confirmations := currentBlock - receipt.BlockNumber.Uint64()
-			if confirmations >= tw.blocks {
+			if confirmations >= blocks {
 				return receipt, nil
 			}
 		}
 	}
 }
 
+// pollInterval polls a few times per block, within sane bounds
+func pollInterval(blockTime time.Duration) time.Duration {
+	interval := blockTime / 4
+	if interval < 250*time.Millisecond {
+		return 250 * time.Millisecond
+	}
+	if interval > 3*time.Second {
+		return 3 * time.Second
+	}
+	return interval
+}
+
 // GasEstimator handles gas estimation with safety margins
 type GasEstimator struct {
-	client *Web3Client
+	client GasBackend
 	margin uint64
 }
 
 // NewGasEstimator creates a new gas estimator
-func NewGasEstimator(client *Web3Client, marginPercent uint64) *GasEstimator {
+func NewGasEstimator(client GasBackend, marginPercent uint64) *GasEstimator {
 	return &GasEstimator{
 		client: client,
 		margin: marginPercent,
@@ -73,8 +103,8 @@ func NewGasEstimator(client *Web3Client, marginPercent uint64) *GasEstimator {
 }
 
 // EstimateGasWithMargin estimates gas with a safety margin
-func (ge *GasEstimator) EstimateGasWithMargin(msg ethereum.CallMsg) (uint64, error) {
-	gas, err := ge.client.client.EstimateGas(context.Background(), msg)
+func (ge *GasEstimator) EstimateGasWithMargin(ctx context.Context, msg ethereum.CallMsg) (uint64, error) {
+	gas, err := ge.client.EstimateGas(ctx, msg)
 	if err != nil {
 		return 0, fmt.Errorf("failed to estimate gas: %v", err)
 	}
@@ -85,7 +115,7 @@ func (ge *GasEstimator) EstimateGasWithMargin(msg ethereum.CallMsg) (uint64, err
 
 // GetOptimalGasPrice suggests an optimal gas price based on recent blocks
 func (ge *GasEstimator) GetOptimalGasPrice(ctx context.Context) (*big.Int, error) {
-	gasPrice, err := ge.client.client.SuggestGasPrice(ctx)
+	gasPrice, err := ge.client.SuggestGasPrice(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get gas price: %v", err)
 	}
@@ -95,3 +125,35 @@ func (ge *GasEstimator) GetOptimalGasPrice(ctx context.Context) (*big.Int, error
 
 	return new(big.Int).Add(gasPrice, margin), nil
 }
+
+// SuggestFees returns EIP-1559 tip and fee caps for the connected chain,
+// honouring its minimum tip, with the margin added to the fee cap
+func (ge *GasEstimator) SuggestFees(ctx context.Context) (*big.Int, *big.Int, error) {
+	chain, err := ge.client.Chain(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	head, err := ge.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get latest header: %v", err)
+	}
+	if !chain.EIP1559 || head.BaseFee == nil {
+		return nil, nil, fmt.Errorf("chain %d does not support EIP-1559", chain.ChainID)
+	}
+
+	tipCap := new(big.Int)
+	if !chain.Quirks.IgnoresPriorityFee {
+		if tipCap, err = ge.client.SuggestGasTipCap(ctx); err != nil {
+			return nil, nil, fmt.Errorf("failed to get priority fee: %v", err)
+		}
+	}
+	if min := chain.Quirks.MinPriorityFee; min != nil && tipCap.Cmp(min) < 0 {
+		tipCap = new(big.Int).Set(min)
+	}
+
+	// Twice the base fee absorbs six full blocks of base fee increases
+	feeCap := new(big.Int).Add(new(big.Int).Mul(head.BaseFee, big.NewInt(2)), tipCap)
+	margin := new(big.Int).Mul(feeCap, new(big.Int).SetUint64(ge.margin))
+	feeCap.Add(feeCap, margin.Div(margin, big.NewInt(100)))
+	return tipCap, feeCap, nil
+}
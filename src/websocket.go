@@ -1,23 +1,23 @@
-package main
+package pyweb3
 
 import (
 	"crypto/tls"
-	"errors"
 	"fmt"
-	"log"
 	"net/url"
+	"sync"
 	"time"
 
 	"golang.org/x/net/websocket"
 )
 
 const (
-	defaultHTTPSPort  = 443
-	globalTimeout     = 8 * time.Second
-	unitWaitingTime   = 400 * time.Millisecond
+	defaultHTTPSPort = 443
+	unitWaitingTime  = 400 * time.Millisecond
 )
 
-var cyclesTimeout = int(globalTimeout / unitWaitingTime)
+// DefaultHandshakeTimeout is how long a new connection waits for the host
+// to accept it
+const DefaultHandshakeTimeout = 8 * time.Second
 
 type WebSocketClientException struct {
 	Message string
@@ -32,16 +32,59 @@ func (e *WebSocketClientException) Error() string {
 }
 
 type WebSocketClient struct {
-	Conn            *websocket.Conn
-	PartialTxtMsgs  []string
-	PartialBinMsgs  [][]byte
+	Conn             *websocket.Conn
+	PartialTxtMsgs   []string
+	PartialBinMsgs   [][]byte
 	ReceivedMessages []string
+	mutex            sync.Mutex
+
+	config          *websocket.Config
+	endpoint        string
+	instrumentation Instrumentation
+	auth            AuthProvider
+	// handshakeTimeout is DefaultHandshakeTimeout when zero
+	handshakeTimeout time.Duration
+}
+
+// WebSocketConfig configures a WebSocketClient
+type WebSocketConfig struct {
+	// TLS verifies the host, one checking its name against the URL if nil
+	TLS *tls.Config
+	// Auth supplies the credentials, asked again on every reconnection. The
+	// userinfo of the URL is sent as basic auth if nil.
+	Auth AuthProvider
+	// HandshakeTimeout bounds the wait for the host to accept a connection,
+	// DefaultHandshakeTimeout when zero
+	HandshakeTimeout time.Duration
 }
 
 func NewWebSocketClient(wsURL, userAgent string) (*WebSocketClient, error) {
-	parsedURL, err := url.Parse(wsURL)
+	return NewWebSocketClientWithTLS(wsURL, userAgent, nil)
+}
+
+// NewWebSocketClientWithTLS connects with a custom TLS configuration, such
+// as one trusting a test certificate
+func NewWebSocketClientWithTLS(wsURL, userAgent string, tlsConfig *tls.Config) (*WebSocketClient, error) {
+	return NewWebSocketClientWithAuth(wsURL, userAgent, tlsConfig, nil)
+}
+
+// NewWebSocketClientWithAuth connects sending the credentials of auth, asked
+// again on every reconnection. Without auth, the userinfo of the URL is sent
+// as basic auth.
+func NewWebSocketClientWithAuth(wsURL, userAgent string, tlsConfig *tls.Config, auth AuthProvider) (*WebSocketClient, error) {
+	return NewWebSocketClientWithConfig(wsURL, userAgent, WebSocketConfig{TLS: tlsConfig, Auth: auth})
+}
+
+// NewWebSocketClientWithConfig connects with the settings of config
+func NewWebSocketClientWithConfig(wsURL, userAgent string, config WebSocketConfig) (*WebSocketClient, error) {
+	tlsConfig, auth := config.TLS, config.Auth
+	urlAuth, stripped, err := BasicAuthFromURL(wsURL)
 	if err != nil {
-		return nil, &WebSocketClientException{"Invalid URL", err}
+		return nil, &WebSocketClientException{"Invalid URL", errorOf(err)}
+	}
+	parsedURL, err := url.Parse(stripped)
+	if err != nil {
+		return nil, &WebSocketClientException{"Invalid URL", errorOf(err)}
 	}
 
 	if parsedURL.Scheme != "wss" {
@@ -54,45 +97,122 @@ func NewWebSocketClient(wsURL, userAgent string) (*WebSocketClient, error) {
 		port = fmt.Sprintf("%d", defaultHTTPSPort)
 	}
 
-	tlsConfig := &tls.Config{ServerName: host}
-	origin := "https://" + host
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: host}
+	}
 	wsEndpoint := parsedURL.Path
 	if parsedURL.RawQuery != "" {
 		wsEndpoint += "?" + parsedURL.RawQuery
 	}
 
-	log.Printf("Connecting to WebSocket Host=%s PathTarget=%s", host, wsEndpoint)
+	// The path and query are not logged, they often hold an API key
+	loggerOr(nil).Debug("Connecting to WebSocket", "endpoint", host+":"+port)
 
-	conn, err := websocket.DialConfig(&websocket.Config{
-		Location: &url.URL{Scheme: "wss", Host: host + ":" + port, Path: wsEndpoint},
-		Origin:   &url.URL{Scheme: "https", Host: host},
-		TlsConfig: tlsConfig,
-		Header: map[string][]string{
-			"User-Agent": {userAgent},
+	client := &WebSocketClient{
+		PartialTxtMsgs:   []string{},
+		PartialBinMsgs:   [][]byte{},
+		ReceivedMessages: []string{},
+		config: &websocket.Config{
+			Location:  &url.URL{Scheme: "wss", Host: host + ":" + port, Path: wsEndpoint},
+			Origin:    &url.URL{Scheme: "https", Host: host},
+			Version:   websocket.ProtocolVersionHybi13,
+			TlsConfig: tlsConfig,
+			Header: map[string][]string{
+				"User-Agent": {userAgent},
+			},
 		},
-	})
-	if err != nil {
-		return nil, &WebSocketClientException{"Error during WebSocket connection", err}
+		endpoint:         host + ":" + port,
+		auth:             auth,
+		handshakeTimeout: config.HandshakeTimeout,
+	}
+	if auth == nil && urlAuth != nil {
+		client.auth = urlAuth
+	}
+	if err := client.connect(); err != nil {
+		return nil, err
 	}
+	return client, nil
+}
 
-	client := &WebSocketClient{
-		Conn:            conn,
-		PartialTxtMsgs:  []string{},
-		PartialBinMsgs:  [][]byte{},
-		ReceivedMessages: []string{},
+// SetInstrumentation sets the instrumentation of the client, nil meaning the
+// package default. The first connection reports to the package default.
+func (client *WebSocketClient) SetInstrumentation(instrumentation Instrumentation) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.instrumentation = instrumentation
+}
+
+// connect dials the host and waits for the handshake
+func (client *WebSocketClient) connect() error {
+	config := *client.config
+	config.Header = client.config.Header.Clone()
+	if err := applyAuth(client.auth, config.Header); err != nil {
+		return &WebSocketClientException{"Error during WebSocket connection", err}
+	}
+	conn, err := websocket.DialConfig(&config)
+	if err != nil {
+		return &WebSocketClientException{"Error during WebSocket connection", err}
 	}
+	client.mutex.Lock()
+	client.Conn = conn
+	instrumentation := instrumentationOr(client.instrumentation)
+	client.mutex.Unlock()
 
+	go client.receive(conn, instrumentation)
 	if err := client.waitForHandshake(); err != nil {
-		return nil, err
+		conn.Close()
+		return err
 	}
+	return nil
+}
 
-	return client, nil
+// Reconnect closes the connection and opens a new one to the same host
+func (client *WebSocketClient) Reconnect() error {
+	client.mutex.Lock()
+	conn := client.Conn
+	instrumentation := instrumentationOr(client.instrumentation)
+	client.mutex.Unlock()
+	if conn != nil {
+		conn.Close()
+	}
+	loggerOr(nil).Debug("Reconnecting to WebSocket", "endpoint", client.endpoint)
+	instrumentation.Reconnect(client.endpoint)
+	return client.connect()
+}
+
+// receive stores the text messages from the host until the connection
+// closes, the connection counting as open meanwhile
+func (client *WebSocketClient) receive(conn *websocket.Conn, instrumentation Instrumentation) {
+	instrumentation.Connections(client.endpoint, 1)
+	defer instrumentation.Connections(client.endpoint, -1)
+	for {
+		var msg string
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			return
+		}
+		client.mutex.Lock()
+		client.ReceivedMessages = append(client.ReceivedMessages, msg)
+		client.mutex.Unlock()
+	}
 }
 
 func (client *WebSocketClient) waitForHandshake() error {
-	for cycle := 0; cycle < cyclesTimeout; cycle++ {
-		log.Printf("Waiting WebSocket handshake: %dth loop.", cycle+1)
-		time.Sleep(unitWaitingTime)
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	timeout := client.handshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	wait := unitWaitingTime
+	if timeout < wait {
+		wait = timeout
+	}
+	for cycle := 0; cycle < int(timeout/wait); cycle++ {
+		loggerOr(nil).Debug("Waiting for WebSocket handshake", "attempt", cycle+1)
+		client.mutex.Unlock()
+		time.Sleep(wait)
+		client.mutex.Lock()
 		if len(client.ReceivedMessages) > 0 {
 			for len(client.ReceivedMessages) > 0 {
 				msg := client.ReceivedMessages[len(client.ReceivedMessages)-1]
@@ -109,16 +229,3 @@ func (client *WebSocketClient) waitForHandshake() error {
 	}
 	return &WebSocketClientException{"WebSocket handshake timeout", nil}
 }
-
-func main() {
-	wsURL := "wss://example.com/socket"
-	userAgent := "GoWebSocketClient/1.0"
-
-	client, err := NewWebSocketClient(wsURL, userAgent)
-	if err != nil {
-		log.Fatalf("Failed to connect: %v", err)
-	}
-
-	defer client.Conn.Close()
-	log.Println("WebSocket connection established successfully.")
-}